@@ -0,0 +1,190 @@
+package goban
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Reasons a move or setup stone is refused
+var (
+	ErrOffBoard   = errors.New("point is off the board")
+	ErrOccupied   = errors.New("point is occupied")
+	ErrKo         = errors.New("move retakes the ko immediately")
+	ErrSuicide    = errors.New("move is suicide")
+	ErrSuperko    = errors.New("move repeats an earlier position")
+	ErrSetupAfter = errors.New("setup stones must be added before the first move")
+)
+
+// A move of a game; X and Y are -1 for a pass
+type Move struct {
+	X, Y   int
+	Player string
+}
+
+// Returns the pass of player
+func Pass(player string) Move {
+	return Move{-1, -1, player}
+}
+
+// Reports whether the move is a pass
+func (m Move) IsPass() bool {
+	return m.X < 0
+}
+
+// A position: the stones on the board, the color to play and the point a ko forbids retaking.
+// Boards are values; Apply returns the next position and leaves the board it is called on unchanged.
+type Board struct {
+	sizeX, sizeY int
+	points       [][]string
+	toPlay       string
+	koX, koY     int // Ko point, (-1, -1) if none
+	captured     int // Stones captured by the move that led to this position
+}
+
+// Creates an empty board of sizeX columns and sizeY rows with Black to play
+func NewBoard(sizeX, sizeY int) (*Board, error) {
+	if sizeX < 1 || sizeY < 1 || sizeX > MaxBoardSize || sizeY > MaxBoardSize {
+		return nil, fmt.Errorf("invalid board size %dx%d (must be between 1 and %d)", sizeX, sizeY, MaxBoardSize)
+	}
+	return &Board{sizeX: sizeX, sizeY: sizeY, points: MakeEmptyBoard(sizeX, sizeY), toPlay: Black, koX: -1, koY: -1}, nil
+}
+
+// Creates a board from rows of points (Empty, Black, White or Blocked) with toPlay to move and no ko.
+// The rows are copied; they must all have the same length.
+func BoardFromPoints(points [][]string, toPlay string) (*Board, error) {
+	if len(points) == 0 {
+		return nil, fmt.Errorf("the board has no rows")
+	}
+	board, err := NewBoard(len(points[0]), len(points))
+	if err != nil {
+		return nil, err
+	}
+	if toPlay != Black && toPlay != White {
+		return nil, fmt.Errorf("invalid color to play %q", toPlay)
+	}
+	for y, row := range points {
+		if len(row) != board.sizeX {
+			return nil, fmt.Errorf("row %d has %d points instead of %d", y+1, len(row), board.sizeX)
+		}
+		for x, point := range row {
+			if point != Empty && point != Black && point != White && point != Blocked {
+				return nil, fmt.Errorf("invalid point %q at %d, %d", point, x, y)
+			}
+		}
+	}
+	board.points = CopyBoard(points)
+	board.toPlay = toPlay
+	return board, nil
+}
+
+// Returns the number of columns and rows
+func (b *Board) Size() (sizeX, sizeY int) {
+	return b.sizeX, b.sizeY
+}
+
+// Returns the point at (x, y): Empty, Black, White or Blocked
+func (b *Board) At(x, y int) string {
+	return b.points[y][x]
+}
+
+// Returns a copy of the rows of points
+func (b *Board) Points() [][]string {
+	return CopyBoard(b.points)
+}
+
+// Returns the color to play
+func (b *Board) ToPlay() string {
+	return b.toPlay
+}
+
+// Returns the point the player to move may not retake, ok false if no ko is pending
+func (b *Board) Ko() (x, y int, ok bool) {
+	return b.koX, b.koY, b.koX >= 0
+}
+
+// Returns the number of stones captured by the move that led to this position
+func (b *Board) Captured() int {
+	return b.captured
+}
+
+// Returns the position as a string, equal for equal stones whatever the color to play
+func (b *Board) Key() string {
+	return BoardKey(b.points)
+}
+
+// Returns nil if the move may be played, or the reason it is illegal. A pass is always legal.
+// The move's player need not be the color to play, so that either side's moves can be tried.
+func (b *Board) Check(m Move) error {
+	if m.IsPass() {
+		return nil
+	}
+	if m.X >= b.sizeX || m.Y < 0 || m.Y >= b.sizeY {
+		return ErrOffBoard
+	}
+	if m.Player != Black && m.Player != White {
+		return fmt.Errorf("invalid player %q", m.Player)
+	}
+	if b.points[m.Y][m.X] != Empty {
+		return ErrOccupied
+	}
+	if m.X == b.koX && m.Y == b.koY {
+		return ErrKo
+	}
+	if !IsLegal(b.points, m.X, m.Y, m.Player, b.koX, b.koY, b.sizeX, b.sizeY) {
+		return ErrSuicide
+	}
+	return nil
+}
+
+// Returns the position after the move, with captured stones removed and the other color to play,
+// or the reason the move is illegal. A pass lifts any ko ban.
+func (b *Board) Apply(m Move) (*Board, error) {
+	if err := b.Check(m); err != nil {
+		return nil, err
+	}
+	if m.IsPass() {
+		player := m.Player
+		if player != Black && player != White {
+			player = b.toPlay
+		}
+		return &Board{sizeX: b.sizeX, sizeY: b.sizeY, points: b.points, toPlay: SwitchPlayer(player), koX: -1, koY: -1}, nil
+	}
+	next := &Board{sizeX: b.sizeX, sizeY: b.sizeY, points: CopyBoard(b.points), toPlay: SwitchPlayer(m.Player)}
+	stones := 0
+	for _, row := range b.points {
+		for _, point := range row {
+			if point == SwitchPlayer(m.Player) {
+				stones++
+			}
+		}
+	}
+	next.points[m.Y][m.X] = m.Player
+	next.koX, next.koY = CaptureStones(next.points, m.X, m.Y, m.Player, b.sizeX, b.sizeY)
+	for _, row := range next.points {
+		for _, point := range row {
+			if point == SwitchPlayer(m.Player) {
+				stones--
+			}
+		}
+	}
+	next.captured = stones
+	return next, nil
+}
+
+// Returns the legal moves of the color to play in row-major order, without the pass, which is always legal
+func (b *Board) LegalMoves() []Move {
+	var moves []Move
+	for y := 0; y < b.sizeY; y++ {
+		for x := 0; x < b.sizeX; x++ {
+			if move := (Move{x, y, b.toPlay}); b.Check(move) == nil {
+				moves = append(moves, move)
+			}
+		}
+	}
+	return moves
+}
+
+// Scores the position by area with every stone alive: stones plus empty regions bordered by one color only
+func (b *Board) Score() (black, white int) {
+	return TrompTaylorScore(b.points, b.sizeX, b.sizeY)
+}
@@ -0,0 +1,248 @@
+package goban
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Builds a board from rows such as "B.W.", with toPlay to move
+func parseBoard(t *testing.T, toPlay string, rows ...string) *Board {
+	t.Helper()
+	points := make([][]string, len(rows))
+	for y, row := range rows {
+		points[y] = strings.Split(row, "")
+	}
+	board, err := BoardFromPoints(points, toPlay)
+	if err != nil {
+		t.Fatalf("BoardFromPoints: %v", err)
+	}
+	return board
+}
+
+// Returns the rows of the board in the form parseBoard reads
+func formatBoard(b *Board) []string {
+	var rows []string
+	for _, row := range b.Points() {
+		rows = append(rows, strings.Join(row, ""))
+	}
+	return rows
+}
+
+func assertRows(t *testing.T, b *Board, want ...string) {
+	t.Helper()
+	if got := formatBoard(b); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("board:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestNewBoardRejectsInvalidSizes(t *testing.T) {
+	for _, size := range [][2]int{{0, 9}, {9, 0}, {MaxBoardSize + 1, 9}, {-1, -1}} {
+		if _, err := NewBoard(size[0], size[1]); err == nil {
+			t.Errorf("NewBoard(%d, %d) succeeded", size[0], size[1])
+		}
+	}
+	board, err := NewBoard(19, 13)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, y := board.Size(); x != 19 || y != 13 {
+		t.Errorf("Size() = %d, %d", x, y)
+	}
+	if board.ToPlay() != Black {
+		t.Errorf("ToPlay() = %q, want Black", board.ToPlay())
+	}
+}
+
+func TestBoardFromPointsValidates(t *testing.T) {
+	if _, err := BoardFromPoints([][]string{{".", "."}, {"."}}, Black); err == nil {
+		t.Error("ragged rows accepted")
+	}
+	if _, err := BoardFromPoints([][]string{{".", "X"}}, Black); err == nil {
+		t.Error("invalid point accepted")
+	}
+	if _, err := BoardFromPoints([][]string{{"."}}, Empty); err == nil {
+		t.Error("invalid color to play accepted")
+	}
+}
+
+func TestApplyLeavesBoardUnchanged(t *testing.T) {
+	board := parseBoard(t, Black, "...", "...", "...")
+	next, err := board.Apply(Move{1, 1, Black})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRows(t, board, "...", "...", "...")
+	assertRows(t, next, "...", ".B.", "...")
+	if next.ToPlay() != White {
+		t.Errorf("ToPlay() = %q after Black's move, want White", next.ToPlay())
+	}
+}
+
+func TestApplyCaptures(t *testing.T) {
+	tests := []struct {
+		name     string
+		rows     []string
+		move     Move
+		want     []string
+		captured int
+	}{
+		{
+			name:     "single stone",
+			rows:     []string{".B.", "BW.", ".B."},
+			move:     Move{2, 1, Black},
+			want:     []string{".B.", "B.B", ".B."},
+			captured: 1,
+		},
+		{
+			name:     "corner group",
+			rows:     []string{"WWB", "B..", "..."},
+			move:     Move{1, 1, Black},
+			want:     []string{"..B", "BB.", "..."},
+			captured: 2,
+		},
+		{
+			name:     "capture instead of suicide",
+			rows:     []string{".WB", "WB.", "B.."},
+			move:     Move{0, 0, Black},
+			want:     []string{"B.B", ".B.", "B.."},
+			captured: 2,
+		},
+		{
+			name:     "no capture while a liberty remains",
+			rows:     []string{"....", ".W..", "....", "...."},
+			move:     Move{1, 0, Black},
+			want:     []string{".B..", ".W..", "....", "...."},
+			captured: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, err := parseBoard(t, tt.move.Player, tt.rows...).Apply(tt.move)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertRows(t, next, tt.want...)
+			if next.Captured() != tt.captured {
+				t.Errorf("Captured() = %d, want %d", next.Captured(), tt.captured)
+			}
+		})
+	}
+}
+
+func TestApplyRefusesIllegalMoves(t *testing.T) {
+	board := parseBoard(t, Black, ".W.", "W#.", "...")
+	tests := []struct {
+		name string
+		move Move
+		want error
+	}{
+		{"off the board", Move{3, 0, Black}, ErrOffBoard},
+		{"below the board", Move{0, 3, Black}, ErrOffBoard},
+		{"occupied", Move{1, 0, Black}, ErrOccupied},
+		{"missing point", Move{1, 1, Black}, ErrOccupied},
+		{"suicide", Move{0, 0, Black}, ErrSuicide},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := board.Apply(tt.move); !errors.Is(err, tt.want) {
+				t.Errorf("Apply(%v) = %v, want %v", tt.move, err, tt.want)
+			}
+		})
+	}
+	if _, err := board.Apply(Move{0, 0, White}); err != nil {
+		t.Errorf("White filling its own eye refused: %v", err)
+	}
+}
+
+func TestKo(t *testing.T) {
+	board := parseBoard(t, Black,
+		".BW.",
+		"BW.W",
+		".BW.",
+		"....")
+	taken, err := board.Apply(Move{2, 1, Black})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, y, ok := taken.Ko(); !ok || x != 1 || y != 1 {
+		t.Fatalf("Ko() = %d, %d, %v, want 1, 1, true", x, y, ok)
+	}
+	if _, err := taken.Apply(Move{1, 1, White}); !errors.Is(err, ErrKo) {
+		t.Errorf("immediate retake: %v, want ErrKo", err)
+	}
+	afterThreat, err := taken.Apply(Move{0, 3, White})
+	if err != nil {
+		t.Fatal(err)
+	}
+	answered, err := afterThreat.Apply(Move{1, 3, Black})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := answered.Apply(Move{1, 1, White}); err != nil {
+		t.Errorf("retake after a ko threat refused: %v", err)
+	}
+}
+
+func TestPassLiftsKo(t *testing.T) {
+	board := parseBoard(t, Black,
+		".BW.",
+		"BW.W",
+		".BW.")
+	taken, err := board.Apply(Move{2, 1, Black})
+	if err != nil {
+		t.Fatal(err)
+	}
+	passed, err := taken.Apply(Pass(White))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := passed.Ko(); ok {
+		t.Error("ko still pending after a pass")
+	}
+	if passed.ToPlay() != Black {
+		t.Errorf("ToPlay() = %q after White's pass, want Black", passed.ToPlay())
+	}
+	if passed.Key() != taken.Key() {
+		t.Error("a pass changed the stones")
+	}
+}
+
+func TestLegalMoves(t *testing.T) {
+	empty, err := NewBoard(9, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moves := empty.LegalMoves(); len(moves) != 81 {
+		t.Errorf("%d legal moves on an empty 9x9 board, want 81", len(moves))
+	}
+
+	board := parseBoard(t, Black,
+		".W.",
+		"W#.",
+		"...")
+	var got []string
+	for _, move := range board.LegalMoves() {
+		if move.Player != Black {
+			t.Errorf("move for %q, want Black", move.Player)
+		}
+		got = append(got, SGFPoint(move.X, move.Y))
+	}
+	// aa is suicide, ba, ab are occupied and bb is missing
+	if want := "ca cb ac bc cc"; strings.Join(got, " ") != want {
+		t.Errorf("LegalMoves() = %s, want %s", strings.Join(got, " "), want)
+	}
+}
+
+func TestBoardScore(t *testing.T) {
+	board := parseBoard(t, White,
+		".B.W.",
+		"BB.WW",
+		".B.W.",
+		".B.W#")
+	black, white := board.Score()
+	// Black: 5 stones and 3 points on the left; White: 5 stones and 2 points on the right, one missing; the middle is neutral
+	if black != 8 || white != 7 {
+		t.Errorf("Score() = %d, %d, want 8, 7", black, white)
+	}
+}
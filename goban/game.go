@@ -0,0 +1,160 @@
+package goban
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A game played without the GUI: setup stones followed by a line of moves, checked by the same rules.
+// The zero value is not usable; create games with NewGame.
+type Game struct {
+	SizeX, SizeY int
+	Komi         int  // Points added to White's score
+	Superko      bool // Forbid moves repeating any earlier position, not only the immediate ko
+
+	moves     []Move
+	positions []*Board // Board before the first move, then after each move
+}
+
+// Creates a game on an empty board of sizeX columns and sizeY rows with Black to play
+func NewGame(sizeX, sizeY, komi int) (*Game, error) {
+	board, err := NewBoard(sizeX, sizeY)
+	if err != nil {
+		return nil, err
+	}
+	return &Game{SizeX: sizeX, SizeY: sizeY, Komi: komi, positions: []*Board{board}}, nil
+}
+
+// Returns a copy of the current position
+func (g *Game) Board() [][]string {
+	return g.Position().Points()
+}
+
+// Returns the current position
+func (g *Game) Position() *Board {
+	return g.positions[len(g.positions)-1]
+}
+
+// Returns the moves played so far
+func (g *Game) Moves() []Move {
+	return append([]Move(nil), g.moves...)
+}
+
+// Returns the color to play: Black first, then alternating
+func (g *Game) ToPlay() string {
+	if len(g.moves) == 0 {
+		return Black
+	}
+	return SwitchPlayer(g.moves[len(g.moves)-1].Player)
+}
+
+// Returns nil if player may play at (x, y) in the current position, or the reason the move is illegal
+func (g *Game) CheckMove(x, y int, player string) error {
+	_, err := g.next(Move{x, y, player})
+	return err
+}
+
+// Returns the position after the move, checked against the rules and, if enabled, superko
+func (g *Game) next(m Move) (*Board, error) {
+	if m.X < 0 || m.Y < 0 {
+		return nil, ErrOffBoard
+	}
+	board, err := g.Position().Apply(m)
+	if err != nil {
+		return nil, err
+	}
+	if g.Superko {
+		key := board.Key()
+		for _, position := range g.positions {
+			if position.Key() == key {
+				return nil, ErrSuperko
+			}
+		}
+	}
+	return board, nil
+}
+
+// Plays a stone of the color to play at (x, y), capturing as needed, or returns why it is illegal
+func (g *Game) PlayMove(x, y int) error {
+	move := Move{x, y, g.ToPlay()}
+	board, err := g.next(move)
+	if err != nil {
+		return err
+	}
+	g.moves = append(g.moves, move)
+	g.positions = append(g.positions, board)
+	return nil
+}
+
+// Passes for the color to play, which lifts any ko ban
+func (g *Game) Pass() {
+	move := Pass(g.ToPlay())
+	board, _ := g.Position().Apply(move)
+	g.moves = append(g.moves, move)
+	g.positions = append(g.positions, board)
+}
+
+// Puts a stone of color, or Empty to clear the point, on the starting position
+func (g *Game) AddSetupStone(x, y int, color string) error {
+	if len(g.moves) > 0 {
+		return ErrSetupAfter
+	}
+	if x < 0 || x >= g.SizeX || y < 0 || y >= g.SizeY {
+		return ErrOffBoard
+	}
+	if color != Black && color != White && color != Empty {
+		return fmt.Errorf("invalid setup color %q", color)
+	}
+	g.positions[0].points[y][x] = color
+	return nil
+}
+
+// Scores the current position by area as the GUI's scoring mode does with every stone alive:
+// stones plus empty regions bordered by one color only. Komi is included in White's score.
+func (g *Game) Score() (black, white int) {
+	black, white = g.Position().Score()
+	return black, white + g.Komi
+}
+
+// Formats the game as an SGF file: the board size, komi and setup stones in the root node, then one node per move
+func (g *Game) ExportSGF() string {
+	var sb strings.Builder
+	g.WriteSGF(&sb)
+	return sb.String()
+}
+
+// Writes the game as an SGF file to w, as ExportSGF formats it, without building it in memory first
+func (g *Game) WriteSGF(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	out.WriteString("(;FF[4]GM[1]CA[UTF-8]")
+	if g.SizeX == g.SizeY {
+		fmt.Fprintf(out, "SZ[%d]", g.SizeX)
+	} else {
+		fmt.Fprintf(out, "SZ[%d:%d]", g.SizeX, g.SizeY)
+	}
+	fmt.Fprintf(out, "KM[%d]", g.Komi)
+	for _, color := range []string{Black, White} {
+		points := ""
+		for y, row := range g.positions[0].points {
+			for x, stone := range row {
+				if stone == color {
+					points += "[" + SGFPoint(x, y) + "]"
+				}
+			}
+		}
+		if points != "" {
+			out.WriteString("A" + color + points)
+		}
+	}
+	for _, move := range g.moves {
+		point := ""
+		if move.X >= 0 {
+			point = SGFPoint(move.X, move.Y)
+		}
+		fmt.Fprintf(out, ";%s[%s]", move.Player, point)
+	}
+	out.WriteString(")")
+	return out.Flush()
+}
@@ -0,0 +1,151 @@
+package goban
+
+import (
+	"errors"
+	"testing"
+)
+
+func playMoves(t *testing.T, g *Game, points ...string) {
+	t.Helper()
+	for _, point := range points {
+		if point == "" {
+			g.Pass()
+			continue
+		}
+		xy := ParseSGFPoint(point)
+		if err := g.PlayMove(xy[0], xy[1]); err != nil {
+			t.Fatalf("move %d at %s: %v", len(g.Moves())+1, point, err)
+		}
+	}
+}
+
+func TestGameAlternatesColors(t *testing.T) {
+	g, err := NewGame(9, 9, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	playMoves(t, g, "cc", "gg", "")
+	moves := g.Moves()
+	if len(moves) != 3 || moves[0].Player != Black || moves[1].Player != White || !moves[2].IsPass() || moves[2].Player != Black {
+		t.Errorf("Moves() = %v", moves)
+	}
+	if g.ToPlay() != White {
+		t.Errorf("ToPlay() = %q, want White", g.ToPlay())
+	}
+	if g.Position().ToPlay() != White {
+		t.Errorf("Position().ToPlay() = %q, want White", g.Position().ToPlay())
+	}
+}
+
+func TestGameRefusesKoRetake(t *testing.T) {
+	g, err := NewGame(5, 5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// White takes the ko at bb, so Black may not retake at cb until a move elsewhere
+	playMoves(t, g, "ba", "ca", "ab", "db", "bc", "cc", "cb", "bb")
+	if err := g.PlayMove(2, 1); !errors.Is(err, ErrKo) {
+		t.Fatalf("immediate retake: %v, want ErrKo", err)
+	}
+	playMoves(t, g, "ee", "ed", "cb")
+}
+
+func TestGameSuperko(t *testing.T) {
+	type stone struct {
+		point, color string
+	}
+	tests := []struct {
+		name         string
+		sizeX, sizeY int
+		setup        []stone
+		moves        []string // Played before the repeating move, "" for a pass
+		repeat       string
+	}{
+		{
+			// Retaking the ko after both players pass repeats the starting position with Black to play again
+			name: "situational repetition", sizeX: 4, sizeY: 3,
+			setup: []stone{{"ba", Black}, {"ab", Black}, {"bc", Black}, {"ca", White}, {"db", White}, {"cc", White}, {"bb", White}},
+			moves: []string{"cb", "", ""}, repeat: "bb",
+		},
+		{
+			// White captures two and Black takes back one, repeating the position after White's bb
+			// with White to play rather than Black, which positional superko forbids all the same
+			name: "positional repetition", sizeX: 3, sizeY: 3,
+			moves: []string{"bc", "cb", "ab", "bb", "cc", "ac"}, repeat: "bc",
+		},
+	}
+	for _, tt := range tests {
+		for _, superko := range []bool{false, true} {
+			g, err := NewGame(tt.sizeX, tt.sizeY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g.Superko = superko
+			for _, s := range tt.setup {
+				xy := ParseSGFPoint(s.point)
+				if err := g.AddSetupStone(xy[0], xy[1], s.color); err != nil {
+					t.Fatal(err)
+				}
+			}
+			playMoves(t, g, tt.moves...)
+			xy := ParseSGFPoint(tt.repeat)
+			err = g.PlayMove(xy[0], xy[1])
+			if superko && !errors.Is(err, ErrSuperko) {
+				t.Errorf("%s: repeating move with superko: %v, want ErrSuperko", tt.name, err)
+			}
+			if !superko && err != nil {
+				t.Errorf("%s: repeating move without superko: %v", tt.name, err)
+			}
+		}
+	}
+}
+
+func TestAddSetupStone(t *testing.T) {
+	g, err := NewGame(5, 5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddSetupStone(5, 0, Black); !errors.Is(err, ErrOffBoard) {
+		t.Errorf("off the board: %v", err)
+	}
+	if err := g.AddSetupStone(0, 0, Blocked); err == nil {
+		t.Error("invalid setup color accepted")
+	}
+	if err := g.AddSetupStone(2, 2, Black); err != nil {
+		t.Fatal(err)
+	}
+	if g.Board()[2][2] != Black {
+		t.Error("setup stone missing from the board")
+	}
+	playMoves(t, g, "aa")
+	if err := g.AddSetupStone(1, 1, White); !errors.Is(err, ErrSetupAfter) {
+		t.Errorf("setup after a move: %v, want ErrSetupAfter", err)
+	}
+}
+
+func TestGameScoreIncludesKomi(t *testing.T) {
+	g, err := NewGame(3, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	playMoves(t, g, "bb")
+	black, white := g.Score()
+	if black != 9 || white != 2 {
+		t.Errorf("Score() = %d, %d, want 9, 2", black, white)
+	}
+}
+
+func TestExportSGF(t *testing.T) {
+	g, err := NewGame(9, 7, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddSetupStone(2, 2, Black); err != nil {
+		t.Fatal(err)
+	}
+	playMoves(t, g, "dd", "")
+	want := "(;FF[4]GM[1]CA[UTF-8]SZ[9:7]KM[6]AB[cc];B[dd];W[])"
+	if got := g.ExportSGF(); got != want {
+		t.Errorf("ExportSGF() = %s, want %s", got, want)
+	}
+}
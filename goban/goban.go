@@ -0,0 +1,468 @@
+// Package goban holds the rules of the connected groups goban without any user interface:
+// boards, liberties, captures, ko, territory and SGF coordinates. The GUI plays by these same functions.
+// Board and Move are the value-level API: Apply returns the next position and LegalMoves lists the options.
+package goban
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	Empty           = "."
+	Black           = "B"
+	White           = "W"
+	Blocked         = "#" // Intersection missing from an irregular board: it takes no stones and is no liberty
+	MaxSGFBoardSize = 52  // Board size reachable with the SGF coordinate letters a-z and A-Z
+	MaxBoardSize    = 128 // Largest board playable locally, using extended coordinates beyond MaxSGFBoardSize
+)
+
+// Switches the current player.
+// Returns "W" if the current player is "B", and vice versa.
+func SwitchPlayer(player string) string {
+	if player == Black {
+		return White
+	}
+	return Black
+}
+
+// Returns a board of sizeX columns and sizeY rows with every point empty
+func MakeEmptyBoard(sizeX, sizeY int) [][]string {
+	board := make([][]string, sizeY)
+	for i := range board {
+		board[i] = make([]string, sizeX)
+		for j := range board[i] {
+			board[i][j] = Empty
+		}
+	}
+	return board
+}
+
+// Returns a deep copy of the board
+func CopyBoard(board [][]string) [][]string {
+	boardCopy := make([][]string, len(board))
+	for i := range board {
+		boardCopy[i] = make([]string, len(board[i]))
+		copy(boardCopy[i], board[i])
+	}
+	return boardCopy
+}
+
+// Encodes a board state as a string for comparing positions
+func BoardKey(board [][]string) string {
+	var sb strings.Builder
+	for _, row := range board {
+		for _, point := range row {
+			sb.WriteString(point)
+		}
+	}
+	return sb.String()
+}
+
+// Determines if the stone at (x, y) has any liberties.
+// Utilizes depth-first search to check for empty adjacent positions.
+func HasLiberty(board [][]string, x, y int, player string, sizeX, sizeY int) bool {
+	visited := make(map[[2]int]bool) // Tracks visited positions to prevent infinite loops
+	return dfs(board, x, y, player, visited, sizeX, sizeY)
+}
+
+// Recursive DFS to check for liberties
+func dfs(board [][]string, x, y int, player string, visited map[[2]int]bool, sizeX, sizeY int) bool {
+	if x < 0 || x >= sizeX || y < 0 || y >= sizeY {
+		return false // Out of bounds
+	}
+
+	if visited[[2]int{x, y}] {
+		return false // Already visited
+	}
+
+	if board[y][x] == Empty {
+		return true // Found a liberty
+	}
+
+	if board[y][x] != player {
+		return false // Encountered opponent's stone
+	}
+
+	visited[[2]int{x, y}] = true // Mark the current stone as visited
+
+	// Explore all four adjacent directions
+	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+	for _, d := range dirs {
+		if dfs(board, x+d[0], y+d[1], player, visited, sizeX, sizeY) {
+			return true // Found a liberty in adjacent stones
+		}
+	}
+	return false // No liberties found in this group
+}
+
+// Removes the opponent groups left without liberties by the stone just placed at (x, y), then the
+// player's own group if it has none left. Returns the ko point the opponent may not retake, or (-1, -1).
+func CaptureStones(board [][]string, x, y int, player string, sizeX, sizeY int) (int, int) {
+	opponent := SwitchPlayer(player)
+
+	// Check adjacent opponent stones for capture
+	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+	capturedGroupsSizes := []int{}
+	capturedGroupsCoords := [][2]int{}
+
+	for _, d := range dirs {
+		nx, ny := x+d[0], y+d[1]
+		if nx < 0 || nx >= sizeX || ny < 0 || ny >= sizeY {
+			continue
+		}
+		if board[ny][nx] == opponent && !HasLiberty(board, nx, ny, opponent, sizeX, sizeY) {
+			// Get size of captured group
+			groupSize := GroupSize(board, nx, ny, opponent, sizeX, sizeY)
+			capturedGroupsSizes = append(capturedGroupsSizes, groupSize)
+			capturedGroupsCoords = append(capturedGroupsCoords, [2]int{nx, ny})
+
+			// Capture group
+			RemoveGroup(board, nx, ny, opponent, sizeX, sizeY)
+		}
+	}
+
+	// Check for suicide
+	if !HasLiberty(board, x, y, player, sizeX, sizeY) {
+		// Remove player's own stone
+		RemoveGroup(board, x, y, player, sizeX, sizeY)
+	}
+
+	// Implement ko logic
+	koX := -1
+	koY := -1
+	if len(capturedGroupsSizes) == 1 { // 1 group was captured, might be ko
+		capturingGroupSize := GroupSize(board, x, y, player, sizeX, sizeY)
+		capturedGroupSize := capturedGroupsSizes[0]
+		if capturedGroupSize == 1 && capturingGroupSize == 1 {
+			// Set ko point
+			koX = capturedGroupsCoords[0][0]
+			koY = capturedGroupsCoords[0][1]
+		}
+	}
+	return koX, koY
+}
+
+// Counts the stones of the group at (x, y)
+func GroupSize(board [][]string, x, y int, player string, sizeX, sizeY int) int {
+	visited := make(map[[2]int]bool)
+	groupDFS(board, x, y, player, visited, sizeX, sizeY)
+	return len(visited)
+}
+
+func groupDFS(board [][]string, x, y int, player string, visited map[[2]int]bool, sizeX, sizeY int) {
+	if x < 0 || x >= sizeX || y < 0 || y >= sizeY {
+		return
+	}
+
+	if visited[[2]int{x, y}] {
+		return
+	}
+
+	if board[y][x] != player {
+		return
+	}
+
+	visited[[2]int{x, y}] = true
+
+	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+	for _, d := range dirs {
+		groupDFS(board, x+d[0], y+d[1], player, visited, sizeX, sizeY)
+	}
+}
+
+// Removes the group at (x, y) from the board and returns the number of stones removed
+func RemoveGroup(board [][]string, x, y int, player string, sizeX, sizeY int) int {
+	visited := make(map[[2]int]bool)
+	removeDFS(board, x, y, player, visited, sizeX, sizeY)
+	return len(visited)
+}
+
+func removeDFS(board [][]string, x, y int, player string, visited map[[2]int]bool, sizeX, sizeY int) {
+	if x < 0 || x >= sizeX || y < 0 || y >= sizeY {
+		return
+	}
+
+	if visited[[2]int{x, y}] {
+		return
+	}
+
+	if board[y][x] != player {
+		return
+	}
+
+	visited[[2]int{x, y}] = true
+
+	board[y][x] = Empty
+
+	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+	for _, d := range dirs {
+		removeDFS(board, x+d[0], y+d[1], player, visited, sizeX, sizeY)
+	}
+}
+
+// Returns one stone of each opponent group next to (x, y) left without liberties
+func CapturedStones(board [][]string, x, y int, opponent string, sizeX, sizeY int) [][2]int {
+	captured := make([][2]int, 0)
+	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+	for _, d := range dirs {
+		nx, ny := x+d[0], y+d[1]
+		if nx < 0 || nx >= sizeX || ny < 0 || ny >= sizeY {
+			continue
+		}
+		if board[ny][nx] == opponent && !HasLiberty(board, nx, ny, opponent, sizeX, sizeY) {
+			captured = append(captured, [2]int{nx, ny})
+		}
+	}
+	return captured
+}
+
+// Returns the stones and liberties of the group at (x, y)
+func GroupLiberties(board [][]string, x, y int, sizeX, sizeY int) ([][2]int, [][2]int) {
+	player := board[y][x]
+	visited := make(map[[2]int]bool)
+	groupDFS(board, x, y, player, visited, sizeX, sizeY)
+	stones := make([][2]int, 0, len(visited))
+	liberties := [][2]int{}
+	seen := make(map[[2]int]bool)
+	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+	for stone := range visited {
+		stones = append(stones, stone)
+		for _, d := range dirs {
+			nx, ny := stone[0]+d[0], stone[1]+d[1]
+			if nx >= 0 && nx < sizeX && ny >= 0 && ny < sizeY && board[ny][nx] == Empty && !seen[[2]int{nx, ny}] {
+				seen[[2]int{nx, ny}] = true
+				liberties = append(liberties, [2]int{nx, ny})
+			}
+		}
+	}
+	return stones, liberties
+}
+
+// Places a stone and removes the opponent groups it captures, ignoring ko.
+// Returns false, leaving the board unchanged, if the point is occupied or the move is suicide.
+func PlaceStone(board [][]string, x, y int, player string, sizeX, sizeY int) bool {
+	if board[y][x] != Empty {
+		return false
+	}
+	board[y][x] = player
+	opponent := SwitchPlayer(player)
+	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+	for _, d := range dirs {
+		nx, ny := x+d[0], y+d[1]
+		if nx >= 0 && nx < sizeX && ny >= 0 && ny < sizeY && board[ny][nx] == opponent && !HasLiberty(board, nx, ny, opponent, sizeX, sizeY) {
+			RemoveGroup(board, nx, ny, opponent, sizeX, sizeY)
+		}
+	}
+	if !HasLiberty(board, x, y, player, sizeX, sizeY) {
+		board[y][x] = Empty
+		return false
+	}
+	return true
+}
+
+// Reports whether player may play at (x, y): the point is empty, is not the ko point (koX, koY),
+// and the stone captures or keeps a liberty. Positional superko is checked separately by callers.
+func IsLegal(board [][]string, x, y int, player string, koX, koY, sizeX, sizeY int) bool {
+	if x < 0 || x >= sizeX || y < 0 || y >= sizeY || (x == koX && y == koY) || board[y][x] != Empty {
+		return false
+	}
+	boardCopy := CopyBoard(board)
+	boardCopy[y][x] = player
+	if len(CapturedStones(boardCopy, x, y, SwitchPlayer(player), sizeX, sizeY)) > 0 {
+		return true
+	}
+	return HasLiberty(boardCopy, x, y, player, sizeX, sizeY)
+}
+
+// Returns a territory map with the stones of the board as their own owners and empty points as "?"
+func NewTerritoryMap(board [][]string, sizeX, sizeY int) [][]string {
+	territoryMap := make([][]string, sizeY)
+	for y := 0; y < sizeY; y++ {
+		territoryMap[y] = make([]string, sizeX)
+		for x := 0; x < sizeX; x++ {
+			stone := board[y][x]
+			if stone == Black || stone == White {
+				territoryMap[y][x] = stone
+			} else {
+				territoryMap[y][x] = "?"
+			}
+		}
+	}
+	return territoryMap
+}
+
+// Gives each empty region of the board to the only color bordering it in the territory map
+func AssignTerritory(board, territoryMap [][]string, sizeX, sizeY int) {
+	visited := make([][]bool, sizeY)
+	for y := 0; y < sizeY; y++ {
+		visited[y] = make([]bool, sizeX)
+	}
+
+	for y := 0; y < sizeY; y++ {
+		for x := 0; x < sizeX; x++ {
+			if board[y][x] == Empty && !visited[y][x] {
+				// Start flood fill for this empty region
+				stack := [][2]int{{x, y}}
+				adjacentStones := make(map[string]bool)
+				region := [][2]int{}
+
+				for len(stack) > 0 {
+					cx, cy := stack[len(stack)-1][0], stack[len(stack)-1][1]
+					stack = stack[:len(stack)-1]
+
+					if visited[cy][cx] {
+						continue
+					}
+					visited[cy][cx] = true
+					region = append(region, [2]int{cx, cy})
+
+					dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+					for _, d := range dirs {
+						nx, ny := cx+d[0], cy+d[1]
+						if nx >= 0 && nx < sizeX && ny >= 0 && ny < sizeY {
+							neighborStone := territoryMap[ny][nx]
+							if board[ny][nx] == Empty && !visited[ny][nx] {
+								stack = append(stack, [2]int{nx, ny})
+							} else if neighborStone == Black || neighborStone == White {
+								adjacentStones[neighborStone] = true
+							}
+						}
+					}
+				}
+
+				// Determine owner
+				if len(adjacentStones) == 1 {
+					var owner string
+					for k := range adjacentStones {
+						owner = k
+					}
+					// Assign territory
+					for _, pos := range region {
+						territoryMap[pos[1]][pos[0]] = owner
+					}
+				} else {
+					// Neutral territory, leave as "?"
+					for _, pos := range region {
+						territoryMap[pos[1]][pos[0]] = "?"
+					}
+				}
+			}
+		}
+	}
+}
+
+// Counts territory as Japanese rules do: empty points owned by a color, plus the opponent's dead stones on them,
+// which count twice, as the point and as a prisoner. Prisoners taken during the game are not included.
+func CountJapaneseTerritory(board, territoryMap [][]string) (black, white int) {
+	for y, row := range territoryMap {
+		for x, owner := range row {
+			points := 0
+			switch board[y][x] {
+			case Empty:
+				points = 1
+			case SwitchPlayer(owner):
+				points = 2
+			}
+			if owner == Black {
+				black += points
+			} else if owner == White {
+				white += points
+			}
+		}
+	}
+	return black, white
+}
+
+// Scores the board by Tromp-Taylor rules: every stone counts as alive, and each empty region counts
+// for the color it reaches if it reaches only one. Komi is not included.
+func TrompTaylorScore(board [][]string, sizeX, sizeY int) (black, white int) {
+	territoryMap := NewTerritoryMap(board, sizeX, sizeY)
+	AssignTerritory(board, territoryMap, sizeX, sizeY)
+	return CountTerritory(territoryMap)
+}
+
+// Counts the points owned by each color in a territory map
+func CountTerritory(territoryMap [][]string) (int, int) {
+	blackScore := 0
+	whiteScore := 0
+	for _, row := range territoryMap {
+		for _, owner := range row {
+			if owner == Black {
+				blackScore++
+			} else if owner == White {
+				whiteScore++
+			}
+		}
+	}
+	return blackScore, whiteScore
+}
+
+func charToInt(c rune) (int, error) {
+	if c >= 'a' && c <= 'z' {
+		return int(c - 'a'), nil
+	} else if c >= 'A' && c <= 'Z' {
+		return int(c - 'A' + 26), nil
+	} else {
+		return 93, fmt.Errorf("invalid coordinate character: %c", c)
+	}
+}
+
+// Converts SGF coordinates (e.g., "pd") to board x, y indices.
+// Four letters are the extended coordinates of boards larger than 52, two base 52 letters per axis.
+// Returns a slice with [x, y] or nil if invalid.
+func ParseSGFPoint(coord string) []int {
+	if len(coord) == 4 {
+		x1, errX1 := charToInt(rune(coord[0]))
+		x2, errX2 := charToInt(rune(coord[1]))
+		y1, errY1 := charToInt(rune(coord[2]))
+		y2, errY2 := charToInt(rune(coord[3]))
+		if errX1 != nil || errX2 != nil || errY1 != nil || errY2 != nil {
+			return nil // Invalid characters in coordinate
+		}
+		x, y := x1*MaxSGFBoardSize+x2, y1*MaxSGFBoardSize+y2
+		if x < MaxBoardSize && y < MaxBoardSize {
+			return []int{x, y}
+		}
+		return nil // Coordinate out of range
+	}
+	if len(coord) != 2 {
+		return nil // Invalid coordinate length
+	}
+	x, err1 := charToInt(rune(coord[0]))
+	y, err2 := charToInt(rune(coord[1]))
+	if err1 != nil || err2 != nil {
+		return nil // Invalid characters in coordinate
+	}
+	if x >= 0 && x < 52 && y >= 0 && y < 52 {
+		return []int{x, y} // Valid coordinate
+	}
+	return nil // Coordinate out of range
+}
+
+func intToChar(n int) (string, error) {
+	if n >= 0 && n <= 25 {
+		// 'a' to 'z' for indices 0 to 25
+		return string(rune('a' + n)), nil
+	} else if n >= 26 && n <= 51 {
+		// 'A' to 'Z' for indices 26 to 51
+		return string(rune('A' + n - 26)), nil
+	} else {
+		return "", fmt.Errorf("coordinate out of range for SGF (max 52x52 board size)")
+	}
+}
+
+// Converts board x, y indices to SGF coordinates.
+// Points beyond the 52 SGF letters are written as four letters, two base 52 letters per axis.
+func SGFPoint(x, y int) string {
+	if x >= MaxSGFBoardSize || y >= MaxSGFBoardSize {
+		x1, _ := intToChar(x / MaxSGFBoardSize)
+		x2, _ := intToChar(x % MaxSGFBoardSize)
+		y1, _ := intToChar(y / MaxSGFBoardSize)
+		y2, _ := intToChar(y % MaxSGFBoardSize)
+		return x1 + x2 + y1 + y2
+	}
+	sgfX, _ := intToChar(x)
+	sgfY, _ := intToChar(y)
+	return sgfX + sgfY
+}
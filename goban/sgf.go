@@ -0,0 +1,292 @@
+package goban
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Deepest nesting of variations ParseSGF accepts
+const MaxVariationDepth = 100000
+
+// Limits on the tokens of an SGF file, so that a malformed or hostile file is refused instead of exhausting memory
+const (
+	maxPropIdentLength = 64      // Longest property identifier, in bytes
+	maxPropValueLength = 1 << 24 // Largest property value once unescaped, in bytes
+)
+
+// A game tree of an SGF file: a sequence of nodes followed by its variations
+type SGFGameTree struct {
+	Sequence []*SGFNode     // Nodes of the main line of the tree, in order
+	Subtrees []*SGFGameTree // Variations following the sequence
+}
+
+// A node of an SGF game tree
+type SGFNode struct {
+	Properties map[string][]string // Unescaped values of each property, by identifier
+}
+
+// A malformed SGF file: what is wrong and the byte offset in the file where it was found
+type SGFSyntaxError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *SGFSyntaxError) Error() string {
+	return fmt.Sprintf("SGF syntax error at byte %d: %s", e.Offset, e.Msg)
+}
+
+type sgfParser struct {
+	content string // The SGF content to parse
+	index   int    // Offset of the next byte to read
+}
+
+// Parses an SGF collection into its game trees; text between the game trees is ignored.
+// Malformed input, such as an unterminated property value, a null byte, invalid UTF-8, an oversized token or
+// variations nested deeper than MaxVariationDepth, returns an *SGFSyntaxError rather than a partial result.
+func ParseSGF(content string) ([]*SGFGameTree, error) {
+	p := &sgfParser{content: content}
+	var collection []*SGFGameTree
+	for p.index < len(p.content) {
+		switch p.content[p.index] {
+		case '(':
+			p.index++ // Consume '('
+			gameTree, err := p.parseGameTree()
+			if err != nil {
+				return nil, err
+			}
+			collection = append(collection, gameTree)
+		case ')':
+			return nil, p.errorAt(p.index, "unmatched ')'")
+		case 0:
+			return nil, p.errorAt(p.index, "null byte in SGF content")
+		default:
+			p.index++
+		}
+	}
+	return collection, nil
+}
+
+func (p *sgfParser) errorAt(offset int, format string, args ...any) error {
+	return &SGFSyntaxError{Offset: offset, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Parses a game tree whose '(' was just consumed: its sequence, its variations and the closing ')'.
+// The game trees being read are kept on a stack of their own, so variations nested up to MaxVariationDepth
+// levels deep are read without recursion.
+func (p *sgfParser) parseGameTree() (*SGFGameTree, error) {
+	type openTree struct {
+		tree  *SGFGameTree
+		start int // Offset of the tree's '('
+	}
+	var stack []openTree
+	start := p.index - 1
+	for {
+		// A game tree was just opened: read its sequence and add it to the tree containing it
+		if len(stack) > MaxVariationDepth {
+			return nil, p.errorAt(start, "variations are nested deeper than %d levels", MaxVariationDepth)
+		}
+		sequence, err := p.parseSequence()
+		if err != nil {
+			return nil, err
+		}
+		tree := &SGFGameTree{Sequence: sequence}
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1].tree
+			parent.Subtrees = append(parent.Subtrees, tree)
+		}
+		stack = append(stack, openTree{tree, start})
+
+		// Close game trees until a variation opens
+		for {
+			p.skipWhitespace()
+			if p.index < len(p.content) && p.content[p.index] == '(' {
+				start = p.index
+				p.index++ // Consume '(' before parsing the subtree
+				break
+			}
+			top := stack[len(stack)-1]
+			if p.index >= len(p.content) {
+				return nil, p.errorAt(top.start, "game tree is never closed with ')'")
+			}
+			if p.content[p.index] != ')' {
+				r, _, err := p.nextRune()
+				if err != nil {
+					return nil, err
+				}
+				return nil, p.errorAt(p.index, "expected ')', found %q", r)
+			}
+			p.index++ // Consume ')'
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return top.tree, nil
+			}
+		}
+	}
+}
+
+// Parses the sequence of nodes at the start of a game tree
+func (p *sgfParser) parseSequence() ([]*SGFNode, error) {
+	var nodes []*SGFNode
+	for {
+		p.skipWhitespace()
+		if p.index >= len(p.content) || p.content[p.index] != ';' {
+			return nodes, nil
+		}
+		node, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+}
+
+// Skips whitespace characters in the SGF content
+func (p *sgfParser) skipWhitespace() {
+	for p.index < len(p.content) && strings.IndexByte(" \n\r\t", p.content[p.index]) >= 0 {
+		p.index++
+	}
+}
+
+// Parses a node starting at its ';', reading properties until a character that cannot start one
+func (p *sgfParser) parseNode() (*SGFNode, error) {
+	properties := make(map[string][]string)
+	p.index++ // Skip the ';'
+	for {
+		p.skipWhitespace()
+		if p.index >= len(p.content) {
+			break
+		}
+		r, _, err := p.nextRune()
+		if err != nil {
+			return nil, err
+		}
+		if !unicode.IsUpper(r) {
+			break // No more properties in this node
+		}
+		ident, values, err := p.parseProperty()
+		if err != nil {
+			return nil, err
+		}
+		properties[ident] = values
+	}
+	return &SGFNode{Properties: properties}, nil
+}
+
+// Parses a property, returning its identifier and values. Whitespace may separate the values.
+func (p *sgfParser) parseProperty() (string, []string, error) {
+	start := p.index
+	for p.index < len(p.content) {
+		r, size, err := p.nextRune()
+		if err != nil {
+			return "", nil, err
+		}
+		if !unicode.IsUpper(r) {
+			break // End of the property identifier
+		}
+		p.index += size
+		if p.index-start > maxPropIdentLength {
+			return "", nil, p.errorAt(start, "property identifier is longer than %d bytes", maxPropIdentLength)
+		}
+	}
+	ident := p.content[start:p.index]
+	var values []string
+	for {
+		p.skipWhitespace()
+		if p.index >= len(p.content) || p.content[p.index] != '[' {
+			return ident, values, nil
+		}
+		value, err := p.parsePropValue()
+		if err != nil {
+			return "", nil, err
+		}
+		values = append(values, value)
+	}
+}
+
+// Returns the rune at the current index without consuming it, refusing null bytes and invalid UTF-8
+func (p *sgfParser) nextRune() (rune, int, error) {
+	if p.index >= len(p.content) {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	r, size := utf8.DecodeRuneInString(p.content[p.index:])
+	if r == utf8.RuneError && size == 1 {
+		return 0, 0, p.errorAt(p.index, "invalid UTF-8 encoding")
+	}
+	if r == 0 {
+		return 0, 0, p.errorAt(p.index, "null byte in SGF content")
+	}
+	return r, size, nil
+}
+
+// Parses a property value starting at its '[', removing the backslashes of escaped characters
+func (p *sgfParser) parsePropValue() (string, error) {
+	start := p.index
+	p.index++ // Skip '['
+	var value strings.Builder
+	for {
+		if p.index >= len(p.content) {
+			return "", p.errorAt(start, "property value is never closed with ']'")
+		}
+		r, size, err := p.nextRune()
+		if err != nil {
+			return "", err
+		}
+		p.index += size
+		if r == ']' {
+			return value.String(), nil
+		}
+		if r == '\\' {
+			if p.index >= len(p.content) {
+				return "", p.errorAt(start, "property value is never closed with ']'")
+			}
+			if r, size, err = p.nextRune(); err != nil {
+				return "", err
+			}
+			p.index += size
+		}
+		value.WriteRune(r)
+		if value.Len() > maxPropValueLength {
+			return "", p.errorAt(start, "property value is longer than %d bytes", maxPropValueLength)
+		}
+	}
+}
+
+// Writes a game tree as SGF to w while walking it, so the file is never held in memory as a whole.
+// node returns the text of a node from its semicolon on, e.g. ";B[dd]C[Joseki]", and children its variations,
+// the main line first. The walk keeps its own stack, so trees of any depth are written without recursion.
+func WriteSGFTree[N any](w io.Writer, root N, node func(N) string, children func(N) []N) error {
+	type step struct {
+		node  N
+		open  bool // Starts a variation: "(" comes before the node
+		close bool // Ends a variation: ")" and no node
+	}
+	out := bufio.NewWriter(w)
+	out.WriteString("(")
+	stack := []step{{close: true}, {node: root}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if top.close {
+			out.WriteString(")")
+			continue
+		}
+		if top.open {
+			out.WriteString("(")
+		}
+		out.WriteString(node(top.node))
+		next := children(top.node)
+		if len(next) == 1 {
+			// A single child continues the sequence without a new variation
+			stack = append(stack, step{node: next[0]})
+			continue
+		}
+		for i := len(next) - 1; i >= 0; i-- {
+			stack = append(stack, step{close: true}, step{node: next[i], open: true})
+		}
+	}
+	return out.Flush()
+}
@@ -0,0 +1,216 @@
+package goban
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type testNode struct {
+	text     string
+	children []*testNode
+}
+
+func writeTestTree(t *testing.T, root *testNode) string {
+	t.Helper()
+	var sb strings.Builder
+	err := WriteSGFTree(&sb, root,
+		func(n *testNode) string { return n.text },
+		func(n *testNode) []*testNode { return n.children })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sb.String()
+}
+
+func TestWriteSGFTreeVariations(t *testing.T) {
+	root := &testNode{";SZ[9]", []*testNode{
+		{";B[aa]", []*testNode{
+			{";W[bb]", nil},
+			{";W[cc]", []*testNode{{";B[dd]", nil}}},
+		}},
+	}}
+	want := "(;SZ[9];B[aa](;W[bb])(;W[cc];B[dd]))"
+	if got := writeTestTree(t, root); got != want {
+		t.Errorf("WriteSGFTree() = %s, want %s", got, want)
+	}
+}
+
+func TestWriteSGFTreeDeepLine(t *testing.T) {
+	// A line far deeper than a recursive writer could comfortably follow
+	const depth = 200000
+	root := &testNode{text: ";"}
+	for node, i := root, 0; i < depth; i++ {
+		child := &testNode{text: ";"}
+		node.children = []*testNode{child}
+		node = child
+	}
+	got := writeTestTree(t, root)
+	if want := "(" + strings.Repeat(";", depth+1) + ")"; got != want {
+		t.Errorf("WriteSGFTree() wrote %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestParseSGF(t *testing.T) {
+	collection, err := ParseSGF("(;GM[1]SZ[9]\nAB[aa]\n  [bb]C[a \\] b\\\\ :)];B[cc]\n( ;W[dd])(;W[ee]))garbage(;)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collection) != 2 {
+		t.Fatalf("%d game trees, want 2", len(collection))
+	}
+	tree := collection[0]
+	if len(tree.Sequence) != 2 || len(tree.Subtrees) != 2 {
+		t.Fatalf("%d nodes and %d variations, want 2 and 2", len(tree.Sequence), len(tree.Subtrees))
+	}
+	root := tree.Sequence[0].Properties
+	if got := root["AB"]; !reflect.DeepEqual(got, []string{"aa", "bb"}) {
+		t.Errorf("AB = %q, want aa and bb", got)
+	}
+	if got := root["C"]; !reflect.DeepEqual(got, []string{"a ] b\\ :)"}) {
+		t.Errorf("C = %q", got)
+	}
+	if got := tree.Subtrees[1].Sequence[0].Properties["W"]; !reflect.DeepEqual(got, []string{"ee"}) {
+		t.Errorf("W of the second variation = %q, want ee", got)
+	}
+}
+
+func TestParseSGFErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		offset  int
+	}{
+		{"unterminated value", "(;C[no end)", 3},
+		{"escape at the end", "(;C[\\", 3},
+		{"unclosed game tree", "(;B[aa](;W[bb])", 0},
+		{"unmatched parenthesis", "(;B[aa]))", 8},
+		{"null byte in a value", "(;C[a\x00b])", 5},
+		{"null byte outside game trees", "\x00(;)", 0},
+		{"invalid UTF-8", "(;C[\xff])", 4},
+		{"unexpected character", "(;B[aa]x)", 7},
+		{"long identifier", "(;" + strings.Repeat("A", maxPropIdentLength+1) + "[])", 2},
+		{"long value", "(;C[" + strings.Repeat("x", maxPropValueLength+1) + "])", 3},
+		{"deep variations", strings.Repeat("(", MaxVariationDepth+2), MaxVariationDepth + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSGF(tt.content)
+			var syntaxErr *SGFSyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("ParseSGF() = %v, want an *SGFSyntaxError", err)
+			}
+			if syntaxErr.Offset != tt.offset {
+				t.Errorf("error at byte %d, want %d: %v", syntaxErr.Offset, tt.offset, err)
+			}
+		})
+	}
+}
+
+func TestParseSGFDeepVariations(t *testing.T) {
+	// Nested as deep as allowed, read from the parser's own stack
+	content := strings.Repeat("(;B[aa]", MaxVariationDepth+1) + strings.Repeat(")", MaxVariationDepth+1) + "(;W[bb])"
+	trees, err := ParseSGF(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trees) != 2 {
+		t.Fatalf("parsed %d game trees, want 2", len(trees))
+	}
+	depth := 0
+	for tree := trees[0]; len(tree.Subtrees) > 0; tree = tree.Subtrees[0] {
+		depth++
+	}
+	if depth != MaxVariationDepth {
+		t.Errorf("nested %d levels deep, want %d", depth, MaxVariationDepth)
+	}
+}
+
+// Formats parsed game trees back into SGF, escaping the values and leaving out properties without values
+func formatTestTrees(trees []*SGFGameTree) string {
+	var sb strings.Builder
+	var format func(tree *SGFGameTree)
+	format = func(tree *SGFGameTree) {
+		sb.WriteString("(")
+		for _, node := range tree.Sequence {
+			sb.WriteString(";")
+			var idents []string
+			for ident := range node.Properties {
+				idents = append(idents, ident)
+			}
+			sort.Strings(idents)
+			for _, ident := range idents {
+				if len(node.Properties[ident]) == 0 {
+					continue
+				}
+				sb.WriteString(ident)
+				for _, value := range node.Properties[ident] {
+					value = strings.NewReplacer("\\", "\\\\", "]", "\\]").Replace(value)
+					sb.WriteString("[" + value + "]")
+				}
+			}
+		}
+		for _, subtree := range tree.Subtrees {
+			format(subtree)
+		}
+		sb.WriteString(")")
+	}
+	for _, tree := range trees {
+		format(tree)
+	}
+	return sb.String()
+}
+
+// Removes the properties without values, which formatTestTrees leaves out
+func dropEmptyProperties(trees []*SGFGameTree) {
+	for _, tree := range trees {
+		for _, node := range tree.Sequence {
+			for ident, values := range node.Properties {
+				if len(values) == 0 {
+					delete(node.Properties, ident)
+				}
+			}
+		}
+		dropEmptyProperties(tree.Subtrees)
+	}
+}
+
+// Run with go test -fuzz FuzzParseSGF ./goban
+func FuzzParseSGF(f *testing.F) {
+	for _, seed := range []string{
+		"(;FF[4]GM[1]SZ[19]KM[6.5]PB[Black]PW[White];B[pd];W[dp](;B[pp])(;B[dd]C[Joseki \\] done]))",
+		"(;AB[aa][bb]\n[cc]LB[dd:A]TR[ee])(;)",
+		"(;C[unterminated",
+		"(;B[aa]\x00)",
+		"((((((;))))))",
+		"(;B[aa]))",
+		"(;C[\xc3\x28])",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, content string) {
+		collection, err := ParseSGF(content)
+		if err != nil {
+			var syntaxErr *SGFSyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("ParseSGF() = %v, want an *SGFSyntaxError", err)
+			}
+			if syntaxErr.Offset < 0 || syntaxErr.Offset > len(content) {
+				t.Fatalf("error at byte %d of %d: %v", syntaxErr.Offset, len(content), err)
+			}
+			return
+		}
+		// Whatever is accepted reads back the same once written out
+		dropEmptyProperties(collection)
+		formatted := formatTestTrees(collection)
+		reparsed, err := ParseSGF(formatted)
+		if err != nil {
+			t.Fatalf("formatted collection %q cannot be parsed: %v", formatted, err)
+		}
+		if !reflect.DeepEqual(reparsed, collection) {
+			t.Fatalf("formatted collection %q parses differently", formatted)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package goban
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Tree functions work on any node type through accessors, as WriteSGFTree does: children returns the
+// variations of a node, the main line first, and parent returns the node above, the zero value for the root.
+
+// Visits root and its descendants depth first, children in order, so the order is the same on every import.
+// Returning false from visit stops the walk; Walk reports whether it ran to the end. The walk keeps its own
+// stack, so trees of any depth are walked without recursion.
+func Walk[N any](root N, children func(N) []N, visit func(N) bool) bool {
+	stack := []N{root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !visit(node) {
+			return false
+		}
+		next := children(node)
+		for i := len(next) - 1; i >= 0; i-- {
+			stack = append(stack, next[i])
+		}
+	}
+	return true
+}
+
+// Returns an identifier derived from the node's place in the tree: the child index of each step from the root,
+// joined by dots, with the root as "0". It is the same whenever the same SGF file is loaded.
+func PathID[N comparable](node N, parent func(N) N, children func(N) []N) string {
+	var root N
+	var steps []string
+	for n := node; parent(n) != root; n = parent(n) {
+		steps = append(steps, strconv.Itoa(slices.Index(children(parent(n)), n)))
+	}
+	steps = append(steps, "0")
+	slices.Reverse(steps)
+	return strings.Join(steps, ".")
+}
+
+// Returns the node of the tree under root with the given PathID; ok is false if there is none
+func NodeAtPath[N any](root N, path string, children func(N) []N) (node N, ok bool) {
+	steps := strings.Split(path, ".")
+	if steps[0] != "0" {
+		return node, false
+	}
+	node = root
+	for _, step := range steps[1:] {
+		next := children(node)
+		index, err := strconv.Atoi(step)
+		if err != nil || index < 0 || index >= len(next) {
+			var none N
+			return none, false
+		}
+		node = next[index]
+	}
+	return node, true
+}
@@ -0,0 +1,96 @@
+package goban
+
+import (
+	"strings"
+	"testing"
+)
+
+type pathNode struct {
+	name     string
+	parent   *pathNode
+	children []*pathNode
+}
+
+func (n *pathNode) add(name string) *pathNode {
+	child := &pathNode{name: name, parent: n}
+	n.children = append(n.children, child)
+	return child
+}
+
+func pathParent(n *pathNode) *pathNode     { return n.parent }
+func pathChildren(n *pathNode) []*pathNode { return n.children }
+
+func TestWalkOrder(t *testing.T) {
+	root := &pathNode{name: "root"}
+	a := root.add("a")
+	a.add("a1")
+	a.add("a2").add("a2x")
+	root.add("b")
+	var names []string
+	if !Walk(root, pathChildren, func(n *pathNode) bool {
+		names = append(names, n.name)
+		return true
+	}) {
+		t.Error("complete walk reported as stopped")
+	}
+	if got, want := strings.Join(names, " "), "root a a1 a2 a2x b"; got != want {
+		t.Errorf("walk order = %s, want %s", got, want)
+	}
+
+	names = nil
+	if Walk(root, pathChildren, func(n *pathNode) bool {
+		names = append(names, n.name)
+		return n.name != "a2"
+	}) {
+		t.Error("stopped walk reported as complete")
+	}
+	if got, want := strings.Join(names, " "), "root a a1 a2"; got != want {
+		t.Errorf("stopped walk visited %s, want %s", got, want)
+	}
+}
+
+func TestWalkDeepTree(t *testing.T) {
+	root := &pathNode{name: "root"}
+	node := root
+	for i := 0; i < 1000000; i++ {
+		node = node.add("")
+	}
+	count := 0
+	Walk(root, pathChildren, func(*pathNode) bool {
+		count++
+		return true
+	})
+	if count != 1000001 {
+		t.Errorf("walked %d nodes, want 1000001", count)
+	}
+}
+
+func TestPathID(t *testing.T) {
+	root := &pathNode{name: "root"}
+	a := root.add("a")
+	a.add("a1")
+	a2x := a.add("a2").add("a2x")
+	b := root.add("b")
+	for _, test := range []struct {
+		node *pathNode
+		want string
+	}{
+		{root, "0"},
+		{a, "0.0"},
+		{b, "0.1"},
+		{a2x, "0.0.1.0"},
+	} {
+		id := PathID(test.node, pathParent, pathChildren)
+		if id != test.want {
+			t.Errorf("PathID(%s) = %s, want %s", test.node.name, id, test.want)
+		}
+		if node, ok := NodeAtPath(root, id, pathChildren); !ok || node != test.node {
+			t.Errorf("NodeAtPath(%s) did not return %s", id, test.node.name)
+		}
+	}
+	for _, path := range []string{"", "1", "0.2", "0.0.x", "0.-1", "0.0.1.0.0"} {
+		if node, ok := NodeAtPath(root, path, pathChildren); ok || node != nil {
+			t.Errorf("NodeAtPath(%q) found a node", path)
+		}
+	}
+}
@@ -1,16 +1,35 @@
 package main
 
 import (
+	"ConnectedGroupsGoban/goban"
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"html"
+	"image"
 	"image/color"
+	"image/draw"
+	_ "image/jpeg" // Board photos
+	"image/png"
 	"io"
+	"maps"
 	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -24,16 +43,25 @@ import (
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/driver/mobile"
+	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
 )
 
 const (
-	empty             = "."
-	black             = "B"
-	white             = "W"
+	empty             = goban.Empty
+	black             = goban.Black
+	white             = goban.White
+	blocked           = goban.Blocked
 	gridLineThickness = 0.15
 	version           = "2"
+	maxSGFBoardSize   = goban.MaxSGFBoardSize
+	maxBoardSize      = goban.MaxBoardSize
 )
 
 var (
@@ -47,13 +75,75 @@ var (
 	transparentBlackColor = color.NRGBA{0, 0, 0, 128}
 	redColor              = color.RGBA{255, 0, 0, 255}
 	purpleColor           = color.RGBA{128, 0, 128, 255}
+	dimColor              = color.NRGBA{128, 128, 128, 160}
+	blockedColor          = color.RGBA{60, 45, 30, 255}
+
+	// Colors available for tagging variations, by name
+	variationColors = map[string]color.NRGBA{
+		"blue":   {40, 90, 220, 255},
+		"orange": {240, 140, 20, 255},
+		"green":  {30, 160, 60, 255},
+		"red":    {210, 40, 40, 255},
+		"purple": {150, 60, 190, 255},
+		"teal":   {20, 160, 160, 255},
+	}
+	variationColorNames = []string{"blue", "orange", "green", "red", "purple", "teal"}
 )
 
 type Config struct {
-	Komi     int    `json:"komi"`
-	GTPPath  string `json:"gtpPath"`
-	GTPArgs  string `json:"gtpArgs"`
-	GTPColor string `json:"gtpColor"`
+	Komi                int               `json:"komi"`
+	GTPPath             string            `json:"gtpPath"`
+	GTPArgs             string            `json:"gtpArgs"`
+	GTPColor            string            `json:"gtpColor"`
+	GTPStartupCommands  []string          `json:"gtpStartupCommands,omitempty"` // Read only, from before the commands were kept by engine profile
+	EngineStartup       startupCommands   `json:"engineStartup"`
+	GTPTimeout          int               `json:"gtpTimeout"`
+	GTPGenmoveTimeout   int               `json:"gtpGenmoveTimeout"`
+	SequenceAutoRestart bool              `json:"sequenceAutoRestart"`
+	SequenceAlternate   bool              `json:"sequenceAlternate"`
+	HideCommentMarkers  bool              `json:"hideCommentMarkers"`
+	HideEventMarkers    bool              `json:"hideEventMarkers"`
+	HideLabels          bool              `json:"hideLabels"`
+	HideShapes          bool              `json:"hideShapes"`
+	ShowMoveNumbers     bool              `json:"showMoveNumbers"`
+	ShowLiberties       bool              `json:"showLiberties"`
+	HideLastMove        bool              `json:"hideLastMove"`
+	HideAnalysis        bool              `json:"hideAnalysis"`
+	HideTerritory       bool              `json:"hideTerritory"`
+	HideLadderPath      bool              `json:"hideLadderPath"`
+	ShowLegality        bool              `json:"showLegality"`
+	TenukiFinder        bool              `json:"tenukiFinder"`
+	AtariWarnings       bool              `json:"atariWarnings"`
+	FilterTree          bool              `json:"filterTree"`
+	MainLinePolicy      string            `json:"mainLinePolicy"`
+	CountingErrors      []int             `json:"countingErrors"`
+	CommentPhrases      []string          `json:"commentPhrases"`
+	DictionaryPath      string            `json:"dictionaryPath"`
+	HideSpelling        bool              `json:"hideSpelling"`
+	LockedFiles         []string          `json:"lockedFiles"`
+	RecentFiles         []recentFile      `json:"recentFiles"`
+	BackupCount         int               `json:"backupCount"`
+	BackupFolder        string            `json:"backupFolder"`
+	ClipboardImageScale int               `json:"clipboardImageScale"`
+	CapturePreview      bool              `json:"capturePreview"`
+	HideHoverStone      bool              `json:"hideHoverStone"`
+	HoverOpacity        int               `json:"hoverOpacity"`
+	HoverSize           int               `json:"hoverSize"`
+	HoverEvaluation     bool              `json:"hoverEvaluation"`
+	GestureActions      map[string]string `json:"gestureActions"`
+	KeyBindings         map[string]string `json:"keyBindings"`
+	TouchInput          bool              `json:"touchInput"`
+	Superko             bool              `json:"superko"`
+	PassEncoding        string            `json:"passEncoding"`
+	ReplayPolicy        string            `json:"replayPolicy"`
+	BackgroundReview    bool              `json:"backgroundReview"`
+	ReviewVisits        int               `json:"reviewVisits"`
+	ShowWinrateGraph    bool              `json:"showWinrateGraph"`
+	HeuristicGraph      bool              `json:"heuristicGraph"`
+	GameInfoDefaults    map[string]string `json:"gameInfoDefaults"`
+	DatabaseFolder      string            `json:"databaseFolder"`
+	EngineMatches       matchHistory      `json:"engineMatches"`
+	PracticeLadder      practiceLadder    `json:"practiceLadder"`
 }
 
 func (g *Game) loadConfig() error {
@@ -77,12 +167,135 @@ func (g *Game) loadConfig() error {
 	}
 
 	// Apply the loaded configuration
+	g.applyConfig(config)
+
+	return nil
+}
+
+// Copies the settings of the configuration into the game
+func (g *Game) applyConfig(config Config) {
 	g.komi = config.Komi
 	g.gtpPath = config.GTPPath
 	g.gtpArgs = config.GTPArgs
 	g.gtpColor = config.GTPColor
+	g.gtpStartupCommands = config.EngineStartup
+	if g.gtpStartupCommands == nil {
+		g.gtpStartupCommands = make(startupCommands)
+	}
+	if profile := g.engineProfile(); len(config.GTPStartupCommands) > 0 && g.gtpStartupCommands[profile] == nil {
+		g.gtpStartupCommands[profile] = config.GTPStartupCommands
+	}
+	g.gtpTimeout = config.GTPTimeout
+	g.gtpGenmoveTimeout = config.GTPGenmoveTimeout
+	g.sequenceAutoRestart = config.SequenceAutoRestart
+	g.sequenceAlternate = config.SequenceAlternate
+	g.showCommentMarkers = !config.HideCommentMarkers
+	g.showEventMarkers = !config.HideEventMarkers
+	g.showLabels = !config.HideLabels
+	g.showShapes = !config.HideShapes
+	g.showMoveNumbers = config.ShowMoveNumbers
+	g.showLiberties = config.ShowLiberties
+	g.showLastMove = !config.HideLastMove
+	g.showAnalysis = !config.HideAnalysis
+	g.showTerritory = !config.HideTerritory
+	g.showLadderPath = !config.HideLadderPath
+	g.showLegality = config.ShowLegality
+	g.tenukiFinder = config.TenukiFinder
+	g.atariWarnings = config.AtariWarnings
+	g.superko = config.Superko
+	g.passEncoding = config.PassEncoding
+	g.replayPolicy = config.ReplayPolicy
+	g.backgroundReview = config.BackgroundReview
+	g.reviewVisits = config.ReviewVisits
+	g.showWinrateGraph = config.ShowWinrateGraph
+	g.heuristicGraph = config.HeuristicGraph
+	g.filterTree = config.FilterTree
+	g.mainLinePolicy = config.MainLinePolicy
+	g.countingErrors = config.CountingErrors
+	if config.CommentPhrases != nil {
+		g.commentPhrases = config.CommentPhrases
+	}
+	if config.DictionaryPath != "" {
+		g.dictionaryPath = config.DictionaryPath
+	}
+	g.underlineSpelling = !config.HideSpelling
+	g.databaseFolder = config.DatabaseFolder
+	g.engineMatches = config.EngineMatches
+	g.practiceLadder = config.PracticeLadder
+	g.gameInfoDefaults = config.GameInfoDefaults
+	g.lockedFiles = config.LockedFiles
+	g.recentFiles = config.RecentFiles
+	g.backupCount = config.BackupCount
+	g.backupFolder = config.BackupFolder
+	g.clipboardImageScale = config.ClipboardImageScale
+	g.capturePreview = config.CapturePreview
+	g.showHoverStone = !config.HideHoverStone
+	g.hoverOpacity = config.HoverOpacity
+	g.hoverSize = config.HoverSize
+	g.hoverEvaluation = config.HoverEvaluation
+	if config.GestureActions != nil {
+		g.gestureActions = config.GestureActions
+	}
+	g.keyBindings = config.KeyBindings
+	g.touchInput = config.TouchInput
+}
 
-	return nil
+// Collects the current settings of the game into a configuration
+func (g *Game) currentConfig() Config {
+	return Config{
+		Komi:                g.komi,
+		GTPPath:             g.gtpPath,
+		GTPArgs:             g.gtpArgs,
+		GTPColor:            g.gtpColor,
+		EngineStartup:       g.gtpStartupCommands,
+		GTPTimeout:          g.gtpTimeout,
+		GTPGenmoveTimeout:   g.gtpGenmoveTimeout,
+		SequenceAutoRestart: g.sequenceAutoRestart,
+		SequenceAlternate:   g.sequenceAlternate,
+		HideCommentMarkers:  !g.showCommentMarkers,
+		HideEventMarkers:    !g.showEventMarkers,
+		HideLabels:          !g.showLabels,
+		HideShapes:          !g.showShapes,
+		ShowMoveNumbers:     g.showMoveNumbers,
+		ShowLiberties:       g.showLiberties,
+		HideLastMove:        !g.showLastMove,
+		HideAnalysis:        !g.showAnalysis,
+		HideTerritory:       !g.showTerritory,
+		HideLadderPath:      !g.showLadderPath,
+		ShowLegality:        g.showLegality,
+		TenukiFinder:        g.tenukiFinder,
+		AtariWarnings:       g.atariWarnings,
+		Superko:             g.superko,
+		PassEncoding:        g.passEncoding,
+		ReplayPolicy:        g.replayPolicy,
+		BackgroundReview:    g.backgroundReview,
+		ReviewVisits:        g.reviewVisits,
+		ShowWinrateGraph:    g.showWinrateGraph,
+		HeuristicGraph:      g.heuristicGraph,
+		FilterTree:          g.filterTree,
+		MainLinePolicy:      g.mainLinePolicy,
+		CountingErrors:      g.countingErrors,
+		CommentPhrases:      g.commentPhrases,
+		DictionaryPath:      g.dictionaryPath,
+		HideSpelling:        !g.underlineSpelling,
+		GameInfoDefaults:    g.gameInfoDefaults,
+		DatabaseFolder:      g.databaseFolder,
+		EngineMatches:       g.engineMatches,
+		PracticeLadder:      g.practiceLadder,
+		LockedFiles:         g.lockedFiles,
+		RecentFiles:         g.recentFiles,
+		BackupCount:         g.backupCount,
+		BackupFolder:        g.backupFolder,
+		ClipboardImageScale: g.clipboardImageScale,
+		CapturePreview:      g.capturePreview,
+		HideHoverStone:      !g.showHoverStone,
+		HoverOpacity:        g.hoverOpacity,
+		HoverSize:           g.hoverSize,
+		HoverEvaluation:     g.hoverEvaluation,
+		GestureActions:      g.gestureActions,
+		KeyBindings:         g.keyBindings,
+		TouchInput:          g.touchInput,
+	}
 }
 
 func (g *Game) saveConfig() error {
@@ -92,12 +305,7 @@ func (g *Game) saveConfig() error {
 	}
 	configPath := filepath.Join(filepath.Dir(exePath), "ConnectedGroupsGoban.config")
 
-	config := Config{
-		Komi:     g.komi,
-		GTPPath:  g.gtpPath,
-		GTPArgs:  g.gtpArgs,
-		GTPColor: g.gtpColor,
-	}
+	config := g.currentConfig()
 
 	file, err := os.Create(configPath)
 	if err != nil {
@@ -115,2326 +323,12407 @@ func (g *Game) saveConfig() error {
 	return nil
 }
 
-type Game struct {
-	sizeX             int
-	sizeY             int
-	boardCanvas       *fyne.Container
-	gridContainer     *fyne.Container
-	hoverStone        *canvas.Circle
-	window            fyne.Window
-	cellSize          float32
-	currentNode       *GameTreeNode
-	rootNode          *GameTreeNode
-	nodeMap           map[string]*GameTreeNode
-	idCounter         int
-	gameTreeContainer *container.Scroll
-	mouseMode         string
-	territoryMap      [][]string
-	territoryLayer    *fyne.Container
-	scoringStatus     *widget.Label
-	commentEntry      *widget.Entry
-	komi              int
-	gtpPath           string
-	gtpArgs           string
-	gtpColor          string
-	gtpCmd            *exec.Cmd
-	gtpIn             io.WriteCloser
-	gtpOut            io.ReadCloser
-	gtpReader         *bufio.Reader
-	selfPlaying       bool
-	selfPlayCtx       context.Context
-	selfPlayCancel    context.CancelFunc
-	selfPlayWaitGrp   sync.WaitGroup
+// Writes all settings as JSON so they can be imported on another machine
+func (g *Game) exportSettings() {
+	dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil || writer == nil {
+			return
+		}
+		defer writer.Close()
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ") // Pretty print for readability
+		if err := encoder.Encode(g.currentConfig()); err != nil {
+			g.showError(err)
+		}
+	}, g.window)
 }
 
-func (g *Game) newGameTreeNode() *GameTreeNode {
-	g.idCounter++
+// Writes a review summary of the game: a section per commented or marked node, with a diagram and the comment.
+// A file ending in .html gets its diagrams embedded; otherwise it is Markdown with the diagrams as PNG files next to it.
+func (g *Game) exportReviewSummary() {
+	dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil || writer == nil {
+			return
+		}
+		defer writer.Close()
+		path := writer.URI().Path()
+		isHTML := strings.EqualFold(filepath.Ext(path), ".html") || strings.EqualFold(filepath.Ext(path), ".htm")
+		title := g.gameInfo["GN"]
+		if title == "" {
+			title = "Game Review"
+		}
+		var summary strings.Builder
+		if isHTML {
+			fmt.Fprintf(&summary, "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>%s</title></head>\n<body>\n<h1>%s</h1>\n", html.EscapeString(title), html.EscapeString(title))
+		} else {
+			fmt.Fprintf(&summary, "# %s\n", title)
+		}
+		cell := max(8, 400/max(g.sizeX, g.sizeY))
+		for i, node := range reviewNodes(g.rootNode) {
+			var diagram bytes.Buffer
+			if err := png.Encode(&diagram, renderDiagramImage(node, g.sizeX, g.sizeY, cell)); err != nil {
+				g.showError(err)
+				return
+			}
+			heading := fmt.Sprintf("Move %d", node.displayMoveNumber())
+			if isHTML {
+				fmt.Fprintf(&summary, "<h2>%s</h2>\n<img src=\"data:image/png;base64,%s\" alt=\"%s\">\n", heading, base64.StdEncoding.EncodeToString(diagram.Bytes()), heading)
+				if node.Comment != "" {
+					fmt.Fprintf(&summary, "<p>%s</p>\n", strings.ReplaceAll(html.EscapeString(node.Comment), "\n", "<br>\n"))
+				}
+				continue
+			}
+			imageName := fmt.Sprintf("%s-%d.png", strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), i+1)
+			if err := os.WriteFile(filepath.Join(filepath.Dir(path), imageName), diagram.Bytes(), 0644); err != nil {
+				g.showError(err)
+				return
+			}
+			fmt.Fprintf(&summary, "\n## %s\n\n![%s](%s)\n", heading, heading, imageName)
+			if node.Comment != "" {
+				fmt.Fprintf(&summary, "\n%s\n", node.Comment)
+			}
+		}
+		if isHTML {
+			summary.WriteString("</body>\n</html>\n")
+		}
+		if _, err := writer.Write([]byte(summary.String())); err != nil {
+			g.showError(err)
+		}
+	}, g.window)
+}
 
-	newNode := &GameTreeNode{
-		boardState:       makeEmptyBoard(g.sizeX, g.sizeY),
-		id:               fmt.Sprintf("%d", g.idCounter),
-		koX:              -1,
-		koY:              -1,
-		addedBlackStones: make([][]bool, g.sizeY),
-		addedWhiteStones: make([][]bool, g.sizeY),
-		AE:               make([][]bool, g.sizeY),
-		CR:               make([][]bool, g.sizeY),
-		SQ:               make([][]bool, g.sizeY),
-		TR:               make([][]bool, g.sizeY),
-		MA:               make([][]bool, g.sizeY),
-		LB:               make([][]string, g.sizeY),
+// Bookmarks the current node, or removes its bookmark. Bookmarks are hotspots (HO), which other SGF programs show too.
+func (g *Game) toggleBookmark() {
+	if !g.allowEdit(g.toggleBookmark) {
+		return
 	}
-
-	for y := 0; y < g.sizeY; y++ {
-		newNode.addedBlackStones[y] = make([]bool, g.sizeX)
-		newNode.addedWhiteStones[y] = make([]bool, g.sizeX)
-		newNode.AE[y] = make([]bool, g.sizeX)
-		newNode.CR[y] = make([]bool, g.sizeX)
-		newNode.SQ[y] = make([]bool, g.sizeX)
-		newNode.TR[y] = make([]bool, g.sizeX)
-		newNode.MA[y] = make([]bool, g.sizeX)
-		newNode.LB[y] = make([]string, g.sizeX)
+	node := g.currentNode
+	if _, bookmarked := node.annotations["HO"]; bookmarked {
+		delete(node.annotations, "HO")
+	} else {
+		if node.annotations == nil {
+			node.annotations = make(map[string]string)
+		}
+		node.annotations["HO"] = "1"
 	}
-
-	g.nodeMap[newNode.id] = newNode
-	return newNode
+	g.updateGameTreeUI()
 }
 
-type GameTreeNode struct {
-	boardState       [][]string      // Current state of the board at this node
-	move             [2]int          // Coordinates of the move ([x, y]); (-1, -1) represents a pass
-	player           string          // Player who made the move ("B" for Black, "W" for White)
-	children         []*GameTreeNode // Child nodes representing subsequent moves
-	parent           *GameTreeNode   // Parent node in the game tree
-	id               string          // Unique identifier for the node
-	koX              int             // X-coordinate for ko rule; -1 if not applicable
-	koY              int             // Y-coordinate for ko rule; -1 if not applicable
-	Comment          string          // Optional comment for the move
-	addedBlackStones [][]bool        // Coordinates of additional Black stones (AB properties)
-	addedWhiteStones [][]bool        // Coordinates of additional White stones (AW properties)
-	AE               [][]bool        // Coordinates of points made empty (AE properties)
-	CR               [][]bool        // Coordinates for circle annotations
-	SQ               [][]bool        // Coordinates for square annotations
-	TR               [][]bool        // Coordinates for triangle annotations
-	MA               [][]bool        // Coordinates for mark (X) annotations
-	LB               [][]string      // Labels for specific points on the board
-}
+// Pixels per board point of handout diagrams
+const handoutCellSize = 40
 
-func (gtn *GameTreeNode) addBlackStone(x, y int) {
-	if x >= 0 && x < len(gtn.addedBlackStones[0]) && y >= 0 && y < len(gtn.addedBlackStones) {
-		gtn.addedBlackStones[y][x] = true
+// Shows the bookmarked nodes to pick the diagrams of a handout from, then asks for the folder to write them to
+func (g *Game) showHandoutExportDialog() {
+	var bookmarks []*GameTreeNode
+	g.rootNode.Walk(func(node *GameTreeNode) bool {
+		if _, bookmarked := node.annotations["HO"]; bookmarked {
+			bookmarks = append(bookmarks, node)
+		}
+		return true
+	})
+	if len(bookmarks) == 0 {
+		dialog.ShowInformation("Export Handout Diagrams", "Bookmark the nodes to export first (Game > Toggle Bookmark).", g.window)
+		return
+	}
+	checks := make([]*widget.Check, len(bookmarks))
+	list := container.NewVBox()
+	for i, node := range bookmarks {
+		summary := fmt.Sprintf("Move %d (%s)", node.displayMoveNumber(), node.PathID())
+		if comment := strings.ReplaceAll(node.Comment, "\n", " "); comment != "" {
+			summary += ": " + comment
+		}
+		checks[i] = widget.NewCheck(summary, nil)
+		checks[i].SetChecked(true)
+		list.Add(checks[i])
 	}
+	exportDialog := dialog.NewCustomConfirm("Export Handout Diagrams", "Choose Folder", "Cancel", container.NewVScroll(list), func(ok bool) {
+		if !ok {
+			return
+		}
+		var selected []*GameTreeNode
+		for i, check := range checks {
+			if check.Checked {
+				selected = append(selected, bookmarks[i])
+			}
+		}
+		if len(selected) == 0 {
+			return
+		}
+		dialog.ShowFolderOpen(func(folder fyne.ListableURI, err error) {
+			if err != nil || folder == nil {
+				return
+			}
+			if err := g.exportHandoutDiagrams(selected, folder.Path()); err != nil {
+				g.showError(err)
+				return
+			}
+			g.scoringStatus.SetText(fmt.Sprintf("Exported %d diagrams to %s.", len(selected), folder.Path()))
+		}, g.window)
+	}, g.window)
+	exportDialog.Resize(fyne.NewSize(500, 400))
+	exportDialog.Show()
 }
 
-func (gtn *GameTreeNode) hasAddedBlackStones() bool {
-	for _, arr := range gtn.addedBlackStones {
-		for _, el := range arr {
-			if el {
-				return true
+// Writes a numbered PNG diagram of each node to folder, with its moves since the previous diagram of its line
+// numbered on the stones, and captions.txt giving each diagram's move range and comment
+func (g *Game) exportHandoutDiagrams(nodes []*GameTreeNode, folder string) error {
+	var captions strings.Builder
+	for i, node := range nodes {
+		start := g.rootNode
+		for ancestor := node.parent; ancestor != nil; ancestor = ancestor.parent {
+			if slices.Contains(nodes, ancestor) {
+				start = ancestor
+				break
 			}
 		}
+		img, first, last := renderHandoutDiagram(node, start, g.sizeX, g.sizeY, handoutCellSize)
+		var pngData bytes.Buffer
+		if err := png.Encode(&pngData, img); err != nil {
+			return err
+		}
+		name := fmt.Sprintf("diagram-%02d.png", i+1)
+		if err := os.WriteFile(filepath.Join(folder, name), pngData.Bytes(), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(&captions, "Diagram %d (%s)", i+1, name)
+		switch {
+		case first == 0:
+		case first == last:
+			fmt.Fprintf(&captions, ": move %d", first)
+		default:
+			fmt.Fprintf(&captions, ": moves %d-%d", first, last)
+		}
+		captions.WriteString("\n")
+		if node.Comment != "" {
+			captions.WriteString(node.Comment + "\n")
+		}
+		captions.WriteString("\n")
 	}
-	return false
+	return os.WriteFile(filepath.Join(folder, "captions.txt"), []byte(captions.String()), 0644)
 }
 
-func (gtn *GameTreeNode) addWhiteStone(x, y int) {
-	if x >= 0 && x < len(gtn.addedWhiteStones[0]) && y >= 0 && y < len(gtn.addedWhiteStones) {
-		gtn.addedWhiteStones[y][x] = true
+// Renders the diagram of node with the numbers of the moves after start that are still on the board.
+// Returns the image and the first and last move numbers of the range, 0 if it has no moves.
+func renderHandoutDiagram(node, start *GameTreeNode, sizeX, sizeY, cell int) (*image.RGBA, int, int) {
+	img := renderDiagramImage(node, sizeX, sizeY, cell)
+	first, last := 0, 0
+	numbered := make(map[[2]int]bool)
+	for n := node; n != nil && n != start; n = n.parent {
+		if !n.hasMove() {
+			continue
+		}
+		number := n.displayMoveNumber()
+		first = number
+		if last == 0 {
+			last = number
+		}
+		x, y := n.move[0], n.move[1]
+		if x < 0 || numbered[[2]int{x, y}] || node.boardState[y][x] != n.player {
+			continue
+		}
+		numbered[[2]int{x, y}] = true
+		textColor := whiteColor
+		if n.player == white {
+			textColor = blackColor
+		}
+		drawImageText(img, x*cell+cell/2, y*cell+cell/2, strconv.Itoa(number), textColor)
 	}
+	return img, first, last
 }
 
-func (gtn *GameTreeNode) hasAddedWhiteStones() bool {
-	for _, arr := range gtn.addedWhiteStones {
-		for _, el := range arr {
-			if el {
-				return true
-			}
-		}
+// Draws text centered on (cx, cy) in a small fixed-width font
+func drawImageText(img *image.RGBA, cx, cy int, text string, c color.Color) {
+	face := basicfont.Face7x13
+	drawer := font.Drawer{Dst: img, Src: image.NewUniform(c), Face: face}
+	width := drawer.MeasureString(text)
+	drawer.Dot = fixed.Point26_6{
+		X: fixed.I(cx) - width/2,
+		Y: fixed.I(cy + (face.Ascent-face.Descent)/2),
 	}
-	return false
+	drawer.DrawString(text)
 }
 
-type ResizingContainer struct {
-	widget.BaseWidget
-	content     fyne.CanvasObject
-	placeholder fyne.CanvasObject
-	resizeTimer *time.Timer
-	mutex       sync.Mutex
+// Returns the commented or marked nodes of the game tree in depth-first order
+func reviewNodes(root *GameTreeNode) []*GameTreeNode {
+	var nodes []*GameTreeNode
+	root.Walk(func(node *GameTreeNode) bool {
+		if node.Comment != "" || node.hasMarkup() {
+			nodes = append(nodes, node)
+		}
+		return true
+	})
+	return nodes
 }
 
-func NewResizingContainer(content fyne.CanvasObject, placeholder fyne.CanvasObject) *ResizingContainer {
-	rc := &ResizingContainer{
-		content:     content,
-		placeholder: placeholder,
+// Renders the position of a node with its marked and labeled points shown as purple squares
+func renderDiagramImage(node *GameTreeNode, sizeX, sizeY, cell int) *image.RGBA {
+	img := renderBoardImage(node, sizeX, sizeY, cell)
+	mark := max(2, cell/3)
+	for y := 0; y < sizeY; y++ {
+		for x := 0; x < sizeX; x++ {
+			if node.CR.has(x, y) || node.SQ.has(x, y) || node.TR.has(x, y) || node.MA.has(x, y) || node.LB.at(x, y) != "" {
+				cx, cy := x*cell+cell/2, y*cell+cell/2
+				drawImageRect(img, cx-mark/2, cy-mark/2, cx-mark/2+mark, cy-mark/2+mark, purpleColor)
+			}
+		}
 	}
-	rc.ExtendBaseWidget(rc)
-	rc.placeholder.Hide() // Hide the placeholder initially
-	return rc
+	return img
 }
 
-func (rc *ResizingContainer) CreateRenderer() fyne.WidgetRenderer {
-	return &resizingContainerRenderer{
-		container: rc,
+// Pixels per board point of clipboard images when no scale is configured
+const defaultClipboardImageScale = 32
+
+// Copies the current position to the clipboard as a PNG image
+func (g *Game) copyBoardImage() {
+	scale := g.clipboardImageScale
+	if scale <= 0 {
+		scale = defaultClipboardImageScale
 	}
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, renderDiagramImage(g.currentNode, g.sizeX, g.sizeY, scale)); err != nil {
+		g.showError(err)
+		return
+	}
+	if err := copyPNGToClipboard(pngData.Bytes()); err != nil {
+		g.showError(fmt.Errorf("failed to copy the board image: %v", err))
+		return
+	}
+	g.scoringStatus.SetText("Board image copied to the clipboard.")
 }
 
-func (rc *ResizingContainer) Resize(size fyne.Size) {
-	// Check if the size is different before proceeding
-	if rc.Size() == size {
-		return // Skip handling if the size has not changed
+// Puts PNG data on the system clipboard. The clipboard of Fyne only holds text,
+// so this goes through the clipboard tool of the platform.
+func copyPNGToClipboard(pngData []byte) error {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		// These tools read the image from a file
+		file, err := os.CreateTemp("", "goban-*.png")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(file.Name())
+		_, err = file.Write(pngData)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		if runtime.GOOS == "windows" {
+			script := fmt.Sprintf("Add-Type -AssemblyName System.Windows.Forms; [System.Windows.Forms.Clipboard]::SetImage([System.Drawing.Image]::FromFile('%s'))", strings.ReplaceAll(file.Name(), "'", "''"))
+			return exec.Command("powershell", "-NoProfile", "-STA", "-Command", script).Run()
+		}
+		return exec.Command("osascript", "-e", fmt.Sprintf("set the clipboard to (read (POSIX file %q) as «class PNGf»)", file.Name())).Run()
 	}
-	rc.BaseWidget.Resize(size)
-	rc.handleResize()
+	var lastErr error
+	for _, command := range [][]string{
+		{"wl-copy", "--type", "image/png"},
+		{"xclip", "-selection", "clipboard", "-t", "image/png", "-i"},
+	} {
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdin = bytes.NewReader(pngData)
+		if lastErr = cmd.Run(); lastErr == nil {
+			return nil
+		}
+	}
+	return lastErr
 }
 
-func (rc *ResizingContainer) handleResize() {
-	rc.mutex.Lock()
-	defer rc.mutex.Unlock()
-
-	if rc.resizeTimer != nil {
-		rc.resizeTimer.Stop()
+// Shows a dialog for the number of pixels per board point of clipboard images
+func (g *Game) showClipboardImageScaleDialog() {
+	scaleEntry := widget.NewEntry()
+	scale := g.clipboardImageScale
+	if scale <= 0 {
+		scale = defaultClipboardImageScale
+	}
+	scaleEntry.SetText(strconv.Itoa(scale))
+	scaleEntry.Validator = func(s string) error {
+		if value, err := strconv.Atoi(s); err != nil || value < 4 || value > 200 {
+			return fmt.Errorf("scale must be between 4 and 200")
+		}
+		return nil
+	}
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Pixels per Point", scaleEntry),
 	}
+	dialog.ShowForm("Board Image Scale", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+		g.clipboardImageScale, _ = strconv.Atoi(scaleEntry.Text)
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
+		}
+	}, g.window)
+}
 
-	rc.content.Hide()
-	rc.placeholder.Show()
-	rc.Refresh()
+// Reads settings exported by exportSettings, applies them, and saves them as the local configuration
+func (g *Game) importSettings() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		defer reader.Close()
+		var config Config
+		if err := json.NewDecoder(reader).Decode(&config); err != nil {
+			g.showError(fmt.Errorf("invalid settings file: %v", err))
+			return
+		}
+		g.applyConfig(config)
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
+		}
 
-	rc.resizeTimer = time.AfterFunc(39*time.Millisecond, func() {
-		rc.mutex.Lock()
-		defer rc.mutex.Unlock()
-		rc.placeholder.Hide()
-		rc.content.Show()
-		rc.Refresh()
-	})
+		// Refresh everything that shows a setting
+		g.dictionary = nil
+		g.commentEntry.Refresh()
+		g.phraseSelect.Options = g.commentPhrases
+		g.phraseSelect.Refresh()
+		for item, value := range g.toggleMenuItems {
+			item.Checked = *value
+		}
+		g.window.MainMenu().Refresh()
+		g.redrawBoard()
+		g.updateGameTreeUI()
+	}, g.window)
 }
 
-type resizingContainerRenderer struct {
-	container *ResizingContainer
+type Game struct {
+	gameState           // The shown game; board tabs swap it as a whole
+	boardCanvas         *fyne.Container
+	gridContainer       *fyne.Container
+	hoverStone          *canvas.Circle
+	hoverCaptures       *fyne.Container // Dimmed stones the hovered move would capture, nil if none shown
+	window              fyne.Window
+	cellSize            float32
+	gameTreeContainer   *container.Scroll
+	mouseMode           string
+	territoryLayer      *fyne.Container
+	scoringStatus       *widget.Label
+	commentEntry        *commentEntry
+	phraseSelect        *widget.Select
+	commentPreview      *widget.RichText
+	previewingComment   bool
+	commentStats        *widget.Label
+	tagsLabel           *widget.Label // Tags of the current node
+	koLabel             *widget.Label // Point the player to move may not retake, hidden if none
+	gameNotesEntry      *widget.Entry // Notes on the whole game, kept in the GC property of the root
+	databaseLabel       *widget.Label // Known games reaching the current position, hidden without a database
+	databaseFolder      string        // Folder of SGF files indexed as the position database, empty if none
+	database            *positionDatabase
+	dictionaryPath      string
+	dictionary          map[string]bool          // Lazily loaded words of dictionaryPath
+	underlineSpelling   bool                     // Underline the words of the comment that are not in the dictionary
+	gameInfoDefaults    map[string]string        // Game info applied to new games and filled into exports
+	toggleMenuItems     map[*fyne.MenuItem]*bool // Checkable menu items and the settings they show
+	broadcasting        bool                     // Following a live broadcast; the board is read-only
+	lockedFiles         []string                 // Paths of the SGF files locked against edits
+	recentFiles         []recentFile             // SGF files recently opened or saved, most recent first
+	recentMenuItem      *fyne.MenuItem           // File menu item listing recentFiles
+	backupCount         int                      // Backups kept of a file exported over: 0 for the default, -1 for none
+	backupFolder        string                   // Folder of the backups, empty to keep them next to the file
+	clipboardImageScale int                      // Pixels per board point of images copied to the clipboard; 0 for the default
+	capturePreview      bool                     // Dim the stones the hovered move would capture
+	gestureActions      map[string]string        // Action of each board gesture (see boardGestures)
+	keyBindings         map[string]string        // Key combination of each command the user rebound, "" if unbound
+	keyCommands         map[string]func()        // Commands that can be bound to keys: navigation and every menu item
+	keyCommandNames     []string                 // Names of keyCommands in menu order
+	lastTapTime         time.Time                // Time of the last click on the board, to detect double clicks
+	lastTapPoint        [2]int                   // Board point of the last click
+	engineMatches       matchHistory             // Finished games against each engine
+	practiceLadder      practiceLadder           // Handicap practice level against each engine
+	touchInput          bool                     // Taps in play mode place a cursor that the confirm button plays
+	confirmMoveButton   *widget.Button           // Plays the move at the touch cursor, shown in touch input mode
+	broadcastCancel     context.CancelFunc
+	spectatorImage      *canvas.Image // Board image of the spectator window, nil if it is closed
+	audioLabel          *widget.Label
+	playAudioButton     *widget.Button
+	recordAudioButton   *widget.Button
+	audioRecorder       *exec.Cmd // Process recording an audio note, nil if none
+	removeAudioButton   *widget.Button
+	commentPhrases      []string
+	gtpPath             string
+	gtpArgs             string
+	gtpColor            string
+	gtpStartupCommands  startupCommands // GTP commands sent whenever the engine is initialized, e.g. "kata-set-rules japanese"
+	attachedProfile     string          // Engine profile of the running engine process
+	gtpTimeout          int             // Seconds to wait for a GTP response: 0 for the default, -1 to wait forever
+	gtpGenmoveTimeout   int             // Seconds to wait for a genmove response: 0 for the default, -1 to wait forever
+	gtpLastID           int             // Id of the last GTP command sent to the attached engine
+	gtpMutex            sync.Mutex      // Serializes GTP exchanges between the UI and engine goroutines
+	enginePosition      sync.Mutex      // Held while the engine's board is set up, changed or searched, so such sequences do not interleave
+	engineThinking      bool            // A genmove requested by requestEngineMove is pending; board input is blocked
+	premove             *Move           // Move queued while the engine thinks, played if still legal; nil if none
+	gtpCmd              *exec.Cmd
+	gtpIn               io.WriteCloser
+	gtpOut              io.ReadCloser
+	gtpReader           *bufio.Reader
+	selfPlaying         bool
+	selfPlayCtx         context.Context
+	selfPlayCancel      context.CancelFunc
+	selfPlayWaitGrp     sync.WaitGroup
+	genmoveGeneration   int                       // Generation of the pending genmove; replies of older generations are dropped
+	genmoveDone         chan struct{}             // Closed once the reply to the last genmove has been handled on the UI thread
+	cancelledGenmoves   int                       // Cancelled genmoves the engine is still searching; its board is set up again after the last
+	engineSetupPending  bool                      // The engine is to be initialized again once the cancelled genmoves are answered
+	analyzing           bool                      // Analyze mode: the engine analyzes the current node continuously instead of playing
+	liveAnalysis        *liveAnalysis             // Latest report of analyze mode, nil if none
+	analysisCancel      context.CancelFunc        // Stops the running analysis of analyze mode
+	analyzeMenuItem     *fyne.MenuItem            // Engine menu item switching analyze mode, checked while it is on
+	sequenceAutoRestart bool                      // Restart numbering at 1 when the sequence tool is used on another node
+	sequenceAlternate   bool                      // Draw numeric labels in alternating black and white
+	showCommentMarkers  bool                      // Mark commented nodes in the game tree
+	showEventMarkers    bool                      // Mark captures, kos and dead groups of the main line in the tree and graph
+	showLabels          bool                      // Draw LB labels
+	showShapes          bool                      // Draw circles, squares, triangles and X marks
+	showMoveNumbers     bool                      // Draw move numbers on stones
+	showLiberties       bool                      // Draw the liberty count of each group on one of its stones
+	showLastMove        bool                      // Highlight the last move
+	showAnalysis        bool                      // Draw the analysis overlays: ownership, candidate moves and tenuki shading
+	showTerritory       bool                      // Draw territory markers in scoring mode
+	filterTree          bool                      // Show only commented, marked, bookmarked and blunder nodes in the game tree
+	mainLinePolicy      string                    // How the main line of imported files is chosen; see mainLinePolicies
+	passEncoding        string                    // How passes are exported; see passEncodings
+	replayPolicy        string                    // What clicking an existing child move does; see replayPolicies
+	altClick            bool                      // Alt was held when the last click on the board started
+	backgroundReview    bool                      // Let the engine analyze unanalyzed nodes while the user is idle
+	reviewVisits        int                       // Visits the engine spends per node of the background review, 0 for the default
+	lastInteraction     time.Time                 // Last click, key press or navigation; the background review waits for a pause
+	showWinrateGraph    bool                      // Show the graph of Black's winrate along the current line
+	heuristicGraph      bool                      // Plot a rough heuristic winrate for nodes the engine has not analyzed
+	hoverEvaluation     bool                      // Show the engine's evaluation of the hovered move
+	hoverPoint          [2]int                    // Point under the pointer in play mode, (-1, -1) if none
+	pointerPosition     *fyne.Position            // Last pointer position over the board, nil while the pointer is outside
+	showHoverStone      bool                      // Preview the move under the pointer with a translucent stone
+	hoverOpacity        int                       // Opacity of the hover stone in percent, 0 for the default
+	hoverSize           int                       // Size of the hover stone in percent of a stone, 0 for the default
+	hoverEvaluationText *canvas.Text              // Evaluation drawn on the hover stone, nil if none
+	winrateGraph        *winrateGraph             // Graph of the winrates of the current line
+	treeThumbnail       fyne.CanvasObject         // Thumbnail overlay currently shown over the tree, nil if none
+	snapshots           []*positionSnapshot       // Named positions saved outside the game tree
+	snapshotList        *widget.List              // List of the open snapshots window, nil if closed
+	scoreSheetList      *widget.List              // List of the open score sheet window, nil if closed
+	scratchBar          *fyne.Container           // Commit and discard buttons of the scratch board
+	scoreSheetNodes     []*GameTreeNode           // Moves of the line shown in the score sheet
+	syncingScoreSheet   bool                      // The score sheet selection is being set to the current node
+	compareSplit        *container.Split          // Split between the board and the comparison board
+	mainSplit           *container.Split          // Split between the controls and the board, which sets the board's size
+	comparePane         *fyne.Container           // Comparison board with its own navigation, hidden unless in split view
+	compareImage        *canvas.Image             // Rendered position of the comparison board
+	compareLabel        *widget.Label             // Move number of the comparison board
+	boardTabs           []*boardTab               // Games hosted side by side; empty until a second board is opened
+	activeBoardTab      int                       // Index of the board tab shown in the window
+	boardTabBar         *container.AppTabs        // Tab bar selecting the hosted board
+	boardTabRow         fyne.CanvasObject         // Tab bar with the next board button, hidden with fewer than two boards
+	changingBoardTabs   bool                      // The tab bar is being changed by the program, not the user
+	countingErrors      []int                     // Errors of the stone counting trainer estimates, oldest first
+	showLadderPath      bool                      // Draw the moves read by the ladder tool
+	scoreAgreement      *fyne.Container           // Accept and dispute buttons shown in scoring mode
+	rulesetScores       *widget.Label             // Results of the count under each ruleset, shown in scoring mode
+	acceptButtons       map[string]*widget.Button // Accept button of each player
+	groupInfoTip        fyne.CanvasObject         // Group info overlay shown while Shift is held over a stone, nil if none
+	showLegality        bool                      // Draw illegal points of each color and true eyes
+	tenukiFinder        bool                      // Shade the largest open areas, where a move elsewhere might go
+	superko             bool                      // Forbid any move repeating an earlier position of the current line
+	atariWarnings       bool                      // Warn when a human move leaves one of the mover's groups in atari
 }
 
-func (r *resizingContainerRenderer) Layout(size fyne.Size) {
-	if r.container.content.Visible() {
-		r.container.content.Resize(size)
-	}
-	if r.container.placeholder.Visible() {
-		r.container.placeholder.Resize(size)
-	}
+// The points each color may legally play on in a position
+type legalityMap struct {
+	black [][]bool
+	white [][]bool
 }
 
-func (r *resizingContainerRenderer) MinSize() fyne.Size {
-	minSize := fyne.NewSize(0, 0)
-	if r.container.content.Visible() {
-		minSize = minSize.Max(r.container.content.MinSize())
-	}
-	if r.container.placeholder.Visible() {
-		minSize = minSize.Max(r.container.placeholder.MinSize())
-	}
-	return minSize
+// The state of one game, kept apart from the window and the settings so board tabs can swap it as a whole
+type gameState struct {
+	sizeX           int
+	sizeY           int
+	currentNode     *GameTreeNode
+	rootNode        *GameTreeNode
+	nodeMap         map[string]*GameTreeNode
+	idCounter       int
+	komi            int
+	territoryMap    [][]string
+	gameInfo        map[string]string              // Game info root properties (PB, PW, EV, ...) of the current game
+	sgfPath         string                         // Path of the SGF file last imported or exported, empty if none
+	sgfFileContent  string                         // Content of sgfPath as last read or written, backed up when exported over
+	savedSGF        string                         // SGF of the game as last opened or saved, to tell whether it changed since
+	thumbnails      map[*GameTreeNode]*image.RGBA  // Cached position thumbnails for tree tooltips
+	timelineEvents  gameEvents                     // Events of the main line, found whenever the tree is rebuilt
+	matchRoot       *GameTreeNode                  // Root of the game last recorded in engineMatches, so it is recorded once
+	practicing      bool                           // The game is a practice game, whose result moves the practice level
+	match           *gameMatch                     // Match being played, nil outside match mode
+	touchCursor     *[2]int                        // Point of the touch cursor, nil if none
+	sequenceNext    int                            // Next number placed by the numbered sequence tool
+	sequenceNode    *GameTreeNode                  // Node the current numbered sequence was started on
+	viewCorner      *[2]int                        // First corner picked by the view tool, nil if none
+	insertTarget    *GameTreeNode                  // Node a move is being inserted before, nil unless in insertMove mode
+	scratchOrigin   *GameTreeNode                  // Node the scratch board was taken from, nil if not on the scratch board
+	compareNode     *GameTreeNode                  // Node shown on the comparison board
+	ladderPath      []Move                         // Moves of the last ladder read, first move first
+	ladderNode      *GameTreeNode                  // Node the ladder path was read on
+	semeaiFirst     *[2]int                        // First group picked by the capture race tool, nil if none
+	semeaiLiberties [3][][2]int                    // Outside liberties of the first and second group, then shared liberties
+	semeaiColors    [2]string                      // Colors of the first and second group of the capture race
+	semeaiNode      *GameTreeNode                  // Node the capture race liberties were counted on
+	endgameValues   map[[2]int]string              // Labels of the endgame points evaluated on endgameNode
+	endgameNode     *GameTreeNode                  // Node the endgame values were evaluated on
+	scoreAccepted   map[string]bool                // Players who accepted the dead stones of the current count
+	legalityCache   map[*GameTreeNode]*legalityMap // Legal points of positions already computed
+	positionHistory map[string]*GameTreeNode       // Latest node of each position on the line to historyNode
+	historyNode     *GameTreeNode                  // Node positionHistory was collected for
+	historyKey      string                         // Position of historyNode when it was collected
+	atariStones     [][2]int                       // Stones currently flagged by the atari warning
+	atariNode       *GameTreeNode                  // Node the atari warning was raised on
+	tutorialActive  bool                           // A tutorial lesson is loaded; clicks are checked against its main line
+	importWarnings  []string                       // Problems skipped while importing the current SGF file
 }
 
-func (r *resizingContainerRenderer) Refresh() {
-	canvas.Refresh(r.container)
+// A hosted game and its name in the tab bar
+type boardTab struct {
+	name      string
+	hostColor string    // Color the host plays on this board, empty if the host does not play
+	state     gameState // The game, stored while another board tab is shown
 }
 
-func (r *resizingContainerRenderer) BackgroundColor() color.Color {
-	return color.Transparent
+// A named copy of a board position, kept outside the game tree
+type positionSnapshot struct {
+	name       string
+	boardState [][]string
+	player     string // Player who moved last; the other player is to play
+	sizeX      int
+	sizeY      int
 }
 
-func (r *resizingContainerRenderer) Objects() []fyne.CanvasObject {
-	return []fyne.CanvasObject{r.container.content, r.container.placeholder}
+// Game info root properties editable in the Game Info dialog, in display order
+var gameInfoFields = []struct {
+	key   string
+	label string
+}{
+	{"GN", "Game Name"},
+	{"PB", "Black Player"},
+	{"BR", "Black Rank"},
+	{"PW", "White Player"},
+	{"WR", "White Rank"},
+	{"EV", "Event"},
+	{"RO", "Round"},
+	{"DT", "Date"},
+	{"PC", "Place"},
+	{"RU", "Rules"},
+	{"RE", "Result"},
+	{"TM", "Time Limit"},
+	{"OT", "Overtime"},
+	{"SO", "Source"},
+	{"AN", "Annotator"},
+	{"US", "User"},
+	{"CP", "Copyright"},
+	{"GC", "Game Comment"},
 }
 
-func (r *resizingContainerRenderer) Destroy() {}
+// Reports whether the SGF property is one of the game info properties
+func isGameInfoProperty(key string) bool {
+	for _, field := range gameInfoFields {
+		if field.key == key {
+			return true
+		}
+	}
+	return false
+}
 
-func main() {
-	a := app.NewWithID("com.nazgand.connectedgroupsgoban")
-	w := a.NewWindow("Connected Groups Goban Version " + version)
-	game := &Game{
-		window:    w,
-		mouseMode: "play",
-		nodeMap:   make(map[string]*GameTreeNode),
-		komi:      7.0,
-		gtpPath:   "/usr/games/leela_gtp",
-		gtpArgs:   "-g -p 931 --noponder",
-		gtpColor:  "W",
+// Returns a copy of the game info with empty values dropped
+func copyGameInfo(info map[string]string) map[string]string {
+	infoCopy := make(map[string]string)
+	for key, value := range info {
+		if value != "" {
+			infoCopy[key] = value
+		}
 	}
+	return infoCopy
+}
 
-	// Load configuration
-	err := game.loadConfig()
-	if err != nil {
-		// Handle error (e.g., file not found is acceptable)
-		fmt.Println("Could not load config:", err)
+// Shows a form with one entry per game info property and passes the edited values to onSave
+func (g *Game) showGameInfoForm(title string, info map[string]string, onSave func(map[string]string)) {
+	entries := make(map[string]*widget.Entry)
+	formItems := []*widget.FormItem{}
+	for _, field := range gameInfoFields {
+		entry := widget.NewEntry()
+		entry.SetText(info[field.key])
+		entries[field.key] = entry
+		formItems = append(formItems, widget.NewFormItem(field.label, entry))
 	}
+	infoDialog := dialog.NewForm(title, "OK", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+		edited := make(map[string]string)
+		for key, entry := range entries {
+			edited[key] = strings.TrimSpace(entry.Text)
+		}
+		onSave(copyGameInfo(edited))
+	}, g.window)
+	infoDialog.Resize(fyne.NewSize(450, 600))
+	infoDialog.Show()
+}
 
-	w.Canvas().SetOnTypedKey(game.handleKeyEvent)
+// Shows the Game Info dialog for the current game
+func (g *Game) showGameInfoDialog() {
+	g.showGameInfoForm("Game Info", g.gameInfo, func(info map[string]string) {
+		g.gameInfo = info
+		g.updateGameNotes()
+	})
+}
 
-	// Create scoring status label
-	game.scoringStatus = widget.NewLabel("Not in scoring mode.")
+// Shows the dialog for the game info template applied to new games and exports
+func (g *Game) showGameInfoDefaultsDialog() {
+	g.showGameInfoForm("Game Info Defaults", g.gameInfoDefaults, func(info map[string]string) {
+		g.gameInfoDefaults = info
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
+		}
+	})
+}
 
-	// Create comment entry with placeholder
-	game.commentEntry = widget.NewMultiLineEntry()
-	game.commentEntry.SetPlaceHolder("Current move comment")
+// Shows the notes of the game in the game notes panel, unless they are already shown
+func (g *Game) updateGameNotes() {
+	if g.gameNotesEntry != nil && g.gameNotesEntry.Text != g.gameInfo["GC"] {
+		g.gameNotesEntry.SetText(g.gameInfo["GC"])
+	}
+}
 
-	// Attach a listener to update the current node's comment when the textbox changes
-	game.commentEntry.OnChanged = func(content string) {
-		if game.currentNode != nil {
-			game.currentNode.Comment = content
+// Chooses colors as players do at the board: the first player grabs a handful of white stones and the second
+// guesses odd or even. A right guess takes Black. The players and the outcome are written to the game info.
+func (g *Game) showNigiriDialog() {
+	holderEntry := widget.NewEntry()
+	holderEntry.SetText(g.gameInfo["PW"])
+	holderEntry.SetPlaceHolder("Player grabbing white stones")
+	guesserEntry := widget.NewEntry()
+	guesserEntry.SetText(g.gameInfo["PB"])
+	guesserEntry.SetPlaceHolder("Player guessing")
+	guessSelect := widget.NewRadioGroup([]string{"Odd (one black stone)", "Even (two black stones)"}, nil)
+	guessSelect.SetSelected("Odd (one black stone)")
+	items := []*widget.FormItem{
+		widget.NewFormItem("Grabs Stones", holderEntry),
+		widget.NewFormItem("Guesses", guesserEntry),
+		widget.NewFormItem("Guess", guessSelect),
+	}
+	dialog.ShowForm("Nigiri", "Reveal", "Cancel", items, func(ok bool) {
+		if !ok {
+			return
 		}
-	}
+		holder, guesser := strings.TrimSpace(holderEntry.Text), strings.TrimSpace(guesserEntry.Text)
+		if holder == "" {
+			holder = "Player 1"
+		}
+		if guesser == "" {
+			guesser = "Player 2"
+		}
+		handful := 10 + rand.Intn(21)
+		guessedOdd := strings.HasPrefix(guessSelect.Selected, "Odd")
+		parity, guess := "even", "even"
+		if handful%2 == 1 {
+			parity = "odd"
+		}
+		if guessedOdd {
+			guess = "odd"
+		}
+		blackPlayer, whitePlayer := guesser, holder
+		if guess != parity {
+			blackPlayer, whitePlayer = holder, guesser
+		}
+		outcome := fmt.Sprintf("Nigiri: %s grabbed %d stones (%s), %s guessed %s. %s takes Black.", holder, handful, parity, guesser, guess, blackPlayer)
+		g.gameInfo["PB"] = blackPlayer
+		g.gameInfo["PW"] = whitePlayer
+		if notes := strings.TrimSpace(g.gameInfo["GC"]); notes != "" {
+			g.gameInfo["GC"] = notes + "\n" + outcome
+		} else {
+			g.gameInfo["GC"] = outcome
+		}
+		g.updateGameNotes()
+		g.scoringStatus.SetText(outcome)
+		dialog.ShowInformation("Nigiri", fmt.Sprintf("%s\n\nBlack: %s\nWhite: %s", outcome, blackPlayer, whitePlayer), g.window)
+	}, g.window)
+}
 
-	// Create board canvas and related containers
-	background := canvas.NewRectangle(gobanColor)
-	inputLayer := newInputLayer(game)
-	game.gridContainer = container.NewWithoutLayout()
+// Dates and players in file names such as "2024-05-03_Lee-vs-Park.sgf" or "20240503 Lee vs Park.sgf"
+var (
+	filenameDatePattern    = regexp.MustCompile(`(\d{4})-?(\d{2})-?(\d{2})`)
+	filenamePlayersPattern = regexp.MustCompile(`(?i)^(.+?)[ _-]+vs\.?[ _-]+(.+)$`)
+)
+
+// Reads the date and the players, Black first, from the name of a game file; parts not found are empty
+func parseGameFilename(path string) (date, playerBlack, playerWhite string) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if match := filenameDatePattern.FindStringSubmatchIndex(name); match != nil {
+		parsed, err := time.Parse("2006-01-02", name[match[2]:match[3]]+"-"+name[match[4]:match[5]]+"-"+name[match[6]:match[7]])
+		if err == nil {
+			date = parsed.Format("2006-01-02")
+			name = name[:match[0]] + " " + name[match[1]:]
+		}
+	}
+	name = strings.Trim(name, " _-.")
+	if match := filenamePlayersPattern.FindStringSubmatch(name); match != nil {
+		playerBlack = strings.TrimSpace(strings.ReplaceAll(match[1], "_", " "))
+		playerWhite = strings.TrimSpace(strings.ReplaceAll(match[2], "_", " "))
+	}
+	return date, playerBlack, playerWhite
+}
+
+// Offers to fill the date and players the game info lacks from the name of the file it was opened from
+func (g *Game) offerFilenameGameInfo(path string) {
+	date, playerBlack, playerWhite := parseGameFilename(path)
+	proposed := map[string]string{}
+	for key, value := range map[string]string{"DT": date, "PB": playerBlack, "PW": playerWhite} {
+		if value != "" && g.gameInfo[key] == "" {
+			proposed[key] = value
+		}
+	}
+	if len(proposed) == 0 {
+		return
+	}
+	preview := []string{fmt.Sprintf("The file name %s suggests:", filepath.Base(path))}
+	for _, field := range gameInfoFields {
+		if value, ok := proposed[field.key]; ok {
+			preview = append(preview, fmt.Sprintf("%s: %s", field.label, value))
+		}
+	}
+	preview = append(preview, "", "Fill these into the game info?")
+	dialog.ShowConfirm("Game Info from File Name", strings.Join(preview, "\n"), func(ok bool) {
+		if !ok {
+			return
+		}
+		for key, value := range proposed {
+			g.gameInfo[key] = value
+		}
+		g.updateGameTreeUI()
+	}, g.window)
+}
+
+// Returns the game info to export, with properties missing from the game filled in from the defaults
+func (g *Game) exportGameInfo() map[string]string {
+	info := copyGameInfo(g.gameInfoDefaults)
+	for key, value := range g.gameInfo {
+		info[key] = value
+	}
+	return info
+}
+
+// Frequently used review phrases offered for quick insertion into comments
+var defaultCommentPhrases = []string{
+	"Overplay.",
+	"Joseki ends here.",
+	"Count before invading.",
+	"Slow move.",
+	"Good shape.",
+	"Bad shape.",
+	"Urgent before big.",
+	"Tenuki is possible here.",
+	"This group is now weak.",
+}
+
+// A multi-line entry for move comments that inserts quick phrases with Ctrl+1 to Ctrl+9
+// and underlines the words missing from the spelling dictionary
+type commentEntry struct {
+	widget.Entry
+	game *Game
+}
+
+func newCommentEntry(game *Game) *commentEntry {
+	e := &commentEntry{game: game}
+	e.MultiLine = true
+	e.Wrapping = fyne.TextWrap(fyne.TextTruncateClip)
+	e.ExtendBaseWidget(e)
+	return e
+}
+
+// Draws a commentEntry with the words missing from the spelling dictionary underlined
+type commentEntryRenderer struct {
+	fyne.WidgetRenderer
+	entry      *commentEntry
+	scroll     *container.Scroll // Scroll of the entry's text, nil if the entry does not scroll
+	underlines []*canvas.Line
+}
+
+func (e *commentEntry) CreateRenderer() fyne.WidgetRenderer {
+	r := &commentEntryRenderer{WidgetRenderer: e.Entry.CreateRenderer(), entry: e}
+	for _, object := range r.WidgetRenderer.Objects() {
+		if scroll, ok := object.(*container.Scroll); ok {
+			r.scroll = scroll
+			scroll.OnScrolled = func(fyne.Position) { r.layoutUnderlines() }
+		}
+	}
+	// The entry scrolls to the cursor before reporting that it moved
+	e.OnCursorChanged = r.layoutUnderlines
+	return r
+}
+
+func (r *commentEntryRenderer) Objects() []fyne.CanvasObject {
+	objects := append([]fyne.CanvasObject{}, r.WidgetRenderer.Objects()...)
+	for _, line := range r.underlines {
+		objects = append(objects, line)
+	}
+	return objects
+}
+
+func (r *commentEntryRenderer) Layout(size fyne.Size) {
+	r.WidgetRenderer.Layout(size)
+	r.layoutUnderlines()
+}
+
+func (r *commentEntryRenderer) Refresh() {
+	r.WidgetRenderer.Refresh()
+	r.layoutUnderlines()
+}
+
+// Underlines the misspelled words in the visible part of the entry. The text is laid out without wrapping,
+// one comment line per row, from the inner padding of the entry's scroll.
+func (r *commentEntryRenderer) layoutUnderlines() {
+	g := r.entry.game
+	var spans []spellingSpan
+	if g.underlineSpelling && r.scroll != nil && g.loadDictionary() == nil {
+		spans = misspelledSpans(r.entry.Text, g.dictionary)
+	}
+	th := r.entry.Theme()
+	textSize := th.Size(theme.SizeNameText)
+	innerPad := th.Size(theme.SizeNameInnerPadding)
+	border := th.Size(theme.SizeNameInputBorder)
+	lineHeight := fyne.MeasureText("M", textSize, r.entry.TextStyle).Height
+	rows := strings.Split(r.entry.Text, "\n")
+	shown := 0
+	for _, span := range spans {
+		view, offset := r.scroll.Size(), r.scroll.Offset
+		y := innerPad + float32(span.row+1)*lineHeight - offset.Y - 2
+		if y < border || y > border+view.Height {
+			continue
+		}
+		row := []rune(rows[span.row])
+		x1 := innerPad + fyne.MeasureText(string(row[:span.start]), textSize, r.entry.TextStyle).Width - offset.X
+		x2 := innerPad + fyne.MeasureText(string(row[:span.end]), textSize, r.entry.TextStyle).Width - offset.X
+		x1, x2 = max(x1, 0), min(x2, view.Width)
+		if x1 >= x2 {
+			continue
+		}
+		if shown == len(r.underlines) {
+			r.underlines = append(r.underlines, canvas.NewLine(th.Color(theme.ColorNameError, fyne.CurrentApp().Settings().ThemeVariant())))
+		}
+		line := r.underlines[shown]
+		line.Position1, line.Position2 = fyne.NewPos(x1, y), fyne.NewPos(x2, y)
+		line.Show()
+		line.Refresh()
+		shown++
+	}
+	for _, line := range r.underlines[shown:] {
+		line.Hide()
+	}
+}
+
+func (e *commentEntry) TypedRune(r rune) {
+	if !e.game.allowEdit(nil) {
+		return
+	}
+	e.Entry.TypedRune(r)
+}
+
+func (e *commentEntry) TypedKey(key *fyne.KeyEvent) {
+	if (key.Name == fyne.KeyBackspace || key.Name == fyne.KeyDelete || key.Name == fyne.KeyReturn || key.Name == fyne.KeyEnter) && !e.game.allowEdit(nil) {
+		return
+	}
+	e.Entry.TypedKey(key)
+}
+
+func (e *commentEntry) TypedShortcut(shortcut fyne.Shortcut) {
+	if _, isPaste := shortcut.(*fyne.ShortcutPaste); isPaste && !e.game.allowEdit(nil) {
+		return
+	}
+	if _, isCut := shortcut.(*fyne.ShortcutCut); isCut && !e.game.allowEdit(nil) {
+		return
+	}
+	if index, ok := phraseShortcutIndex(shortcut); ok {
+		e.game.insertCommentPhrase(index)
+		return
+	}
+	e.Entry.TypedShortcut(shortcut)
+}
+
+// Reports whether the game record was loaded from or saved to a locked file
+func (g *Game) isLocked() bool {
+	return g.sgfPath != "" && slices.Contains(g.lockedFiles, g.sgfPath)
+}
+
+// Locks the file of the game record against edits, or unlocks it
+func (g *Game) toggleFileLock() {
+	if g.sgfPath == "" {
+		g.showError(fmt.Errorf("the game record has no file to lock; open or export it first"))
+		return
+	}
+	if index := slices.Index(g.lockedFiles, g.sgfPath); index >= 0 {
+		g.lockedFiles = slices.Delete(g.lockedFiles, index, index+1)
+		g.scoringStatus.SetText(fmt.Sprintf("Unlocked %s", filepath.Base(g.sgfPath)))
+	} else {
+		g.lockedFiles = append(g.lockedFiles, g.sgfPath)
+		g.scoringStatus.SetText(fmt.Sprintf("Locked %s", filepath.Base(g.sgfPath)))
+	}
+	if err := g.saveConfig(); err != nil {
+		g.showError(fmt.Errorf("failed to save config: %v", err))
+	}
+}
+
+// An SGF file recently opened or saved, with the view of it to restore when it is opened again
+type recentFile struct {
+	Path        string  `json:"path"`
+	Node        string  `json:"node"`        // PathID of the node viewed
+	TreeOffsetX float32 `json:"treeOffsetX"` // Scroll position of the game tree
+	TreeOffsetY float32 `json:"treeOffsetY"`
+	BoardSplit  float64 `json:"boardSplit"` // Offset of the split between the controls and the board
+}
+
+// Files kept in the Open Recent menu
+const maxRecentFiles = 10
+
+// Creates the File menu item listing the recent files
+func (g *Game) newRecentFilesMenuItem() *fyne.MenuItem {
+	g.recentMenuItem = fyne.NewMenuItem("Open Recent", nil)
+	g.updateRecentFilesMenu()
+	return g.recentMenuItem
+}
+
+// Rebuilds the Open Recent submenu from recentFiles
+func (g *Game) updateRecentFilesMenu() {
+	if g.recentMenuItem == nil {
+		return
+	}
+	var items []*fyne.MenuItem
+	for _, recent := range g.recentFiles {
+		path := recent.Path
+		items = append(items, fyne.NewMenuItem(filepath.Base(path)+"  ("+filepath.Dir(path)+")", func() {
+			g.openRecentFile(path)
+		}))
+	}
+	if len(items) == 0 {
+		item := fyne.NewMenuItem("No Recent Files", nil)
+		item.Disabled = true
+		items = append(items, item)
+	}
+	g.recentMenuItem.ChildMenu = fyne.NewMenu("", items...)
+	if g.window.MainMenu() != nil {
+		g.window.MainMenu().Refresh()
+	}
+}
+
+// Records the file of the game record as the most recent one, with the node viewed, the scroll position
+// of the game tree and the board's size, so reopening it resumes the review where it was left
+func (g *Game) rememberFileView() {
+	if g.sgfPath == "" {
+		return
+	}
+	recent := recentFile{
+		Path:        g.sgfPath,
+		Node:        g.currentNode.PathID(),
+		TreeOffsetX: g.gameTreeContainer.Offset.X,
+		TreeOffsetY: g.gameTreeContainer.Offset.Y,
+	}
+	if g.mainSplit != nil {
+		recent.BoardSplit = g.mainSplit.Offset
+	}
+	g.recentFiles = slices.DeleteFunc(g.recentFiles, func(r recentFile) bool { return r.Path == g.sgfPath })
+	g.recentFiles = append([]recentFile{recent}, g.recentFiles[:min(len(g.recentFiles), maxRecentFiles-1)]...)
+	g.updateRecentFilesMenu()
+	if err := g.saveConfig(); err != nil {
+		g.showError(fmt.Errorf("failed to save config: %v", err))
+	}
+}
+
+// Returns to the view of the game record's file remembered by rememberFileView. Files without one, and nodes
+// the file no longer has, start at the node the import chose with the game tree scrolled to the bottom.
+func (g *Game) restoreFileView() {
+	index := slices.IndexFunc(g.recentFiles, func(r recentFile) bool { return r.Path == g.sgfPath })
+	if index < 0 {
+		g.gameTreeContainer.ScrollToBottom()
+		return
+	}
+	recent := g.recentFiles[index]
+	node := NodeAtPath(g.rootNode, recent.Node)
+	if node == nil {
+		g.gameTreeContainer.ScrollToBottom()
+		return
+	}
+	g.setCurrentNode(node)
+	g.redrawBoard()
+	g.updateGameTreeUI()
+	if g.mainSplit != nil && recent.BoardSplit > 0 {
+		g.mainSplit.SetOffset(recent.BoardSplit)
+	}
+	g.gameTreeContainer.Offset = fyne.NewPos(recent.TreeOffsetX, recent.TreeOffsetY)
+	g.gameTreeContainer.Refresh()
+}
+
+// Opens a file of the Open Recent menu at the view it was left at; files that have gone are dropped from the menu
+func (g *Game) openRecentFile(path string) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		g.recentFiles = slices.DeleteFunc(g.recentFiles, func(r recentFile) bool { return r.Path == path })
+		g.updateRecentFilesMenu()
+		if saveErr := g.saveConfig(); saveErr != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", saveErr))
+		}
+		g.showError(err)
+		return
+	}
+	g.rememberFileView()
+	if err := g.importGameRecord(string(content)); err != nil {
+		g.showError(err)
+		return
+	}
+	g.sgfPath = path
+	g.sgfFileContent = string(content)
+	g.markSaved()
+	g.updateAudioControls()
+	g.restoreFileView()
+	g.rememberFileView()
+}
+
+// Backups kept of a file exported over when none is configured
+const defaultBackupCount = 3
+
+// Returns the number of backups kept of a file exported over
+func (g *Game) backupsKept() int {
+	if g.backupCount == 0 {
+		return defaultBackupCount
+	}
+	return max(g.backupCount, 0)
+}
+
+// Returns the path of the nth backup of a file: file.sgf.bak1 is the newest
+func (g *Game) backupPath(path string, n int) string {
+	dir := filepath.Dir(path)
+	if g.backupFolder != "" {
+		dir = g.backupFolder
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s.bak%d", filepath.Base(path), n))
+}
+
+// Keeps content, the former content of the file at path, as its newest backup, shifting the older backups
+// down and dropping the oldest, so that exporting a pruned tree over a full review can be undone
+func (g *Game) backUpFile(path string, content string) error {
+	kept := g.backupsKept()
+	if kept == 0 || content == "" {
+		return nil
+	}
+	if err := os.Remove(g.backupPath(path, kept)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := kept - 1; n >= 1; n-- {
+		if err := os.Rename(g.backupPath(path, n), g.backupPath(path, n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.WriteFile(g.backupPath(path, 1), []byte(content), 0644)
+}
+
+// Shows the settings of the backups made when exporting over the game record's file: how many are kept and where
+func (g *Game) showBackupDialog() {
+	countOptions := []string{"Off"}
+	for n := 1; n <= 10; n++ {
+		countOptions = append(countOptions, strconv.Itoa(n))
+	}
+	countSelect := widget.NewSelect(countOptions, nil)
+	if kept := g.backupsKept(); kept == 0 {
+		countSelect.SetSelected("Off")
+	} else {
+		countSelect.SetSelected(strconv.Itoa(kept))
+	}
+	folder := g.backupFolder
+	folderLabel := widget.NewLabel("")
+	showFolder := func() {
+		if folder == "" {
+			folderLabel.SetText("Next to the file")
+		} else {
+			folderLabel.SetText(folder)
+		}
+	}
+	showFolder()
+	chooseButton := widget.NewButton("Choose Folder", func() {
+		dialog.ShowFolderOpen(func(chosen fyne.ListableURI, err error) {
+			if err != nil || chosen == nil {
+				return
+			}
+			folder = chosen.Path()
+			showFolder()
+		}, g.window)
+	})
+	besideButton := widget.NewButton("Next to the File", func() {
+		folder = ""
+		showFolder()
+	})
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Backups Kept", countSelect),
+		widget.NewFormItem("Folder", container.NewVBox(folderLabel, container.NewHBox(chooseButton, besideButton))),
+	}
+	dialog.ShowForm("Export Backups", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+		if countSelect.Selected == "Off" {
+			g.backupCount = -1
+		} else {
+			g.backupCount, _ = strconv.Atoi(countSelect.Selected)
+		}
+		g.backupFolder = folder
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
+		}
+	}, g.window)
+}
+
+// Reports whether an edit of the game record may go ahead. If the record is locked, it instead offers
+// to create a review copy, detached from the locked file, and then runs the edit if given.
+func (g *Game) allowEdit(edit func()) bool {
+	if !g.isLocked() {
+		return true
+	}
+	dialog.ShowConfirm("Locked Game Record", fmt.Sprintf("%s is locked. Create a review copy?", filepath.Base(g.sgfPath)), func(ok bool) {
+		if !ok {
+			return
+		}
+		g.sgfPath = ""
+		g.scoringStatus.SetText("Editing a review copy; export it to keep the changes.")
+		if edit != nil {
+			edit()
+		}
+	}, g.window)
+	return false
+}
+
+// Reports whether a click on (x, y) in the current mouse mode would change the game record
+func (g *Game) clickEdits(x, y int) bool {
+	switch g.mouseMode {
+	case "play":
+		if g.tutorialActive || g.engineThinking || g.currentNode.boardState[y][x] != empty {
+			return false
+		}
+		return g.childWithMove(x, y, goban.SwitchPlayer(g.currentNode.player)) == nil || !g.entersExistingMove()
+	case "score", "ladder", "semeai", "endgame", "view", "scratch":
+		return false
+	}
+	return true
+}
+
+// Returns the child of the current node for the move of the player at (x, y), nil if none
+func (g *Game) childWithMove(x, y int, player string) *GameTreeNode {
+	for _, child := range g.currentNode.children {
+		if child.move == [2]int{x, y} && child.player == player {
+			return child
+		}
+	}
+	return nil
+}
+
+// Returns the phrase index bound to a Ctrl+digit shortcut
+func phraseShortcutIndex(shortcut fyne.Shortcut) (int, bool) {
+	custom, ok := shortcut.(*desktop.CustomShortcut)
+	if !ok || custom.Modifier != fyne.KeyModifierShortcutDefault {
+		return 0, false
+	}
+	if custom.KeyName < fyne.Key1 || custom.KeyName > fyne.Key9 {
+		return 0, false
+	}
+	return int(custom.KeyName[0] - '1'), true
+}
+
+// Inserts the phrase with the given index at the comment cursor
+func (g *Game) insertCommentPhrase(index int) {
+	if index < 0 || index >= len(g.commentPhrases) {
+		return
+	}
+	phrase := g.commentPhrases[index]
+	entry := g.commentEntry
+	if lines := strings.Split(entry.Text, "\n"); entry.CursorRow < len(lines) {
+		line := []rune(lines[entry.CursorRow])
+		if column := min(entry.CursorColumn, len(line)); column > 0 && !unicode.IsSpace(line[column-1]) {
+			phrase = " " + phrase
+		}
+	}
+	// Inserted at the cursor as a single paste, so the comment changes and is spell checked once and one undo removes it
+	entry.TypedShortcut(&fyne.ShortcutPaste{Clipboard: textClipboard(phrase)})
+	g.window.Canvas().Focus(entry)
+}
+
+// A clipboard holding fixed text, for inserting the text into an entry as a paste
+type textClipboard string
+
+func (c textClipboard) Content() string {
+	return string(c)
+}
+
+func (c textClipboard) SetContent(string) {}
+
+// Reports whether the rune belongs to a word of a comment
+func isCommentWordRune(r rune) bool {
+	return unicode.IsLetter(r) || r == '\''
+}
+
+// Splits text into words made of letters and apostrophes
+func commentWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !isCommentWordRune(r)
+	})
+}
+
+// A word of a comment missing from the spelling dictionary: its line and its range of runes in the line
+type spellingSpan struct {
+	row   int
+	start int
+	end   int
+}
+
+// Finds the words of the text that are not in the dictionary, in reading order. Apostrophes around a word
+// are quotes rather than part of it.
+func misspelledSpans(text string, dictionary map[string]bool) []spellingSpan {
+	var spans []spellingSpan
+	for row, line := range strings.Split(text, "\n") {
+		runes := []rune(line)
+		for end := 0; end < len(runes); {
+			start := end
+			for end < len(runes) && isCommentWordRune(runes[end]) {
+				end++
+			}
+			if start == end {
+				end++
+				continue
+			}
+			wordStart, wordEnd := start, end
+			for wordStart < wordEnd && runes[wordStart] == '\'' {
+				wordStart++
+			}
+			for wordEnd > wordStart && runes[wordEnd-1] == '\'' {
+				wordEnd--
+			}
+			if word := strings.ToLower(string(runes[wordStart:wordEnd])); word != "" && !dictionary[word] {
+				spans = append(spans, spellingSpan{row, wordStart, wordEnd})
+			}
+		}
+	}
+	return spans
+}
+
+// Shows the word and character count of the comment
+func (g *Game) updateCommentStats(text string) {
+	g.commentStats.SetText(fmt.Sprintf("Words: %d  Characters: %d", len(commentWords(text)), utf8.RuneCountInString(text)))
+}
+
+// Loads the spelling dictionary, one word per line, if it has not been loaded yet
+func (g *Game) loadDictionary() error {
+	if g.dictionary != nil {
+		return nil
+	}
+	file, err := os.Open(g.dictionaryPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dictionary := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if word := strings.TrimSpace(scanner.Text()); word != "" {
+			dictionary[strings.ToLower(word)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	g.dictionary = dictionary
+	return nil
+}
+
+// Lists the words of the current comment that are not in the spelling dictionary
+func (g *Game) checkCommentSpelling() {
+	if err := g.loadDictionary(); err != nil {
+		g.showError(fmt.Errorf("failed to load spelling dictionary %s: %v", g.dictionaryPath, err))
+		return
+	}
+	seen := make(map[string]bool)
+	unknown := []string{}
+	for _, word := range commentWords(g.commentEntry.Text) {
+		word = strings.Trim(word, "'")
+		lower := strings.ToLower(word)
+		if lower == "" || seen[lower] || g.dictionary[lower] {
+			continue
+		}
+		seen[lower] = true
+		unknown = append(unknown, word)
+	}
+	if len(unknown) == 0 {
+		dialog.ShowInformation("Spelling", "No unknown words found.", g.window)
+		return
+	}
+	dialog.ShowInformation("Spelling", "Unknown words:\n"+strings.Join(unknown, "\n"), g.window)
+}
+
+// Creates the Underline Misspellings toggle, which also redraws the comment entry
+func (g *Game) newSpellingMenuItem() *fyne.MenuItem {
+	item := g.newToggleMenuItem("Underline Misspellings", &g.underlineSpelling)
+	toggle := item.Action
+	item.Action = func() {
+		toggle()
+		g.commentEntry.Refresh()
+	}
+	return item
+}
+
+// Lets the user pick the word list used for spell checking
+func (g *Game) chooseDictionary() {
+	fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		defer reader.Close()
+		g.dictionaryPath = reader.URI().Path()
+		g.dictionary = nil
+		g.commentEntry.Refresh()
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
+		}
+	}, g.window)
+	if listableURI, err := storage.ListerForURI(storage.NewFileURI(filepath.Dir(g.dictionaryPath))); err == nil {
+		fileDialog.SetLocation(listableURI)
+	}
+	fileDialog.Show()
+}
+
+// Shows a dialog for editing the quick-insert comment phrases, one per line
+func (g *Game) showCommentPhrasesDialog() {
+	phrasesEntry := widget.NewMultiLineEntry()
+	phrasesEntry.SetText(strings.Join(g.commentPhrases, "\n"))
+	phrasesEntry.SetMinRowsVisible(9)
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Phrases", phrasesEntry),
+	}
+	phrasesDialog := dialog.NewForm("Comment Phrases", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+		phrases := []string{}
+		for _, line := range strings.Split(phrasesEntry.Text, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				phrases = append(phrases, line)
+			}
+		}
+		g.commentPhrases = phrases
+		g.phraseSelect.Options = phrases
+		g.phraseSelect.Refresh()
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
+		}
+	}, g.window)
+	phrasesDialog.Resize(fyne.NewSize(400, 300))
+	phrasesDialog.Show()
+}
+
+func (g *Game) newGameTreeNode() *GameTreeNode {
+	g.idCounter++
+
+	newNode := &GameTreeNode{
+		boardState: goban.MakeEmptyBoard(g.sizeX, g.sizeY),
+		id:         fmt.Sprintf("%d", g.idCounter),
+		koX:        -1,
+		koY:        -1,
+	}
+
+	g.nodeMap[newNode.id] = newNode
+	return newNode
+}
+
+type GameTreeNode struct {
+	boardState         [][]string          // Current state of the board at this node; rows may be shared with relatives, so write through setPoint
+	move               [2]int              // Coordinates of the move ([x, y]); (-1, -1) represents a pass
+	player             string              // Player who made the move ("B" for Black, "W" for White)
+	children           []*GameTreeNode     // Child nodes representing subsequent moves
+	parent             *GameTreeNode       // Parent node in the game tree
+	id                 string              // Unique identifier for the node
+	koX                int                 // X-coordinate for ko rule; -1 if not applicable
+	koY                int                 // Y-coordinate for ko rule; -1 if not applicable
+	Comment            string              // Optional comment for the move
+	audioNote          string              // Audio clip for the node (AUDIO property), relative to the SGF file unless absolute
+	variationColor     string              // Color tag of the variation starting at this node (VARCOLOR property), empty if none
+	conflict           bool                // The move became illegal when an earlier node was edited
+	analysis           *positionAnalysis   // Engine evaluation of the position, nil until analyzed
+	previews           map[[2]int]float64  // Black's winrate after moves evaluated by hovering, by point
+	moveTime           time.Time           // Wall-clock time the move was played in the client (MOVETIME property), zero if unknown
+	tags               []nodeTag           // Key/value metadata of the node (TAG properties)
+	otherProperties    map[string][]string // Properties this application does not interpret, written back verbatim on export
+	annotations        map[string]string   // Move and position annotations (TE, BM, IT, DO, GB, GW, DM, UC, HO) and their values
+	moveNumberOverride int                 // Move number set by the MN property, 0 if none
+	addedBlackStones   pointSet            // Coordinates of additional Black stones (AB properties)
+	addedWhiteStones   pointSet            // Coordinates of additional White stones (AW properties)
+	AE                 pointSet            // Coordinates of points made empty (AE properties)
+	CR                 pointSet            // Coordinates for circle annotations
+	SQ                 pointSet            // Coordinates for square annotations
+	TR                 pointSet            // Coordinates for triangle annotations
+	MA                 pointSet            // Coordinates for mark (X) annotations
+	LB                 pointLabels         // Labels for specific points on the board
+	DD                 pointSet            // Dimmed points (DD property); only meaningful if hasDD
+	VW                 pointSet            // Visible points (VW property); only meaningful if hasVW
+	hasDD              bool                // DD is set on this node; an empty DD undims inherited points
+	hasVW              bool                // VW is set on this node; an empty VW restores the whole board
+}
+
+// A set of board points; most nodes carry no markup, so sets stay nil until a point is added
+type pointSet map[[2]int]bool
+
+// Adds (x, y) to the set, or removes it if on is false, allocating the set on first use
+func (s *pointSet) set(x, y int, on bool) {
+	if !on {
+		delete(*s, [2]int{x, y})
+		return
+	}
+	if *s == nil {
+		*s = make(pointSet)
+	}
+	(*s)[[2]int{x, y}] = true
+}
+
+func (s pointSet) has(x, y int) bool {
+	return s[[2]int{x, y}]
+}
+
+func (s *pointSet) toggle(x, y int) {
+	s.set(x, y, !s.has(x, y))
+}
+
+// Returns the points in row-major order, so that SGF output is stable
+func (s pointSet) sorted() [][2]int {
+	points := make([][2]int, 0, len(s))
+	for point := range s {
+		points = append(points, point)
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i][1] < points[j][1] || (points[i][1] == points[j][1] && points[i][0] < points[j][0])
+	})
+	return points
+}
+
+// Labels of board points, nil until a label is set
+type pointLabels map[[2]int]string
+
+// Sets the label of (x, y); an empty label removes it
+func (l *pointLabels) set(x, y int, label string) {
+	if label == "" {
+		delete(*l, [2]int{x, y})
+		return
+	}
+	if *l == nil {
+		*l = make(pointLabels)
+	}
+	(*l)[[2]int{x, y}] = label
+}
+
+func (l pointLabels) at(x, y int) string {
+	return l[[2]int{x, y}]
+}
+
+// Returns the set with every point moved by f, nil if the set is nil
+func (s pointSet) mapped(f func(x, y int) (int, int)) pointSet {
+	if s == nil {
+		return nil
+	}
+	result := make(pointSet, len(s))
+	for point := range s {
+		x, y := f(point[0], point[1])
+		result[[2]int{x, y}] = true
+	}
+	return result
+}
+
+// Returns the labels with every point moved by f, nil if there are none
+func (l pointLabels) mapped(f func(x, y int) (int, int)) pointLabels {
+	if l == nil {
+		return nil
+	}
+	result := make(pointLabels, len(l))
+	for point, label := range l {
+		x, y := f(point[0], point[1])
+		result[[2]int{x, y}] = label
+	}
+	return result
+}
+
+// Sets a point of the board, copying its row first since rows are shared between parent and child nodes
+func (gtn *GameTreeNode) setPoint(x, y int, value string) {
+	gtn.boardState[y] = slices.Clone(gtn.boardState[y])
+	gtn.boardState[y][x] = value
+	gtn.validateKo()
+}
+
+// Clears the ko point once an edit has broken the ko shape: the stone of the node's move must still stand
+// alone with the ko point as its only liberty. Edits cannot create a ko, as only a capture does.
+func (gtn *GameTreeNode) validateKo() {
+	if gtn.koX < 0 {
+		return
+	}
+	x, y := gtn.move[0], gtn.move[1]
+	sizeY := len(gtn.boardState)
+	sizeX := len(gtn.boardState[0])
+	if x >= 0 && y >= 0 && x < sizeX && y < sizeY && gtn.boardState[y][x] == gtn.player && gtn.boardState[gtn.koY][gtn.koX] == empty {
+		stones, liberties := goban.GroupLiberties(gtn.boardState, x, y, sizeX, sizeY)
+		if len(stones) == 1 && len(liberties) == 1 {
+			return
+		}
+	}
+	gtn.koX, gtn.koY = -1, -1
+}
+
+// Replaces the rows of board equal to those of parentBoard with the parent's rows, so that a position
+// differing from its parent by a move and its captures only stores the few rows it changed
+func shareRows(board, parentBoard [][]string) [][]string {
+	if len(board) != len(parentBoard) {
+		return board
+	}
+	for y := range board {
+		if slices.Equal(board[y], parentBoard[y]) {
+			board[y] = parentBoard[y]
+		}
+	}
+	return board
+}
+
+func (gtn *GameTreeNode) addBlackStone(x, y int) {
+	if y >= 0 && y < len(gtn.boardState) && x >= 0 && x < len(gtn.boardState[y]) {
+		gtn.addedBlackStones.set(x, y, true)
+	}
+}
+
+func (gtn *GameTreeNode) hasAddedBlackStones() bool {
+	return len(gtn.addedBlackStones) > 0
+}
+
+func (gtn *GameTreeNode) addWhiteStone(x, y int) {
+	if y >= 0 && y < len(gtn.boardState) && x >= 0 && x < len(gtn.boardState[y]) {
+		gtn.addedWhiteStones.set(x, y, true)
+	}
+}
+
+func (gtn *GameTreeNode) hasAddedWhiteStones() bool {
+	return len(gtn.addedWhiteStones) > 0
+}
+
+// Reports whether the node carries any markup: shapes, labels, dimmed points or a view
+func (gtn *GameTreeNode) hasMarkup() bool {
+	return gtn.hasDD || gtn.hasVW || len(gtn.CR) > 0 || len(gtn.SQ) > 0 || len(gtn.TR) > 0 || len(gtn.MA) > 0 || len(gtn.LB) > 0
+}
+
+// Reports whether the filtered game tree shows the node: it is commented, marked, bookmarked or flagged as a blunder
+func (gtn *GameTreeNode) inTreeOutline() bool {
+	_, bookmarked := gtn.annotations["HO"]
+	_, blunder := gtn.annotations["BM"]
+	return gtn.Comment != "" || gtn.hasMarkup() || bookmarked || blunder
+}
+
+type ResizingContainer struct {
+	widget.BaseWidget
+	content     fyne.CanvasObject
+	placeholder fyne.CanvasObject
+	resizeTimer *time.Timer
+	mutex       sync.Mutex
+}
+
+func NewResizingContainer(content fyne.CanvasObject, placeholder fyne.CanvasObject) *ResizingContainer {
+	rc := &ResizingContainer{
+		content:     content,
+		placeholder: placeholder,
+	}
+	rc.ExtendBaseWidget(rc)
+	rc.placeholder.Hide() // Hide the placeholder initially
+	return rc
+}
+
+func (rc *ResizingContainer) CreateRenderer() fyne.WidgetRenderer {
+	return &resizingContainerRenderer{
+		container: rc,
+	}
+}
+
+func (rc *ResizingContainer) Resize(size fyne.Size) {
+	// Check if the size is different before proceeding
+	if rc.Size() == size {
+		return // Skip handling if the size has not changed
+	}
+	rc.BaseWidget.Resize(size)
+	rc.handleResize()
+}
+
+func (rc *ResizingContainer) handleResize() {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	if rc.resizeTimer != nil {
+		rc.resizeTimer.Stop()
+	}
+
+	rc.content.Hide()
+	rc.placeholder.Show()
+	rc.Refresh()
+
+	rc.resizeTimer = time.AfterFunc(39*time.Millisecond, func() {
+		rc.mutex.Lock()
+		defer rc.mutex.Unlock()
+		rc.placeholder.Hide()
+		rc.content.Show()
+		rc.Refresh()
+	})
+}
+
+type resizingContainerRenderer struct {
+	container *ResizingContainer
+}
+
+func (r *resizingContainerRenderer) Layout(size fyne.Size) {
+	if r.container.content.Visible() {
+		r.container.content.Resize(size)
+	}
+	if r.container.placeholder.Visible() {
+		r.container.placeholder.Resize(size)
+	}
+}
+
+func (r *resizingContainerRenderer) MinSize() fyne.Size {
+	minSize := fyne.NewSize(0, 0)
+	if r.container.content.Visible() {
+		minSize = minSize.Max(r.container.content.MinSize())
+	}
+	if r.container.placeholder.Visible() {
+		minSize = minSize.Max(r.container.placeholder.MinSize())
+	}
+	return minSize
+}
+
+func (r *resizingContainerRenderer) Refresh() {
+	canvas.Refresh(r.container)
+}
+
+func (r *resizingContainerRenderer) BackgroundColor() color.Color {
+	return color.Transparent
+}
+
+func (r *resizingContainerRenderer) Objects() []fyne.CanvasObject {
+	return []fyne.CanvasObject{r.container.content, r.container.placeholder}
+}
+
+func (r *resizingContainerRenderer) Destroy() {}
+
+func main() {
+	a := app.NewWithID("com.nazgand.connectedgroupsgoban")
+	w := a.NewWindow("Connected Groups Goban Version " + version)
+	game := &Game{
+		gameState: gameState{
+			nodeMap:      make(map[string]*GameTreeNode),
+			komi:         7.0,
+			sequenceNext: 1,
+		},
+		window:    w,
+		mouseMode: "play",
+		gtpPath:   "/usr/games/leela_gtp",
+		gtpArgs:   "-g -p 931 --noponder",
+		gtpColor:  "W",
+
+		toggleMenuItems: make(map[*fyne.MenuItem]*bool),
+		hoverPoint:      [2]int{-1, -1},
+
+		commentPhrases:    defaultCommentPhrases,
+		dictionaryPath:    "/usr/share/dict/words",
+		underlineSpelling: true,
+
+		showCommentMarkers: true,
+		showEventMarkers:   true,
+		showLabels:         true,
+		showShapes:         true,
+		showLastMove:       true,
+		showAnalysis:       true,
+		showTerritory:      true,
+		showLadderPath:     true,
+	}
+
+	// Load configuration
+	err := game.loadConfig()
+	if err != nil {
+		// Handle error (e.g., file not found is acceptable)
+		fmt.Println("Could not load config:", err)
+	}
+
+	w.Canvas().SetOnTypedKey(game.handleKeyEvent)
+
+	// Create scoring status label
+	game.scoringStatus = widget.NewLabel("Not in scoring mode.")
+	game.acceptButtons = map[string]*widget.Button{
+		black: widget.NewButton("Black Accepts", func() { game.acceptScore(black) }),
+		white: widget.NewButton("White Accepts", func() { game.acceptScore(white) }),
+	}
+	game.rulesetScores = widget.NewLabel("")
+	game.scoreAgreement = container.NewVBox(
+		game.rulesetScores,
+		container.NewHBox(
+			game.acceptButtons[black],
+			game.acceptButtons[white],
+			widget.NewButton("Dispute", func() { game.disputeScore() }),
+		),
+	)
+	game.scoreAgreement.Hide()
+	game.scratchBar = container.NewHBox(
+		widget.NewButton("Commit as Variation", func() { game.commitScratchBoard() }),
+		widget.NewButton("Discard Scratch Board", func() { game.discardScratchBoard() }),
+	)
+	game.scratchBar.Hide()
+	game.confirmMoveButton = widget.NewButton("Confirm Move", func() { game.confirmTouchMove() })
+	game.confirmMoveButton.Importance = widget.HighImportance
+	game.confirmMoveButton.Hide()
+
+	// Create comment entry with placeholder
+	game.commentEntry = newCommentEntry(game)
+	game.commentEntry.SetPlaceHolder("Current move comment")
+
+	// Create the quick-insert phrase dropdown, also reachable with Ctrl+1 to Ctrl+9
+	game.phraseSelect = widget.NewSelect(game.commentPhrases, nil)
+	game.phraseSelect.PlaceHolder = "Insert phrase"
+	game.phraseSelect.OnChanged = func(phrase string) {
+		if phrase == "" {
+			return
+		}
+		for i, p := range game.commentPhrases {
+			if p == phrase {
+				game.insertCommentPhrase(i)
+				break
+			}
+		}
+		game.phraseSelect.ClearSelected()
+	}
+	// Create the read-only Markdown rendering of the comment and its toggle button
+	game.commentPreview = widget.NewRichTextFromMarkdown("")
+	game.commentPreview.Wrapping = fyne.TextWrapWord
+	game.commentPreview.Hide()
+	var previewButton *widget.Button
+	previewButton = widget.NewButton("Preview", func() {
+		game.toggleCommentPreview()
+		if game.previewingComment {
+			previewButton.SetText("Edit")
+		} else {
+			previewButton.SetText("Preview")
+		}
+	})
+
+	for key := fyne.Key1; key <= fyne.Key9; key = fyne.KeyName(rune(key[0]) + 1) {
+		shortcut := &desktop.CustomShortcut{KeyName: key, Modifier: fyne.KeyModifierShortcutDefault}
+		w.Canvas().AddShortcut(shortcut, func(s fyne.Shortcut) {
+			if index, ok := phraseShortcutIndex(s); ok {
+				game.insertCommentPhrase(index)
+			}
+		})
+	}
+
+	// Create the audio note controls
+	game.audioLabel = widget.NewLabel("No audio note")
+	game.playAudioButton = widget.NewButton("Play", func() { game.playAudioNote() })
+	game.removeAudioButton = widget.NewButton("Remove", func() {
+		game.currentNode.audioNote = ""
+		game.updateAudioControls()
+	})
+	game.recordAudioButton = widget.NewButton("Record", func() { game.toggleAudioRecording() })
+	game.playAudioButton.Disable()
+	game.removeAudioButton.Disable()
+	audioControls := container.NewHBox(
+		widget.NewButton("Attach Audio", func() { game.attachAudioNote() }),
+		game.recordAudioButton,
+		game.playAudioButton,
+		game.removeAudioButton,
+		game.audioLabel,
+	)
+
+	// Create the live word and character count of the comment
+	game.commentStats = widget.NewLabel("")
+	game.updateCommentStats("")
+	game.tagsLabel = widget.NewLabel("")
+	game.tagsLabel.Wrapping = fyne.TextWrapWord
+	game.koLabel = widget.NewLabel("")
+	game.koLabel.Hide()
+	game.databaseLabel = widget.NewLabel("")
+	game.databaseLabel.Hide()
+	game.gameNotesEntry = widget.NewMultiLineEntry()
+	game.gameNotesEntry.Wrapping = fyne.TextWrapWord
+	game.gameNotesEntry.SetPlaceHolder("Overall impressions of the game")
+	game.gameNotesEntry.SetMinRowsVisible(4)
+	game.gameNotesEntry.OnChanged = func(notes string) {
+		if notes == "" {
+			delete(game.gameInfo, "GC")
+		} else {
+			game.gameInfo["GC"] = notes
+		}
+	}
+	gameNotes := widget.NewAccordion(widget.NewAccordionItem("Game Notes", game.gameNotesEntry))
+	game.winrateGraph = newWinrateGraph(game)
+
+	// Attach a listener to update the current node's comment when the textbox changes
+	game.commentEntry.OnChanged = func(content string) {
+		if game.currentNode != nil {
+			game.currentNode.Comment = content
+		}
+		game.updateCommentStats(content)
+	}
+
+	// Create board canvas and related containers
+	background := canvas.NewRectangle(gobanColor)
+	var inputLayer fyne.CanvasObject = newInputLayer(game)
+	if fyne.CurrentDevice().IsMobile() {
+		inputLayer = newSwipeInputLayer(game)
+	}
+	game.gridContainer = container.NewWithoutLayout()
+
+	game.boardCanvas = container.NewStack(
+		background,
+		game.gridContainer,
+		inputLayer,
+	)
+
+	game.sizeX = 19
+	game.sizeY = 19
+
+	// Initialize the board here
+	game.initializeBoard()
+	game.redrawBoard()
+
+	// Initialize the game tree
+	game.gameTreeContainer = container.NewScroll(nil)
+	game.updateGameTreeUI()
+
+	// Define the "File" menu
+	fileMenu := fyne.NewMenu("File",
+		fyne.NewMenuItem("Import SGF", func() {
+			fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+				if err != nil || reader == nil {
+					return
+				}
+				defer reader.Close()
+				sgfContent, err := io.ReadAll(reader)
+				if err != nil {
+					game.showError(err)
+					return
+				}
+				game.rememberFileView()
+				err = game.importGameRecord(string(sgfContent))
+				if err != nil {
+					game.showError(err)
+					return
+				}
+				game.sgfPath = reader.URI().Path()
+				game.sgfFileContent = string(sgfContent)
+				game.markSaved()
+				game.updateAudioControls()
+				game.restoreFileView()
+				game.rememberFileView()
+				game.offerFilenameGameInfo(game.sgfPath)
+			}, game.window)
+			fileDialog.SetFilter(storage.NewExtensionFileFilter(recordExtensions()))
+			fileDialog.Show()
+		}),
+		game.newRecentFilesMenuItem(),
+		fyne.NewMenuItem("Open from Clipboard", func() {
+			game.importFromClipboard()
+		}),
+		fyne.NewMenuItem("Open from URL", func() {
+			game.showOpenURLDialog()
+		}),
+		fyne.NewMenuItem("Lock/Unlock Game Record", func() {
+			game.toggleFileLock()
+		}),
+		fyne.NewMenuItem("Import Board Photo", func() {
+			game.importBoardPhoto(a)
+		}),
+		fyne.NewMenuItem("Enter Diagram", func() {
+			game.showDiagramEntryDialog()
+		}),
+		fyne.NewMenuItem("Validate SGF Round Trip", func() {
+			game.validateSGFRoundTrip()
+		}),
+		fyne.NewMenuItem("Main Line After Import", func() {
+			game.showMainLinePolicyDialog()
+		}),
+		fyne.NewMenuItem("Pass Encoding", func() {
+			game.showPassEncodingDialog()
+		}),
+		fyne.NewMenuItem("Export Backups", func() {
+			game.showBackupDialog()
+		}),
+		fyne.NewMenuItem("Position Database Folder", func() {
+			game.chooseDatabaseFolder()
+		}),
+		fyne.NewMenuItem("Export SGF", func() {
+			game.showExportDialog("game.sgf")
+		}),
+		fyne.NewMenuItem("Export Go XML", func() {
+			if game.sizeX != game.sizeY || game.sizeX > 25 {
+				game.showError(fmt.Errorf("Go XML only describes square boards of up to 25 lines"))
+				return
+			}
+			game.showExportDialog("game.xml")
+		}),
+		fyne.NewMenuItem("Export Review Summary", func() {
+			game.exportReviewSummary()
+		}),
+		fyne.NewMenuItem("Export Handout Diagrams", func() {
+			game.showHandoutExportDialog()
+		}),
+		fyne.NewMenuItem("Copy Board Image (I)", func() {
+			game.copyBoardImage()
+		}),
+		fyne.NewMenuItem("Board Image Scale", func() {
+			game.showClipboardImageScaleDialog()
+		}),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Follow Live Broadcast", func() {
+			game.showBroadcastDialog()
+		}),
+		fyne.NewMenuItem("Stop Following Broadcast", func() {
+			game.stopBroadcast()
+		}),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Export Settings", func() {
+			game.exportSettings()
+		}),
+		fyne.NewMenuItem("Import Settings", func() {
+			game.importSettings()
+		}),
+	)
+
+	gameMenu := fyne.NewMenu("Game",
+		fyne.NewMenuItem("Fresh Board", func() {
+			// Define the input entries outside the dialog
+			widthEntry := widget.NewEntry()
+			widthEntry.SetPlaceHolder(fmt.Sprintf("(1-%d)", maxBoardSize))
+			widthEntry.SetText(strconv.Itoa(game.sizeX))
+			heightEntry := widget.NewEntry()
+			heightEntry.SetPlaceHolder(fmt.Sprintf("(1-%d)", maxBoardSize))
+			heightEntry.SetText(strconv.Itoa(game.sizeY))
+
+			// Create form items
+			formItems := []*widget.FormItem{
+				widget.NewFormItem("Width", widthEntry),
+				widget.NewFormItem("Height", heightEntry),
+			}
+
+			// Create a custom dialog to input board width and height
+			boardSizeDialog := dialog.NewForm(
+				"Fresh Board",
+				"OK",
+				"Cancel",
+				formItems,
+				func(ok bool) {
+					if !ok {
+						return
+					}
+					widthStr := widthEntry.Text
+					heightStr := heightEntry.Text
+					x, errX := strconv.Atoi(widthStr)
+					y, errY := strconv.Atoi(heightStr)
+					if errX != nil || errY != nil || x < 1 || y < 1 || x > maxBoardSize || y > maxBoardSize {
+						game.showError(fmt.Errorf("invalid board size (must be between 1 and %d)", maxBoardSize))
+						return
+					}
+					game.stopBroadcast()
+					game.sizeX = x
+					game.sizeY = y
+					game.initializeBoard()
+					game.redrawBoard()
+					game.updateGameTreeUI() // Refresh the game tree UI
+				},
+				game.window,
+			)
+
+			// Optionally, handle dialog close if needed
+			boardSizeDialog.SetOnClosed(func() {
+				// You can perform additional actions here when the dialog is closed
+			})
+
+			// Show the dialog
+			boardSizeDialog.Show()
+		}),
+		fyne.NewMenuItem("New Board Tab", func() {
+			game.showNewBoardTabDialog()
+		}),
+		fyne.NewMenuItem("Start Match", func() {
+			game.showStartMatchDialog()
+		}),
+		fyne.NewMenuItem("Finish Match Game", func() {
+			game.finishMatchGame()
+		}),
+		fyne.NewMenuItem("Match Score", func() {
+			game.showMatchScore()
+		}),
+		fyne.NewMenuItem("Close Board Tab", func() {
+			game.closeBoardTab()
+		}),
+		fyne.NewMenuItem("Next Board Needing My Move", func() {
+			game.nextBoardNeedingHost()
+		}),
+		fyne.NewMenuItem("Jump to Middlegame", func() {
+			game.jumpToPhase(false)
+		}),
+		fyne.NewMenuItem("Jump to Endgame", func() {
+			game.jumpToPhase(true)
+		}),
+		fyne.NewMenuItem("Ko Fights", func() {
+			game.showKoFights()
+		}),
+		fyne.NewMenuItem("Pass", func() {
+			game.handlePass()
+		}),
+		fyne.NewMenuItem("Set Komi", func() {
+			game.showSetKomiDialog()
+		}),
+		fyne.NewMenuItem("Game Info", func() {
+			game.showGameInfoDialog()
+		}),
+		fyne.NewMenuItem("Nigiri", func() {
+			game.showNigiriDialog()
+		}),
+		fyne.NewMenuItem("Game Info Defaults", func() {
+			game.showGameInfoDefaultsDialog()
+		}),
+		fyne.NewMenuItem("Delete Node", func() {
+			game.confirmDeleteBranch(game.currentNode)
+		}),
+		fyne.NewMenuItem("Make Main Variation", func() {
+			game.promoteToMainLine(game.currentNode)
+		}),
+		fyne.NewMenuItem("Insert Move Before", func() {
+			game.startInsertMoveBefore()
+		}),
+		fyne.NewMenuItem("Insert Setup Node Before", func() {
+			game.insertSetupNodeBefore()
+		}),
+		fyne.NewMenuItem("Swap With Previous Move", func() {
+			game.swapWithPreviousMove()
+		}),
+		fyne.NewMenuItem("Swap Colors", func() {
+			game.swapColors()
+		}),
+		fyne.NewMenuItem("Board Shape", func() {
+			game.showBoardShapeDialog()
+		}),
+		fyne.NewMenuItem("Transform Game", func() {
+			game.showTransformGameDialog()
+		}),
+		fyne.NewMenuItem("Clean Up Tree", func() {
+			game.normalizeTree()
+		}),
+		fyne.NewMenuItem("Variation Color", func() {
+			game.showVariationColorDialog()
+		}),
+		fyne.NewMenuItem("Transcribe Game", func() {
+			game.showTranscriptionWindow(a)
+		}),
+		fyne.NewMenuItem("Scratch Board", func() {
+			game.startScratchBoard()
+		}),
+		fyne.NewMenuItem("Board Gestures", func() {
+			game.showGesturesDialog()
+		}),
+		fyne.NewMenuItem("Keyboard Shortcuts", func() {
+			game.showKeyBindingsDialog()
+		}),
+		game.newSuperkoMenuItem(),
+		fyne.NewMenuItem("Replaying Existing Moves", func() {
+			game.showReplayPolicyDialog()
+		}),
+		fyne.NewMenuItem("Annotate Node", func() {
+			game.showAnnotationDialog()
+		}),
+		fyne.NewMenuItem("Toggle Bookmark", func() {
+			game.toggleBookmark()
+		}),
+		fyne.NewMenuItem("Node Tags", func() {
+			game.showNodeTagsDialog()
+		}),
+		fyne.NewMenuItem("Find Nodes", func() {
+			game.showFindDialog()
+		}),
+		fyne.NewMenuItem("Comment Phrases", func() {
+			game.showCommentPhrasesDialog()
+		}),
+		fyne.NewMenuItem("Stone Counting Trainer", func() {
+			game.showCountingTrainer(a)
+		}),
+		fyne.NewMenuItem("Check Comment Spelling", func() {
+			game.checkCommentSpelling()
+		}),
+		game.newSpellingMenuItem(),
+		fyne.NewMenuItem("Spelling Dictionary", func() {
+			game.chooseDictionary()
+		}),
+	)
+
+	// Define the "MouseMode" menu
+	mouseModeMenu := fyne.NewMenu("MouseMode",
+		fyne.NewMenuItem("Play", func() { game.setMouseMode("play") }),
+		fyne.NewMenuItem("Score", func() { game.setMouseMode("score") }),
+		fyne.NewMenuItem("Set Label", func() { game.setMouseMode("label") }),
+		fyne.NewMenuItem("Add Black", func() { game.setMouseMode("addBlack") }),
+		fyne.NewMenuItem("Add White", func() { game.setMouseMode("addWhite") }),
+		fyne.NewMenuItem("Add Empty", func() { game.setMouseMode("addEmpty") }),
+		fyne.NewMenuItem("Toggle Circle", func() { game.setMouseMode("circle") }),
+		fyne.NewMenuItem("Toggle Square", func() { game.setMouseMode("square") }),
+		fyne.NewMenuItem("Toggle Triangle", func() { game.setMouseMode("triangle") }),
+		fyne.NewMenuItem("Toggle X Mark", func() { game.setMouseMode("xMark") }),
+		fyne.NewMenuItem("Toggle Dim", func() { game.setMouseMode("dim") }),
+		fyne.NewMenuItem("Set View", func() { game.setMouseMode("view") }),
+		fyne.NewMenuItem("Clear Dim", func() { game.clearDimmedPoints() }),
+		fyne.NewMenuItem("Clear View", func() { game.clearView() }),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Numbered Sequence", func() { game.setMouseMode("sequence") }),
+		fyne.NewMenuItem("Restart Sequence", func() { game.restartSequence() }),
+		game.newToggleMenuItem("Sequence Auto Restart", &game.sequenceAutoRestart),
+		game.newToggleMenuItem("Sequence Color Alternation", &game.sequenceAlternate),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Read Ladder", func() { game.setMouseMode("ladder") }),
+		fyne.NewMenuItem("Count Capture Race", func() { game.setMouseMode("semeai") }),
+		fyne.NewMenuItem("Endgame Values", func() { game.setMouseMode("endgame") }),
+	)
+
+	// Define the "View" menu
+	viewMenu := fyne.NewMenu("View",
+		game.newToggleMenuItem("Comment Markers", &game.showCommentMarkers),
+		game.newToggleMenuItem("Event Markers", &game.showEventMarkers),
+		game.newToggleMenuItem("Labels", &game.showLabels),
+		game.newToggleMenuItem("Shapes", &game.showShapes),
+		game.newToggleMenuItem("Move Numbers", &game.showMoveNumbers),
+		game.newToggleMenuItem("Liberty Counts", &game.showLiberties),
+		game.newToggleMenuItem("Last Move", &game.showLastMove),
+		game.newToggleMenuItem("Analysis Overlays", &game.showAnalysis),
+		game.newToggleMenuItem("Territory", &game.showTerritory),
+		game.newToggleMenuItem("Ladder Path", &game.showLadderPath),
+		game.newToggleMenuItem("Illegal Points and Eyes", &game.showLegality),
+		game.newToggleMenuItem("Tenuki Finder", &game.tenukiFinder),
+		game.newToggleMenuItem("Atari Warnings", &game.atariWarnings),
+		game.newToggleMenuItem("Hover Stone", &game.showHoverStone),
+		fyne.NewMenuItem("Hover Stone Appearance", func() {
+			game.showHoverStoneDialog()
+		}),
+		game.newToggleMenuItem("Capture Preview", &game.capturePreview),
+		game.newToggleMenuItem("Touch Input", &game.touchInput),
+		game.newToggleMenuItem("Winrate Graph", &game.showWinrateGraph),
+		game.newToggleMenuItem("Heuristic Winrate Without Engine", &game.heuristicGraph),
+		fyne.NewMenuItemSeparator(),
+		game.newToggleMenuItem("Only Annotated Nodes in Tree", &game.filterTree),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Spectator Window", func() {
+			game.showSpectatorWindow(a)
+		}),
+		fyne.NewMenuItem("Snapshots", func() {
+			game.showSnapshotsWindow(a)
+		}),
+		fyne.NewMenuItem("Split View", func() {
+			game.toggleSplitView()
+		}),
+		fyne.NewMenuItem("Score Sheet", func() {
+			game.showScoreSheetWindow(a)
+		}),
+	)
+
+	// Define the "Engine" menu
+	engineMenu := fyne.NewMenu("Engine",
+		fyne.NewMenuItem("Settings", func() {
+			game.showEngineSettings()
+		}),
+		fyne.NewMenuItem("Attach Engine", func() {
+			game.attachEngine()
+		}),
+		fyne.NewMenuItem("Detach Engine", func() {
+			game.detachEngine()
+		}),
+		fyne.NewMenuItem("Test Engine", func() {
+			game.testEngine()
+		}),
+		game.newAnalyzeMenuItem(),
+		fyne.NewMenuItem("Start Self Play", func() {
+			game.stopAnalysis()
+			game.gtpColor = "Both"
+			if game.gtpCmd == nil {
+				game.attachEngine()
+			}
+			game.startSelfPlay()
+		}),
+		fyne.NewMenuItem("Stop Self Play", func() {
+			game.stopSelfPlay()
+		}),
+		fyne.NewMenuItem("Cancel Engine Move", func() {
+			game.cancelEngineMove()
+		}),
+		fyne.NewMenuItemSeparator(),
+		game.newToggleMenuItem("Background Review", &game.backgroundReview),
+		game.newToggleMenuItem("Evaluate Hovered Moves", &game.hoverEvaluation),
+		fyne.NewMenuItem("Review Visit Budget", func() {
+			game.showReviewVisitsDialog()
+		}),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Match Statistics", func() {
+			game.showMatchStatistics()
+		}),
+		fyne.NewMenuItem("Start Practice Game", func() {
+			game.startPracticeGame()
+		}),
+		fyne.NewMenuItem("Practice Ladder", func() {
+			game.showPracticeLadder()
+		}),
+	)
+
+	// Define the "Help" menu with one item per tutorial lesson
+	tutorialItems := []*fyne.MenuItem{}
+	for _, lesson := range tutorialLessons {
+		tutorialItems = append(tutorialItems, fyne.NewMenuItem(lesson.title, func() {
+			game.startTutorial(lesson)
+		}))
+	}
+	tutorialMenuItem := fyne.NewMenuItem("Tutorial", nil)
+	tutorialMenuItem.ChildMenu = fyne.NewMenu("", tutorialItems...)
+	helpMenu := fyne.NewMenu("Help", tutorialMenuItem)
+
+	// Update the main menu to include the new "Engine" menu
+	mainMenu := fyne.NewMainMenu(
+		fileMenu,
+		gameMenu,
+		mouseModeMenu,
+		viewMenu,
+		engineMenu, // Add Engine menu here
+		helpMenu,
+	)
+	w.SetMainMenu(mainMenu)
+	game.registerKeyCommands(mainMenu)
+	game.setKeyShortcuts(true)
+
+	// Wrap the gameTreeContainer in a ResizingContainer
+	resizingLabel := widget.NewLabel("Resizing")
+	gameTreeResizingContainer := NewResizingContainer(game.gameTreeContainer, resizingLabel)
+
+	// Layout for controls
+	controls := container.NewVSplit(
+		container.NewVBox(
+			game.scoringStatus,
+			game.koLabel,
+			game.databaseLabel,
+			game.winrateGraph,
+			game.scoreAgreement,
+			game.confirmMoveButton,
+			game.scratchBar,
+			container.NewBorder(nil, nil, nil, previewButton, game.phraseSelect),
+			container.NewStack(game.commentEntry, game.commentPreview),
+			game.commentStats,
+			game.tagsLabel,
+			audioControls,
+			gameNotes,
+		),
+		gameTreeResizingContainer, // Use the ResizingContainer here
+	)
+	controls.SetOffset(0)
+
+	// Main layout with split view
+	game.comparePane = game.newComparePane()
+	game.comparePane.Hide()
+	game.compareSplit = container.NewHSplit(game.boardCanvas, game.comparePane)
+	game.compareSplit.SetOffset(1)
+	content := container.NewHSplit(
+		controls,
+		game.compareSplit,
+	)
+	content.SetOffset(0)
+	game.mainSplit = content
+
+	// Tabs of the simultaneous games, shown once a second board is opened
+	game.boardTabBar = container.NewAppTabs()
+	game.boardTabBar.OnSelected = func(*container.TabItem) {
+		if !game.changingBoardTabs {
+			game.switchBoardTab(game.boardTabBar.SelectedIndex())
+		}
+	}
+	game.boardTabRow = container.NewBorder(nil, nil, nil,
+		widget.NewButton("Next Board Needing My Move", func() { game.nextBoardNeedingHost() }),
+		game.boardTabBar,
+	)
+	game.boardTabRow.Hide()
+	w.SetContent(container.NewBorder(game.boardTabRow, nil, nil, nil, content))
+	w.Resize(fyne.NewSize(800, 600))
+	w.SetOnClosed(game.rememberFileView)
+	w.Show()
+	go game.runBackgroundReview()
+	if game.databaseFolder != "" {
+		game.indexDatabase()
+	}
+
+	a.Run()
+}
+
+// Creates a checkable menu item that flips the given setting, then redraws and saves the configuration
+func (g *Game) newToggleMenuItem(label string, value *bool) *fyne.MenuItem {
+	item := fyne.NewMenuItem(label, nil)
+	item.Checked = *value
+	g.toggleMenuItems[item] = value
+	item.Action = func() {
+		*value = !*value
+		item.Checked = *value
+		g.window.MainMenu().Refresh()
+		g.redrawBoard()
+		g.updateGameTreeUI()
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
+		}
+	}
+	return item
+}
+
+func (g *Game) deleteCurrentNode() {
+	g.deleteNode(g.currentNode)
+}
+
+// Deletes the node and everything after it; deleting the root resets the game.
+// If the current node is among those deleted, the node's parent becomes current.
+func (g *Game) deleteNode(node *GameTreeNode) {
+	if g.broadcasting {
+		return // The broadcast record is read-only
+	}
+	if !g.allowEdit(func() { g.deleteNode(node) }) {
+		return
+	}
+	if node == g.rootNode {
+		// Deleting the root node, reset the game
+		g.initializeBoard()
+		g.updateGameTreeUI()
+		g.updateCommentTextbox()
+		g.redrawBoard()
+		return
+	}
+	parent := node.parent
+	if parent == nil {
+		return
+	}
+	parent.children = slices.DeleteFunc(parent.children, func(child *GameTreeNode) bool { return child == node })
+	deletedCurrent := false
+	node.Walk(func(n *GameTreeNode) bool {
+		delete(g.nodeMap, n.id)
+		delete(g.thumbnails, n)
+		delete(g.legalityCache, n)
+		deletedCurrent = deletedCurrent || n == g.currentNode
+		return true
+	})
+	if deletedCurrent {
+		g.setCurrentNode(parent)
+	}
+	g.updateGameTreeUI()
+	g.updateCommentTextbox()
+	g.redrawBoard()
+}
+
+// Makes the line through the node the main line: the node and each node above it become the first child
+// of their parent, so exports and replays follow it
+func (g *Game) promoteToMainLine(node *GameTreeNode) {
+	if g.broadcasting {
+		return // The broadcast record is read-only
+	}
+	if !g.allowEdit(func() { g.promoteToMainLine(node) }) {
+		return
+	}
+	moved := 0
+	for n := node; n.parent != nil; n = n.parent {
+		if i := slices.Index(n.parent.children, n); i > 0 {
+			n.parent.children = slices.Insert(slices.Delete(n.parent.children, i, i+1), 0, n)
+			moved++
+		}
+	}
+	if moved == 0 {
+		g.scoringStatus.SetText("The node is already on the main line.")
+		return
+	}
+	g.scoringStatus.SetText(fmt.Sprintf("Made the line through move %d the main line.", node.displayMoveNumber()))
+	g.updateGameTreeUI()
+	g.redrawBoard()
+}
+
+// Asks before deleting the node and the branch below it, telling how many nodes would go
+func (g *Game) confirmDeleteBranch(node *GameTreeNode) {
+	if g.broadcasting {
+		return
+	}
+	count := 0
+	node.Walk(func(*GameTreeNode) bool {
+		count++
+		return true
+	})
+	var message string
+	switch {
+	case node == g.rootNode:
+		message = "Delete the whole game tree and start a new game?"
+	case count == 1:
+		message = fmt.Sprintf("Delete move %d?", node.displayMoveNumber())
+	default:
+		message = fmt.Sprintf("Delete move %d and the %d nodes of the branch after it?", node.displayMoveNumber(), count-1)
+	}
+	dialog.ShowConfirm("Delete Branch", message, func(ok bool) {
+		if ok {
+			g.deleteNode(node)
+		}
+	}, g.window)
+}
+
+// Computes the position of node from its parent's: its move with captures, then its setup stones.
+// Returns false when the move is illegal there. The stone is placed anyway so that the line can still be read,
+// unless its point is now occupied: the stone standing there is kept and the move is left off the board.
+func (g *Game) recomputeNodeBoard(node *GameTreeNode) bool {
+	parent := node.parent
+	board := goban.CopyBoard(parent.boardState)
+	node.koX, node.koY = -1, -1
+	legal := true
+	if node.hasMove() && node.move[0] >= 0 {
+		x, y := node.move[0], node.move[1]
+		legal = goban.IsLegal(board, x, y, node.player, parent.koX, parent.koY, g.sizeX, g.sizeY)
+		if board[y][x] == empty {
+			board[y][x] = node.player
+			node.koX, node.koY = goban.CaptureStones(board, x, y, node.player, g.sizeX, g.sizeY)
+		}
+	}
+	for point := range node.addedBlackStones {
+		board[point[1]][point[0]] = black
+	}
+	for point := range node.addedWhiteStones {
+		board[point[1]][point[0]] = white
+	}
+	for point := range node.AE {
+		board[point[1]][point[0]] = empty
+	}
+	node.boardState = shareRows(board, parent.boardState)
+	node.conflict = !legal
+	node.analysis, node.previews = nil, nil // Evaluations of the old position
+	delete(g.thumbnails, node)
+	delete(g.legalityCache, node)
+	g.historyNode = nil // The line to the current node may run through node
+	return legal
+}
+
+// Computes the positions of all descendants of node again after node was edited, replaying their moves
+// onto the edited position. Returns the nodes whose moves are no longer legal, in tree order; they stay
+// marked as conflicts in the tree and on the board until a later edit makes them legal again.
+func (g *Game) recomputeFollowing(node *GameTreeNode) []*GameTreeNode {
+	var conflicts []*GameTreeNode
+	node.Walk(func(descendant *GameTreeNode) bool {
+		if descendant != node && !g.recomputeNodeBoard(descendant) {
+			conflicts = append(conflicts, descendant)
+		}
+		return true
+	})
+	return conflicts
+}
+
+// Lists the moves an edit made illegal, which were kept on the board where their point is still free
+func (g *Game) reportConflicts(conflicts []*GameTreeNode) {
+	if len(conflicts) == 0 {
+		return
+	}
+	var lines []string
+	for i, node := range conflicts {
+		if i == 10 {
+			lines = append(lines, fmt.Sprintf("... and %d more", len(conflicts)-10))
+			break
+		}
+		line := fmt.Sprintf("Move %d, %s at %s (node %s)", node.displayMoveNumber(), playerName(node.player), g.pointName(node.move[0], node.move[1]), node.PathID())
+		if node.parent.boardState[node.move[1]][node.move[0]] != empty {
+			line += ": the point is occupied, so the move is left off the board"
+		}
+		lines = append(lines, line)
+	}
+	dialog.ShowInformation("Conflicting Moves", "These later moves are no longer legal after the edit and were placed anyway where their point is free:\n"+strings.Join(lines, "\n"), g.window)
+}
+
+// Shows the position before the current node and waits for the click of the move to insert there
+func (g *Game) startInsertMoveBefore() {
+	if g.broadcasting || g.currentNode.parent == nil {
+		return
+	}
+	target := g.currentNode
+	g.setMouseMode("insertMove")
+	g.insertTarget = target
+	g.setCurrentNode(target.parent)
+	g.redrawBoard()
+	g.updateGameTreeUI()
+	g.scoringStatus.SetText(fmt.Sprintf("Click the move %s plays before move %d.", playerName(goban.SwitchPlayer(target.parent.player)), target.displayMoveNumber()))
+}
+
+// Inserts the move at (x, y) between the current node and the node chosen by startInsertMoveBefore
+func (g *Game) insertMoveBefore(x, y int) {
+	target := g.insertTarget
+	if target == nil || target.parent != g.currentNode {
+		g.setMouseMode("play")
+		return
+	}
+	player := goban.SwitchPlayer(g.currentNode.player)
+	if !g.isMoveLegal(x, y, player) {
+		g.explainIllegalMove(x, y, player)
+		return
+	}
+	node, conflicts := g.insertMoveNode(target, x, y, player)
+	g.setMouseMode("play")
+	g.scoringStatus.SetText("")
+	g.setCurrentNode(node)
+	g.redrawBoard()
+	g.updateGameTreeUI()
+	g.reportConflicts(conflicts)
+}
+
+// Inserts a node with the move of player at (x, y) before target and replays the moves after it.
+// Returns the new node and the later moves the insertion made illegal.
+func (g *Game) insertMoveNode(target *GameTreeNode, x, y int, player string) (*GameTreeNode, []*GameTreeNode) {
+	node := g.insertNodeBefore(target)
+	node.player = player
+	node.move = [2]int{x, y}
+	g.recomputeNodeBoard(node)
+	return node, g.recomputeFollowing(node)
+}
+
+// Inserts a node without a move before the current node, to take setup stones that the following moves build on
+func (g *Game) insertSetupNodeBefore() {
+	if g.broadcasting || g.currentNode.parent == nil || !g.allowEdit(g.insertSetupNodeBefore) {
+		return
+	}
+	node := g.insertNodeBefore(g.currentNode)
+	node.player = node.parent.player
+	node.move = [2]int{93, 93} // No move
+	g.recomputeNodeBoard(node)
+	g.setCurrentNode(node)
+	g.redrawBoard()
+	g.updateGameTreeUI()
+}
+
+// Creates a node between target and its parent, taking target's place among the parent's children
+func (g *Game) insertNodeBefore(target *GameTreeNode) *GameTreeNode {
+	parent := target.parent
+	node := g.newGameTreeNode()
+	node.parent = parent
+	node.children = []*GameTreeNode{target}
+	parent.children[slices.Index(parent.children, target)] = node
+	target.parent = node
+	return node
+}
+
+// Exchanges the current move with the move before it, with comments and markup travelling with their moves.
+// Refused when either ordering would be illegal or the previous move has other variations.
+func (g *Game) swapWithPreviousMove() {
+	if g.broadcasting || !g.allowEdit(g.swapWithPreviousMove) {
+		return
+	}
+	previous := g.currentNode.parent
+	conflicts, err := g.swapMoves(g.currentNode)
+	if err != nil {
+		g.showError(err)
+		return
+	}
+	g.setCurrentNode(previous)
+	g.redrawBoard()
+	g.updateGameTreeUI()
+	g.reportConflicts(conflicts)
+}
+
+// Exchanges the move of current with the move before it and replays the moves after them. Returns the later
+// moves the exchange made illegal, or an error with the tree unchanged when the moves cannot be swapped.
+func (g *Game) swapMoves(current *GameTreeNode) ([]*GameTreeNode, error) {
+	previous := current.parent
+	if !current.hasMove() || previous == nil || !previous.hasMove() {
+		return nil, fmt.Errorf("the current node and the node before it must both be moves")
+	}
+	if len(previous.children) > 1 {
+		return nil, fmt.Errorf("move %d has other variations, so the order cannot be swapped", previous.displayMoveNumber())
+	}
+	grandparent := previous.parent
+	relink := func(upper, lower *GameTreeNode) {
+		grandparent.children[slices.Index(grandparent.children, lower)] = upper
+		upper.parent = grandparent
+		lower.children = upper.children
+		for _, child := range lower.children {
+			child.parent = lower
+		}
+		upper.children = []*GameTreeNode{lower}
+		lower.parent = upper
+	}
+	relink(current, previous)
+	if !g.recomputeNodeBoard(current) || !g.recomputeNodeBoard(previous) {
+		relink(previous, current)
+		g.recomputeNodeBoard(previous)
+		g.recomputeNodeBoard(current)
+		return nil, fmt.Errorf("the moves cannot be swapped: one of them would be illegal in the other order")
+	}
+	return g.recomputeFollowing(previous), nil
+}
+
+// Pairs of SGF properties kept as other properties that name Black and White, exchanged when the colors are swapped
+var colorPropertyPairs = [][2]string{{"BL", "WL"}, {"OB", "OW"}, {"TB", "TW"}, {"BT", "WT"}}
+
+// Exchanges the values stored under keys a and b, leaving a missing key missing
+func swapKeys[V any](values map[string]V, a, b string) {
+	valueA, hasA := values[a]
+	valueB, hasB := values[b]
+	delete(values, a)
+	delete(values, b)
+	if hasA {
+		values[b] = valueA
+	}
+	if hasB {
+		values[a] = valueB
+	}
+}
+
+// Exchanges Black and White throughout the game, for records entered with the colors reversed:
+// stones, moves, setup stones, the player to move, GB/GW and time properties, players and the result
+func (g *Game) swapColors() {
+	if g.broadcasting || !g.allowEdit(g.swapColors) {
+		return
+	}
+	g.swapTreeColors()
+
+	g.redrawBoard()
+	g.updateGameTreeUI()
+	if g.gtpCmd != nil {
+		if err := g.updateEngineBoardState(); err != nil {
+			g.showError(err)
+			g.detachEngine()
+		}
+	}
+}
+
+// Exchanges Black and White in every node and in the game info, without redrawing
+func (g *Game) swapTreeColors() {
+	root := g.rootNode
+	board := goban.CopyBoard(root.boardState)
+	for _, row := range board {
+		for x, stone := range row {
+			if isStone(stone) {
+				row[x] = goban.SwitchPlayer(stone)
+			}
+		}
+	}
+	root.boardState = board
+	root.Walk(func(node *GameTreeNode) bool {
+		if node.player != "" {
+			node.player = goban.SwitchPlayer(node.player)
+		}
+		node.addedBlackStones, node.addedWhiteStones = node.addedWhiteStones, node.addedBlackStones
+		swapKeys(node.annotations, "GB", "GW")
+		for _, pair := range colorPropertyPairs {
+			swapKeys(node.otherProperties, pair[0], pair[1])
+		}
+		return true
+	})
+	g.recomputeFollowing(root)
+	root.analysis, root.previews = nil, nil
+	delete(g.thumbnails, root)
+	delete(g.legalityCache, root)
+
+	for _, pair := range [][2]string{{"PB", "PW"}, {"BR", "WR"}} {
+		swapKeys(g.gameInfo, pair[0], pair[1])
+	}
+	if result := g.gameInfo["RE"]; strings.HasPrefix(result, "B+") {
+		g.gameInfo["RE"] = "W+" + result[2:]
+	} else if strings.HasPrefix(result, "W+") {
+		g.gameInfo["RE"] = "B+" + result[2:]
+	}
+}
+
+// Reports whether point holds a stone, rather than being empty or missing from the board
+func isStone(point string) bool {
+	return point == black || point == white
+}
+
+// Returns the points missing from an irregular board
+func blockedPoints(board [][]string) pointSet {
+	var points pointSet
+	for y, row := range board {
+		for x, point := range row {
+			if point == blocked {
+				points.set(x, y, true)
+			}
+		}
+	}
+	return points
+}
+
+// Edits which points of the starting position are missing, for boards of irregular shape.
+// The shape is a grid with one line per row: '#' for a missing point, '.' for an open one, and B or W
+// for the setup stones, which cannot be changed here.
+func (g *Game) showBoardShapeDialog() {
+	if g.broadcasting || !g.allowEdit(g.showBoardShapeDialog) {
+		return
+	}
+	root := g.rootNode
+	var rows []string
+	for _, row := range root.boardState {
+		rows = append(rows, strings.Join(row, ""))
+	}
+	entry := widget.NewMultiLineEntry()
+	entry.TextStyle = fyne.TextStyle{Monospace: true}
+	entry.SetText(strings.Join(rows, "\n"))
+	entry.SetMinRowsVisible(min(g.sizeY, 19))
+	hint := widget.NewLabel("'#' removes a point from the board, '.' restores it. Stones stay where they are.")
+	hint.Wrapping = fyne.TextWrapWord
+	content := container.NewBorder(hint, nil, nil, nil, entry)
+	shapeDialog := dialog.NewCustomConfirm("Board Shape", "Apply", "Cancel", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(entry.Text, "\r", "")), "\n")
+		if len(lines) != g.sizeY {
+			g.showError(fmt.Errorf("the shape has %d rows, but the board has %d", len(lines), g.sizeY))
+			return
+		}
+		for y, line := range lines {
+			line = strings.TrimSpace(line)
+			if len(line) != g.sizeX {
+				g.showError(fmt.Errorf("row %d has %d points, but the board has %d columns", y+1, len(line), g.sizeX))
+				return
+			}
+			for x, c := range line {
+				point := string(c)
+				if current := root.boardState[y][x]; isStone(current) != isStone(point) || (isStone(point) && point != current) {
+					g.showError(fmt.Errorf("the point %s holds %q instead of %q; edit stones on the board instead", g.pointName(x, y), point, current))
+					return
+				}
+				if point != empty && point != blocked && !isStone(point) {
+					g.showError(fmt.Errorf("the point %s is %q; use '#', '.', B or W", g.pointName(x, y), point))
+					return
+				}
+			}
+			lines[y] = line
+		}
+		changed := false
+		for y, line := range lines {
+			for x, c := range line {
+				if point := string(c); point != root.boardState[y][x] {
+					root.setPoint(x, y, point)
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			return
+		}
+		g.reportConflicts(g.recomputeFollowing(root))
+		root.analysis, root.previews = nil, nil
+		delete(g.thumbnails, root)
+		delete(g.legalityCache, root)
+		g.redrawBoard()
+		g.updateGameTreeUI()
+		if g.gtpCmd != nil {
+			if err := g.updateEngineBoardState(); err != nil {
+				g.showError(err)
+				g.detachEngine()
+			}
+		}
+	}, g.window)
+	shapeDialog.Resize(fyne.NewSize(500, 500))
+	shapeDialog.Show()
+}
+
+// Symmetries of the board other than the identity; the last four exchange rows and columns,
+// so they only apply to square boards
+var gameTransforms = []string{"rotate 180°", "mirror left-right", "mirror top-bottom",
+	"rotate 90° clockwise", "rotate 90° counterclockwise", "mirror along the main diagonal", "mirror along the other diagonal"}
+
+// Maps (x, y) by the symmetry of a sizeX by sizeY board named by transform
+func transformPoint(x, y, sizeX, sizeY int, transform string) (int, int) {
+	switch transform {
+	case "rotate 180°":
+		return sizeX - 1 - x, sizeY - 1 - y
+	case "mirror left-right":
+		return sizeX - 1 - x, y
+	case "mirror top-bottom":
+		return x, sizeY - 1 - y
+	case "rotate 90° clockwise":
+		return sizeY - 1 - y, x
+	case "rotate 90° counterclockwise":
+		return y, sizeX - 1 - x
+	case "mirror along the main diagonal":
+		return y, x
+	case "mirror along the other diagonal":
+		return sizeY - 1 - y, sizeX - 1 - x
+	}
+	return x, y
+}
+
+// Other properties holding points, or pairs of points such as arrows and compressed lists
+var pointValuedProperties = []string{"TB", "TW", "AR", "LN"}
+
+// Asks for a symmetry and applies it to the whole game
+func (g *Game) showTransformGameDialog() {
+	transforms := gameTransforms
+	if g.sizeX != g.sizeY {
+		transforms = gameTransforms[:3]
+	}
+	transformSelect := widget.NewSelect(transforms, nil)
+	transformSelect.SetSelected(transforms[0])
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Symmetry", transformSelect),
+	}
+	if g.sizeX != g.sizeY {
+		formItems = append(formItems, widget.NewFormItem("", widget.NewLabel("Rotations by 90° and diagonal mirrors need a square board.")))
+	}
+	transformDialog := dialog.NewForm("Transform Game", "OK", "Cancel", formItems, func(ok bool) {
+		if ok {
+			g.transformGame(transformSelect.Selected)
+		}
+	}, g.window)
+	transformDialog.Show()
+}
+
+// Applies a symmetry of the board to every move, setup stone and markup of the game
+func (g *Game) transformGame(transform string) {
+	if g.broadcasting || !g.allowEdit(func() { g.transformGame(transform) }) {
+		return
+	}
+	g.transformTree(transform)
+
+	g.redrawBoard()
+	g.updateGameTreeUI()
+	if g.gtpCmd != nil {
+		if err := g.updateEngineBoardState(); err != nil {
+			g.showError(err)
+			g.detachEngine()
+		}
+	}
+}
+
+// Maps the positions, moves, setup stones and markup of every node by the symmetry, without redrawing
+func (g *Game) transformTree(transform string) {
+	sizeX, sizeY := g.sizeX, g.sizeY
+	mapPoint := func(x, y int) (int, int) {
+		return transformPoint(x, y, sizeX, sizeY, transform)
+	}
+	root := g.rootNode
+	board := goban.MakeEmptyBoard(sizeX, sizeY)
+	for y, row := range root.boardState {
+		for x, stone := range row {
+			nx, ny := mapPoint(x, y)
+			board[ny][nx] = stone
+		}
+	}
+	root.boardState = board
+	root.Walk(func(node *GameTreeNode) bool {
+		if x, y := node.move[0], node.move[1]; node.hasMove() && x >= 0 {
+			nx, ny := mapPoint(x, y)
+			node.move = [2]int{nx, ny}
+		}
+		node.addedBlackStones = node.addedBlackStones.mapped(mapPoint)
+		node.addedWhiteStones = node.addedWhiteStones.mapped(mapPoint)
+		node.AE = node.AE.mapped(mapPoint)
+		node.CR = node.CR.mapped(mapPoint)
+		node.SQ = node.SQ.mapped(mapPoint)
+		node.TR = node.TR.mapped(mapPoint)
+		node.MA = node.MA.mapped(mapPoint)
+		node.LB = node.LB.mapped(mapPoint)
+		node.DD = node.DD.mapped(mapPoint)
+		node.VW = node.VW.mapped(mapPoint)
+		for _, key := range pointValuedProperties {
+			for i, value := range node.otherProperties[key] {
+				parts := strings.Split(value, ":")
+				for j, part := range parts {
+					if xy := goban.ParseSGFPoint(part); xy != nil && xy[0] < sizeX && xy[1] < sizeY {
+						parts[j] = goban.SGFPoint(mapPoint(xy[0], xy[1]))
+					}
+				}
+				node.otherProperties[key][i] = strings.Join(parts, ":")
+			}
+		}
+		return true
+	})
+	g.recomputeFollowing(root)
+	root.analysis, root.previews = nil, nil
+	g.thumbnails = make(map[*GameTreeNode]*image.RGBA)
+	g.legalityCache = make(map[*GameTreeNode]*legalityMap)
+	g.ladderNode, g.semeaiNode, g.endgameNode, g.atariNode = nil, nil, nil, nil
+}
+
+// Reports whether the node carries nothing but setup stones and the player to move: no move, comment, markup or metadata
+func (gtn *GameTreeNode) isSetupOnly() bool {
+	return gtn.parent != nil && !gtn.hasMove() && gtn.Comment == "" && !gtn.hasMarkup() && gtn.audioNote == "" &&
+		gtn.variationColor == "" && len(gtn.tags) == 0 && len(gtn.otherProperties) == 0 && len(gtn.annotations) == 0 &&
+		gtn.moveNumberOverride == 0
+}
+
+// Reports whether removing the node would lose nothing: it is setup-only without setup stones and keeps the player to move
+func (gtn *GameTreeNode) isEmptyNode() bool {
+	return gtn.isSetupOnly() && len(gtn.addedBlackStones) == 0 && len(gtn.addedWhiteStones) == 0 && len(gtn.AE) == 0 &&
+		gtn.player == gtn.parent.player
+}
+
+// Tidies the tree after long editing: removes empty nodes, folds a setup-only node into a preceding node
+// without a move, and numbers the nodes again from the root so that node IDs are compact
+func (g *Game) normalizeTree() {
+	if g.broadcasting || !g.allowEdit(g.normalizeTree) {
+		return
+	}
+	removed, merged := 0, 0
+	// Removes one empty child of node, its children taking its place in order; reports whether it found one
+	removeEmptyChild := func(node *GameTreeNode) bool {
+		for i, child := range node.children {
+			if !child.isEmptyNode() {
+				continue
+			}
+			node.children = slices.Replace(node.children, i, i+1, child.children...)
+			for _, grandchild := range child.children {
+				grandchild.parent = node
+			}
+			if g.currentNode == child {
+				g.currentNode = node
+			}
+			removed++
+			return true
+		}
+		return false
+	}
+	// Folds the only child of a node without a move into it if the child is setup-only; reports whether it did
+	mergeSetupChild := func(node *GameTreeNode) bool {
+		if node.parent == nil || node.hasMove() || len(node.children) != 1 || !node.children[0].isSetupOnly() {
+			return false
+		}
+		next := node.children[0]
+		for point := range next.addedBlackStones {
+			node.addedBlackStones.set(point[0], point[1], true)
+			node.addedWhiteStones.set(point[0], point[1], false)
+			node.AE.set(point[0], point[1], false)
+		}
+		for point := range next.addedWhiteStones {
+			node.addedWhiteStones.set(point[0], point[1], true)
+			node.addedBlackStones.set(point[0], point[1], false)
+			node.AE.set(point[0], point[1], false)
+		}
+		for point := range next.AE {
+			node.AE.set(point[0], point[1], true)
+			node.addedBlackStones.set(point[0], point[1], false)
+			node.addedWhiteStones.set(point[0], point[1], false)
+		}
+		node.player = next.player
+		node.boardState = next.boardState
+		node.children = next.children
+		for _, child := range node.children {
+			child.parent = node
+		}
+		if g.currentNode == next {
+			g.currentNode = node
+		}
+		merged++
+		return true
+	}
+	// The children of each node are tidied before the walk goes on to them
+	g.rootNode.Walk(func(node *GameTreeNode) bool {
+		for removeEmptyChild(node) || mergeSetupChild(node) {
+		}
+		return true
+	})
+
+	// Number the remaining nodes in tree order, as newGameTreeNode would for a freshly loaded file
+	g.nodeMap = make(map[string]*GameTreeNode)
+	g.idCounter = 1
+	g.rootNode.Walk(func(node *GameTreeNode) bool {
+		g.idCounter++
+		node.id = strconv.Itoa(g.idCounter)
+		g.nodeMap[node.id] = node
+		return true
+	})
+	g.thumbnails = make(map[*GameTreeNode]*image.RGBA)
+	g.legalityCache = make(map[*GameTreeNode]*legalityMap)
+
+	g.setCurrentNode(g.currentNode)
+	g.redrawBoard()
+	g.updateGameTreeUI()
+	dialog.ShowInformation("Clean Up Tree", fmt.Sprintf("Removed %d empty nodes and merged %d setup nodes; %d nodes remain.", removed, merged, len(g.nodeMap)), g.window)
+}
+
+// Runs the command bound to a key pressed without modifiers; combinations with modifiers are canvas shortcuts
+func (g *Game) handleKeyEvent(event *fyne.KeyEvent) {
+	g.lastInteraction = time.Now()
+	for _, command := range g.keyCommandNames {
+		if g.keyBinding(command) == string(event.Name) {
+			g.keyCommands[command]()
+			return
+		}
+	}
+}
+
+// Moves to the parent of the current node
+func (g *Game) previousMove() {
+	if g.currentNode.parent != nil {
+		g.setCurrentNode(g.currentNode.parent)
+		g.updateGameTreeUI()
+		g.redrawBoard()
+	}
+}
+
+// Moves to the first child of the current node
+func (g *Game) nextMove() {
+	if len(g.currentNode.children) > 0 {
+		g.setCurrentNode(g.currentNode.children[0])
+		g.updateGameTreeUI()
+		g.redrawBoard()
+	}
+}
+
+// Moves to the root of the game tree
+func (g *Game) firstMove() {
+	if g.currentNode != g.rootNode {
+		g.setCurrentNode(g.rootNode)
+		g.updateGameTreeUI()
+		g.redrawBoard()
+	}
+}
+
+// Moves to the end of the current line, following first children
+func (g *Game) lastMove() {
+	node := g.currentNode
+	for len(node.children) > 0 {
+		node = node.children[0]
+	}
+	if node != g.currentNode {
+		g.setCurrentNode(node)
+		g.updateGameTreeUI()
+		g.redrawBoard()
+	}
+}
+
+// Moves to the next sibling of the current node, or the previous one if step is -1
+func (g *Game) switchVariation(step int) {
+	if g.currentNode.parent == nil {
+		return
+	}
+	siblings := g.currentNode.parent.children
+	if i := slices.Index(siblings, g.currentNode) + step; i >= 0 && i < len(siblings) {
+		g.setCurrentNode(siblings[i])
+		g.updateGameTreeUI()
+		g.redrawBoard()
+	}
+}
+
+// Commands for moving around the game tree, with the keys they have until the user rebinds them
+var navigationCommands = []struct {
+	name string
+	key  fyne.KeyName
+	run  func(g *Game)
+}{
+	{"Navigate > Previous Move", fyne.KeyLeft, (*Game).previousMove},
+	{"Navigate > Next Move", fyne.KeyRight, (*Game).nextMove},
+	{"Navigate > Next Variation", fyne.KeyDown, func(g *Game) { g.switchVariation(1) }},
+	{"Navigate > Previous Variation", fyne.KeyUp, func(g *Game) { g.switchVariation(-1) }},
+	{"Navigate > First Move", fyne.KeyHome, (*Game).firstMove},
+	{"Navigate > Last Move", fyne.KeyEnd, (*Game).lastMove},
+	{"Navigate > Delete Node", fyne.KeyDelete, func(g *Game) { g.confirmDeleteBranch(g.currentNode) }},
+	{"Navigate > Pass", fyne.KeyP, (*Game).handlePass},
+	{"Navigate > Copy Board Image", fyne.KeyI, (*Game).copyBoardImage},
+}
+
+// Makes the navigation commands and every item of the menus bindable to keys, named by their menu path
+func (g *Game) registerKeyCommands(mainMenu *fyne.MainMenu) {
+	g.keyCommands = make(map[string]func())
+	g.keyCommandNames = nil
+	add := func(name string, run func()) {
+		if _, exists := g.keyCommands[name]; !exists {
+			g.keyCommandNames = append(g.keyCommandNames, name)
+		}
+		g.keyCommands[name] = run
+	}
+	for _, command := range navigationCommands {
+		add(command.name, func() { command.run(g) })
+	}
+	var addMenu func(path string, items []*fyne.MenuItem)
+	addMenu = func(path string, items []*fyne.MenuItem) {
+		for _, item := range items {
+			if item.IsSeparator || item.Label == "" {
+				continue
+			}
+			if item.ChildMenu != nil {
+				addMenu(path+" > "+item.Label, item.ChildMenu.Items)
+			}
+			if item.Action != nil {
+				add(path+" > "+item.Label, item.Action)
+			}
+		}
+	}
+	for _, menu := range mainMenu.Items {
+		addMenu(menu.Label, menu.Items)
+	}
+}
+
+// Returns the key combination of a command: the user's binding, else the default
+func (g *Game) keyBinding(command string) string {
+	if combo, bound := g.keyBindings[command]; bound {
+		return combo
+	}
+	return defaultKeyBinding(command)
+}
+
+// Returns the key a command has until the user rebinds it, "" if none
+func defaultKeyBinding(command string) string {
+	for _, navigation := range navigationCommands {
+		if navigation.name == command {
+			return string(navigation.key)
+		}
+	}
+	return ""
+}
+
+// Modifiers of key combinations, as written in the shortcut editor
+var keyModifierNames = []struct {
+	name     string
+	modifier fyne.KeyModifier
+}{
+	{"Ctrl", fyne.KeyModifierControl},
+	{"Alt", fyne.KeyModifierAlt},
+	{"Shift", fyne.KeyModifierShift},
+	{"Super", fyne.KeyModifierSuper},
+}
+
+// Keys other than letters and digits that can be bound
+var namedKeys = []fyne.KeyName{fyne.KeyUp, fyne.KeyDown, fyne.KeyLeft, fyne.KeyRight, fyne.KeyHome, fyne.KeyEnd,
+	fyne.KeyPageUp, fyne.KeyPageDown, fyne.KeyInsert, fyne.KeyDelete, fyne.KeyBackspace, fyne.KeySpace, fyne.KeyTab,
+	fyne.KeyReturn, fyne.KeyEscape, fyne.KeyF1, fyne.KeyF2, fyne.KeyF3, fyne.KeyF4, fyne.KeyF5, fyne.KeyF6, fyne.KeyF7,
+	fyne.KeyF8, fyne.KeyF9, fyne.KeyF10, fyne.KeyF11, fyne.KeyF12}
+
+// Parses a key combination such as "Ctrl+Shift+G" or "Up", in any letter case; "" is no key
+func parseKeyCombo(combo string) (fyne.KeyName, fyne.KeyModifier, error) {
+	combo = strings.TrimSpace(combo)
+	if combo == "" {
+		return "", 0, nil
+	}
+	parts := strings.Split(combo, "+")
+	var modifier fyne.KeyModifier
+	for _, part := range parts[:len(parts)-1] {
+		found := false
+		for _, named := range keyModifierNames {
+			if strings.EqualFold(strings.TrimSpace(part), named.name) {
+				modifier |= named.modifier
+				found = true
+			}
+		}
+		if !found {
+			return "", 0, fmt.Errorf("unknown modifier %q in %q", part, combo)
+		}
+	}
+	key := strings.TrimSpace(parts[len(parts)-1])
+	if len(key) == 1 && (unicode.IsLetter(rune(key[0])) || unicode.IsDigit(rune(key[0]))) {
+		return fyne.KeyName(strings.ToUpper(key)), modifier, nil
+	}
+	for _, named := range namedKeys {
+		if strings.EqualFold(key, string(named)) {
+			return named, modifier, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unknown key %q in %q", key, combo)
+}
+
+// Writes a key combination as the shortcut editor shows it, modifiers first
+func formatKeyCombo(key fyne.KeyName, modifier fyne.KeyModifier) string {
+	combo := ""
+	for _, named := range keyModifierNames {
+		if modifier&named.modifier != 0 {
+			combo += named.name + "+"
+		}
+	}
+	return combo + string(key)
+}
+
+// Adds the canvas shortcuts for the bindings with modifiers, or removes them when register is false
+func (g *Game) setKeyShortcuts(register bool) {
+	for _, command := range g.keyCommandNames {
+		key, modifier, err := parseKeyCombo(g.keyBinding(command))
+		if err != nil || key == "" || modifier == 0 {
+			continue
+		}
+		shortcut := &desktop.CustomShortcut{KeyName: key, Modifier: modifier}
+		if !register {
+			g.window.Canvas().RemoveShortcut(shortcut)
+			continue
+		}
+		run := g.keyCommands[command]
+		g.window.Canvas().AddShortcut(shortcut, func(fyne.Shortcut) {
+			g.lastInteraction = time.Now()
+			run()
+		})
+	}
+}
+
+// Key combinations taken by the comment phrase shortcuts
+func reservedKeyCombos() map[string]string {
+	reserved := make(map[string]string)
+	for key := fyne.Key1; key <= fyne.Key9; key = fyne.KeyName(rune(key[0]) + 1) {
+		reserved[formatKeyCombo(key, fyne.KeyModifierShortcutDefault)] = "Comment Phrase " + string(key)
+	}
+	return reserved
+}
+
+// Shows an editor binding each command to a key combination. Bindings are checked for conflicts with each other
+// and with the comment phrase shortcuts before they are applied.
+func (g *Game) showKeyBindingsDialog() {
+	entries := make(map[string]*widget.Entry)
+	form := widget.NewForm()
+	for _, command := range g.keyCommandNames {
+		entry := widget.NewEntry()
+		entry.SetPlaceHolder("none")
+		entry.SetText(g.keyBinding(command))
+		entry.Validator = func(combo string) error {
+			_, _, err := parseKeyCombo(combo)
+			return err
+		}
+		entries[command] = entry
+		form.Append(command, entry)
+	}
+	defaultsButton := widget.NewButton("Restore Defaults", func() {
+		for command, entry := range entries {
+			entry.SetText(defaultKeyBinding(command))
+		}
+	})
+	hint := widget.NewLabel("Write combinations such as Ctrl+Shift+G, F5 or Up; leave a field empty to unbind the command.")
+	hint.Wrapping = fyne.TextWrapWord
+	content := container.NewBorder(hint, defaultsButton, nil, nil, container.NewVScroll(form))
+	bindingsDialog := dialog.NewCustomConfirm("Keyboard Shortcuts", "OK", "Cancel", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		bindings := make(map[string]string)
+		users := reservedKeyCombos()
+		conflicts := []string{}
+		for _, command := range g.keyCommandNames {
+			key, modifier, err := parseKeyCombo(entries[command].Text)
+			if err != nil {
+				g.showError(err)
+				return
+			}
+			combo := ""
+			if key != "" {
+				combo = formatKeyCombo(key, modifier)
+				if other, taken := users[combo]; taken {
+					conflicts = append(conflicts, fmt.Sprintf("%s: %s and %s", combo, other, command))
+				}
+				users[combo] = command
+			}
+			if combo != defaultKeyBinding(command) {
+				bindings[command] = combo
+			}
+		}
+		if len(conflicts) > 0 {
+			g.showError(fmt.Errorf("keys bound twice:\n%s", strings.Join(conflicts, "\n")))
+			return
+		}
+		g.setKeyShortcuts(false)
+		g.keyBindings = bindings
+		g.setKeyShortcuts(true)
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
+		}
+	}, g.window)
+	bindingsDialog.Resize(fyne.NewSize(600, 500))
+	bindingsDialog.Show()
+}
+
+func (g *Game) showSetKomiDialog() {
+	komiEntry := widget.NewEntry()
+	komiEntry.SetText(fmt.Sprintf("%d", g.komi))
+	komiEntry.Validator = func(s string) error {
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return fmt.Errorf("invalid komi value")
+		}
+		return nil
+	}
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Komi", komiEntry),
+	}
+	komiDialog := dialog.NewForm("Set Komi", "OK", "Cancel", formItems, func(ok bool) {
+		if ok {
+			komiValue, err := strconv.Atoi(komiEntry.Text)
+			if err != nil {
+				g.showError(fmt.Errorf("invalid komi value"))
+				return
+			}
+			g.komi = komiValue
+
+			// Save the configuration
+			if err := g.saveConfig(); err != nil {
+				g.showError(fmt.Errorf("failed to save config: %v", err))
+			}
+
+			// If engine is attached, send komi command; after a cancelled genmove the engine's setup sends it
+			if g.gtpCmd != nil && g.cancelledGenmoves == 0 {
+				_, err := g.sendGTPCommand(fmt.Sprintf("komi %d", g.komi))
+				if err != nil {
+					g.showError(err)
+				}
+			}
+
+			// Recalculate and display score if in scoring mode
+			if g.mouseMode == "score" {
+				g.calculateAndDisplayScore()
+			}
+		}
+	}, g.window)
+	komiDialog.Show()
+}
+
+func (g *Game) showEngineSettings() {
+	// Create input entries for settings
+	gtpPathEntry := widget.NewEntry()
+	gtpPathEntry.SetText(g.gtpPath)
+	gtpArgsEntry := widget.NewEntry()
+	gtpArgsEntry.SetText(g.gtpArgs)
+	gtpColorEntry := widget.NewSelect([]string{"B", "W", "Both"}, func(value string) {})
+	gtpColorEntry.SetSelected(g.gtpColor)
+	startupCommandsEntry := widget.NewMultiLineEntry()
+	startupCommandsEntry.SetPlaceHolder("One GTP command per line")
+	startupCommandsEntry.SetText(strings.Join(g.gtpStartupCommands[g.engineProfile()], "\n"))
+	// The startup commands belong to the engine profile being edited
+	enteredProfile := func() string {
+		return strings.TrimSpace(gtpPathEntry.Text + " " + gtpArgsEntry.Text)
+	}
+	showProfileCommands := func(string) {
+		startupCommandsEntry.SetText(strings.Join(g.gtpStartupCommands[enteredProfile()], "\n"))
+	}
+	gtpPathEntry.OnChanged = showProfileCommands
+	gtpArgsEntry.OnChanged = showProfileCommands
+	timeoutValidator := func(s string) error {
+		if seconds, err := strconv.Atoi(s); err != nil || seconds < 0 {
+			return fmt.Errorf("invalid timeout")
+		}
+		return nil
+	}
+	timeoutEntry := widget.NewEntry()
+	timeoutEntry.SetText(strconv.Itoa(timeoutSeconds(g.gtpTimeout, defaultGTPTimeout)))
+	timeoutEntry.SetPlaceHolder("0 to wait forever")
+	timeoutEntry.Validator = timeoutValidator
+	genmoveTimeoutEntry := widget.NewEntry()
+	genmoveTimeoutEntry.SetText(strconv.Itoa(timeoutSeconds(g.gtpGenmoveTimeout, defaultGenmoveTimeout)))
+	genmoveTimeoutEntry.SetPlaceHolder("0 to wait forever")
+	genmoveTimeoutEntry.Validator = timeoutValidator
+
+	// Create the "Browse" button for GTP Path
+	browseButton := widget.NewButton("Browse", func() {
+		// Open file selector
+		fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			defer reader.Close()
+			gtpPathEntry.SetText(reader.URI().Path())
+		}, g.window)
+
+		// If g.gtpPath is not a malformed path, set the initial directory
+		if g.gtpPath != "" {
+			dir := filepath.Dir(g.gtpPath)
+			uri := storage.NewFileURI(dir)
+			listableURI, err := storage.ListerForURI(uri)
+			if err == nil {
+				fileDialog.SetLocation(listableURI)
+			}
+		}
+
+		fileDialog.Show()
+	})
+
+	// Create form items
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("GTP Path", browseButton),
+		widget.NewFormItem("GTP Path", gtpPathEntry),
+		widget.NewFormItem("GTP Arguments", gtpArgsEntry),
+		widget.NewFormItem("GTP Color", gtpColorEntry),
+		widget.NewFormItem("Startup Commands", startupCommandsEntry),
+		widget.NewFormItem("Command Timeout (s)", timeoutEntry),
+		widget.NewFormItem("Genmove Timeout (s)", genmoveTimeoutEntry),
+	}
+
+	// Show settings dialog
+	settingsDialog := dialog.NewForm("Engine Settings", "OK", "Cancel", formItems, func(ok bool) {
+		if ok {
+			timeout, err := strconv.Atoi(timeoutEntry.Text)
+			genmoveTimeout, genmoveErr := strconv.Atoi(genmoveTimeoutEntry.Text)
+			if err != nil || genmoveErr != nil || timeout < 0 || genmoveTimeout < 0 {
+				g.showError(fmt.Errorf("invalid timeout: enter a number of seconds, 0 to wait forever; the settings were not changed"))
+				return
+			}
+			g.gtpPath = gtpPathEntry.Text
+			g.gtpArgs = gtpArgsEntry.Text
+			g.gtpColor = gtpColorEntry.Selected
+			var commands []string
+			for _, line := range strings.Split(startupCommandsEntry.Text, "\n") {
+				if command := strings.TrimSpace(line); command != "" {
+					commands = append(commands, command)
+				}
+			}
+			if commands == nil {
+				delete(g.gtpStartupCommands, g.engineProfile())
+			} else {
+				if g.gtpStartupCommands == nil {
+					g.gtpStartupCommands = make(startupCommands)
+				}
+				g.gtpStartupCommands[g.engineProfile()] = commands
+			}
+			g.gtpTimeout = timeoutSetting(timeout)
+			g.gtpGenmoveTimeout = timeoutSetting(genmoveTimeout)
+
+			// Save the configuration
+			if err := g.saveConfig(); err != nil {
+				g.showError(fmt.Errorf("failed to save config: %v", err))
+			}
+		}
+	}, g.window)
+	settingsDialog.Show()
+}
+
+// Sets up the current position on the engine's board. While the engine still searches a cancelled genmove,
+// finishEngineMove sets it up after the reply instead, so the UI thread does not wait for the search.
+func (g *Game) updateEngineBoardState() error {
+	if g.cancelledGenmoves > 0 {
+		return nil
+	}
+	return g.setEnginePosition(g.currentNode)
+}
+
+// Sets up the position of node on the engine's board
+func (g *Game) setEnginePosition(node *GameTreeNode) error {
+	g.enginePosition.Lock()
+	defer g.enginePosition.Unlock()
+	return g.sendEnginePosition(node)
+}
+
+// Sets up the position of node on the engine's board; the caller holds enginePosition
+func (g *Game) sendEnginePosition(node *GameTreeNode) error {
+	if g.gtpCmd == nil {
+		return fmt.Errorf("engine is not attached")
+	}
+
+	// Send "clear_board" to reset the engine's board
+	if _, err := g.sendGTPCommand("clear_board"); err != nil {
+		return err
+	}
+
+	// Set komi in case it has changed
+	if _, err := g.sendGTPCommand(fmt.Sprintf("komi %d", g.komi)); err != nil {
+		return err
+	}
+
+	// Send "play" commands for each stone on the board. With a ko, the captured stone is placed
+	// instead of the capturing one, which is played last so that the engine sees the ko as well.
+	for y := 0; y < g.sizeY; y++ {
+		for x := 0; x < g.sizeX; x++ {
+			stone := node.boardState[y][x]
+			if node.koX >= 0 && x == node.move[0] && y == node.move[1] {
+				continue
+			}
+			if node.koX >= 0 && x == node.koX && y == node.koY {
+				stone = goban.SwitchPlayer(node.player)
+			}
+			if isStone(stone) {
+				coord := g.clientToGTPCoords(x, y)
+				if _, err := g.sendGTPCommand(fmt.Sprintf("play %s %s", stone, coord)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if node.koX >= 0 {
+		coord := g.clientToGTPCoords(node.move[0], node.move[1])
+		if _, err := g.sendGTPCommand(fmt.Sprintf("play %s %s", node.player, coord)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// An engine evaluation of a position
+type positionAnalysis struct {
+	blackWinrate float64            // Chance of Black winning, from 0 to 1
+	scoreLead    float64            // Points Black is expected to lead by
+	visits       int                // Visits the evaluation rests on, 0 if the engine gave none
+	bestMove     string             // GTP vertex of the engine's preferred move, empty if none
+	candidates   map[string]float64 // Black's winrate after each move the engine considered, by GTP vertex
+}
+
+// Visits per node of the background review when none are configured
+const defaultReviewVisits = 200
+
+// Reads the last analysis line of a kata-genmove_analyze response, whose values are from the view of toMove.
+// Returns nil if the response holds no analysis.
+func parseAnalysisResponse(response string, toMove string) *positionAnalysis {
+	var last string
+	for _, line := range strings.Split(response, "\n") {
+		if strings.HasPrefix(line, "info ") {
+			last = line
+		}
+	}
+	if last == "" {
+		return nil
+	}
+	var analysis *positionAnalysis
+	total := 0
+	candidates := make(map[string]float64)
+	for _, candidate := range strings.Split(last, "info ")[1:] {
+		fields := strings.Fields(candidate)
+		values := make(map[string]string)
+		for i := 0; i+1 < len(fields); i += 2 {
+			if fields[i] == "pv" {
+				break // The principal variation runs to the end of the candidate
+			}
+			values[fields[i]] = fields[i+1]
+		}
+		visits, _ := strconv.Atoi(values["visits"])
+		total += visits
+		winrate, err1 := strconv.ParseFloat(values["winrate"], 64)
+		lead, err2 := strconv.ParseFloat(values["scoreLead"], 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if toMove == white {
+			winrate, lead = 1-winrate, -lead
+		}
+		candidates[values["move"]] = winrate
+		if values["order"] == "0" {
+			analysis = &positionAnalysis{blackWinrate: winrate, scoreLead: lead, bestMove: values["move"]}
+		}
+	}
+	if analysis != nil {
+		analysis.visits = total
+		analysis.candidates = candidates
+	}
+	return analysis
+}
+
+// A move the engine considers in analyze mode
+type analysisCandidate struct {
+	x, y         int
+	visits       int
+	blackWinrate float64 // Chance of Black winning after the move
+	scoreLead    float64 // Points Black leads by after the move, 0 if the engine reports no scores
+	order        int     // Rank of the move, 0 for the engine's choice
+}
+
+// The latest report of the engine analyzing a node in analyze mode
+type liveAnalysis struct {
+	node       *GameTreeNode
+	candidates []analysisCandidate // In the engine's order
+	ownership  [][]float64         // Ownership of each point from -1 (White) to 1 (Black), nil if not reported
+	visits     int
+}
+
+// Centiseconds between the reports of an analyze command
+const analysisInterval = 50
+
+// Candidate moves drawn in analyze mode
+const maxAnalysisCandidates = 10
+
+// Reads one report of kata-analyze or lz-analyze, whose values are from the view of toMove.
+// lz-analyze gives winrates in hundredths of a percent and neither scores nor ownership.
+// Returns nil if the line holds no report.
+func (g *Game) parseAnalyzeLine(line string, toMove string) *liveAnalysis {
+	analysis := &liveAnalysis{}
+	if i := strings.Index(line, "ownership "); i >= 0 {
+		values := strings.Fields(line[i+len("ownership "):])
+		if len(values) == g.sizeX*g.sizeY {
+			// Row by row from the top left, as the board is drawn
+			analysis.ownership = make([][]float64, g.sizeY)
+			for y := range analysis.ownership {
+				analysis.ownership[y] = make([]float64, g.sizeX)
+				for x := range analysis.ownership[y] {
+					value, _ := strconv.ParseFloat(values[y*g.sizeX+x], 64)
+					if toMove == white {
+						value = -value
+					}
+					analysis.ownership[y][x] = value
+				}
+			}
+		}
+		line = line[:i]
+	}
+	for _, candidate := range strings.Split(line, "info ")[1:] {
+		fields := strings.Fields(candidate)
+		values := make(map[string]string)
+		for i := 0; i+1 < len(fields); i += 2 {
+			if fields[i] == "pv" {
+				break // The principal variation runs to the end of the candidate
+			}
+			values[fields[i]] = fields[i+1]
+		}
+		x, y, err := g.gtpToClientCoords(values["move"])
+		winrate, err2 := strconv.ParseFloat(values["winrate"], 64)
+		if err != nil || err2 != nil || x < 0 || x >= g.sizeX || y < 0 || y >= g.sizeY {
+			continue // Passes are not drawn
+		}
+		if winrate > 1 {
+			winrate /= 10000
+		}
+		lead, _ := strconv.ParseFloat(values["scoreLead"], 64)
+		visits, _ := strconv.Atoi(values["visits"])
+		order, _ := strconv.Atoi(values["order"])
+		if toMove == white {
+			winrate, lead = 1-winrate, -lead
+		}
+		analysis.visits += visits
+		analysis.candidates = append(analysis.candidates, analysisCandidate{x, y, visits, winrate, lead, order})
+	}
+	if len(analysis.candidates) == 0 && analysis.ownership == nil {
+		return nil
+	}
+	sort.SliceStable(analysis.candidates, func(i, j int) bool {
+		return analysis.candidates[i].order < analysis.candidates[j].order
+	})
+	return analysis
+}
+
+// Menu item switching analyze mode on and off
+func (g *Game) newAnalyzeMenuItem() *fyne.MenuItem {
+	item := g.newToggleMenuItem("Analyze", &g.analyzing)
+	toggle := item.Action
+	item.Action = func() {
+		toggle()
+		if g.analyzing {
+			g.startAnalysis()
+		} else {
+			g.stopAnalysis()
+		}
+	}
+	g.analyzeMenuItem = item
+	return item
+}
+
+// Enters analyze mode, in which the engine analyzes each position shown instead of playing,
+// attaching the engine first if needed
+func (g *Game) startAnalysis() {
+	g.analyzing = true
+	g.stopSelfPlay()
+	g.cancelEngineMove()
+	if g.gtpCmd == nil {
+		g.attachEngine() // Starts the analysis once attached
+		if g.gtpCmd == nil {
+			g.endAnalyzeMode()
+		}
+		return
+	}
+	g.restartAnalysis()
+}
+
+// Leaves analyze mode and sets the engine back to the current position
+func (g *Game) stopAnalysis() {
+	if !g.analyzing && g.liveAnalysis == nil {
+		return
+	}
+	g.endAnalyzeMode()
+	g.redrawBoard()
+	if g.gtpCmd != nil {
+		go func() {
+			if err := g.updateEngineBoardState(); err != nil {
+				g.runOnUI(func() {
+					g.showError(err)
+					g.detachEngine()
+				})
+			}
+		}()
+	}
+}
+
+// Stops the running analysis and clears analyze mode and its report
+func (g *Game) endAnalyzeMode() {
+	g.analyzing = false
+	if g.analysisCancel != nil {
+		g.analysisCancel()
+		g.analysisCancel = nil
+	}
+	g.liveAnalysis = nil
+	if g.analyzeMenuItem != nil && g.analyzeMenuItem.Checked {
+		g.analyzeMenuItem.Checked = false
+		g.window.MainMenu().Refresh()
+	}
+}
+
+// Stops the running analysis and analyzes the current node instead, in the background
+func (g *Game) restartAnalysis() {
+	if g.analysisCancel != nil {
+		g.analysisCancel()
+	}
+	if !g.analyzing || g.gtpCmd == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	g.analysisCancel = cancel
+	node := g.currentNode
+	go func() {
+		if err := g.streamAnalysis(ctx, node); err != nil {
+			g.runOnUI(func() {
+				if ctx.Err() != nil {
+					return // The analysis was stopped meanwhile
+				}
+				g.endAnalyzeMode()
+				g.showError(fmt.Errorf("analysis stopped: %v", err))
+				g.redrawBoard()
+			})
+		}
+	}()
+}
+
+// Runs kata-analyze, or lz-analyze for engines without it, on the position of node and keeps each report in
+// liveAnalysis, on the UI thread, until ctx is cancelled. Any further command ends an analyze command,
+// so a name request stops it.
+func (g *Game) streamAnalysis(ctx context.Context, node *GameTreeNode) error {
+	g.enginePosition.Lock()
+	defer g.enginePosition.Unlock()
+	if ctx.Err() != nil {
+		return nil // Another node was shown before the previous analysis ended
+	}
+	commands, err := g.sendGTPCommand("list_commands")
+	if err != nil {
+		return err
+	}
+	toMove := goban.SwitchPlayer(node.player)
+	var command string
+	switch {
+	case slices.Contains(strings.Fields(commands), "kata-analyze"):
+		command = fmt.Sprintf("kata-analyze %s %d ownership true", toMove, analysisInterval)
+	case slices.Contains(strings.Fields(commands), "lz-analyze"):
+		command = fmt.Sprintf("lz-analyze %s %d", toMove, analysisInterval)
+	default:
+		return fmt.Errorf("the engine supports neither kata-analyze nor lz-analyze")
+	}
+	if err := g.sendEnginePosition(node); err != nil {
+		return err
+	}
+
+	g.gtpMutex.Lock()
+	defer g.gtpMutex.Unlock()
+	if g.gtpIn == nil || g.gtpReader == nil {
+		return fmt.Errorf("engine is not attached")
+	}
+	if _, err := fmt.Fprintf(g.gtpIn, "%d %s\n", g.nextGTPID(), command); err != nil {
+		return err
+	}
+	stopID := ""
+	for {
+		line, err := g.gtpReader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case stopID != "" && (strings.HasPrefix(line, "="+stopID) || strings.HasPrefix(line, "?"+stopID)):
+			// The answer to the stop request, which ends with a blank line
+			for line != "" {
+				if line, err = g.gtpReader.ReadString('\n'); err != nil {
+					return err
+				}
+				line = strings.TrimSpace(line)
+			}
+			return nil
+		case strings.HasPrefix(line, "?") && stopID == "":
+			return fmt.Errorf("error from engine: %s", strings.TrimSpace(strings.TrimLeft(line[1:], "0123456789")))
+		case strings.HasPrefix(line, "info "):
+			if analysis := g.parseAnalyzeLine(line, toMove); analysis != nil {
+				analysis.node = node
+				g.runOnUI(func() {
+					if ctx.Err() != nil {
+						return // Another node is analyzed by now
+					}
+					g.liveAnalysis = analysis
+					g.storeLiveAnalysis(analysis)
+					if g.currentNode == node {
+						g.redrawBoard()
+					}
+				})
+			}
+		}
+		if ctx.Err() != nil && stopID == "" {
+			stopID = strconv.Itoa(g.nextGTPID())
+			if _, err := fmt.Fprintf(g.gtpIn, "%s name\n", stopID); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Keeps the report of analyze mode as the node's evaluation, for the winrate graph, if it rests on more
+// visits than the evaluation the node has
+func (g *Game) storeLiveAnalysis(analysis *liveAnalysis) {
+	if len(analysis.candidates) == 0 || (analysis.node.analysis != nil && analysis.node.analysis.visits >= analysis.visits) {
+		return
+	}
+	best := analysis.candidates[0]
+	stored := &positionAnalysis{
+		blackWinrate: best.blackWinrate,
+		scoreLead:    best.scoreLead,
+		visits:       analysis.visits,
+		bestMove:     g.clientToGTPCoords(best.x, best.y),
+		candidates:   make(map[string]float64),
+	}
+	for _, candidate := range analysis.candidates {
+		stored.candidates[g.clientToGTPCoords(candidate.x, candidate.y)] = candidate.blackWinrate
+	}
+	analysis.node.analysis = stored
+}
+
+// Draws the report of analyze mode: the ownership as translucent black and white shading, and the candidate
+// moves with the mover's winrate and their visits, the engine's choice in blue
+func (g *Game) drawLiveAnalysis() {
+	analysis := g.liveAnalysis
+	for y, row := range analysis.ownership {
+		for x, owner := range row {
+			shade := color.NRGBA{0, 0, 0, uint8(min(1, math.Abs(owner)) * 140)}
+			if owner < 0 {
+				shade.R, shade.G, shade.B = 255, 255, 255
+			}
+			rect := canvas.NewRectangle(shade)
+			rect.Resize(fyne.NewSize(g.cellSize*0.5, g.cellSize*0.5))
+			rect.Move(g.boardCoordsToPixel(x, y).AddXY(g.cellSize*0.25, g.cellSize*0.25))
+			g.gridContainer.Add(rect)
+		}
+	}
+	mover := goban.SwitchPlayer(g.currentNode.player)
+	for i, candidate := range analysis.candidates {
+		if i == maxAnalysisCandidates {
+			break
+		}
+		if g.currentNode.boardState[candidate.y][candidate.x] != empty {
+			continue
+		}
+		fill := color.NRGBA{80, 200, 120, 200}
+		if i == 0 {
+			fill = color.NRGBA{60, 160, 255, 220}
+		}
+		pos := g.boardCoordsToPixel(candidate.x, candidate.y)
+		circle := canvas.NewCircle(fill)
+		circle.Resize(fyne.NewSize(g.cellSize*0.9, g.cellSize*0.9))
+		circle.Move(pos.AddXY(g.cellSize*0.05, g.cellSize*0.05))
+		g.gridContainer.Add(circle)
+
+		winrate := candidate.blackWinrate
+		if mover == white {
+			winrate = 1 - winrate
+		}
+		visits := strconv.Itoa(candidate.visits)
+		if candidate.visits >= 1000 {
+			visits = fmt.Sprintf("%.1fk", float64(candidate.visits)/1000)
+		}
+		for line, label := range []string{fmt.Sprintf("%.0f", winrate*100), visits} {
+			text := canvas.NewText(label, blackColor)
+			text.TextSize = g.cellSize * 0.28
+			text.TextStyle = fyne.TextStyle{Bold: line == 0}
+			text.Resize(text.MinSize())
+			text.Move(fyne.Position{
+				X: pos.X + 0.5*g.cellSize - text.Size().Width/2,
+				Y: pos.Y + g.cellSize*(0.3+0.4*float32(line)) - text.Size().Height/2,
+			})
+			g.gridContainer.Add(text)
+		}
+	}
+}
+
+// Works through unanalyzed nodes while the user is idle, the current line first. Runs for the life of the window;
+// each node takes one engine search, after which the engine is set back to the current position. Only the search
+// runs in the background: the node is chosen and its evaluation stored on the UI thread.
+func (g *Game) runBackgroundReview() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		var node *GameTreeNode
+		var visits int
+		chosen := make(chan struct{})
+		g.runOnUI(func() {
+			defer close(chosen)
+			if !g.backgroundReview || g.gtpCmd == nil || g.engineThinking || g.selfPlaying || g.analyzing || g.broadcasting ||
+				g.scratchOrigin != nil || time.Since(g.lastInteraction) < 3*time.Second {
+				return
+			}
+			node, visits = g.nextUnanalyzedNode(), g.reviewVisits
+		})
+		<-chosen
+		if node == nil {
+			continue
+		}
+		if visits <= 0 {
+			visits = defaultReviewVisits
+		}
+		analysis, err := g.searchPosition(node, nil, visits)
+		g.runOnUI(func() {
+			if err != nil {
+				g.backgroundReview = false
+				g.showError(fmt.Errorf("background review stopped: %v", err))
+				return
+			}
+			node.analysis = analysis
+			g.winrateGraph.update()
+		})
+	}
+}
+
+// Returns the first node of the current line without an analysis, else the first in the whole tree, nil if none
+func (g *Game) nextUnanalyzedNode() *GameTreeNode {
+	for _, node := range g.currentLine() {
+		if node.analysis == nil {
+			return node
+		}
+	}
+	var found *GameTreeNode
+	g.rootNode.Walk(func(node *GameTreeNode) bool {
+		if node.analysis == nil {
+			found = node
+		}
+		return found == nil
+	})
+	return found
+}
+
+// Searches the position of node, after move if not nil, with the given number of visits, then sets the engine
+// back to the current position. The engine's own visit limit is restored, so games against it are unaffected.
+// A search too brief to report anything gives an analysis without visits.
+func (g *Game) searchPosition(node *GameTreeNode, move *Move, visits int) (*positionAnalysis, error) {
+	g.enginePosition.Lock()
+	defer g.enginePosition.Unlock()
+	if err := g.sendEnginePosition(node); err != nil {
+		return nil, err
+	}
+	toMove := goban.SwitchPlayer(node.player)
+	if move != nil {
+		if _, err := g.sendGTPCommand(fmt.Sprintf("play %s %s", move.player, g.clientToGTPCoords(move.x, move.y))); err != nil {
+			return nil, err
+		}
+		toMove = goban.SwitchPlayer(move.player)
+	}
+	originalVisits, err := g.sendGTPCommand("kata-get-param maxVisits")
+	if err != nil {
+		return nil, fmt.Errorf("the engine does not support KataGo's analysis commands: %v", err)
+	}
+	if _, err := g.sendGTPCommand(fmt.Sprintf("kata-set-param maxVisits %d", visits)); err != nil {
+		return nil, err
+	}
+	response, err := g.sendGTPCommand(fmt.Sprintf("kata-genmove_analyze %s 10", toMove))
+	if _, restoreErr := g.sendGTPCommand("kata-set-param maxVisits " + originalVisits); err == nil {
+		err = restoreErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	analysis := parseAnalysisResponse(response, toMove)
+	if analysis == nil {
+		analysis = &positionAnalysis{}
+	}
+	// The search played its move on the engine's board
+	return analysis, g.sendEnginePosition(g.currentNode)
+}
+
+// Asks for the visits the engine spends per node of the background review
+func (g *Game) showReviewVisitsDialog() {
+	visitsEntry := widget.NewEntry()
+	visits := g.reviewVisits
+	if visits <= 0 {
+		visits = defaultReviewVisits
+	}
+	visitsEntry.SetText(strconv.Itoa(visits))
+	visitsEntry.Validator = func(s string) error {
+		if value, err := strconv.Atoi(s); err != nil || value < 1 || value > 1000000 {
+			return fmt.Errorf("visits must be between 1 and 1000000")
+		}
+		return nil
+	}
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Visits per Node", visitsEntry),
+	}
+	dialog.ShowForm("Review Visit Budget", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+		g.reviewVisits, _ = strconv.Atoi(visitsEntry.Text)
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
+		}
+	}, g.window)
+}
+
+// Plots Black's winrate over the current line; tapping it goes to the move under the pointer
+type winrateGraph struct {
+	widget.BaseWidget
+	game  *Game
+	line  []*GameTreeNode // Nodes of the plotted line, one per column
+	shown []fyne.CanvasObject
+}
+
+func newWinrateGraph(g *Game) *winrateGraph {
+	graph := &winrateGraph{game: g}
+	graph.ExtendBaseWidget(graph)
+	graph.Hide()
+	return graph
+}
+
+// Shows or hides the graph as configured and plots the current line again
+func (w *winrateGraph) update() {
+	if w == nil {
+		return
+	}
+	if !w.game.showWinrateGraph {
+		w.Hide()
+		return
+	}
+	w.line = w.game.currentLine()
+	w.Show()
+	w.Refresh()
+}
+
+func (w *winrateGraph) Tapped(ev *fyne.PointEvent) {
+	if len(w.line) == 0 || w.Size().Width <= 0 {
+		return
+	}
+	index := int(ev.Position.X / w.Size().Width * float32(len(w.line)))
+	index = max(0, min(index, len(w.line)-1))
+	g := w.game
+	g.setCurrentNode(w.line[index])
+	g.redrawBoard()
+	g.updateGameTreeUI()
+}
+
+func (w *winrateGraph) CreateRenderer() fyne.WidgetRenderer {
+	return &winrateGraphRenderer{graph: w}
+}
+
+type winrateGraphRenderer struct {
+	graph *winrateGraph
+}
+
+func (r *winrateGraphRenderer) Layout(size fyne.Size) {
+	r.Refresh()
+}
+
+func (r *winrateGraphRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(100, 80)
+}
+
+// Draws the half line, a line segment between each pair of evaluated neighbors, and the current move.
+// Engine evaluations are drawn in black, heuristic ones in gray under a label saying so.
+func (r *winrateGraphRenderer) Refresh() {
+	w := r.graph
+	g := w.game
+	size := w.Size()
+	background := canvas.NewRectangle(color.NRGBA{240, 240, 240, 255})
+	background.Resize(size)
+	objects := []fyne.CanvasObject{background}
+	half := canvas.NewLine(dimColor)
+	half.Position1 = fyne.NewPos(0, size.Height/2)
+	half.Position2 = fyne.NewPos(size.Width, size.Height/2)
+	objects = append(objects, half)
+	if n := len(w.line); n > 0 {
+		column := size.Width / float32(n)
+		pointAt := func(i int, winrate float64) fyne.Position {
+			return fyne.NewPos((float32(i)+0.5)*column, (1-float32(winrate))*size.Height)
+		}
+		winrates := make([]float64, n)
+		heuristic := make([]bool, n)
+		captureLead := 0 // Stones captured by Black minus those captured by White
+		for i, node := range w.line {
+			if node.hasMove() && node.move[0] >= 0 {
+				if node.player == black {
+					captureLead += capturedStones(node)
+				} else {
+					captureLead -= capturedStones(node)
+				}
+			}
+			switch {
+			case node.analysis != nil && node.analysis.visits > 0:
+				winrates[i] = node.analysis.blackWinrate
+			case g.heuristicGraph:
+				winrates[i] = heuristicWinrate(node.boardState, captureLead, g.komi, g.sizeX, g.sizeY)
+				heuristic[i] = true
+			default:
+				winrates[i] = math.NaN()
+			}
+		}
+		for i := 1; i < n; i++ {
+			if math.IsNaN(winrates[i-1]) || math.IsNaN(winrates[i]) {
+				continue
+			}
+			segment := canvas.NewLine(blackColor)
+			if heuristic[i-1] || heuristic[i] {
+				segment = canvas.NewLine(dimColor)
+			}
+			segment.StrokeWidth = 2
+			segment.Position1 = pointAt(i-1, winrates[i-1])
+			segment.Position2 = pointAt(i, winrates[i])
+			objects = append(objects, segment)
+		}
+		if slices.Contains(heuristic, true) {
+			label := canvas.NewText("Gray: rough heuristic, not an engine", dimColor)
+			label.TextSize = 10
+			label.Move(fyne.NewPos(4, 2))
+			objects = append(objects, label)
+		}
+		if w.game.showEventMarkers {
+			for i, node := range w.line {
+				if w.game.timelineEvents[node] == "" {
+					continue
+				}
+				tick := canvas.NewLine(redColor)
+				tick.StrokeWidth = 2
+				tick.Position1 = fyne.NewPos((float32(i)+0.5)*column, 0)
+				tick.Position2 = fyne.NewPos((float32(i)+0.5)*column, size.Height/5)
+				objects = append(objects, tick)
+			}
+		}
+		if current := slices.Index(w.line, w.game.currentNode); current >= 0 {
+			marker := canvas.NewLine(purpleColor)
+			marker.Position1 = fyne.NewPos((float32(current)+0.5)*column, 0)
+			marker.Position2 = fyne.NewPos((float32(current)+0.5)*column, size.Height)
+			objects = append(objects, marker)
+		}
+	}
+	w.shown = objects
+	canvas.Refresh(w)
+}
+
+// Estimates Black's chance of winning without an engine from the stone difference, a territory estimate in which
+// empty points belong to the color of the nearest stones, the capture difference and komi. It knows nothing of
+// dead stones or weak groups, so it is only a rough guide.
+func heuristicWinrate(board [][]string, captureLead, komi, sizeX, sizeY int) float64 {
+	lead := float64(areaDifference(board, sizeX, sizeY) + captureLead - komi)
+	scale := max(2, float64(sizeX*sizeY)/40) // Points of lead that make about a 73% chance
+	return 1 / (1 + math.Exp(-lead/scale))
+}
+
+func (r *winrateGraphRenderer) Objects() []fyne.CanvasObject {
+	return r.graph.shown
+}
+
+func (r *winrateGraphRenderer) Destroy() {}
+
+func (g *Game) startSelfPlay() {
+	if g.selfPlaying {
+		return // Already self-playing
+	}
+	g.selfPlaying = true
+	g.selfPlayCtx, g.selfPlayCancel = context.WithCancel(context.Background())
+	g.selfPlayWaitGrp.Add(1)
+	player := goban.SwitchPlayer(g.currentNode.player)
+	go func() {
+		defer g.selfPlayWaitGrp.Done()
+		for {
+			select {
+			case <-g.selfPlayCtx.Done():
+				return
+			default:
+				// Generate move for current player
+				engineMove, err := g.sendGTPCommand(fmt.Sprintf("genmove %s", player))
+				// Update the game state on the main thread; stopSelfPlay waits for this goroutine there,
+				// so a move still queued after cancelling is dropped rather than waited for
+				played := make(chan bool, 1)
+				ctx, movePlayer := g.selfPlayCtx, player
+				g.runOnUI(func() {
+					if ctx.Err() != nil {
+						played <- false
+						return
+					}
+					switch {
+					case err != nil:
+						g.showError(err)
+						g.detachEngine()
+						played <- false
+					case engineMove == "pass" || engineMove == "resign":
+						// Game over
+						dialog.ShowInformation("Game Over", fmt.Sprintf("Player %s %s.", movePlayer, engineMove), g.window)
+						played <- false
+					default:
+						played <- g.handleEngineMove(engineMove)
+					}
+				})
+				select {
+				case <-ctx.Done():
+					return
+				case ok := <-played:
+					if !ok {
+						return
+					}
+				}
+				// Switch player
+				player = goban.SwitchPlayer(player)
+			}
+		}
+	}()
+}
+
+func (g *Game) stopSelfPlay() {
+	if g.selfPlaying {
+		g.selfPlayCancel()
+		g.selfPlayWaitGrp.Wait()
+		g.selfPlaying = false
+	}
+}
+
+func (g *Game) attachEngine() {
+	if err := g.startEngine(); err != nil {
+		g.showError(err)
+		if g.gtpCmd.Process != nil {
+			g.detachEngine()
+		}
+		g.gtpCmd = nil
+	} else {
+		dialog.ShowInformation("Engine Attached", "Successfully attached to the engine.", g.window)
+		// Check if it's the engine's move
+		nextPlayer := goban.SwitchPlayer(g.currentNode.player)
+		if g.analyzing {
+			g.restartAnalysis()
+		} else if g.gtpColor == "Both" {
+			g.startSelfPlay()
+		} else if g.gtpColor == nextPlayer {
+			g.requestEngineMove(g.gtpColor)
+		}
+	}
+}
+
+// Optional GTP commands reported by Test Engine, with the feature each one enables
+var optionalGTPCommands = []struct {
+	command string
+	feature string
+}{
+	{"rectangular_boardsize", "rectangular boards"},
+	{"kata-analyze", "KataGo analysis"},
+	{"final_status_list", "engine dead stone marking"},
+}
+
+// Starts the configured engine in a separate process, independent of any attached engine,
+// and reports its identity, response latency and optional command support
+func (g *Game) testEngine() {
+	progress := dialog.NewCustomWithoutButtons("Test Engine", widget.NewLabel("Testing "+g.gtpPath+" ..."), g.window)
+	progress.Show()
+	// The settings are read here, since they may change while the test runs
+	path, args, startupCommands := g.gtpPath, strings.Fields(g.gtpArgs), g.gtpStartupCommands[g.engineProfile()]
+	go func() {
+		report, err := runEngineTest(path, args, startupCommands)
+		if err != nil {
+			report += "\nTest failed: " + err.Error()
+		}
+		g.runOnUI(func() {
+			progress.Hide()
+			dialog.ShowInformation("Test Engine", report, g.window)
+		})
+	}()
+}
+
+// Runs the engine test and returns the report written so far
+func runEngineTest(path string, args []string, startupCommands []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, args...)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return "", err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	defer func() {
+		in.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	reader := bufio.NewReader(out)
+	id := 0
+	send := func(command string) (string, error) {
+		id++
+		return exchangeGTP(in, reader, id, command)
+	}
+
+	report := ""
+	for _, command := range []string{"name", "version"} {
+		response, err := send(command)
+		if err != nil {
+			response = "(not supported)"
+		}
+		report += fmt.Sprintf("%s: %s\n", command, response)
+	}
+
+	supportedCommands, err := send("list_commands")
+	if err != nil {
+		return report, err
+	}
+	supported := make(map[string]bool)
+	for _, command := range strings.Fields(supportedCommands) {
+		supported[command] = true
+	}
+	for _, command := range []string{"boardsize", "komi", "play", "genmove"} {
+		if !supported[command] {
+			return report, fmt.Errorf("engine does not support required command: %s", command)
+		}
+	}
+
+	for _, command := range startupCommands {
+		if _, err := send(command); err != nil {
+			report += fmt.Sprintf("Startup command %q failed: %v\n", command, err)
+		}
+	}
+
+	// Time a genmove on an empty 9x9 board
+	for _, command := range []string{"boardsize 9", "clear_board", "komi 7"} {
+		if _, err := send(command); err != nil {
+			return report, err
+		}
+	}
+	start := time.Now()
+	move, err := send("genmove b")
+	if err != nil {
+		return report, err
+	}
+	report += fmt.Sprintf("genmove b on empty 9x9: %s in %v\n", move, time.Since(start).Round(time.Millisecond))
+
+	report += "\nOptional commands:\n"
+	for _, optional := range optionalGTPCommands {
+		status := "missing"
+		if supported[optional.command] {
+			status = "supported"
+		}
+		report += fmt.Sprintf("%s (%s): %s\n", optional.command, optional.feature, status)
+	}
+	return report, nil
+}
+
+// Starts the engine process and initializes it with the current position
+func (g *Game) startEngine() error {
+	// Start the GTP engine process
+	args := strings.Fields(g.gtpArgs)
+	g.gtpCmd = exec.Command(g.gtpPath, args...)
+	g.attachedProfile = g.engineProfile()
+
+	var err error
+	g.gtpIn, err = g.gtpCmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	g.gtpOut, err = g.gtpCmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := g.gtpCmd.Start(); err != nil {
+		return err
+	}
+
+	g.gtpReader = bufio.NewReader(g.gtpOut)
+
+	// Initialize the engine; the new process has no genmove to wait for
+	return g.setUpEngine()
+}
+
+func (g *Game) detachEngine() {
+	g.stopSelfPlay()
+	g.endAnalyzeMode()
+	if g.gtpCmd != nil {
+		g.stopEngine()
+		dialog.ShowInformation("Engine Detached", "Successfully detached from the engine.", g.window)
+	}
+}
+
+// Kills the engine process and closes its pipes
+func (g *Game) stopEngine() {
+	// Kill the engine process
+	err := g.gtpCmd.Process.Kill()
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		g.showError(fmt.Errorf("failed to kill engine process: %v", err))
+	}
+
+	// Close stdin pipe
+	if g.gtpIn != nil {
+		err := g.gtpIn.Close()
+		if err != nil {
+			g.showError(fmt.Errorf("failed to close engine stdin: %v", err))
+		}
+		g.gtpIn = nil
+	}
+
+	// Close stdout pipe
+	if g.gtpOut != nil {
+		err := g.gtpOut.Close()
+		if err != nil {
+			g.showError(fmt.Errorf("failed to close engine stdout: %v", err))
+		}
+		g.gtpOut = nil
+	}
+
+	// Wait for the process to exit
+	err = g.gtpCmd.Wait()
+	if err != nil && !strings.Contains(err.Error(), "killed") {
+		g.showError(fmt.Errorf("error while waiting for engine process to exit: %v", err))
+	}
+
+	// Set engine-related variables to nil
+	g.gtpCmd = nil
+	g.gtpReader = nil
+
+	// Replies to genmoves of the stopped process are dropped by finishEngineMove
+	g.genmoveGeneration++
+	g.engineThinking = false
+	g.cancelledGenmoves = 0
+	g.engineSetupPending = false
+}
+
+// Sets up the attached engine for the shown game. While the engine still searches a cancelled genmove,
+// which holds the GTP connection, the setup is left to finishEngineMove so the UI thread does not wait.
+func (g *Game) initializeEngine() error {
+	if g.cancelledGenmoves > 0 {
+		g.engineSetupPending = true
+		return nil
+	}
+	return g.setUpEngine()
+}
+
+// Sends the board size, komi, startup commands and position of the shown game to the engine
+func (g *Game) setUpEngine() error {
+	// Check if the required commands are supported
+	supportedCommands, err := g.sendGTPCommand("list_commands")
+	if err != nil {
+		return err
+	}
+
+	requiredCommands := []string{"boardsize", "komi", "play", "genmove"}
+	for _, cmd := range requiredCommands {
+		if !strings.Contains(supportedCommands, cmd) {
+			return fmt.Errorf("engine does not support required command: %s", cmd)
+		}
+	}
+
+	// Set board size
+	if g.sizeX == g.sizeY {
+		if _, err := g.sendGTPCommand(fmt.Sprintf("boardsize %d", g.sizeX)); err != nil {
+			return err
+		}
+	} else {
+		// Check if rectangular_boardsize is supported
+		if strings.Contains(supportedCommands, "rectangular_boardsize") {
+			if _, err := g.sendGTPCommand(fmt.Sprintf("rectangular_boardsize %d %d", g.sizeX, g.sizeY)); err != nil {
+				return err
+			}
+		} else {
+			return fmt.Errorf("engine does not support rectangular boards and board is not square")
+		}
+	}
+
+	// Set komi
+	if _, err := g.sendGTPCommand(fmt.Sprintf("komi %d", g.komi)); err != nil {
+		return err
+	}
+
+	// Send the startup commands of the attached engine's profile, which may override the settings above
+	for _, command := range g.gtpStartupCommands[g.attachedProfile] {
+		if _, err := g.sendGTPCommand(command); err != nil {
+			return fmt.Errorf("startup command %q failed: %v", command, err)
+		}
+	}
+
+	// Send the current board state to the engine
+	for y := 0; y < g.sizeY; y++ {
+		for x := 0; x < g.sizeX; x++ {
+			stone := g.currentNode.boardState[y][x]
+			if isStone(stone) {
+				coord := g.clientToGTPCoords(x, y)
+				if _, err := g.sendGTPCommand(fmt.Sprintf("play %s %s", stone, coord)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Sends a GTP command and waits for the response, or until the command times out.
+// The exchange runs on its own goroutine; if the engine does not answer in time, it is killed, since its output
+// can no longer be matched to commands, and the user is offered a restart.
+func (g *Game) sendGTPCommand(command string) (string, error) {
+	g.gtpMutex.Lock()
+	defer g.gtpMutex.Unlock()
+	if g.gtpIn == nil || g.gtpReader == nil {
+		return "", fmt.Errorf("engine is not attached")
+	}
+	var expired <-chan time.Time
+	timeout := g.gtpTimeoutFor(command)
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	type gtpResult struct {
+		response string
+		err      error
+	}
+	done := make(chan gtpResult, 1)
+	in, reader, cmd, id := g.gtpIn, g.gtpReader, g.gtpCmd, g.nextGTPID()
+	go func() {
+		response, err := exchangeGTP(in, reader, id, command)
+		done <- gtpResult{response, err}
+	}()
+	select {
+	case result := <-done:
+		return result.response, result.err
+	case <-expired:
+		// Killing the engine ends the blocked read, after which the reader is no longer in use;
+		// every later command fails until the engine is detached
+		if err := cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			fmt.Printf("Error: failed to kill engine process: %v\n", err)
+		}
+		<-done
+		g.runOnUI(func() { g.showEngineNotRespondingDialog(command, timeout) })
+		return "", fmt.Errorf("%w: no response to %q within %v", errEngineNotResponding, command, timeout)
+	}
+}
+
+// Returns the id for the next GTP command sent to the attached engine
+func (g *Game) nextGTPID() int {
+	g.gtpLastID++
+	return g.gtpLastID
+}
+
+// Returned by sendGTPCommand when the engine timed out; the user is told by the recovery dialog
+var errEngineNotResponding = errors.New("engine not responding")
+
+// Seconds to wait for a GTP response and for a genmove response when no timeout is configured
+const (
+	defaultGTPTimeout     = 30
+	defaultGenmoveTimeout = 600
+)
+
+// Returns the seconds to wait for a timeout setting, 0 to wait forever. A setting of 0 stands for
+// the default, so configurations without the setting keep the default; -1 waits forever.
+func timeoutSeconds(setting, defaultSeconds int) int {
+	if setting == 0 {
+		return defaultSeconds
+	}
+	return max(setting, 0)
+}
+
+// Converts seconds entered in the engine settings, 0 to wait forever, into a timeout setting
+func timeoutSetting(seconds int) int {
+	if seconds == 0 {
+		return -1
+	}
+	return seconds
+}
+
+// Returns how long to wait for the response to a GTP command, 0 to wait forever
+func (g *Game) gtpTimeoutFor(command string) time.Duration {
+	fields := strings.Fields(command)
+	if len(fields) > 0 && strings.Contains(fields[0], "genmove") {
+		return time.Duration(timeoutSeconds(g.gtpGenmoveTimeout, defaultGenmoveTimeout)) * time.Second
+	}
+	return time.Duration(timeoutSeconds(g.gtpTimeout, defaultGTPTimeout)) * time.Second
+}
+
+// Tells the user the engine stopped responding and offers to restart it
+func (g *Game) showEngineNotRespondingDialog(command string, timeout time.Duration) {
+	message := widget.NewLabel(fmt.Sprintf("The engine did not respond to \"%s\" within %v and was stopped.", command, timeout))
+	dialog.ShowCustomConfirm("Engine Not Responding", "Restart Engine", "Close", message, func(restart bool) {
+		g.detachEngine()
+		if restart {
+			g.attachEngine()
+		}
+	}, g.window)
+}
+
+// Sends a GTP command tagged with the given id to an engine and reads its response.
+// Lines outside responses and responses tagged with another id, such as late answers
+// to commands that timed out, are skipped so stray output cannot desynchronize the reader.
+func exchangeGTP(in io.Writer, reader *bufio.Reader, id int, command string) (string, error) {
+	// Send command
+	_, err := in.Write([]byte(fmt.Sprintf("%d %s\n", id, command)))
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("GTP command sent:\n%d %s\n", id, command)
+
+	// Read response
+	var responseLines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if line[0] == '=' || line[0] == '?' {
+			// Response start, tagged with the id of the command it answers
+			rest := line[1:]
+			responseID := rest[:len(rest)-len(strings.TrimLeft(rest, "0123456789"))]
+			rest = strings.TrimSpace(rest[len(responseID):])
+			if rest != "" {
+				responseLines = append(responseLines, rest)
+			}
+			// Read any additional output lines
+			for {
+				nextLine, err := reader.ReadString('\n')
+				if err != nil {
+					return "", err
+				}
+				nextLine = strings.TrimSpace(nextLine)
+				if nextLine == "" {
+					break
+				}
+				responseLines = append(responseLines, nextLine)
+			}
+			if responseID != "" && responseID != strconv.Itoa(id) {
+				fmt.Printf("GTP response to command %s ignored while waiting for %d\n", responseID, id)
+				responseLines = nil
+				continue
+			}
+			response := strings.Join(responseLines, "\n")
+			fmt.Println("GTP response recieved:\n" + response)
+			if line[0] == '?' {
+				return response, fmt.Errorf("error from engine: %s", strings.Join(responseLines, "\n"))
+			}
+			return response, nil
+		}
+	}
+}
+
+// GTP coordinates use letters A-H, J-T (I is skipped), and numbers from 1 upwards
+func (g *Game) clientToGTPCoords(x, y int) string {
+	// Convert x to letter
+	letterRunes := []rune("ABCDEFGHJKLMNOPQRSTUVWXYZ")
+	if x < 0 || x >= len(letterRunes) {
+		return ""
+	}
+	letter := string(letterRunes[x])
+	// GTP coordinates have origin at lower-left corner
+	number := g.sizeY - y
+	return fmt.Sprintf("%s%d", letter, number)
+}
+
+func (g *Game) gtpToClientCoords(coord string) (int, int, error) {
+	if len(coord) < 2 {
+		return 0, 0, fmt.Errorf("invalid GTP coordinate: %s", coord)
+	}
+	letter := coord[:1]
+	numberStr := coord[1:]
+	letterRunes := []rune("ABCDEFGHJKLMNOPQRSTUVWXYZ")
+	x := -1
+	for i, r := range letterRunes {
+		if string(r) == letter {
+			x = i
+			break
+		}
+	}
+	if x == -1 {
+		return 0, 0, fmt.Errorf("invalid GTP coordinate letter, coord: %s, %s", letter, coord)
+	}
+	number, err := strconv.Atoi(numberStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	y := g.sizeY - number
+	if y < 0 || y >= g.sizeY {
+		return 0, 0, fmt.Errorf("invalid GTP coordinate number: %s", numberStr)
+	}
+	return x, y, nil
+}
+
+func (g *Game) playMove(x, y int, player string, informEngine bool) {
+	g.placeMove(x, y, player, informEngine, true)
+}
+
+// Plays a move as playMove does; unless enterExisting is set, a move already among the children
+// is added again as a new variation instead of being entered
+func (g *Game) placeMove(x, y int, player string, informEngine, enterExisting bool) {
+	// Check if the move already exists as a child of the current node
+	if child := g.childWithMove(x, y, player); child != nil && enterExisting {
+		// Move already exists, switch to that node
+		g.currentNode = child
+	} else {
+		if !(x == -1 && y == -1) && !g.isMoveLegal(x, y, player) {
+			g.explainIllegalMove(x, y, player)
+			return
+		}
+		g.currentNode = g.appendMoveNode(g.currentNode, x, y, player)
+		g.currentNode.moveTime = time.Now()
+	}
+
+	g.updateCommentTextbox()
+	g.updateGameTreeUI()
+	g.redrawBoard()
+
+	// Inform the engine of the move if it is attached and informEngine is true
+	if informEngine && g.gtpCmd != nil && g.cancelledGenmoves == 0 {
+		coord := "pass"
+		if x != -1 && y != -1 {
+			coord = g.clientToGTPCoords(x, y)
+		}
+		g.enginePosition.Lock()
+		_, err := g.sendGTPCommand(fmt.Sprintf("play %s %s", player, coord))
+		g.enginePosition.Unlock()
+		if err != nil {
+			g.showError(err)
+			g.detachEngine()
+		}
+	}
+}
+
+// Creates a child of parent for the move at (x, y), or a pass if both are -1, capturing stones as needed.
+// Legality is not checked.
+func (g *Game) appendMoveNode(parent *GameTreeNode, x, y int, player string) *GameTreeNode {
+	newNode := g.newGameTreeNode()
+	newNode.boardState = goban.CopyBoard(parent.boardState)
+	newNode.player = player
+	newNode.move = [2]int{-1, -1}
+	newNode.parent = parent
+	if x != -1 || y != -1 {
+		newNode.boardState[y][x] = player
+		newNode.koX, newNode.koY = goban.CaptureStones(newNode.boardState, x, y, player, g.sizeX, g.sizeY)
+		newNode.move = [2]int{x, y}
+	}
+	newNode.boardState = shareRows(newNode.boardState, parent.boardState)
+	parent.children = append(parent.children, newNode)
+	return newNode
+}
+
+// Asks the engine for a move in the background; board input is blocked until it answers or the move
+// is cancelled. Navigating elsewhere meanwhile cancels the move. Only the GTP exchange runs in the
+// background; finishEngineMove applies the reply on the UI thread.
+func (g *Game) requestEngineMove(player string) {
+	if g.engineThinking || g.analyzing {
+		return
+	}
+	g.engineThinking = true
+	g.genmoveGeneration++
+	generation, node, cmd := g.genmoveGeneration, g.currentNode, g.gtpCmd
+	previous := g.genmoveDone
+	done := make(chan struct{})
+	g.genmoveDone = done
+	command := fmt.Sprintf("genmove %s", player)
+	g.redrawBoard()
+	go func() {
+		if previous != nil {
+			<-previous // A cancelled genmove is handled first, which sets up the engine's board again
+		}
+		g.enginePosition.Lock()
+		engineMove, err := g.sendGTPCommand(command)
+		g.enginePosition.Unlock()
+		g.runOnUI(func() {
+			defer close(done)
+			g.finishEngineMove(cmd, generation, node, engineMove, err)
+		})
+	}()
+}
+
+// Applies the reply to the genmove of the given generation. The reply to a cancelled genmove is dropped; since the
+// engine played that move on its board, the current position is set up there again once no other cancelled
+// genmove is still searching. Replies of an engine process that has since been stopped are dropped as well.
+func (g *Game) finishEngineMove(cmd *exec.Cmd, generation int, node *GameTreeNode, engineMove string, err error) {
+	if cmd != g.gtpCmd {
+		return
+	}
+	if generation != g.genmoveGeneration {
+		g.cancelledGenmoves--
+		if g.cancelledGenmoves > 0 || err != nil {
+			return
+		}
+		setUp := g.updateEngineBoardState
+		if g.engineSetupPending {
+			g.engineSetupPending = false
+			setUp = g.initializeEngine
+		}
+		if err := setUp(); err != nil {
+			g.showError(err)
+			g.detachEngine()
+			return
+		}
+		if next := goban.SwitchPlayer(g.currentNode.player); g.gtpColor == next && !g.analyzing {
+			g.requestEngineMove(next)
+		}
+		return
+	}
+	g.engineThinking = false
+	if err != nil {
+		g.premove = nil
+		g.showError(err)
+		g.detachEngine()
+		g.redrawBoard()
+		return
+	}
+	if g.currentNode != node {
+		g.premove = nil
+		g.redrawBoard()
+		return
+	}
+	if !g.handleEngineMove(engineMove) {
+		g.premove = nil
+		g.redrawBoard()
+		return
+	}
+	g.playPremove()
+}
+
+// Stops waiting for the pending genmove. GTP cannot interrupt a search, so the engine finishes it and
+// finishEngineMove drops the late reply by its generation; until then the engine's board is left alone.
+func (g *Game) cancelEngineMove() {
+	if !g.engineThinking {
+		return
+	}
+	g.genmoveGeneration++
+	g.cancelledGenmoves++
+	g.engineThinking = false
+	g.premove = nil
+	g.scoringStatus.SetText("Engine move cancelled.")
+	g.redrawBoard()
+}
+
+// Plays the queued premove if it is still the premover's turn and the move is still legal
+func (g *Game) playPremove() {
+	premove := g.premove
+	if premove == nil {
+		return
+	}
+	g.premove = nil
+	if goban.SwitchPlayer(g.currentNode.player) != premove.player || !g.isMoveLegal(premove.x, premove.y, premove.player) {
+		g.redrawBoard()
+		return
+	}
+	g.playMove(premove.x, premove.y, premove.player, true)
+	g.warnAtari(premove.player)
+	if g.gtpCmd != nil && g.gtpColor == goban.SwitchPlayer(premove.player) {
+		g.requestEngineMove(g.gtpColor)
+	}
+}
+
+// Removes the queued premove
+func (g *Game) cancelPremove() {
+	if g.premove != nil {
+		g.premove = nil
+		g.redrawBoard()
+	}
+}
+
+// Draws the queued premove as a translucent stone with an outline
+func (g *Game) drawPremove() {
+	circle := canvas.NewCircle(transparentBlackColor)
+	if g.premove.player == white {
+		circle.FillColor = transparentWhiteColor
+	}
+	circle.StrokeColor = purpleColor
+	circle.StrokeWidth = max(1, g.cellSize*0.06)
+	circle.Resize(fyne.NewSize(g.cellSize, g.cellSize))
+	circle.Move(g.boardCoordsToPixel(g.premove.x, g.premove.y))
+	g.gridContainer.Add(circle)
+}
+
+// Places the touch cursor at the point nearest to the tap. Taps up to a point beyond the edge still count,
+// so that the edge points are as easy to reach as the others.
+func (g *Game) placeTouchCursor(pos fyne.Position) {
+	size := g.boardCanvas.Size()
+	fx := ((pos.X*2-size.Width)/g.cellSize + float32(g.sizeX)) / 2
+	fy := ((pos.Y*2-size.Height)/g.cellSize + float32(g.sizeY)) / 2
+	if fx < -1 || fx >= float32(g.sizeX+1) || fy < -1 || fy >= float32(g.sizeY+1) {
+		return
+	}
+	x := min(max(int(math.Floor(float64(fx))), 0), g.sizeX-1)
+	y := min(max(int(math.Floor(float64(fy))), 0), g.sizeY-1)
+	g.touchCursor = &[2]int{x, y}
+	g.redrawBoard()
+}
+
+// Plays the move at the touch cursor as a click on its point would
+func (g *Game) confirmTouchMove() {
+	if g.touchCursor == nil {
+		return
+	}
+	pos := g.boardCoordsToPixel(g.touchCursor[0], g.touchCursor[1])
+	g.touchCursor = nil
+	g.handleMouseClick(&fyne.PointEvent{Position: pos.AddXY(g.cellSize/2, g.cellSize/2)})
+	g.redrawBoard()
+}
+
+// Shows the confirm button in touch input mode and draws the touch cursor: a ring on its point and,
+// since the finger hides the point, a magnified stone above it
+func (g *Game) updateTouchInput() {
+	if g.confirmMoveButton == nil {
+		return
+	}
+	if !g.touchInput || g.mouseMode != "play" {
+		g.touchCursor = nil
+		g.confirmMoveButton.Hide()
+		return
+	}
+	g.confirmMoveButton.Show()
+	if g.touchCursor == nil {
+		g.confirmMoveButton.Disable()
+		return
+	}
+	g.confirmMoveButton.Enable()
+	x, y := g.touchCursor[0], g.touchCursor[1]
+	pos := g.boardCoordsToPixel(x, y)
+	ring := canvas.NewCircle(color.Transparent)
+	ring.StrokeColor = purpleColor
+	ring.StrokeWidth = max(2, g.cellSize*0.1)
+	ring.Resize(fyne.NewSize(g.cellSize, g.cellSize))
+	ring.Move(pos)
+	g.gridContainer.Add(ring)
+
+	magnifier := canvas.NewCircle(transparentBlackColor)
+	if goban.SwitchPlayer(g.currentNode.player) == white {
+		magnifier.FillColor = transparentWhiteColor
+	}
+	magnifier.StrokeColor = purpleColor
+	magnifier.StrokeWidth = ring.StrokeWidth
+	diameter := g.cellSize * 2.5
+	magnifier.Resize(fyne.NewSize(diameter, diameter))
+	offsetY := -3 * g.cellSize
+	if pos.Y+offsetY < 0 {
+		offsetY = 1.5 * g.cellSize // No room above, so show it below
+	}
+	magnifier.Move(fyne.NewPos(pos.X+(g.cellSize-diameter)/2, pos.Y+offsetY))
+	g.gridContainer.Add(magnifier)
+}
+
+// Tells the user board input is blocked while the engine thinks
+func (g *Game) drawThinkingIndicator() {
+	text := canvas.NewText("Engine is thinking...", purpleColor)
+	text.TextSize = max(12, g.cellSize*0.4)
+	text.TextStyle = fyne.TextStyle{Bold: true}
+	text.Move(g.boardCoordsToPixel(0, 0))
+	g.gridContainer.Add(text)
+}
+
+// Plays the move the engine answered. Returns false if the engine resigned or its move was rejected,
+// which ends the engine's turn.
+func (g *Game) handleEngineMove(coord string) bool {
+	coord = strings.TrimSpace(coord)
+	if coord == "resign" {
+		g.recordEngineMatch(goban.SwitchPlayer(g.currentNode.player), "R")
+		dialog.ShowInformation("Engine Resigned", "The engine has resigned.", g.window)
+		return false
+	}
+	x, y, err := g.checkEngineMove(coord)
+	if err != nil {
+		g.showError(fmt.Errorf("%v; the engine's turn was stopped", err))
+		// The engine has played the move on its own board, so it is given the position again
+		if err := g.updateEngineBoardState(); err != nil {
+			g.showError(err)
+			g.detachEngine()
+		}
+		return false
+	}
+	player := goban.SwitchPlayer(g.currentNode.player)
+	g.playMove(x, y, player, false) // Do not inform the engine of its own move
+	return true
+}
+
+// Reads the move the engine answered and checks the player to move may play it. GTP has no way to tell
+// the engine about blocked points, so on an irregular board it may pick one. Returns (-1, -1) for a pass.
+func (g *Game) checkEngineMove(coord string) (int, int, error) {
+	if coord == "pass" {
+		return -1, -1, nil
+	}
+	x, y, err := g.gtpToClientCoords(coord)
+	if err != nil {
+		return 0, 0, err
+	}
+	if x >= g.sizeX {
+		return 0, 0, fmt.Errorf("engine played %s, which is off the board", coord)
+	}
+	if g.currentNode.boardState[y][x] == blocked {
+		return 0, 0, fmt.Errorf("engine played %s, which is a blocked point", coord)
+	}
+	if !g.isMoveLegal(x, y, goban.SwitchPlayer(g.currentNode.player)) {
+		return 0, 0, fmt.Errorf("engine played the illegal move %s", coord)
+	}
+	return x, y, nil
+}
+
+// A finished game against an engine, from the side of the human player
+type engineMatch struct {
+	Date        string  `json:"date"`
+	HumanColor  string  `json:"humanColor"`
+	Handicap    int     `json:"handicap"`    // Black stones placed before the first move
+	Won         bool    `json:"won"`         // The human player won
+	Margin      int     `json:"margin"`      // Points won by, negative if lost; 0 for a resignation or a draw
+	Resigned    bool    `json:"resigned"`    // The game ended by resignation
+	Moves       int     `json:"moves"`       // Moves of the human player
+	MoveSeconds float64 `json:"moveSeconds"` // Average seconds the human player took per move
+}
+
+// Games against each engine, by engine command line
+type matchHistory map[string][]engineMatch
+
+// GTP startup commands by engine command line
+type startupCommands map[string][]string
+
+// Names the attached engine by its command line, so each engine setup keeps its own statistics
+func (g *Game) engineProfile() string {
+	return strings.TrimSpace(g.gtpPath + " " + g.gtpArgs)
+}
+
+// Records the result of the game against the attached engine: the winner, or "" for a draw,
+// and the margin, "R" for a resignation. Games without a human side, and games already recorded, are ignored.
+func (g *Game) recordEngineMatch(winner, margin string) {
+	if g.gtpCmd == nil || (g.gtpColor != black && g.gtpColor != white) || g.matchRoot == g.rootNode {
+		return
+	}
+	g.matchRoot = g.rootNode
+	human := goban.SwitchPlayer(g.gtpColor)
+	match := engineMatch{
+		Date:       time.Now().Format("2006-01-02"),
+		HumanColor: human,
+		Won:        winner == human,
+		Resigned:   margin == "R",
+	}
+	if points, err := strconv.Atoi(margin); err == nil {
+		match.Margin = points
+		if winner != human {
+			match.Margin = -points
+		}
+	}
+	for _, row := range g.rootNode.boardState {
+		for _, stone := range row {
+			if stone == black {
+				match.Handicap++
+			}
+		}
+	}
+	thinking := time.Duration(0)
+	timed := 0
+	for node := g.currentNode; node.parent != nil; node = node.parent {
+		if !node.hasMove() || node.player != human {
+			continue
+		}
+		match.Moves++
+		if !node.moveTime.IsZero() && !node.parent.moveTime.IsZero() {
+			thinking += node.moveTime.Sub(node.parent.moveTime)
+			timed++
+		}
+	}
+	if timed > 0 {
+		match.MoveSeconds = thinking.Seconds() / float64(timed)
+	}
+	if g.engineMatches == nil {
+		g.engineMatches = make(matchHistory)
+	}
+	profile := g.engineProfile()
+	g.engineMatches[profile] = append(g.engineMatches[profile], match)
+	if g.practicing {
+		g.advancePractice(profile, match)
+	}
+	if err := g.saveConfig(); err != nil {
+		g.showError(fmt.Errorf("failed to save config: %v", err))
+	}
+}
+
+// Stones the human player received in a match: the handicap as Black, minus the handicap as White
+func (m engineMatch) stonesReceived() int {
+	if m.HumanColor == black {
+		return m.Handicap
+	}
+	return -m.Handicap
+}
+
+// Describes playing with the given number of stones received
+func handicapName(received int) string {
+	switch {
+	case received >= 2:
+		return fmt.Sprintf("Black with %d handicap stones", received)
+	case received <= -2:
+		return fmt.Sprintf("White giving %d handicap stones", -received)
+	}
+	return "an even game"
+}
+
+// Summarizes the games against the engine by color and handicap, and suggests a handicap from the recent games:
+// a stone fewer after winning 7 of the last 10, a stone more after losing 7 of them
+func summarizeMatches(matches []engineMatch) string {
+	type group struct {
+		color                      string
+		handicap                   int
+		games, wins, scored, draws int
+		margin, seconds            float64
+	}
+	groups := []*group{}
+	for _, match := range matches {
+		var found *group
+		for _, candidate := range groups {
+			if candidate.color == match.HumanColor && candidate.handicap == match.Handicap {
+				found = candidate
+			}
+		}
+		if found == nil {
+			found = &group{color: match.HumanColor, handicap: match.Handicap}
+			groups = append(groups, found)
+		}
+		found.games++
+		if match.Won {
+			found.wins++
+		}
+		if !match.Resigned {
+			found.scored++
+			found.margin += float64(match.Margin)
+			if match.Margin == 0 {
+				found.draws++
+			}
+		}
+		found.seconds += match.MoveSeconds
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].color != groups[j].color {
+			return groups[i].color < groups[j].color
+		}
+		return groups[i].handicap < groups[j].handicap
+	})
+	lines := []string{}
+	for _, group := range groups {
+		line := fmt.Sprintf("As %s, handicap %d: %d games, %d won, %d lost", playerName(group.color), group.handicap,
+			group.games, group.wins, group.games-group.wins-group.draws)
+		if group.scored > 0 {
+			line += fmt.Sprintf(", average margin %+.1f", group.margin/float64(group.scored))
+		}
+		line += fmt.Sprintf(", %.1f s per move", group.seconds/float64(group.games))
+		lines = append(lines, line)
+	}
+
+	recent := matches[max(0, len(matches)-10):]
+	last := recent[len(recent)-1]
+	wins := 0
+	for _, match := range recent {
+		if match.Won {
+			wins++
+		}
+	}
+	received := last.stonesReceived()
+	switch {
+	case len(recent) < 5:
+		lines = append(lines, fmt.Sprintf("\nPlay %d more games for a handicap suggestion.", 5-len(recent)))
+	case wins*10 >= len(recent)*7:
+		lines = append(lines, fmt.Sprintf("\nYou won %d of the last %d games: try %s.", wins, len(recent), handicapName(stepHandicap(received, -1))))
+	case wins*10 <= len(recent)*3:
+		lines = append(lines, fmt.Sprintf("\nYou won %d of the last %d games: try %s.", wins, len(recent), handicapName(stepHandicap(received, 1))))
+	default:
+		lines = append(lines, fmt.Sprintf("\nYou won %d of the last %d games: %s suits you.", wins, len(recent), handicapName(received)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Changes the stones received by one step; a single stone is no handicap, so 2 stones step to and from an even game
+func stepHandicap(received, step int) int {
+	received += step
+	if received == 1 || received == -1 {
+		received += step
+	}
+	return received
+}
+
+// Level of the handicap practice against an engine
+type practiceLevel struct {
+	Received int `json:"received"` // Handicap stones the human player receives, negative when giving them
+	Losses   int `json:"losses"`   // Losses in a row at this level
+	Games    int `json:"games"`    // Practice games played
+}
+
+// Practice levels by engine command line
+type practiceLadder map[string]practiceLevel
+
+// Most handicap stones of a practice game
+const maxPracticeHandicap = 9
+
+// Moves the practice level after a practice game: a win takes away a stone, two losses in a row add one
+func (g *Game) advancePractice(profile string, match engineMatch) {
+	if g.practiceLadder == nil {
+		g.practiceLadder = make(practiceLadder)
+	}
+	level := g.practiceLadder[profile]
+	level.Games++
+	switch {
+	case match.Won:
+		level.Received = max(stepHandicap(level.Received, -1), -maxPracticeHandicap)
+		level.Losses = 0
+	case match.Resigned || match.Margin != 0:
+		level.Losses++
+		if level.Losses >= 2 {
+			level.Received = min(stepHandicap(level.Received, 1), maxPracticeHandicap)
+			level.Losses = 0
+		}
+	}
+	g.practiceLadder[profile] = level
+	g.practicing = false
+	g.scoringStatus.SetText(fmt.Sprintf("Practice ladder: the next game is %s.", handicapName(level.Received)))
+}
+
+// Handicap points in the order of the GTP fixed_handicap command: the corner points, then the middle of the sides,
+// then the center, which only odd sizes have. Boards too small for star points have none.
+func handicapPoints(sizeX, sizeY, stones int) [][2]int {
+	if sizeX < 7 || sizeY < 7 {
+		return nil
+	}
+	edgeX, edgeY := 2, 2
+	if sizeX >= 13 {
+		edgeX = 3
+	}
+	if sizeY >= 13 {
+		edgeY = 3
+	}
+	left, right, top, bottom := edgeX, sizeX-1-edgeX, edgeY, sizeY-1-edgeY
+	centerX, centerY := sizeX/2, sizeY/2
+	odd := sizeX%2 == 1 && sizeY%2 == 1
+	points := [][2]int{{left, bottom}, {right, top}, {left, top}, {right, bottom}}
+	switch {
+	case stones >= 8 && odd:
+		points = append(points, [2]int{left, centerY}, [2]int{right, centerY}, [2]int{centerX, bottom}, [2]int{centerX, top})
+	case stones >= 6 && odd:
+		points = append(points, [2]int{left, centerY}, [2]int{right, centerY})
+	}
+	if odd && stones%2 == 1 && stones >= 5 {
+		points = append(points, [2]int{centerX, centerY})
+	}
+	return points[:min(stones, len(points))]
+}
+
+// Starts a game against the engine at the practice level: the human player takes Black with the handicap
+// stones received, or White giving them. Its result moves the practice level.
+func (g *Game) startPracticeGame() {
+	if g.gtpPath == "" {
+		g.showError(fmt.Errorf("set up an engine in the engine settings first"))
+		return
+	}
+	g.stopBroadcast()
+	if g.selfPlaying {
+		g.stopSelfPlay()
+	}
+	level := g.practiceLadder[g.engineProfile()]
+	stones := max(level.Received, -level.Received)
+	points := handicapPoints(g.sizeX, g.sizeY, stones)
+	if stones >= 2 && len(points) < stones {
+		g.showError(fmt.Errorf("a %dx%d board has no room for %d handicap stones", g.sizeX, g.sizeY, stones))
+		return
+	}
+	g.gtpColor = white
+	if level.Received <= -2 {
+		g.gtpColor = black
+	}
+	g.initializeBoard()
+	if stones >= 2 {
+		root := g.rootNode
+		for _, point := range points {
+			root.setPoint(point[0], point[1], black)
+			root.addBlackStone(point[0], point[1])
+		}
+		root.player = black // White moves first after the handicap stones
+		if root.otherProperties == nil {
+			root.otherProperties = make(map[string][]string)
+		}
+		root.otherProperties["HA"] = []string{strconv.Itoa(stones)}
+	}
+	g.practicing = true
+	g.updateGameTreeUI()
+	g.redrawBoard()
+	g.scoringStatus.SetText(fmt.Sprintf("Practice game %d: you play %s.", level.Games+1, handicapName(level.Received)))
+	if g.gtpCmd == nil {
+		g.attachEngine()
+	} else {
+		g.setCurrentNode(g.rootNode)
+	}
+}
+
+// Shows the practice level against the engine and lets it be reset to an even game
+func (g *Game) showPracticeLadder() {
+	profile := g.engineProfile()
+	level := g.practiceLadder[profile]
+	text := fmt.Sprintf("Next game: %s\nPractice games played: %d\nLosses in a row at this level: %d\n\nA win takes away a handicap stone; two losses in a row add one.",
+		handicapName(level.Received), level.Games, level.Losses)
+	dialog.ShowCustomConfirm("Practice Ladder", "Reset", "Close", widget.NewLabel(text), func(reset bool) {
+		if !reset {
+			return
+		}
+		delete(g.practiceLadder, profile)
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
+		}
+	}, g.window)
+}
+
+// Shows the statistics of the games against the attached engine, or the last engine set up
+func (g *Game) showMatchStatistics() {
+	profile := g.engineProfile()
+	matches := g.engineMatches[profile]
+	if len(matches) == 0 {
+		dialog.ShowInformation("Match Statistics", "No finished games against this engine yet.\nGames count once the engine resigns or both players accept the count.", g.window)
+		return
+	}
+	summary := widget.NewLabel(summarizeMatches(matches))
+	content := container.NewVBox(
+		widget.NewLabelWithStyle(profile, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		summary,
+	)
+	statsDialog := dialog.NewCustomConfirm("Match Statistics", "Export CSV", "Close", content, func(export bool) {
+		if export {
+			g.exportMatchStatistics(profile, matches)
+		}
+	}, g.window)
+	statsDialog.Show()
+}
+
+// Writes the games against an engine to a CSV file, one row per game
+func (g *Game) exportMatchStatistics(profile string, matches []engineMatch) {
+	dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil || writer == nil {
+			return
+		}
+		defer writer.Close()
+		out := csv.NewWriter(writer)
+		out.Write([]string{"engine", "date", "color", "handicap", "result", "margin", "moves", "seconds per move"})
+		for _, match := range matches {
+			result := "lost"
+			if match.Won {
+				result = "won"
+			} else if !match.Resigned && match.Margin == 0 {
+				result = "draw"
+			}
+			margin := strconv.Itoa(match.Margin)
+			if match.Resigned {
+				margin = "resignation"
+			}
+			out.Write([]string{profile, match.Date, playerName(match.HumanColor), strconv.Itoa(match.Handicap), result, margin,
+				strconv.Itoa(match.Moves), strconv.FormatFloat(match.MoveSeconds, 'f', 1, 64)})
+		}
+		out.Flush()
+		if err := out.Error(); err != nil {
+			g.showError(err)
+		}
+	}, g.window)
+}
+
+// A finished game of a match, kept as SGF since the board is reused for the next game
+type matchGame struct {
+	black  int    // Index into the match players of the player who took Black
+	result string // Result as in the RE property: B+..., W+..., 0 for a draw or Void
+	sgf    string
+}
+
+// A match of several games between two players
+type gameMatch struct {
+	name       string    // Event name written to every game
+	players    [2]string // Player names
+	games      int       // Games of the match; in a best of match, the most games it can take
+	bestOf     bool      // The match ends once a player has won more than half of the games
+	colors     string    // How colors are assigned, one of matchColorModes
+	komi       int
+	played     []matchGame
+	blackIndex int // Index into players of Black in the game being played
+}
+
+// Ways of assigning colors in a match
+var matchColorModes = []string{"Alternate, first player takes Black", "Nigiri, then alternate", "Nigiri every game"}
+
+// Returns the winner of a game result: black, white, "" for a draw, or "?" if the game does not count
+func resultWinner(result string) string {
+	result = strings.TrimSpace(result)
+	switch {
+	case strings.HasPrefix(result, "B+"):
+		return black
+	case strings.HasPrefix(result, "W+"):
+		return white
+	case result == "0" || strings.EqualFold(result, "Draw") || strings.EqualFold(result, "Jigo"):
+		return ""
+	}
+	return "?"
+}
+
+// Returns the points of the two players after the games played: one per win, half per draw
+func (m *gameMatch) score() [2]float64 {
+	var points [2]float64
+	for _, game := range m.played {
+		switch resultWinner(game.result) {
+		case black:
+			points[game.black]++
+		case white:
+			points[1-game.black]++
+		case "":
+			points[0] += 0.5
+			points[1] += 0.5
+		}
+	}
+	return points
+}
+
+// Reports whether the match is over: all games played, or a best of match won
+func (m *gameMatch) decided() bool {
+	if len(m.played) >= m.games {
+		return true
+	}
+	points := m.score()
+	return m.bestOf && max(points[0], points[1]) > float64(m.games)/2
+}
+
+// Formats the running score, such as "Lee 2 – Park 1½"
+func (m *gameMatch) formatScore() string {
+	points := m.score()
+	format := func(p float64) string {
+		if p != float64(int(p)) {
+			return fmt.Sprintf("%d½", int(p))
+		}
+		return strconv.Itoa(int(p))
+	}
+	return fmt.Sprintf("%s %s – %s %s", m.players[0], format(points[0]), m.players[1], format(points[1]))
+}
+
+// Asks for the players and format of a match, then starts its first game
+func (g *Game) showStartMatchDialog() {
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText(g.gameInfoDefaults["EV"])
+	nameEntry.SetPlaceHolder("Match")
+	firstEntry := widget.NewEntry()
+	firstEntry.SetText(g.gameInfoDefaults["PB"])
+	secondEntry := widget.NewEntry()
+	secondEntry.SetText(g.gameInfoDefaults["PW"])
+	gamesEntry := widget.NewEntry()
+	gamesEntry.SetText("3")
+	formatSelect := widget.NewSelect([]string{"Best of", "Fixed number of games"}, nil)
+	formatSelect.SetSelectedIndex(0)
+	colorsSelect := widget.NewSelect(matchColorModes, nil)
+	colorsSelect.SetSelectedIndex(1)
+	komiEntry := widget.NewEntry()
+	komiEntry.SetText(strconv.Itoa(g.komi))
+	items := []*widget.FormItem{
+		widget.NewFormItem("Match Name", nameEntry),
+		widget.NewFormItem("First Player", firstEntry),
+		widget.NewFormItem("Second Player", secondEntry),
+		widget.NewFormItem("Games", gamesEntry),
+		widget.NewFormItem("Format", formatSelect),
+		widget.NewFormItem("Colors", colorsSelect),
+		widget.NewFormItem("Komi", komiEntry),
+	}
+	dialog.ShowForm("Start Match", "Start", "Cancel", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		games, err := strconv.Atoi(strings.TrimSpace(gamesEntry.Text))
+		if err != nil || games < 1 {
+			g.showError(fmt.Errorf("the number of games must be a positive whole number"))
+			return
+		}
+		komi, err := strconv.Atoi(strings.TrimSpace(komiEntry.Text))
+		if err != nil {
+			g.showError(fmt.Errorf("invalid komi: %v", err))
+			return
+		}
+		match := &gameMatch{
+			name:    strings.TrimSpace(nameEntry.Text),
+			players: [2]string{strings.TrimSpace(firstEntry.Text), strings.TrimSpace(secondEntry.Text)},
+			games:   games,
+			bestOf:  formatSelect.SelectedIndex() == 0,
+			colors:  colorsSelect.Selected,
+			komi:    komi,
+		}
+		if match.name == "" {
+			match.name = "Match"
+		}
+		for i, fallback := range []string{"Player 1", "Player 2"} {
+			if match.players[i] == "" {
+				match.players[i] = fallback
+			}
+		}
+		g.match = match
+		g.startMatchGame()
+	}, g.window)
+}
+
+// Clears the board for the next game of the match, with its players, komi, event and round in the game info
+func (g *Game) startMatchGame() {
+	g.stopBroadcast()
+	m := g.match
+	switch {
+	case m.colors == matchColorModes[2] || (m.colors == matchColorModes[1] && len(m.played) == 0):
+		m.blackIndex = rand.Intn(2)
+	case len(m.played) == 0:
+		m.blackIndex = 0
+	default:
+		m.blackIndex = 1 - m.played[len(m.played)-1].black
+	}
+	g.komi = m.komi
+	g.initializeBoard()
+	g.gameInfo["PB"] = m.players[m.blackIndex]
+	g.gameInfo["PW"] = m.players[1-m.blackIndex]
+	g.gameInfo["EV"] = m.name
+	g.gameInfo["RO"] = fmt.Sprintf("Game %d", len(m.played)+1)
+	delete(g.gameInfo, "RE")
+	g.savedSGF = generateSGF(g.rootNode, g.sizeX, g.sizeY, g.komi, g.exportGameInfo(), g.passValue())
+	g.updateGameNotes()
+	g.redrawBoard()
+	g.updateGameTreeUI()
+	g.scoringStatus.SetText(fmt.Sprintf("%s, game %d: %s (Black) against %s (White). Score: %s",
+		m.name, len(m.played)+1, m.players[m.blackIndex], m.players[1-m.blackIndex], m.formatScore()))
+}
+
+// Records the result of the current match game and starts the next game, unless the match is decided
+func (g *Game) finishMatchGame() {
+	m := g.match
+	if m == nil {
+		g.showError(fmt.Errorf("no match is being played; start one with Game > Start Match"))
+		return
+	}
+	if m.decided() {
+		g.showError(fmt.Errorf("%s is over; Game > Match Score exports its games", m.name))
+		return
+	}
+	resultEntry := widget.NewEntry()
+	resultEntry.SetText(g.gameInfo["RE"])
+	resultEntry.SetPlaceHolder("B+R, W+5, 0 for a draw, Void")
+	dialog.ShowForm(fmt.Sprintf("Finish Game %d", len(m.played)+1), "Record", "Cancel",
+		[]*widget.FormItem{widget.NewFormItem("Result", resultEntry)}, func(ok bool) {
+			if !ok {
+				return
+			}
+			result := strings.TrimSpace(resultEntry.Text)
+			if resultWinner(result) == "?" && !strings.EqualFold(result, "Void") {
+				g.showError(fmt.Errorf("the result must start with B+ or W+, or be 0, Draw or Void"))
+				return
+			}
+			game := matchGame{black: m.blackIndex, result: result}
+			m.played = append(m.played, game)
+			g.gameInfo["RE"] = result
+			g.gameInfo["RO"] = fmt.Sprintf("Game %d (match score after it: %s)", len(m.played), m.formatScore())
+			m.played[len(m.played)-1].sgf = generateSGF(g.rootNode, g.sizeX, g.sizeY, g.komi, g.exportGameInfo(), g.passValue())
+			if !m.decided() {
+				g.startMatchGame()
+				return
+			}
+			g.scoringStatus.SetText(fmt.Sprintf("%s is over. Final score: %s", m.name, m.formatScore()))
+			g.showMatchScore()
+		}, g.window)
+}
+
+// Lists the games of the match with the running score, offering to export them as one SGF collection
+func (g *Game) showMatchScore() {
+	m := g.match
+	if m == nil {
+		dialog.ShowInformation("Match Score", "No match is being played. Start one with Game > Start Match.", g.window)
+		return
+	}
+	format := fmt.Sprintf("%d games", m.games)
+	if m.bestOf {
+		format = fmt.Sprintf("best of %d", m.games)
+	}
+	lines := []string{fmt.Sprintf("%s, %s, komi %d", m.name, format, m.komi), ""}
+	running := gameMatch{players: m.players}
+	for i, game := range m.played {
+		running.played = m.played[:i+1]
+		lines = append(lines, fmt.Sprintf("Game %d: %s (B) – %s (W), %s; %s",
+			i+1, m.players[game.black], m.players[1-game.black], game.result, running.formatScore()))
+	}
+	if m.decided() {
+		lines = append(lines, "", "Final score: "+m.formatScore())
+	} else {
+		lines = append(lines, "", fmt.Sprintf("Game %d in progress: %s takes Black", len(m.played)+1, m.players[m.blackIndex]))
+	}
+	var scoreDialog dialog.Dialog
+	exportButton := widget.NewButton("Export Collection", func() {
+		g.exportMatchCollection(m)
+	})
+	if len(m.played) == 0 {
+		exportButton.Disable()
+	}
+	endButton := widget.NewButton("End Match", func() {
+		scoreDialog.Hide()
+		g.match = nil
+		g.scoringStatus.SetText(fmt.Sprintf("%s ended. Score: %s", m.name, m.formatScore()))
+	})
+	content := container.NewVBox(widget.NewLabel(strings.Join(lines, "\n")), container.NewHBox(exportButton, endButton))
+	scoreDialog = dialog.NewCustom("Match Score", "Close", content, g.window)
+	scoreDialog.Show()
+}
+
+// Saves the finished games of the match in one SGF collection, each game carrying the event and the round with the running score
+func (g *Game) exportMatchCollection(m *gameMatch) {
+	saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil || writer == nil {
+			return
+		}
+		defer writer.Close()
+		for _, game := range m.played {
+			if _, err := io.WriteString(writer, game.sgf+"\n"); err != nil {
+				g.showError(err)
+				return
+			}
+		}
+	}, g.window)
+	saveDialog.SetFileName(m.name + ".sgf")
+	saveDialog.Show()
+}
+
+func (g *Game) updateCommentTextbox() {
+	if g.currentNode != nil && g.currentNode.Comment != "" {
+		g.commentEntry.SetText(g.currentNode.Comment)
+	} else {
+		g.commentEntry.SetText("") // Clears the textbox if there's no comment
+	}
+	if g.previewingComment {
+		g.commentPreview.ParseMarkdown(g.commentEntry.Text)
+	}
+	g.updateAudioControls()
+	g.updateTagsLabel()
+}
+
+// Shows the tags of the current node under the comment
+func (g *Game) updateTagsLabel() {
+	if g.tagsLabel == nil {
+		return
+	}
+	if g.currentNode == nil || len(g.currentNode.tags) == 0 {
+		g.tagsLabel.SetText("")
+		g.tagsLabel.Hide()
+		return
+	}
+	g.tagsLabel.SetText("Tags: " + strings.ReplaceAll(formatNodeTags(g.currentNode.tags), "\n", "; "))
+	g.tagsLabel.Show()
+}
+
+// Shows the audio note of the current node and enables the matching controls
+func (g *Game) updateAudioControls() {
+	if g.audioLabel == nil {
+		return
+	}
+	if g.currentNode == nil || g.currentNode.audioNote == "" {
+		g.audioLabel.SetText("No audio note")
+		g.playAudioButton.Disable()
+		g.removeAudioButton.Disable()
+		return
+	}
+	g.audioLabel.SetText(filepath.Base(g.currentNode.audioNote))
+	g.playAudioButton.Enable()
+	g.removeAudioButton.Enable()
+}
+
+// Resolves an audio note relative to the directory of the current SGF file
+func (g *Game) resolveAudioPath(note string) string {
+	if filepath.IsAbs(note) || g.sgfPath == "" {
+		return note
+	}
+	return filepath.Join(filepath.Dir(g.sgfPath), note)
+}
+
+// Lets the user pick an audio clip for the current node
+func (g *Game) attachAudioNote() {
+	node := g.currentNode
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		defer reader.Close()
+		node.audioNote = reader.URI().Path()
+		g.updateAudioControls()
+	}, g.window)
+}
+
+// Opens the audio note of the current node in the system audio player
+func (g *Game) playAudioNote() {
+	if g.currentNode.audioNote == "" {
+		return
+	}
+	path := g.resolveAudioPath(g.currentNode.audioNote)
+	if _, err := os.Stat(path); err != nil {
+		g.showError(fmt.Errorf("audio note not found: %v", err))
+		return
+	}
+	audioURL, err := url.Parse(storage.NewFileURI(path).String())
+	if err != nil {
+		g.showError(err)
+		return
+	}
+	if err := fyne.CurrentApp().OpenURL(audioURL); err != nil {
+		g.showError(err)
+	}
+}
+
+// Copies the audio notes of every node next to the SGF file at sgfPath and returns the reference each node
+// gets there: the file name of its copy, or the full path of a clip that could not be copied. Clips of the
+// same name from different folders get distinct names. The nodes themselves are left unchanged.
+func (g *Game) copyAudioNotes(sgfPath string) (map[*GameTreeNode]string, error) {
+	dir := filepath.Dir(sgfPath)
+	notes := make(map[*GameTreeNode]string)
+	taken := make(map[string]string) // Source of the clip copied under each file name
+	var copyErr error
+	forEachNode(g.rootNode, func(node *GameTreeNode) {
+		if node.audioNote == "" {
+			return
+		}
+		source, err := filepath.Abs(g.resolveAudioPath(node.audioNote))
+		if err != nil {
+			source = g.resolveAudioPath(node.audioNote)
+		}
+		name := audioNoteName(dir, source, taken)
+		if target := filepath.Join(dir, name); target != source {
+			if err := copyFile(source, target); err != nil {
+				if copyErr == nil {
+					copyErr = fmt.Errorf("failed to copy audio note %s: %v", source, err)
+				}
+				notes[node] = source
+				return
+			}
+		}
+		notes[node] = name
+	})
+	return notes, copyErr
+}
+
+// Returns the file name under which the clip at source is kept in dir: its own name, or the name with a
+// numeric suffix if another clip of the export or a different file in dir already has it
+func audioNoteName(dir, source string, taken map[string]string) string {
+	ext := filepath.Ext(source)
+	stem := strings.TrimSuffix(filepath.Base(source), ext)
+	for i := 1; ; i++ {
+		name := stem + ext
+		if i > 1 {
+			name = fmt.Sprintf("%s-%d%s", stem, i, ext)
+		}
+		if owner, ok := taken[name]; ok {
+			if owner == source {
+				return name
+			}
+			continue
+		}
+		target := filepath.Join(dir, name)
+		if _, err := os.Stat(target); err == nil && target != source && !sameFileContent(source, target) {
+			continue
+		}
+		taken[name] = source
+		return name
+	}
+}
+
+// Reports whether two files can both be read and hold the same bytes
+func sameFileContent(a, b string) bool {
+	contentA, errA := os.ReadFile(a)
+	contentB, errB := os.ReadFile(b)
+	return errA == nil && errB == nil && bytes.Equal(contentA, contentB)
+}
+
+// Sets the audio note of each node in notes and returns the notes they had before
+func setAudioNotes(notes map[*GameTreeNode]string) map[*GameTreeNode]string {
+	previous := make(map[*GameTreeNode]string, len(notes))
+	for node, note := range notes {
+		previous[node], node.audioNote = node.audioNote, note
+	}
+	return previous
+}
+
+// Programs recording the default microphone into a WAV file, tried in order; the file name is appended
+func audioRecorders() [][]string {
+	switch runtime.GOOS {
+	case "windows":
+		return [][]string{{"sox", "-q", "-t", "waveaudio", "default"}}
+	case "darwin":
+		return [][]string{{"rec", "-q"}, {"ffmpeg", "-loglevel", "error", "-y", "-f", "avfoundation", "-i", ":0"}}
+	default:
+		return [][]string{{"arecord", "-q", "-f", "cd", "-t", "wav"}, {"rec", "-q"}}
+	}
+}
+
+// Starts recording an audio note for the current node, or stops the recording under way.
+// The clip is kept next to the SGF file, or in the temporary folder until the game is exported.
+func (g *Game) toggleAudioRecording() {
+	if g.audioRecorder != nil {
+		if runtime.GOOS == "windows" {
+			g.audioRecorder.Process.Kill()
+		} else {
+			g.audioRecorder.Process.Signal(os.Interrupt) // Lets the recorder finish the WAV header
+		}
+		return
+	}
+	dir := os.TempDir()
+	if g.sgfPath != "" {
+		dir = filepath.Dir(g.sgfPath)
+	}
+	file, err := os.CreateTemp(dir, "audio-note-*.wav")
+	if err != nil {
+		g.showError(err)
+		return
+	}
+	file.Close()
+	node, path := g.currentNode, file.Name()
+	var lastErr error
+	for _, recorder := range audioRecorders() {
+		cmd := exec.Command(recorder[0], append(recorder[1:], path)...)
+		if lastErr = cmd.Start(); lastErr != nil {
+			continue
+		}
+		g.audioRecorder = cmd
+		g.recordAudioButton.SetText("Stop Recording")
+		go func() {
+			err := cmd.Wait()
+			g.runOnUI(func() { g.finishAudioRecording(cmd, node, path, err) })
+		}()
+		return
+	}
+	os.Remove(path)
+	g.showError(fmt.Errorf("no audio recorder could be started; install SoX (or arecord on Linux): %v", lastErr))
+}
+
+// Attaches the finished recording to the node it was started on
+func (g *Game) finishAudioRecording(cmd *exec.Cmd, node *GameTreeNode, path string, err error) {
+	g.audioRecorder = nil
+	g.recordAudioButton.SetText("Record")
+	if info, statErr := os.Stat(path); statErr != nil || info.Size() <= 44 {
+		// Nothing beyond the WAV header, so the recorder failed to open the microphone
+		os.Remove(path)
+		g.showError(fmt.Errorf("%s recorded no audio: %v", filepath.Base(cmd.Path), err))
+		return
+	}
+	node.audioNote = path
+	g.updateAudioControls()
+}
+
+// Calls fn for the node and all of its descendants, parents before children
+func forEachNode(node *GameTreeNode, fn func(*GameTreeNode)) {
+	node.Walk(func(n *GameTreeNode) bool {
+		fn(n)
+		return true
+	})
+}
+
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Switches the comment panel between editing and a read-only Markdown rendering
+func (g *Game) toggleCommentPreview() {
+	g.previewingComment = !g.previewingComment
+	if g.previewingComment {
+		g.commentPreview.ParseMarkdown(g.commentEntry.Text)
+		g.commentEntry.Hide()
+		g.commentPreview.Show()
+	} else {
+		g.commentPreview.Hide()
+		g.commentEntry.Show()
+	}
+}
+
+func (g *Game) enterScoringMode() {
+	g.initializeTerritoryMap()
+	g.assignTerritoryToEmptyRegions()
+	g.redrawBoard()
+	g.calculateAndDisplayScore()
+	g.resetScoreAcceptance()
+	g.scoreAgreement.Show()
+}
+
+func (g *Game) exitScoringMode() {
+	g.scoreAgreement.Hide()
+	// Remove territory markers
+	if g.territoryLayer != nil {
+		g.gridContainer.Remove(g.territoryLayer)
+		g.territoryLayer = nil
+	}
+	// Re-draw the board
+	g.redrawBoard()
+	// Reset any scoring status
+	g.scoringStatus.SetText("Not in scoring mode.")
+}
+
+func (g *Game) initializeTerritoryMap() {
+	g.territoryMap = goban.NewTerritoryMap(g.currentNode.boardState, g.sizeX, g.sizeY)
+}
+
+func (g *Game) assignTerritoryToEmptyRegions() {
+	goban.AssignTerritory(g.currentNode.boardState, g.territoryMap, g.sizeX, g.sizeY)
+}
+
+func (g *Game) calculateScore() (int, int) {
+	blackScore, whiteScore := goban.CountTerritory(g.territoryMap)
+
+	// Add komi to white's score
+	whiteScore += g.komi
+
+	return blackScore, whiteScore
+}
+
+func (g *Game) calculateAndDisplayScore() {
+	blackScore, whiteScore := g.calculateScore()
+	g.scoringStatus.SetText(fmt.Sprintf("Black: %d, White: %d", blackScore, whiteScore))
+	g.rulesetScores.SetText(g.compareRulesets())
+}
+
+// Formats a result in the style of the RE property, "0" for a draw
+func formatResult(blackScore, whiteScore int) string {
+	switch {
+	case blackScore > whiteScore:
+		return fmt.Sprintf("B+%d", blackScore-whiteScore)
+	case whiteScore > blackScore:
+		return fmt.Sprintf("W+%d", whiteScore-blackScore)
+	}
+	return "0"
+}
+
+// Returns the stones each color captured with the moves of the line to the current node
+func (g *Game) lineCaptures() (byBlack, byWhite int) {
+	for node := g.currentNode; node.parent != nil; node = node.parent {
+		if !node.hasMove() || node.move[0] < 0 {
+			continue
+		}
+		captured := capturedStones(node)
+		if node.player == black {
+			byBlack += captured
+		} else {
+			byWhite += captured
+		}
+	}
+	return byBlack, byWhite
+}
+
+// Returns the number of stones the move of node captured
+func capturedStones(node *GameTreeNode) int {
+	opponent := goban.SwitchPlayer(node.player)
+	captured := 0
+	for y, row := range node.boardState {
+		parentRow := node.parent.boardState[y]
+		if len(row) > 0 && &row[0] == &parentRow[0] {
+			continue // A shared row is unchanged
+		}
+		for x, stone := range row {
+			if stone == empty && parentRow[x] == opponent {
+				captured++
+			}
+		}
+	}
+	return captured
+}
+
+// Events of the main line by node, such as "first capture"
+type gameEvents map[*GameTreeNode]string
+
+// Captures of at least this many stones are marked as a group dying
+const bigCaptureSize = 6
+
+// Finds the events of the main line worth marking in a long game: the first capture, the start and end of
+// each ko fight, and the capture of big groups
+func findTimelineEvents(root *GameTreeNode) gameEvents {
+	events := make(gameEvents)
+	add := func(node *GameTreeNode, event string) {
+		if events[node] != "" {
+			events[node] += ", "
+		}
+		events[node] += event
+	}
+	line := []*GameTreeNode{}
+	for node := root; len(node.children) > 0; {
+		node = node.children[0]
+		line = append(line, node)
+	}
+	for _, fight := range findKoFights(line) {
+		add(fight.start, "ko fight")
+		if fight.resolved {
+			add(fight.end, "ko resolved")
+		}
+	}
+	captureSeen := false
+	for _, node := range line {
+		if !node.hasMove() || node.move[0] < 0 {
+			continue
+		}
+		if captured := capturedStones(node); captured > 0 {
+			if !captureSeen {
+				add(node, "first capture")
+				captureSeen = true
+			}
+			if captured >= bigCaptureSize {
+				add(node, fmt.Sprintf("%d stones die", captured))
+			}
+		}
+	}
+	return events
+}
+
+// A ko fight of a line: a ko capture and the recaptures that follow at the same ko
+type koFight struct {
+	start, end *GameTreeNode // First capture, and the move filling the ko or else the last recapture
+	captures   int           // Ko captures by both players
+	resolved   bool          // A stone filled one of the two points of the ko
+}
+
+// Finds the ko fights of a line of nodes: ko captures on the same pair of points taken in turn, at least one of
+// them a recapture. A fight ends when a stone fills either point, or another ko is captured.
+func findKoFights(line []*GameTreeNode) []koFight {
+	var fights []koFight
+	var current *koFight
+	var ko [][2]int // The two points fought over in the current fight, nil if none
+	finish := func() {
+		if current != nil && current.captures >= 2 {
+			fights = append(fights, *current)
+		}
+		current = nil
+		ko = nil
+	}
+	for _, node := range line {
+		if !node.hasMove() || node.move[0] < 0 {
+			continue
+		}
+		point := [2]int{node.move[0], node.move[1]}
+		if node.koX >= 0 {
+			koPoint := [2]int{node.koX, node.koY}
+			if !slices.Contains(ko, point) || !slices.Contains(ko, koPoint) {
+				finish()
+				current = &koFight{start: node}
+			}
+			ko = [][2]int{point, koPoint}
+			current.captures++
+			current.end = node
+		} else if slices.Contains(ko, point) {
+			current.end = node
+			current.resolved = true
+			finish()
+		}
+	}
+	finish()
+	return fights
+}
+
+// Lists the ko fights of the line through the current node, with buttons moving to the start or end of each
+func (g *Game) showKoFights() {
+	fights := findKoFights(g.currentLine())
+	if len(fights) == 0 {
+		dialog.ShowInformation("Ko Fights", "No ko fights in the current line.", g.window)
+		return
+	}
+	var fightsDialog dialog.Dialog
+	goTo := func(node *GameTreeNode) {
+		g.setCurrentNode(node)
+		g.redrawBoard()
+		g.updateGameTreeUI()
+		fightsDialog.Hide()
+	}
+	rows := container.NewVBox()
+	for _, fight := range fights {
+		outcome := "unresolved"
+		if fight.resolved {
+			outcome = fmt.Sprintf("filled by %s", playerName(fight.end.player))
+		}
+		summary := fmt.Sprintf("Ko at %s: moves %d-%d, %d captures, %s", g.pointName(fight.start.koX, fight.start.koY),
+			fight.start.displayMoveNumber(), fight.end.displayMoveNumber(), fight.captures, outcome)
+		rows.Add(container.NewBorder(nil, nil, nil, container.NewHBox(
+			widget.NewButton("Start", func() { goTo(fight.start) }),
+			widget.NewButton("End", func() { goTo(fight.end) }),
+		), widget.NewLabel(summary)))
+	}
+	fightsDialog = dialog.NewCustom("Ko Fights", "Close", container.NewVScroll(rows), g.window)
+	fightsDialog.Resize(fyne.NewSize(550, 350))
+	fightsDialog.Show()
+}
+
+// Counts the marked position under Chinese, Japanese and Tromp-Taylor rules, so that dame, prisoners and dead
+// stones left on the board can be seen to change the outcome. Tromp-Taylor takes every stone on the board as alive.
+func (g *Game) compareRulesets() string {
+	board := g.currentNode.boardState
+	chineseBlack, chineseWhite := g.calculateScore()
+	japaneseBlack, japaneseWhite := goban.CountJapaneseTerritory(board, g.territoryMap)
+	byBlack, byWhite := g.lineCaptures()
+	japaneseBlack += byBlack
+	japaneseWhite += byWhite + g.komi
+	trompBlack, trompWhite := goban.TrompTaylorScore(board, g.sizeX, g.sizeY)
+	trompWhite += g.komi
+	results := []string{
+		formatResult(chineseBlack, chineseWhite),
+		formatResult(japaneseBlack, japaneseWhite),
+		formatResult(trompBlack, trompWhite),
+	}
+	text := fmt.Sprintf("Chinese (area): %s\nJapanese (territory, %d+%d prisoners): %s\nTromp-Taylor (all stones alive): %s",
+		results[0], byBlack, byWhite, results[1], results[2])
+	winner := func(result string) string { return result[:1] }
+	if winner(results[0]) != winner(results[1]) || winner(results[0]) != winner(results[2]) {
+		text += "\nThe rulesets disagree on the winner."
+	}
+	if recorded := g.gameInfo["RE"]; recorded != "" {
+		if rules := g.gameInfo["RU"]; rules != "" {
+			text += fmt.Sprintf("\nRecorded result %s under %s rules (RU).", recorded, rules)
+		} else {
+			text += fmt.Sprintf("\nRecorded result %s; the file does not name its rules (RU).", recorded)
+		}
+	}
+	return text
+}
+
+// Withdraws the acceptance of both players, as when the dead stones of the count change
+func (g *Game) resetScoreAcceptance() {
+	g.scoreAccepted = make(map[string]bool)
+	for _, button := range g.acceptButtons {
+		button.Enable()
+	}
+}
+
+// Records that the player accepts the dead stones of the count.
+// Once both players accepted, the result is written to the RE property of the game.
+func (g *Game) acceptScore(player string) {
+	g.scoreAccepted[player] = true
+	g.acceptButtons[player].Disable()
+	if !g.scoreAccepted[black] || !g.scoreAccepted[white] {
+		g.scoringStatus.SetText(fmt.Sprintf("%s accepted the count; waiting for %s.", playerName(player), playerName(goban.SwitchPlayer(player))))
+		return
+	}
+	blackScore, whiteScore := g.calculateScore()
+	result := formatResult(blackScore, whiteScore)
+	g.gameInfo["RE"] = result
+	g.scoringStatus.SetText(fmt.Sprintf("Both players accepted the count. Result: %s", result))
+	switch {
+	case blackScore > whiteScore:
+		g.recordEngineMatch(black, strconv.Itoa(blackScore-whiteScore))
+	case whiteScore > blackScore:
+		g.recordEngineMatch(white, strconv.Itoa(whiteScore-blackScore))
+	default:
+		g.recordEngineMatch("", "0")
+	}
+}
+
+// Rejects the count and resumes play so that the disputed stones can be settled on the board
+func (g *Game) disputeScore() {
+	g.setMouseMode("play")
+	g.scoringStatus.SetText("Count disputed: play resumes.")
+}
+
+func (g *Game) toggleGroupStatus(x, y int) {
+	originalOwner := g.currentNode.boardState[y][x]
+	if originalOwner != black && originalOwner != white {
+		return
+	}
+
+	newOwner := goban.SwitchPlayer(g.territoryMap[y][x])
+
+	visited := make(map[[2]int]bool)
+	stack := [][2]int{{x, y}}
+
+	for len(stack) > 0 {
+		cx, cy := stack[len(stack)-1][0], stack[len(stack)-1][1]
+		stack = stack[:len(stack)-1]
+		if visited[[2]int{cx, cy}] {
+			continue
+		}
+		visited[[2]int{cx, cy}] = true
+
+		stone := g.currentNode.boardState[cy][cx]
+
+		if stone == originalOwner {
+			// Toggle the ownership
+			g.territoryMap[cy][cx] = newOwner
+		}
+
+		// Add neighbors to stack
+		dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+		for _, d := range dirs {
+			nx, ny := cx+d[0], cy+d[1]
+			if nx >= 0 && nx < g.sizeX && ny >= 0 && ny < g.sizeY {
+				neighborStone := g.currentNode.boardState[ny][nx]
+				if !visited[[2]int{nx, ny}] && (neighborStone == originalOwner || neighborStone == empty) {
+					stack = append(stack, [2]int{nx, ny})
+				}
+			}
+		}
+	}
+
+	// Reset all empty spaces to "?" (no owner)
+	for y := 0; y < g.sizeY; y++ {
+		for x := 0; x < g.sizeX; x++ {
+			if g.currentNode.boardState[y][x] == empty {
+				g.territoryMap[y][x] = "?"
+			}
+		}
+	}
+
+	// Recalculate the territory
+	g.assignTerritoryToEmptyRegions()
+}
+
+func (g *Game) updateGameTreeUI() {
+	g.hideTreeThumbnail()
+	g.updateWindowTitle()
+	g.updateScoreSheet()
+	g.updateComparePane()
+	g.updateBoardTabLabels()
+	g.updateGameNotes()
+	g.timelineEvents = findTimelineEvents(g.rootNode)
+	scrollPosition := g.gameTreeContainer.Offset
+	newGameTreeUI := g.buildGameTreeUI(g.rootNode)
+	g.gameTreeContainer.Content = newGameTreeUI
+	g.gameTreeContainer.Refresh()
+	g.gameTreeContainer.Offset = scrollPosition
+}
+
+// A game tree button that shows a thumbnail of the node's position while hovered
+type treeNodeButton struct {
+	widget.Button
+	game *Game
+	node *GameTreeNode
+}
+
+func newTreeNodeButton(game *Game, node *GameTreeNode, label string, tapped func()) *treeNodeButton {
+	b := &treeNodeButton{game: game, node: node}
+	b.Text = label
+	b.OnTapped = tapped
+	b.ExtendBaseWidget(b)
+	return b
+}
+
+func (b *treeNodeButton) MouseIn(e *desktop.MouseEvent) {
+	b.Button.MouseIn(e)
+	b.game.showTreeThumbnail(b.node, e.AbsolutePosition)
+}
+
+func (b *treeNodeButton) MouseOut() {
+	b.Button.MouseOut()
+	b.game.hideTreeThumbnail()
+}
+
+func (b *treeNodeButton) Tapped(e *fyne.PointEvent) {
+	b.game.hideTreeThumbnail()
+	b.Button.Tapped(e)
+}
+
+// Shows the actions on the node: going to it, making its line the main one and deleting its branch
+func (b *treeNodeButton) TappedSecondary(e *fyne.PointEvent) {
+	b.game.hideTreeThumbnail()
+	menu := fyne.NewMenu("",
+		fyne.NewMenuItem("Go to Node", b.OnTapped),
+		fyne.NewMenuItem("Make Main Variation", func() { b.game.promoteToMainLine(b.node) }),
+		fyne.NewMenuItem("Delete Branch", func() { b.game.confirmDeleteBranch(b.node) }),
+	)
+	widget.ShowPopUpMenuAtPosition(menu, b.game.window.Canvas(), e.AbsolutePosition)
+}
+
+// Creates the comparison board shown next to the board in split view, navigable independently of the game
+func (g *Game) newComparePane() *fyne.Container {
+	g.compareImage = canvas.NewImageFromImage(nil)
+	g.compareImage.FillMode = canvas.ImageFillContain
+	g.compareImage.SetMinSize(fyne.NewSize(200, 200))
+	g.compareLabel = widget.NewLabel("")
+	navigate := func(next func(node *GameTreeNode) *GameTreeNode) func() {
+		return func() {
+			if node := next(g.compareNode); node != nil {
+				g.compareNode = node
+				g.updateComparePane()
+			}
+		}
+	}
+	buttons := container.NewHBox(
+		widget.NewButton("|<", navigate(func(node *GameTreeNode) *GameTreeNode { return g.rootNode })),
+		widget.NewButton("<", navigate(func(node *GameTreeNode) *GameTreeNode { return node.parent })),
+		widget.NewButton(">", navigate(func(node *GameTreeNode) *GameTreeNode {
+			if len(node.children) == 0 {
+				return nil
+			}
+			return node.children[0]
+		})),
+		widget.NewButton(">|", navigate(func(node *GameTreeNode) *GameTreeNode {
+			for len(node.children) > 0 {
+				node = node.children[0]
+			}
+			return node
+		})),
+		widget.NewButton("Variation", navigate(func(node *GameTreeNode) *GameTreeNode {
+			if node.parent == nil {
+				return nil
+			}
+			siblings := node.parent.children
+			for i, sibling := range siblings {
+				if sibling == node {
+					return siblings[(i+1)%len(siblings)]
+				}
+			}
+			return nil
+		})),
+	)
+	actions := container.NewHBox(
+		widget.NewButton("Take Current", func() {
+			g.compareNode = g.currentNode
+			g.updateComparePane()
+		}),
+		widget.NewButton("Swap", func() {
+			node := g.compareNode
+			g.compareNode = g.currentNode
+			g.setCurrentNode(node)
+			g.redrawBoard()
+			g.updateGameTreeUI()
+		}),
+		g.compareLabel,
+	)
+	return container.NewBorder(container.NewVBox(buttons, actions), nil, nil, nil, g.compareImage)
+}
+
+// Shows or hides the comparison board next to the board
+func (g *Game) toggleSplitView() {
+	if g.comparePane.Visible() {
+		g.comparePane.Hide()
+		g.compareSplit.SetOffset(1)
+		return
+	}
+	g.compareNode = g.currentNode
+	g.comparePane.Show()
+	g.compareSplit.SetOffset(0.5)
+	g.updateComparePane()
+}
+
+// Redraws the comparison board, following the game if its node left the game tree
+func (g *Game) updateComparePane() {
+	if g.comparePane == nil || !g.comparePane.Visible() {
+		return
+	}
+	if !g.inGameTree(g.compareNode) {
+		g.compareNode = g.currentNode
+	}
+	g.compareImage.Image = renderBoardImage(g.compareNode, g.sizeX, g.sizeY, max(8, 400/max(g.sizeX, g.sizeY)))
+	g.compareImage.Refresh()
+	g.compareLabel.SetText(fmt.Sprintf("Move %d", g.compareNode.displayMoveNumber()))
+}
+
+// Reports whether the node is still part of the game tree, not deleted nor from another game
+func (g *Game) inGameTree(node *GameTreeNode) bool {
+	if node == nil {
+		return false
+	}
+	for ; node.parent != nil; node = node.parent {
+		if !slices.Contains(node.parent.children, node) {
+			return false
+		}
+	}
+	return node == g.rootNode
+}
+
+// Records the game as saved in its current state
+func (g *Game) markSaved() {
+	g.savedSGF, _ = g.exportToSGF()
+	g.updateWindowTitle()
+}
+
+// Sets the window title to the players and move number, marking changes since the last save
+// and games without a file, e.g. "Lee vs Park — move 134 * (unsaved)"
+func (g *Game) updateWindowTitle() {
+	if g.window == nil {
+		return
+	}
+	info := g.exportGameInfo()
+	playerBlack, playerWhite := info["PB"], info["PW"]
+	if playerBlack == "" {
+		playerBlack = "Black"
+	}
+	if playerWhite == "" {
+		playerWhite = "White"
+	}
+	title := fmt.Sprintf("%s vs %s — move %d", playerBlack, playerWhite, g.currentNode.displayMoveNumber())
+	if sgfContent, _ := g.exportToSGF(); sgfContent != g.savedSGF {
+		title += " *"
+	}
+	if g.sgfPath == "" {
+		title += " (unsaved)"
+	}
+	g.window.SetTitle(title)
+}
+
+// Returns the cached thumbnail of a node's position, rendering it first if needed
+func (g *Game) nodeThumbnail(node *GameTreeNode) *image.RGBA {
+	if img, ok := g.thumbnails[node]; ok {
+		return img
+	}
+	img := renderBoardImage(node, g.sizeX, g.sizeY, max(3, 160/max(g.sizeX, g.sizeY)))
+	g.thumbnails[node] = img
+	return img
+}
+
+// Shows the thumbnail of a node next to the mouse position
+// The thumbnail is a plain overlay rather than a pop-up, so clicks still reach the tree
+func (g *Game) showTreeThumbnail(node *GameTreeNode, mousePos fyne.Position) {
+	g.hideTreeThumbnail()
+	img := g.nodeThumbnail(node)
+	thumbnail := canvas.NewImageFromImage(img)
+	thumbnail.FillMode = canvas.ImageFillContain
+	size := fyne.NewSize(float32(img.Bounds().Dx()), float32(img.Bounds().Dy()))
+	thumbnail.Resize(size)
+
+	canvasSize := g.window.Canvas().Size()
+	pos := mousePos.Add(fyne.NewPos(16, 16))
+	if pos.X+size.Width > canvasSize.Width {
+		pos.X = mousePos.X - 16 - size.Width
+	}
+	if pos.Y+size.Height > canvasSize.Height {
+		pos.Y = mousePos.Y - 16 - size.Height
+	}
+	thumbnail.Move(pos)
+
+	overlay := container.NewWithoutLayout(thumbnail)
+	if elapsed, ok := moveElapsedTime(node); ok {
+		text := canvas.NewText(fmt.Sprintf("%.1fs", elapsed.Seconds()), theme.Color(theme.ColorNameForeground))
+		text.Resize(text.MinSize())
+		background := canvas.NewRectangle(theme.Color(theme.ColorNameOverlayBackground))
+		background.Resize(fyne.NewSize(size.Width, text.Size().Height))
+		background.Move(pos.Add(fyne.NewPos(0, size.Height)))
+		text.Move(pos.Add(fyne.NewPos((size.Width-text.Size().Width)/2, size.Height)))
+		overlay.Add(background)
+		overlay.Add(text)
+	}
+	g.treeThumbnail = overlay
+	g.window.Canvas().Overlays().Add(g.treeThumbnail)
+}
+
+// Returns the time spent on the move of the node, measured from the timestamp of the previous move
+func moveElapsedTime(node *GameTreeNode) (time.Duration, bool) {
+	if node.moveTime.IsZero() || node.parent == nil || node.parent.moveTime.IsZero() {
+		return 0, false
+	}
+	return node.moveTime.Sub(node.parent.moveTime), true
+}
+
+// Removes the tree thumbnail overlay, if shown
+func (g *Game) hideTreeThumbnail() {
+	if g.treeThumbnail == nil {
+		return
+	}
+	g.window.Canvas().Overlays().Remove(g.treeThumbnail)
+	g.treeThumbnail = nil
+}
+
+// Builds the game tree below node: each node's button above a row of its children's trees. The trees are
+// built from the deepest nodes up on a stack of their own, so long games and deep variations need no recursion.
+func (g *Game) buildGameTreeUI(node *GameTreeNode) fyne.CanvasObject {
+	type pending struct {
+		node     *GameTreeNode
+		children []*GameTreeNode
+		built    []fyne.CanvasObject // Trees of the children built so far
+	}
+	stack := []*pending{{node: node, children: g.visibleTreeChildren(node)}}
+	for {
+		top := stack[len(stack)-1]
+		if len(top.built) < len(top.children) {
+			child := top.children[len(top.built)]
+			stack = append(stack, &pending{node: child, children: g.visibleTreeChildren(child)})
+			continue
+		}
+		stack = stack[:len(stack)-1]
+		tree := container.NewVBox(g.treeNodeUI(top.node), container.NewHBox(top.built...))
+		if len(stack) == 0 {
+			return tree
+		}
+		parent := stack[len(stack)-1]
+		parent.built = append(parent.built, tree)
+	}
+}
+
+// Builds the button of a node in the game tree
+func (g *Game) treeNodeUI(node *GameTreeNode) fyne.CanvasObject {
+	var nodeLabel string
+	if node.parent == nil {
+		nodeLabel = "Root"
+	} else if node.hasAddedBlackStones() || node.hasAddedWhiteStones() {
+		nodeLabel = fmt.Sprintf("%s:Setup", node.player)
+	} else if node.move[0] == -1 && node.move[1] == -1 {
+		nodeLabel = fmt.Sprintf("%s:Pass", node.player)
+	} else {
+		nodeLabel = fmt.Sprintf("%s:(%d,%d)", node.player, node.move[0], node.move[1])
+	}
+	if g.filterTree && node.parent != nil {
+		// Intermediate nodes are hidden, so show where in the game the node is
+		nodeLabel = fmt.Sprintf("%d %s", node.displayMoveNumber(), nodeLabel)
+	}
+	if annotation := node.annotationText(); annotation != "" {
+		nodeLabel += " " + annotation
+	}
+	if g.showCommentMarkers && node.Comment != "" {
+		nodeLabel += " *"
+	}
+	if event := g.timelineEvents[node]; event != "" && g.showEventMarkers {
+		nodeLabel += " [" + event + "]"
+	}
+	if node.conflict {
+		nodeLabel += " !"
+	}
+
+	nodeButton := newTreeNodeButton(g, node, nodeLabel, func() {
+		nodeChanged := node != g.currentNode
+		g.setMouseMode("play")
+		g.setCurrentNode(node)
+		g.redrawBoard()
+		g.updateGameTreeUI()
+		if nodeChanged && g.gtpCmd != nil {
+			// Update engine board state
+			err := g.updateEngineBoardState()
+			if err != nil {
+				g.showError(err)
+				g.detachEngine()
+			}
+		}
+	})
+
+	var nodeUI fyne.CanvasObject = nodeButton
+	if node == g.currentNode {
+		nodeButton.Importance = widget.HighImportance
+	} else if node.conflict {
+		// Moves left illegal by an edit stand out until the line is fixed
+		nodeButton.Importance = widget.DangerImportance
+	} else if tagged := variationColorNode(node); tagged != nil {
+		// Show the variation color behind a transparent button
+		nodeButton.Importance = widget.LowImportance
+		background := canvas.NewRectangle(withAlpha(variationColors[tagged.variationColor], 160))
+		background.CornerRadius = 4
+		nodeUI = container.NewStack(background, nodeButton)
+	}
+	return nodeUI
+}
+
+// Returns the children drawn below the node in the game tree
+// When filtering, these are the nearest descendants that are annotated or current,
+// so the tree collapses into an outline of the annotated positions
+func (g *Game) visibleTreeChildren(node *GameTreeNode) []*GameTreeNode {
+	if !g.filterTree {
+		return node.children
+	}
+	visible := []*GameTreeNode{}
+	stack := slices.Clone(node.children)
+	slices.Reverse(stack)
+	for len(stack) > 0 {
+		child := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if child == g.currentNode || child.inTreeOutline() {
+			visible = append(visible, child)
+			continue
+		}
+		for i := len(child.children) - 1; i >= 0; i-- {
+			stack = append(stack, child.children[i])
+		}
+	}
+	return visible
+}
+
+// Returns the nearest node at or above the given node that carries a variation color tag, or nil
+func variationColorNode(node *GameTreeNode) *GameTreeNode {
+	for n := node; n != nil; n = n.parent {
+		if n.variationColor != "" {
+			return n
+		}
+	}
+	return nil
+}
+
+// Returns the color with its alpha replaced
+func withAlpha(c color.NRGBA, alpha uint8) color.NRGBA {
+	c.A = alpha
+	return c
+}
+
+// Lets the user tag the variation starting at the current node with a color
+func (g *Game) showVariationColorDialog() {
+	colorSelect := widget.NewSelect(append([]string{"none"}, variationColorNames...), nil)
+	if g.currentNode.variationColor != "" {
+		colorSelect.SetSelected(g.currentNode.variationColor)
+	} else {
+		colorSelect.SetSelected("none")
+	}
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Color", colorSelect),
+	}
+	colorDialog := dialog.NewForm("Variation Color", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+		g.currentNode.variationColor = ""
+		if colorSelect.Selected != "none" {
+			g.currentNode.variationColor = colorSelect.Selected
+		}
+		g.updateGameTreeUI()
+		g.redrawBoard()
+	}, g.window)
+	colorDialog.Show()
+}
+
+// A key/value tag of a node, such as "theme: invasion"
+type nodeTag struct {
+	key   string
+	value string
+}
+
+// Parses tags written one per line as "key: value"; a line without a colon is a key with an empty value
+func parseNodeTags(text string) []nodeTag {
+	var tags []nodeTag
+	for _, line := range strings.Split(text, "\n") {
+		key, value, _ := strings.Cut(line, ":")
+		if key = strings.TrimSpace(key); key != "" {
+			tags = append(tags, nodeTag{key, strings.TrimSpace(value)})
+		}
+	}
+	return tags
+}
+
+// Formats tags one per line as "key: value"
+func formatNodeTags(tags []nodeTag) string {
+	lines := make([]string, len(tags))
+	for i, tag := range tags {
+		lines[i] = tag.key + ": " + tag.value
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Shows a dialog for editing the tags of the current node
+func (g *Game) showNodeTagsDialog() {
+	tagsEntry := widget.NewMultiLineEntry()
+	tagsEntry.SetPlaceHolder("theme: invasion\nstudent: Alice")
+	tagsEntry.SetText(formatNodeTags(g.currentNode.tags))
+	tagsEntry.SetMinRowsVisible(6)
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Tags", tagsEntry),
+	}
+	tagsDialog := dialog.NewForm("Node Tags", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok || !g.allowEdit(nil) {
+			return
+		}
+		g.currentNode.tags = parseNodeTags(tagsEntry.Text)
+		g.updateTagsLabel()
+	}, g.window)
+	tagsDialog.Resize(fyne.NewSize(400, 300))
+	tagsDialog.Show()
+}
+
+// Choices of the annotation dialog, each with the property and value it sets
+var moveAnnotationChoices = []struct {
+	label, key, value string
+}{
+	{"None", "", ""},
+	{"! Good move", "TE", "1"},
+	{"!! Very good move", "TE", "2"},
+	{"? Bad move", "BM", "1"},
+	{"?? Very bad move", "BM", "2"},
+	{"!? Interesting move", "IT", ""},
+	{"?! Doubtful move", "DO", ""},
+}
+
+var positionAnnotationChoices = []struct {
+	label, key string
+}{
+	{"None", ""},
+	{"Good for Black", "GB"},
+	{"Good for White", "GW"},
+	{"Even", "DM"},
+	{"Unclear", "UC"},
+}
+
+// Shows a dialog setting the move and position annotations and the move number override of the current node
+func (g *Game) showAnnotationDialog() {
+	node := g.currentNode
+	moveLabels := make([]string, len(moveAnnotationChoices))
+	for i, choice := range moveAnnotationChoices {
+		moveLabels[i] = choice.label
+	}
+	moveSelect := widget.NewSelect(moveLabels, nil)
+	moveSelect.SetSelectedIndex(0)
+	for i, choice := range moveAnnotationChoices {
+		if value, ok := node.annotations[choice.key]; ok && (value == choice.value || (choice.value == "1" && value != "2")) {
+			moveSelect.SetSelectedIndex(i)
+		}
+	}
+	positionLabels := make([]string, len(positionAnnotationChoices))
+	for i, choice := range positionAnnotationChoices {
+		positionLabels[i] = choice.label
+	}
+	positionSelect := widget.NewSelect(positionLabels, nil)
+	positionSelect.SetSelectedIndex(0)
+	for i, choice := range positionAnnotationChoices {
+		if _, ok := node.annotations[choice.key]; ok && choice.key != "" {
+			positionSelect.SetSelectedIndex(i)
+		}
+	}
+	_, isHotspot := node.annotations["HO"]
+	hotspotCheck := widget.NewCheck("Hotspot", nil)
+	hotspotCheck.SetChecked(isHotspot)
+	numberEntry := widget.NewEntry()
+	numberEntry.SetPlaceHolder("automatic")
+	if node.moveNumberOverride > 0 {
+		numberEntry.SetText(strconv.Itoa(node.moveNumberOverride))
+	}
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Move", moveSelect),
+		widget.NewFormItem("Position", positionSelect),
+		widget.NewFormItem("", hotspotCheck),
+		widget.NewFormItem("Move Number", numberEntry),
+	}
+	dialog.ShowForm("Annotate Node", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok || !g.allowEdit(nil) {
+			return
+		}
+		number := 0
+		if text := strings.TrimSpace(numberEntry.Text); text != "" {
+			var err error
+			if number, err = strconv.Atoi(text); err != nil || number < 1 {
+				g.showError(fmt.Errorf("invalid move number: %s", text))
+				return
+			}
+		}
+		node.moveNumberOverride = number
+		node.annotations = nil
+		set := func(key, value string) {
+			if node.annotations == nil {
+				node.annotations = make(map[string]string)
+			}
+			node.annotations[key] = value
+		}
+		if choice := moveAnnotationChoices[moveSelect.SelectedIndex()]; choice.key != "" {
+			set(choice.key, choice.value)
+		}
+		if choice := positionAnnotationChoices[positionSelect.SelectedIndex()]; choice.key != "" {
+			set(choice.key, "1")
+		}
+		if hotspotCheck.Checked {
+			set("HO", "1")
+		}
+		g.updateGameTreeUI()
+		g.redrawBoard()
+	}, g.window)
+}
+
+// Returns the nodes of the game tree, in depth-first order, whose comment or tags contain the query, ignoring case
+func findNodes(root *GameTreeNode, query string) []*GameTreeNode {
+	query = strings.ToLower(query)
+	var found []*GameTreeNode
+	root.Walk(func(node *GameTreeNode) bool {
+		if strings.Contains(strings.ToLower(node.Comment), query) || strings.Contains(strings.ToLower(formatNodeTags(node.tags)), query) {
+			found = append(found, node)
+		}
+		return true
+	})
+	return found
+}
+
+// Shows a dialog searching the comments and tags of the nodes, moving to the chosen result
+func (g *Game) showFindDialog() {
+	var results []*GameTreeNode
+	var findDialog dialog.Dialog
+	resultList := widget.NewList(
+		func() int { return len(results) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			node := results[id]
+			summary := strings.ReplaceAll(node.Comment, "\n", " ")
+			if len(node.tags) > 0 {
+				summary = strings.TrimSpace(strings.ReplaceAll(formatNodeTags(node.tags), "\n", "; ") + " " + summary)
+			}
+			item.(*widget.Label).SetText(fmt.Sprintf("Move %d (%s): %s", node.displayMoveNumber(), node.PathID(), summary))
+			item.(*widget.Label).Truncation = fyne.TextTruncateEllipsis
+		},
+	)
+	resultList.OnSelected = func(id widget.ListItemID) {
+		g.setCurrentNode(results[id])
+		g.redrawBoard()
+		g.updateGameTreeUI()
+		findDialog.Hide()
+	}
+	queryEntry := widget.NewEntry()
+	queryEntry.SetPlaceHolder("Text or tag, e.g. theme: invasion")
+	queryEntry.OnChanged = func(query string) {
+		results = nil
+		if strings.TrimSpace(query) != "" {
+			results = findNodes(g.rootNode, strings.TrimSpace(query))
+		}
+		resultList.UnselectAll()
+		resultList.Refresh()
+	}
+	findDialog = dialog.NewCustom("Find Nodes", "Close", container.NewBorder(queryEntry, nil, nil, nil, resultList), g.window)
+	findDialog.Resize(fyne.NewSize(500, 400))
+	findDialog.Show()
+	g.window.Canvas().Focus(queryEntry)
+}
+
+// Draws translucent stones in their variation color for child moves that belong to a tagged variation
+func (g *Game) drawVariationGhostStones() {
+	for _, child := range g.currentNode.children {
+		tagged := variationColorNode(child)
+		if tagged == nil || !child.hasMove() || child.move[0] < 0 {
+			continue
+		}
+		x, y := child.move[0], child.move[1]
+		if g.currentNode.boardState[y][x] != empty {
+			continue
+		}
+		circle := canvas.NewCircle(withAlpha(variationColors[tagged.variationColor], 128))
+		circle.StrokeWidth = 0
+		circle.Resize(fyne.NewSize(g.cellSize*0.8, g.cellSize*0.8))
+		pos := g.boardCoordsToPixel(x, y)
+		circle.Move(fyne.Position{
+			X: pos.X + 0.5*g.cellSize - circle.Size().Width/2,
+			Y: pos.Y + 0.5*g.cellSize - circle.Size().Height/2,
+		})
+		g.gridContainer.Add(circle)
+	}
+}
+
+func (g *Game) showError(err error) {
+	fmt.Printf("Error: %v\n", err)
+	if errors.Is(err, errEngineNotResponding) {
+		return // Already reported by the recovery dialog
+	}
+	dialog.ShowError(err, g.window)
+}
+
+// Runs f on the goroutine that delivers the window's input events, after the events already queued.
+// Background work, such as reading files or talking to the engine, hands its results over with runOnUI,
+// so that the game and the widgets are only changed where user input changes them.
+func (g *Game) runOnUI(f func()) {
+	if queue, ok := g.window.(interface{ QueueEvent(func()) }); ok {
+		queue.QueueEvent(f)
+		return
+	}
+	// Running f here would change the game from a background goroutine
+	panic("runOnUI: the window does not queue events")
+}
+
+func (g *Game) initializeBoard() {
+	if g.scratchOrigin != nil {
+		g.leaveScratchBoard()
+	}
+	g.idCounter = 1
+	rootNode := g.newGameTreeNode()
+	rootNode.player = "" // No player has moved yet
+	g.rootNode = rootNode
+	g.currentNode = rootNode
+	g.nodeMap = make(map[string]*GameTreeNode)
+	g.nodeMap[rootNode.id] = rootNode
+	g.thumbnails = make(map[*GameTreeNode]*image.RGBA)
+	g.legalityCache = make(map[*GameTreeNode]*legalityMap)
+	g.tutorialActive = false
+	g.practicing = false
+	g.touchCursor = nil
+	g.gameInfo = copyGameInfo(g.gameInfoDefaults)
+	g.savedSGF = generateSGF(g.rootNode, g.sizeX, g.sizeY, g.komi, g.exportGameInfo(), g.passValue())
+	g.setMouseMode("play")
+	g.updateCommentTextbox()
+
+	// If engine is attached, re-initialize it with the new board size
+	if g.gtpCmd != nil {
+		if g.analysisCancel != nil {
+			g.analysisCancel() // Frees the engine for the new board; the analysis resumes below
+		}
+		err := g.initializeEngine()
+		if err != nil {
+			g.showError(err)
+			g.detachEngine()
+		} else {
+			g.restartAnalysis()
+		}
+	}
+}
+
+func (g *Game) setCurrentNode(node *GameTreeNode) {
+	g.stopSelfPlay()
+	if g.scratchOrigin != nil {
+		g.leaveScratchBoard()
+	}
+	g.currentNode = node
+	g.lastInteraction = time.Now()
+	g.updateCommentTextbox()
+	if g.gtpCmd != nil && g.engineThinking {
+		// The engine is searching the position left behind; its move is dropped and the new position set up afterwards
+		g.cancelEngineMove()
+	} else if g.analyzing {
+		g.restartAnalysis()
+	} else if g.gtpCmd != nil && g.cancelledGenmoves == 0 {
+		// Update engine board state
+		err := g.updateEngineBoardState()
+		if err != nil {
+			g.showError(err)
+			g.detachEngine()
+		} else {
+			// Determine whose turn it is
+			player := goban.SwitchPlayer(g.currentNode.player)
+			// If engine should play next
+			if g.gtpColor == player {
+				g.requestEngineMove(player)
+			}
+		}
+	}
+}
+
+func (g *Game) drawLastMoveHighlight() {
+	if g.currentNode.parent == nil {
+		return
+	}
+	x := g.currentNode.move[0]
+	y := g.currentNode.move[1]
+	if x >= 0 && x < g.sizeX && y >= 0 && y < g.sizeY {
+		// Draw the highlight
+		circle := canvas.NewCircle(purpleColor)
+		circle.StrokeWidth = 0
+		circle.Resize(fyne.NewSize(g.cellSize*0.319, g.cellSize*0.319))
+		pos := g.boardCoordsToPixel(x, y)
+		circle.Move(fyne.Position{
+			X: pos.X + 0.5*g.cellSize - circle.Size().Width/2,
+			Y: pos.Y + 0.5*g.cellSize - circle.Size().Height/2,
+		})
+		g.gridContainer.Add(circle)
+	}
+}
+
+func (g *Game) redrawBoard() {
+	// The current node may have been edited, so its thumbnail and legality are computed again when needed
+	delete(g.thumbnails, g.currentNode)
+	delete(g.legalityCache, g.currentNode)
+
+	// Clear previous grid lines, stones, and annotations
+	g.gridContainer.Objects = nil
+
+	// Remove existing territory layer if present
+	if g.territoryLayer != nil {
+		g.gridContainer.Remove(g.territoryLayer)
+	}
+
+	// Calculate cell size based on the current board size and window dimensions
+	size := g.boardCanvas.Size()
+	g.cellSize = min(size.Width/float32(g.sizeX), size.Height/float32(g.sizeY))
+
+	// Draw various components of the board
+	g.drawGridLines()
+	g.drawStoneConnections()
+	g.drawStones()
+	g.drawVariationGhostStones()
+	g.drawDimmedPoints()
+	if g.showMoveNumbers {
+		g.drawMoveNumbers()
+	}
+	if g.showLiberties {
+		g.drawLibertyCounts()
+	}
+	g.drawAnnotations()
+	if g.showLastMove {
+		g.drawLastMoveHighlight()
+	}
+	if g.engineThinking {
+		g.drawThinkingIndicator()
+	}
+	if g.premove != nil {
+		g.drawPremove()
+	}
+	g.updateTouchInput()
+	if g.showLadderPath && g.ladderNode == g.currentNode {
+		g.drawLadderPath()
+	}
+	if g.semeaiNode == g.currentNode {
+		g.drawCaptureRaceLiberties()
+	}
+	if g.endgameNode == g.currentNode {
+		g.drawEndgameValues()
+	}
+	if g.showLegality {
+		g.drawLegalityAndEyes()
+	}
+	if g.showAnalysis && g.tenukiFinder {
+		g.drawOpenAreas()
+	}
+	if g.showAnalysis && g.analyzing && g.liveAnalysis != nil && g.liveAnalysis.node == g.currentNode {
+		g.drawLiveAnalysis()
+	}
+	if g.atariNode == g.currentNode {
+		g.drawAtariWarning()
+	}
+	if g.currentNode.conflict {
+		g.drawConflictMarker()
+	}
+	novelty := g.updateDatabaseLabel()
+	if novelty != nil {
+		g.drawNoveltyMarker(novelty)
+	}
+
+	// Draw territory markers if in scoring mode
+	if g.mouseMode == "score" && g.showTerritory {
+		g.drawTerritoryMarkers()
+	}
+
+	// The hover stone was cleared with the board; draw it again for the position now under the pointer
+	g.hoverStone, g.hoverCaptures, g.hoverEvaluationText = nil, nil, nil
+	g.hoverPoint = [2]int{-1, -1}
+	g.updateHoverStone()
+
+	// Show and refresh the grid container to render all added objects
+	g.gridContainer.Refresh()
+
+	g.updateKoLabel()
+	g.winrateGraph.update()
+	g.updateSpectatorWindow()
+}
+
+// Shows the ko point of the current position, so a refused retake is not a mystery
+func (g *Game) updateKoLabel() {
+	if g.koLabel == nil {
+		return
+	}
+	node := g.currentNode
+	if node == nil || node.koX < 0 {
+		g.koLabel.SetText("")
+		g.koLabel.Hide()
+		return
+	}
+	g.koLabel.SetText(fmt.Sprintf("Ko: %s may not retake at %s this move.", playerName(goban.SwitchPlayer(node.player)), g.pointName(node.koX, node.koY)))
+	g.koLabel.Show()
+}
+
+// Positions reached by the games of a folder of SGF files. Positions equal under a symmetry of the board
+// are counted as one, so a mirrored or rotated opening still matches.
+type positionDatabase struct {
+	games  int            // Number of games indexed
+	counts map[string]int // Games reaching each canonical position
+	cache  map[string]int // Counts already looked up, by plain board key
+}
+
+// Returns the key of a position shared by all its symmetric versions: the least key over the symmetries
+func canonicalBoardKey(board [][]string, sizeX, sizeY int) string {
+	transforms := gameTransforms
+	if sizeX != sizeY {
+		transforms = gameTransforms[:3]
+	}
+	best := goban.BoardKey(board)
+	transformed := goban.MakeEmptyBoard(sizeX, sizeY)
+	for _, transform := range transforms {
+		for y, row := range board {
+			for x, stone := range row {
+				tx, ty := transformPoint(x, y, sizeX, sizeY, transform)
+				transformed[ty][tx] = stone
+			}
+		}
+		best = min(best, goban.BoardKey(transformed))
+	}
+	return fmt.Sprintf("%dx%d:%s", sizeX, sizeY, best)
+}
+
+// Returns the number of indexed games that reached board
+func (db *positionDatabase) count(board [][]string, sizeX, sizeY int) int {
+	key := goban.BoardKey(board)
+	if count, ok := db.cache[key]; ok {
+		return count
+	}
+	count := db.counts[canonicalBoardKey(board, sizeX, sizeY)]
+	db.cache[key] = count
+	return count
+}
+
+// Reads the main line of every SGF file in folder, counting each position once per game.
+// Files that cannot be read or parsed are skipped and counted.
+func buildPositionDatabase(folder string) (*positionDatabase, int, error) {
+	paths, err := filepath.Glob(filepath.Join(folder, "*.sgf"))
+	if err != nil {
+		return nil, 0, err
+	}
+	db := &positionDatabase{counts: make(map[string]int), cache: make(map[string]int)}
+	skipped := 0
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			skipped++
+			continue
+		}
+		collection, err := goban.ParseSGF(string(content))
+		if err != nil {
+			skipped++
+			continue
+		}
+		for _, gameTree := range collection {
+			if !db.addGame(gameTree) {
+				skipped++
+			}
+		}
+	}
+	return db, skipped, nil
+}
+
+// Adds the positions of the main line of a game, returning false if the game cannot be read
+func (db *positionDatabase) addGame(gameTree *SGFGameTree) bool {
+	if len(gameTree.Sequence) == 0 {
+		return false
+	}
+	root := gameTree.Sequence[0].Properties
+	sizeX, sizeY, err := sgfBoardSize(root)
+	if err != nil || sizeX > maxBoardSize || sizeY > maxBoardSize {
+		return false
+	}
+	moves, err := sgfMainLineMoves(gameTree, sizeX, sizeY)
+	if err != nil {
+		return false
+	}
+	board := goban.MakeEmptyBoard(sizeX, sizeY)
+	var warnings []string
+	for _, color := range []string{black, white} {
+		for _, point := range onBoardPoints("A"+color, root["A"+color], sizeX, sizeY, &warnings) {
+			xy := goban.ParseSGFPoint(point)
+			board[xy[1]][xy[0]] = color
+		}
+	}
+	seen := map[string]bool{}
+	record := func() {
+		key := canonicalBoardKey(board, sizeX, sizeY)
+		if !seen[key] {
+			seen[key] = true
+			db.counts[key]++
+		}
+	}
+	record()
+	for _, move := range moves {
+		if move.x >= 0 {
+			goban.PlaceStone(board, move.x, move.y, move.player, sizeX, sizeY)
+		}
+		record()
+	}
+	db.games++
+	return true
+}
+
+// Indexes the database folder in the background, then installs the database on the UI thread
+// and shows the counts of the current line
+func (g *Game) indexDatabase() {
+	folder := g.databaseFolder
+	go func() {
+		db, skipped, err := buildPositionDatabase(folder)
+		g.runOnUI(func() {
+			if folder != g.databaseFolder {
+				return // Another folder was chosen meanwhile
+			}
+			if err != nil {
+				g.showError(fmt.Errorf("failed to index position database %s: %v", folder, err))
+				return
+			}
+			g.database = db
+			status := fmt.Sprintf("Indexed %d games of %s.", db.games, filepath.Base(folder))
+			if skipped > 0 {
+				status += fmt.Sprintf(" %d files or games could not be read.", skipped)
+			}
+			g.scoringStatus.SetText(status)
+			g.redrawBoard()
+		})
+	}()
+}
+
+// Lets the user pick the folder of SGF files searched for the positions of the current game
+func (g *Game) chooseDatabaseFolder() {
+	folderDialog := dialog.NewFolderOpen(func(folder fyne.ListableURI, err error) {
+		if err != nil || folder == nil {
+			return
+		}
+		g.databaseFolder = folder.Path()
+		g.database = nil
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
+		}
+		g.scoringStatus.SetText("Indexing the position database...")
+		g.indexDatabase()
+	}, g.window)
+	if g.databaseFolder != "" {
+		if listableURI, err := storage.ListerForURI(storage.NewFileURI(g.databaseFolder)); err == nil {
+			folderDialog.SetLocation(listableURI)
+		}
+	}
+	folderDialog.Show()
+}
+
+// Shows how many known games reached the current position, and returns the novelty of the line
+// through the current node: the first move leaving the positions of the database, nil if none
+func (g *Game) updateDatabaseLabel() *GameTreeNode {
+	db := g.database
+	if g.databaseLabel == nil || db == nil || g.currentNode == nil {
+		if g.databaseLabel != nil {
+			g.databaseLabel.Hide()
+		}
+		return nil
+	}
+	var novelty *GameTreeNode
+	for _, node := range g.currentLine() {
+		if node.hasMove() && db.count(node.boardState, g.sizeX, g.sizeY) == 0 {
+			if db.count(node.parent.boardState, g.sizeX, g.sizeY) > 0 {
+				novelty = node
+			}
+			break
+		}
+	}
+	text := fmt.Sprintf("Database: %d of %d games reached this position.", db.count(g.currentNode.boardState, g.sizeX, g.sizeY), db.games)
+	if novelty != nil {
+		coord := "pass"
+		if x, y := novelty.move[0], novelty.move[1]; x >= 0 {
+			coord = g.pointName(x, y)
+		}
+		text += fmt.Sprintf("\nNovelty: move %d, %s %s.", novelty.displayMoveNumber(), playerName(novelty.player), coord)
+	}
+	g.databaseLabel.SetText(text)
+	g.databaseLabel.Show()
+	return novelty
+}
+
+// Rings the novelty move when its stone is still on the current board
+func (g *Game) drawNoveltyMarker(novelty *GameTreeNode) {
+	x, y := novelty.move[0], novelty.move[1]
+	if x < 0 || y < 0 || x >= g.sizeX || y >= g.sizeY || g.currentNode.boardState[y][x] != novelty.player {
+		return
+	}
+	onLine := false
+	for node := g.currentNode; node != nil; node = node.parent {
+		onLine = onLine || node == novelty
+	}
+	if !onLine {
+		return
+	}
+	ring := canvas.NewCircle(color.Transparent)
+	ring.StrokeColor = blackScoreColor
+	ring.StrokeWidth = max(2, g.cellSize*0.1)
+	ring.Resize(fyne.NewSize(g.cellSize, g.cellSize))
+	ring.Move(g.boardCoordsToPixel(x, y))
+	g.gridContainer.Add(ring)
+}
+
+// Opens a window without controls that mirrors the board of the main window
+func (g *Game) showSpectatorWindow(a fyne.App) {
+	if g.spectatorImage != nil {
+		return
+	}
+	w := a.NewWindow("Connected Groups Goban Spectator")
+	w.SetPadded(false)
+	g.spectatorImage = canvas.NewImageFromImage(nil)
+	g.spectatorImage.FillMode = canvas.ImageFillContain
+	w.SetContent(g.spectatorImage)
+	w.SetOnClosed(func() {
+		g.spectatorImage = nil
+	})
+	g.updateSpectatorWindow()
+	w.Resize(fyne.NewSize(400, 400))
+	w.Show()
+}
+
+// Renders the current position into the spectator window if it is open
+func (g *Game) updateSpectatorWindow() {
+	if g.spectatorImage == nil {
+		return
+	}
+	g.spectatorImage.Image = renderBoardImage(g.currentNode, g.sizeX, g.sizeY, max(8, 640/max(g.sizeX, g.sizeY)))
+	g.spectatorImage.Refresh()
+}
+
+// Opens a window listing the named snapshots, with a preview of the selected one for comparison
+func (g *Game) showSnapshotsWindow(a fyne.App) {
+	if g.snapshotList != nil {
+		return
+	}
+	w := a.NewWindow("Snapshots")
+	preview := canvas.NewImageFromImage(nil)
+	preview.FillMode = canvas.ImageFillContain
+	selected := -1
+
+	g.snapshotList = widget.NewList(
+		func() int { return len(g.snapshots) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			item.(*widget.Label).SetText(g.snapshots[id].name)
+		},
+	)
+	g.snapshotList.OnSelected = func(id widget.ListItemID) {
+		selected = id
+		snapshot := g.snapshots[id]
+		previewNode := &GameTreeNode{boardState: snapshot.boardState}
+		preview.Image = renderBoardImage(previewNode, snapshot.sizeX, snapshot.sizeY, max(8, 400/max(snapshot.sizeX, snapshot.sizeY)))
+		preview.Refresh()
+	}
+	g.snapshotList.OnUnselected = func(widget.ListItemID) {
+		selected = -1
+		preview.Image = nil
+		preview.Refresh()
+	}
+
+	// Runs the action on the selected snapshot, if any
+	withSelected := func(action func(*positionSnapshot)) func() {
+		return func() {
+			if selected < 0 || selected >= len(g.snapshots) {
+				dialog.ShowInformation("Snapshots", "Select a snapshot first", w)
+				return
+			}
+			action(g.snapshots[selected])
+		}
+	}
+	buttons := container.NewHBox(
+		widget.NewButton("Save Current", func() {
+			g.showSaveSnapshotDialog(w)
+		}),
+		widget.NewButton("Set Up Fresh Game", withSelected(func(snapshot *positionSnapshot) {
+			g.setUpFromSnapshot(snapshot)
+		})),
+		widget.NewButton("Export SGF", withSelected(func(snapshot *positionSnapshot) {
+			dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+				if err != nil || writer == nil {
+					return
+				}
+				defer writer.Close()
+				if _, err := writer.Write([]byte(snapshotSGF(snapshot))); err != nil {
+					dialog.ShowError(err, w)
+				}
+			}, w)
+		})),
+		widget.NewButton("Delete", withSelected(func(*positionSnapshot) {
+			g.snapshots = append(g.snapshots[:selected], g.snapshots[selected+1:]...)
+			g.snapshotList.UnselectAll()
+			g.snapshotList.Refresh()
+		})),
+	)
+
+	split := container.NewHSplit(g.snapshotList, preview)
+	split.Offset = 0.3
+	w.SetContent(container.NewBorder(nil, buttons, nil, nil, split))
+	w.SetOnClosed(func() {
+		g.snapshotList = nil
+	})
+	w.Resize(fyne.NewSize(700, 450))
+	w.Show()
+}
+
+// Shows a window listing the moves of the current line in order, following the board
+func (g *Game) showScoreSheetWindow(a fyne.App) {
+	if g.scoreSheetList != nil {
+		return
+	}
+	w := a.NewWindow("Score Sheet")
+	g.scoreSheetList = widget.NewList(
+		func() int { return len(g.scoreSheetNodes) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			item.(*widget.Label).SetText(g.scoreSheetEntry(id))
+		},
+	)
+	g.scoreSheetList.OnSelected = func(id widget.ListItemID) {
+		if g.syncingScoreSheet || g.scoreSheetNodes[id] == g.currentNode {
+			return
+		}
+		g.setCurrentNode(g.scoreSheetNodes[id])
+		g.redrawBoard()
+		g.updateGameTreeUI()
+	}
+	exportButton := widget.NewButton("Export Text", func() {
+		dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil || writer == nil {
+				return
+			}
+			defer writer.Close()
+			lines := make([]string, len(g.scoreSheetNodes))
+			for i := range g.scoreSheetNodes {
+				lines[i] = g.scoreSheetEntry(i)
+			}
+			if _, err := writer.Write([]byte(strings.Join(lines, "\n") + "\n")); err != nil {
+				dialog.ShowError(err, w)
+			}
+		}, w)
+	})
+	w.SetContent(container.NewBorder(nil, exportButton, nil, nil, g.scoreSheetList))
+	w.SetOnClosed(func() {
+		g.scoreSheetList = nil
+	})
+	g.updateScoreSheet()
+	w.Resize(fyne.NewSize(250, 500))
+	w.Show()
+}
+
+// Returns the nodes from the root through the current node, continued along the first children
+func (g *Game) currentLine() []*GameTreeNode {
+	var line []*GameTreeNode
+	for node := g.currentNode; node != nil; node = node.parent {
+		line = append(line, node)
+	}
+	slices.Reverse(line)
+	for node := g.currentNode; len(node.children) > 0; {
+		node = node.children[0]
+		line = append(line, node)
+	}
+	return line
+}
+
+// Collects the moves of the line through the current node, continued along the first children,
+// and selects the current move in the score sheet
+func (g *Game) updateScoreSheet() {
+	if g.scoreSheetList == nil {
+		return
+	}
+	g.scoreSheetNodes = g.scoreSheetNodes[:0]
+	for _, node := range g.currentLine() {
+		if node.hasMove() {
+			g.scoreSheetNodes = append(g.scoreSheetNodes, node)
+		}
+	}
+	g.scoreSheetList.Refresh()
+	g.syncingScoreSheet = true
+	defer func() { g.syncingScoreSheet = false }()
+	g.scoreSheetList.UnselectAll()
+	if index := slices.Index(g.scoreSheetNodes, g.currentNode); index >= 0 {
+		g.scoreSheetList.Select(index)
+	}
+}
+
+// Formats a move of the score sheet as "12. B Q16"
+func (g *Game) scoreSheetEntry(index int) string {
+	node := g.scoreSheetNodes[index]
+	coord := "pass"
+	if x, y := node.move[0], node.move[1]; x >= 0 {
+		coord = g.pointName(x, y)
+	}
+	return strings.TrimSpace(fmt.Sprintf("%d. %s %s %s", node.displayMoveNumber(), node.player, coord, node.annotationText()))
+}
+
+// Names a point in GTP coordinates, or in SGF letters on boards too large for them
+func (g *Game) pointName(x, y int) string {
+	coord := g.clientToGTPCoords(x, y)
+	if coord == "" || g.sizeX > 25 || g.sizeY > 25 {
+		coord = goban.SGFPoint(x, y) // Beyond the reach of the usual letters
+	}
+	return coord
+}
+
+// Orientations of the paper record relative to the board, for transcription
+var transcriptionOrientations = []string{"as printed", "rotated 180°", "mirrored left-right", "mirrored top-bottom"}
+
+// Maps a point of the paper record to the board according to the orientation
+func orientPoint(x, y, sizeX, sizeY int, orientation string) (int, int) {
+	switch orientation {
+	case "rotated 180°":
+		return sizeX - 1 - x, sizeY - 1 - y
+	case "mirrored left-right":
+		return sizeX - 1 - x, y
+	case "mirrored top-bottom":
+		return x, sizeY - 1 - y
+	}
+	return x, y
+}
+
+// Shows a window for entering a game from paper by typing coordinates such as "q16" or "pass".
+// The colors alternate, illegal entries are reported without being played, and the last entry can be taken back.
+func (g *Game) showTranscriptionWindow(a fyne.App) {
+	w := a.NewWindow("Transcribe Game")
+	var entered []*GameTreeNode // Nodes created by this window, most recent last
+	status := widget.NewLabel("")
+	status.Wrapping = fyne.TextWrapWord
+	orientationSelect := widget.NewSelect(transcriptionOrientations, nil)
+	orientationSelect.SetSelected(transcriptionOrientations[0])
+	coordEntry := widget.NewEntry()
+	coordEntry.SetPlaceHolder("q16, then Enter")
+	describeNext := func(prefix string) {
+		status.SetText(fmt.Sprintf("%sMove %d, %s to play.", prefix, g.currentNode.moveNumber()+1, playerName(goban.SwitchPlayer(g.currentNode.player))))
+	}
+	coordEntry.OnSubmitted = func(text string) {
+		text = strings.ToUpper(strings.TrimSpace(text))
+		if text == "" || !g.allowEdit(nil) {
+			return
+		}
+		player := goban.SwitchPlayer(g.currentNode.player)
+		x, y := -1, -1
+		if text != "PASS" {
+			px, py, err := g.gtpToClientCoords(text)
+			if err != nil || px >= g.sizeX {
+				status.SetText(fmt.Sprintf("%s is not a point of the board.", text))
+				return
+			}
+			x, y = orientPoint(px, py, g.sizeX, g.sizeY, orientationSelect.Selected)
+			if !g.isMoveLegal(x, y, player) {
+				status.SetText(fmt.Sprintf("%s is illegal for %s: occupied, suicide or ko.", text, playerName(player)))
+				return
+			}
+		}
+		existing := g.childWithMove(x, y, player)
+		g.playMove(x, y, player, true)
+		if existing == nil {
+			entered = append(entered, g.currentNode)
+		}
+		coordEntry.SetText("")
+		describeNext(fmt.Sprintf("%s %s entered. ", playerName(player), strings.ToLower(text)))
+	}
+	undoButton := widget.NewButton("Undo Last Entry", func() {
+		if len(entered) == 0 || entered[len(entered)-1] != g.currentNode {
+			status.SetText("The last entry is not the current move.")
+			return
+		}
+		entered = entered[:len(entered)-1]
+		g.deleteCurrentNode()
+		describeNext("Last entry removed. ")
+		w.Canvas().Focus(coordEntry)
+	})
+	describeNext("")
+	w.SetContent(container.NewVBox(
+		widget.NewForm(
+			widget.NewFormItem("Orientation", orientationSelect),
+			widget.NewFormItem("Coordinate", coordEntry),
+		),
+		undoButton,
+		status,
+	))
+	w.Resize(fyne.NewSize(360, 200))
+	w.Show()
+	w.Canvas().Focus(coordEntry)
+}
+
+// Copies the current position onto a scratch board outside the game tree, where clicks freely change the points
+func (g *Game) startScratchBoard() {
+	if g.scratchOrigin != nil || g.selfPlaying || g.broadcasting || g.engineThinking {
+		return
+	}
+	scratch := g.newGameTreeNode()
+	delete(g.nodeMap, scratch.id) // Not part of the tree unless committed
+	scratch.boardState = goban.CopyBoard(g.currentNode.boardState)
+	scratch.player = g.currentNode.player
+	scratch.move = [2]int{93, 93}
+	g.scratchOrigin = g.currentNode
+	g.currentNode = scratch
+	g.setMouseMode("scratch")
+	g.scratchBar.Show()
+	g.updateCommentTextbox()
+	g.redrawBoard()
+	g.scoringStatus.SetText("Scratch board: click points to cycle empty, Black and White.")
+}
+
+// Adds the scratch position to the tree as a setup variation of the node it was taken from
+func (g *Game) commitScratchBoard() {
+	if g.scratchOrigin == nil || !g.allowEdit(nil) {
+		return
+	}
+	scratch, origin := g.currentNode, g.scratchOrigin
+	g.leaveScratchBoard()
+	for y := 0; y < g.sizeY; y++ {
+		for x := 0; x < g.sizeX; x++ {
+			stone := scratch.boardState[y][x]
+			if stone == origin.boardState[y][x] {
+				continue
+			}
+			switch stone {
+			case black:
+				scratch.addBlackStone(x, y)
+			case white:
+				scratch.addWhiteStone(x, y)
+			default:
+				scratch.AE.set(x, y, true)
+			}
+		}
+	}
+	scratch.boardState = shareRows(scratch.boardState, origin.boardState)
+	scratch.parent = origin
+	origin.children = append(origin.children, scratch)
+	g.nodeMap[scratch.id] = scratch
+	g.setCurrentNode(scratch)
+	g.redrawBoard()
+	g.updateGameTreeUI()
+}
+
+// Drops the scratch board and returns to the node it was taken from
+func (g *Game) discardScratchBoard() {
+	if g.scratchOrigin == nil {
+		return
+	}
+	origin := g.scratchOrigin
+	g.leaveScratchBoard()
+	g.currentNode = origin
+	g.updateCommentTextbox()
+	g.redrawBoard()
+	g.updateGameTreeUI()
+}
+
+// Ends the scratch board state and returns to play mode, leaving the choice of the current node to the caller
+func (g *Game) leaveScratchBoard() {
+	g.scratchOrigin = nil
+	if g.mouseMode == "scratch" {
+		g.mouseMode = "play"
+	}
+	g.scratchBar.Hide()
+	g.scoringStatus.SetText("")
+}
+
+// Position of the outermost grid lines in a board photo, in pixels of the image
+type photoGrid struct {
+	left, top, right, bottom float64
+}
+
+// Returns the luminance of a color, from 0 to 1
+func luminance(c color.Color) float64 {
+	r, g, b, _ := c.RGBA()
+	return (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 0xffff
+}
+
+// Finds the outermost grid lines of a photo cropped to about the board, as the first and last columns and rows
+// clearly darker than their surroundings within the margin where the edge lines can be.
+// Falls back to half a cell from the borders of the image if no line stands out.
+func detectGrid(img image.Image, sizeX, sizeY int) photoGrid {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	columns := make([]float64, width)
+	rows := make([]float64, height)
+	for py := 0; py < height; py++ {
+		for px := 0; px < width; px++ {
+			l := luminance(img.At(bounds.Min.X+px, bounds.Min.Y+py))
+			columns[px] += l / float64(height)
+			rows[py] += l / float64(width)
+		}
+	}
+	// Returns the first dark line from the start, or from the end if reversed, within a cell of the border
+	findLine := func(profile []float64, cells int, reversed bool) (float64, bool) {
+		n := len(profile)
+		margin := max(3, n/max(cells, 1))
+		window := max(2, n/max(cells, 1)/4)
+		for i := 0; i < margin && i < n; i++ {
+			index := i
+			if reversed {
+				index = n - 1 - i
+			}
+			sum, count := 0.0, 0
+			for j := max(0, index-window); j <= min(n-1, index+window); j++ {
+				sum += profile[j]
+				count++
+			}
+			if profile[index] < 0.85*sum/float64(count) {
+				return float64(index), true
+			}
+		}
+		return 0, false
+	}
+	grid := photoGrid{
+		left:   float64(width) / float64(sizeX) / 2,
+		top:    float64(height) / float64(sizeY) / 2,
+		right:  float64(width) - float64(width)/float64(sizeX)/2,
+		bottom: float64(height) - float64(height)/float64(sizeY)/2,
+	}
+	left, okLeft := findLine(columns, sizeX, false)
+	right, okRight := findLine(columns, sizeX, true)
+	top, okTop := findLine(rows, sizeY, false)
+	bottom, okBottom := findLine(rows, sizeY, true)
+	if okLeft && okRight && right > left {
+		grid.left, grid.right = left, right
+	}
+	if okTop && okBottom && bottom > top {
+		grid.top, grid.bottom = top, bottom
+	}
+	return grid
+}
+
+// Returns the position of the intersection (x, y) of the grid in the photo
+func (grid photoGrid) point(x, y, sizeX, sizeY int) (float64, float64) {
+	px, py := grid.left, grid.top
+	if sizeX > 1 {
+		px += float64(x) * (grid.right - grid.left) / float64(sizeX-1)
+	}
+	if sizeY > 1 {
+		py += float64(y) * (grid.bottom - grid.top) / float64(sizeY-1)
+	}
+	return px, py
+}
+
+// Classifies each intersection of the photo as a black stone, a white stone or empty,
+// by how the brightness around it compares with the median brightness of the intersections
+func classifyStones(img image.Image, grid photoGrid, sizeX, sizeY int) [][]string {
+	bounds := img.Bounds()
+	radius := 0.3 * min((grid.right-grid.left)/float64(max(sizeX-1, 1)), (grid.bottom-grid.top)/float64(max(sizeY-1, 1)))
+	brightness := make([][]float64, sizeY)
+	var all []float64
+	for y := 0; y < sizeY; y++ {
+		brightness[y] = make([]float64, sizeX)
+		for x := 0; x < sizeX; x++ {
+			cx, cy := grid.point(x, y, sizeX, sizeY)
+			sum, count := 0.0, 0
+			for py := int(cy - radius); py <= int(cy+radius); py++ {
+				for px := int(cx - radius); px <= int(cx+radius); px++ {
+					if image.Pt(bounds.Min.X+px, bounds.Min.Y+py).In(bounds) {
+						sum += luminance(img.At(bounds.Min.X+px, bounds.Min.Y+py))
+						count++
+					}
+				}
+			}
+			if count > 0 {
+				brightness[y][x] = sum / float64(count)
+			}
+			all = append(all, brightness[y][x])
+		}
+	}
+	sort.Float64s(all)
+	median := all[len(all)/2]
+	board := goban.MakeEmptyBoard(sizeX, sizeY)
+	for y := 0; y < sizeY; y++ {
+		for x := 0; x < sizeX; x++ {
+			if brightness[y][x] < 0.55*median {
+				board[y][x] = black
+			} else if brightness[y][x] > min(1.25*median, (1+median)/2) {
+				board[y][x] = white
+			}
+		}
+	}
+	return board
+}
+
+// Shows a photo with the stones recognized on it, which clicks on the intersections correct
+type photoBoardView struct {
+	widget.BaseWidget
+	img   image.Image
+	grid  photoGrid
+	board [][]string
+	sizeX int
+	sizeY int
+}
+
+func newPhotoBoardView(img image.Image, grid photoGrid, board [][]string, sizeX, sizeY int) *photoBoardView {
+	v := &photoBoardView{img: img, grid: grid, board: board, sizeX: sizeX, sizeY: sizeY}
+	v.ExtendBaseWidget(v)
+	return v
+}
+
+func (v *photoBoardView) CreateRenderer() fyne.WidgetRenderer {
+	photo := canvas.NewImageFromImage(v.img)
+	photo.FillMode = canvas.ImageFillStretch
+	r := &photoBoardRenderer{view: v, photo: photo, objects: []fyne.CanvasObject{photo}}
+	for i := 0; i < v.sizeX*v.sizeY; i++ {
+		marker := canvas.NewCircle(color.Transparent)
+		marker.StrokeColor = purpleColor
+		marker.StrokeWidth = 2
+		r.markers = append(r.markers, marker)
+		r.objects = append(r.objects, marker)
+	}
+	r.updateMarkers()
+	return r
+}
+
+func (v *photoBoardView) MinSize() fyne.Size {
+	return fyne.NewSize(300, 300)
+}
+
+// Converts a point of the photo to the scale the photo is shown at
+func (v *photoBoardView) scale() (float32, float32) {
+	bounds := v.img.Bounds()
+	return v.Size().Width / float32(bounds.Dx()), v.Size().Height / float32(bounds.Dy())
+}
+
+// Cycles the nearest intersection through empty, Black and White
+func (v *photoBoardView) Tapped(ev *fyne.PointEvent) {
+	scaleX, scaleY := v.scale()
+	bestX, bestY, best := -1, -1, math.Inf(1)
+	for y := 0; y < v.sizeY; y++ {
+		for x := 0; x < v.sizeX; x++ {
+			px, py := v.grid.point(x, y, v.sizeX, v.sizeY)
+			dx, dy := float64(ev.Position.X)-px*float64(scaleX), float64(ev.Position.Y)-py*float64(scaleY)
+			if distance := dx*dx + dy*dy; distance < best {
+				bestX, bestY, best = x, y, distance
+			}
+		}
+	}
+	if bestX < 0 {
+		return
+	}
+	switch v.board[bestY][bestX] {
+	case empty:
+		v.board[bestY][bestX] = black
+	case black:
+		v.board[bestY][bestX] = white
+	default:
+		v.board[bestY][bestX] = empty
+	}
+	v.Refresh()
+}
+
+type photoBoardRenderer struct {
+	view    *photoBoardView
+	photo   *canvas.Image
+	markers []*canvas.Circle
+	objects []fyne.CanvasObject
+}
+
+func (r *photoBoardRenderer) Layout(size fyne.Size) {
+	r.photo.Resize(size)
+	scaleX, scaleY := r.view.scale()
+	diameter := 0.7 * min(
+		float32(r.view.grid.right-r.view.grid.left)*scaleX/float32(max(r.view.sizeX-1, 1)),
+		float32(r.view.grid.bottom-r.view.grid.top)*scaleY/float32(max(r.view.sizeY-1, 1)),
+	)
+	for y := 0; y < r.view.sizeY; y++ {
+		for x := 0; x < r.view.sizeX; x++ {
+			marker := r.markers[y*r.view.sizeX+x]
+			px, py := r.view.grid.point(x, y, r.view.sizeX, r.view.sizeY)
+			marker.Resize(fyne.NewSize(diameter, diameter))
+			marker.Move(fyne.NewPos(float32(px)*scaleX-diameter/2, float32(py)*scaleY-diameter/2))
+		}
+	}
+}
+
+func (r *photoBoardRenderer) MinSize() fyne.Size {
+	return r.view.MinSize()
+}
+
+func (r *photoBoardRenderer) Refresh() {
+	r.updateMarkers()
+	r.Layout(r.view.Size())
+	canvas.Refresh(r.view)
+}
+
+// Shows a marker in the color of each recognized stone
+func (r *photoBoardRenderer) updateMarkers() {
+	for y := 0; y < r.view.sizeY; y++ {
+		for x := 0; x < r.view.sizeX; x++ {
+			marker := r.markers[y*r.view.sizeX+x]
+			switch r.view.board[y][x] {
+			case black:
+				marker.FillColor = transparentBlackColor
+				marker.Show()
+			case white:
+				marker.FillColor = transparentWhiteColor
+				marker.Show()
+			default:
+				marker.Hide()
+			}
+			marker.Refresh()
+		}
+	}
+}
+
+func (r *photoBoardRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *photoBoardRenderer) Destroy() {}
+
+// Loads a photo of a board, recognizes the stones on it and, after manual correction, sets up a fresh game with them
+func (g *Game) importBoardPhoto(a fyne.App) {
+	fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		defer reader.Close()
+		img, _, err := image.Decode(reader)
+		if err != nil {
+			g.showError(fmt.Errorf("failed to read the photo: %v", err))
+			return
+		}
+		widthEntry := widget.NewEntry()
+		widthEntry.SetText(strconv.Itoa(g.sizeX))
+		heightEntry := widget.NewEntry()
+		heightEntry.SetText(strconv.Itoa(g.sizeY))
+		formItems := []*widget.FormItem{
+			widget.NewFormItem("Width", widthEntry),
+			widget.NewFormItem("Height", heightEntry),
+		}
+		dialog.ShowForm("Board Size in Photo", "OK", "Cancel", formItems, func(ok bool) {
+			if !ok {
+				return
+			}
+			sizeX, errX := strconv.Atoi(widthEntry.Text)
+			sizeY, errY := strconv.Atoi(heightEntry.Text)
+			if errX != nil || errY != nil || sizeX < 2 || sizeY < 2 || sizeX > 52 || sizeY > 52 {
+				g.showError(fmt.Errorf("invalid board size (must be between 2 and 52)"))
+				return
+			}
+			grid := detectGrid(img, sizeX, sizeY)
+			board := classifyStones(img, grid, sizeX, sizeY)
+			g.showPhotoCorrectionWindow(a, img, grid, board, sizeX, sizeY)
+		}, g.window)
+	}, g.window)
+	fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".png", ".jpg", ".jpeg"}))
+	fileDialog.Show()
+}
+
+// Shows the stones recognized on a photo for correction before setting up a fresh game with them
+func (g *Game) showPhotoCorrectionWindow(a fyne.App, img image.Image, grid photoGrid, board [][]string, sizeX, sizeY int) {
+	w := a.NewWindow("Correct Recognized Stones")
+	view := newPhotoBoardView(img, grid, board, sizeX, sizeY)
+	buttons := container.NewHBox(
+		widget.NewLabel("Click an intersection to cycle empty, Black and White."),
+		layout.NewSpacer(),
+		widget.NewButton("Cancel", func() { w.Close() }),
+		widget.NewButton("Accept", func() {
+			g.setUpFromSnapshot(&positionSnapshot{name: "Photo", boardState: board, player: white, sizeX: sizeX, sizeY: sizeY})
+			w.Close()
+		}),
+	)
+	w.SetContent(container.NewBorder(nil, buttons, nil, nil, view))
+	w.Resize(fyne.NewSize(700, 750))
+	w.Show()
+}
+
+// Parses diagram rows typed as strings of '.', 'X' and 'O' into a board state; spaces are ignored
+func parseDiagramRows(text string) ([][]string, error) {
+	var board [][]string
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.ReplaceAll(strings.TrimSpace(line), " ", "")
+		if line == "" {
+			continue
+		}
+		row := make([]string, 0, len(line))
+		for _, c := range line {
+			switch c {
+			case '.', '+', ',':
+				row = append(row, empty)
+			case 'X', 'x', '#', '@':
+				row = append(row, black)
+			case 'O', 'o':
+				row = append(row, white)
+			default:
+				return nil, fmt.Errorf("row %d: unexpected character %q (use . X O)", i+1, c)
+			}
+		}
+		if len(board) > 0 && len(row) != len(board[0]) {
+			return nil, fmt.Errorf("row %d has %d points but the first row has %d", i+1, len(row), len(board[0]))
+		}
+		board = append(board, row)
+	}
+	if len(board) < 2 || len(board[0]) < 2 || len(board) > maxBoardSize || len(board[0]) > maxBoardSize {
+		return nil, fmt.Errorf("invalid board size (must be between 2 and %d)", maxBoardSize)
+	}
+	return board, nil
+}
+
+// Shows a blank grid where a diagram from a book can be typed row by row and set up as a fresh game
+func (g *Game) showDiagramEntryDialog() {
+	rows := make([]string, g.sizeY)
+	for y := range rows {
+		rows[y] = strings.Repeat(".", g.sizeX)
+	}
+	gridEntry := widget.NewMultiLineEntry()
+	gridEntry.TextStyle = fyne.TextStyle{Monospace: true}
+	gridEntry.SetText(strings.Join(rows, "\n"))
+	gridEntry.SetMinRowsVisible(min(g.sizeY, 19))
+	toPlay := widget.NewRadioGroup([]string{"Black", "White"}, nil)
+	toPlay.Horizontal = true
+	toPlay.SetSelected("Black")
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Rows (. X O)", gridEntry),
+		widget.NewFormItem("To Play", toPlay),
+	}
+	form := dialog.NewForm("Enter Diagram", "Set Up", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+		board, err := parseDiagramRows(gridEntry.Text)
+		if err != nil {
+			g.showError(err)
+			return
+		}
+		player := white
+		if toPlay.Selected == "White" {
+			player = black
+		}
+		g.setUpFromSnapshot(&positionSnapshot{name: "Diagram", boardState: board, player: player, sizeX: len(board[0]), sizeY: len(board)})
+	}, g.window)
+	form.Resize(fyne.NewSize(500, 600))
+	form.Show()
+}
+
+// Asks for a name and saves the current position as a snapshot
+func (g *Game) showSaveSnapshotDialog(parent fyne.Window) {
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText(fmt.Sprintf("Move %d", g.currentNode.displayMoveNumber()))
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Name", nameEntry),
+	}
+	saveDialog := dialog.NewForm("Save Snapshot", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+		g.snapshots = append(g.snapshots, &positionSnapshot{
+			name:       nameEntry.Text,
+			boardState: goban.CopyBoard(g.currentNode.boardState),
+			player:     g.currentNode.player,
+			sizeX:      g.sizeX,
+			sizeY:      g.sizeY,
+		})
+		if g.snapshotList != nil {
+			g.snapshotList.Refresh()
+		}
+	}, parent)
+	saveDialog.Show()
+}
+
+// Starts a fresh game whose root sets up the stones of the snapshot
+func (g *Game) setUpFromSnapshot(snapshot *positionSnapshot) {
+	g.stopBroadcast()
+	g.sizeX = snapshot.sizeX
+	g.sizeY = snapshot.sizeY
+	g.initializeBoard()
+	root := g.rootNode
+	for y := 0; y < g.sizeY; y++ {
+		for x := 0; x < g.sizeX; x++ {
+			switch snapshot.boardState[y][x] {
+			case black:
+				root.addBlackStone(x, y)
+			case white:
+				root.addWhiteStone(x, y)
+			}
+		}
+	}
+	root.boardState = goban.CopyBoard(snapshot.boardState)
+	root.player = snapshot.player
+	g.redrawBoard()
+	g.updateGameTreeUI()
+	if g.gtpCmd != nil {
+		if err := g.updateEngineBoardState(); err != nil {
+			g.showError(err)
+			g.detachEngine()
+		}
+	}
+}
+
+// Formats a snapshot as an SGF file with a single setup node
+func snapshotSGF(snapshot *positionSnapshot) string {
+	var blackStones, whiteStones pointSet
+	for y := 0; y < snapshot.sizeY; y++ {
+		for x := 0; x < snapshot.sizeX; x++ {
+			blackStones.set(x, y, snapshot.boardState[y][x] == black)
+			whiteStones.set(x, y, snapshot.boardState[y][x] == white)
+		}
+	}
+	sgf := "(;FF[4]GM[1]CA[UTF-8]AP[ConnectedGroupsGobanVersion" + version + "]"
+	if snapshot.sizeX == snapshot.sizeY {
+		sgf += fmt.Sprintf("SZ[%d]", snapshot.sizeX)
+	} else {
+		sgf += fmt.Sprintf("SZ[%d:%d]", snapshot.sizeX, snapshot.sizeY)
+	}
+	sgf += fmt.Sprintf("GN[%s]", escapeSGFText(snapshot.name))
+	if len(blackStones) > 0 {
+		sgf += "AB" + formatPointList(blackStones)
+	}
+	if len(whiteStones) > 0 {
+		sgf += "AW" + formatPointList(whiteStones)
+	}
+	sgf += fmt.Sprintf("PL[%s])", goban.SwitchPlayer(snapshot.player))
+	return sgf
+}
+
+// Asks for the name and host color of a new board tab and opens it with a fresh board
+func (g *Game) showNewBoardTabDialog() {
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText(fmt.Sprintf("Board %d", max(len(g.boardTabs), 1)+1))
+	hostColorSelect := widget.NewSelect([]string{black, white, "None"}, nil)
+	hostColorSelect.SetSelected(white)
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Name", nameEntry),
+		widget.NewFormItem("Host Plays", hostColorSelect),
+	}
+	tabDialog := dialog.NewForm("New Board Tab", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok || !g.canSwitchBoardTab() {
+			return
+		}
+		hostColor := hostColorSelect.Selected
+		if hostColor == "None" {
+			hostColor = ""
+		}
+		g.changingBoardTabs = true
+		defer func() { g.changingBoardTabs = false }()
+		if len(g.boardTabs) == 0 {
+			// The board shown so far becomes the first tab
+			g.boardTabs = append(g.boardTabs, &boardTab{name: "Board 1", hostColor: hostColor})
+			g.boardTabBar.Append(container.NewTabItem("Board 1", layout.NewSpacer()))
+		}
+		g.saveBoardTab()
+		g.boardTabs = append(g.boardTabs, &boardTab{name: nameEntry.Text, hostColor: hostColor})
+		g.activeBoardTab = len(g.boardTabs) - 1
+		g.gameState = gameState{sizeX: g.sizeX, sizeY: g.sizeY, komi: g.komi, sequenceNext: 1}
+		g.initializeBoard()
+		g.saveBoardTab()
+		g.boardTabBar.Append(container.NewTabItem(nameEntry.Text, layout.NewSpacer()))
+		g.boardTabBar.SelectIndex(g.activeBoardTab)
+		g.boardTabRow.Show()
+		g.showBoardTab()
+	}, g.window)
+	tabDialog.Show()
+}
+
+// Reports whether the shown board can be put aside, telling the user if not
+func (g *Game) canSwitchBoardTab() bool {
+	if g.engineThinking || g.cancelledGenmoves > 0 || g.selfPlaying || g.broadcasting {
+		dialog.ShowInformation("Board Tabs", "Wait for the engine, self play or broadcast to stop before switching boards.", g.window)
+		return false
+	}
+	return true
+}
+
+// Stores the shown game into the active board tab, after leaving the scratch board, scoring and the other
+// board tools so that no mode of the window refers to the stored game
+func (g *Game) saveBoardTab() {
+	g.setMouseMode("play")
+	g.premove = nil
+	g.boardTabs[g.activeBoardTab].state = g.gameState
+}
+
+// Shows the game of the active board tab
+func (g *Game) showBoardTab() {
+	g.gameState = g.boardTabs[g.activeBoardTab].state
+	g.updateCommentTextbox()
+	g.redrawBoard()
+	g.updateGameTreeUI()
+	if g.gtpCmd != nil {
+		// The engine follows the board that is shown
+		if err := g.initializeEngine(); err != nil {
+			g.showError(err)
+			g.detachEngine()
+		}
+	}
+}
+
+// Switches the window to another board tab
+func (g *Game) switchBoardTab(index int) {
+	if index == g.activeBoardTab || index < 0 || index >= len(g.boardTabs) {
+		return
+	}
+	g.changingBoardTabs = true
+	defer func() { g.changingBoardTabs = false }()
+	if !g.canSwitchBoardTab() {
+		g.boardTabBar.SelectIndex(g.activeBoardTab)
+		return
+	}
+	g.saveBoardTab()
+	g.activeBoardTab = index
+	g.boardTabBar.SelectIndex(index)
+	g.showBoardTab()
+}
+
+// Closes the active board tab; the last remaining board leaves tab mode
+func (g *Game) closeBoardTab() {
+	if len(g.boardTabs) < 2 || !g.canSwitchBoardTab() {
+		return
+	}
+	g.changingBoardTabs = true
+	defer func() { g.changingBoardTabs = false }()
+	closing := g.activeBoardTab
+	g.saveBoardTab() // Leaves the tools of the closing game
+	g.boardTabs = append(g.boardTabs[:closing], g.boardTabs[closing+1:]...)
+	g.boardTabBar.RemoveIndex(closing)
+	g.activeBoardTab = min(closing, len(g.boardTabs)-1)
+	g.boardTabBar.SelectIndex(g.activeBoardTab)
+	g.showBoardTab()
+	if len(g.boardTabs) == 1 {
+		g.boardTabs = nil
+		g.boardTabBar.RemoveIndex(0)
+		g.activeBoardTab = 0
+		g.boardTabRow.Hide()
+	}
+}
+
+// Reports whether the host is to move on the board tab
+func (g *Game) boardNeedsHost(index int) bool {
+	tab := g.boardTabs[index]
+	node := tab.state.currentNode
+	if index == g.activeBoardTab {
+		node = g.currentNode
+	}
+	return tab.hostColor != "" && goban.SwitchPlayer(node.player) == tab.hostColor
+}
+
+// Switches to the next board tab where it is the host's turn
+func (g *Game) nextBoardNeedingHost() {
+	for step := 1; step <= len(g.boardTabs); step++ {
+		index := (g.activeBoardTab + step) % len(g.boardTabs)
+		if g.boardNeedsHost(index) {
+			if index != g.activeBoardTab {
+				g.switchBoardTab(index)
+			}
+			return
+		}
+	}
+	dialog.ShowInformation("Board Tabs", "No board is waiting for your move.", g.window)
+}
+
+// Marks the board tabs where it is the host's turn
+func (g *Game) updateBoardTabLabels() {
+	if g.boardTabBar == nil {
+		return
+	}
+	for i, item := range g.boardTabBar.Items {
+		if i >= len(g.boardTabs) {
+			break
+		}
+		text := g.boardTabs[i].name
+		if g.boardNeedsHost(i) {
+			text = "● " + text
+		}
+		if item.Text != text {
+			item.Text = text
+			g.boardTabBar.Refresh()
+		}
+	}
+}
+
+// Opens the stone counting trainer: a position is shown for a few seconds,
+// then the estimated score is compared with the count of the scoring engine
+func (g *Game) showCountingTrainer(a fyne.App) {
+	w := a.NewWindow("Stone Counting Trainer")
+	boardImage := canvas.NewImageFromImage(nil)
+	boardImage.FillMode = canvas.ImageFillContain
+	boardImage.SetMinSize(fyne.NewSize(400, 400))
+	secondsEntry := widget.NewEntry()
+	secondsEntry.SetText("10")
+	estimateEntry := widget.NewEntry()
+	estimateEntry.SetPlaceHolder("Black lead, negative if White leads")
+	estimateEntry.Disable()
+	status := widget.NewLabel("Press Start to see a position.")
+	status.Wrapping = fyne.TextWrapWord
+	history := widget.NewLabel(countingErrorSummary(g.countingErrors))
+
+	var board [][]string
+	var sizeX, sizeY int
+	var startButton, submitButton *widget.Button
+	startButton = widget.NewButton("Start", func() {
+		seconds, err := strconv.Atoi(secondsEntry.Text)
+		if err != nil || seconds < 1 {
+			dialog.ShowError(fmt.Errorf("invalid number of seconds"), w)
+			return
+		}
+		board, sizeX, sizeY = g.countingTrainerPosition()
+		boardImage.Image = renderBoardImage(&GameTreeNode{boardState: board}, sizeX, sizeY, max(8, 400/max(sizeX, sizeY)))
+		boardImage.Refresh()
+		startButton.Disable()
+		status.SetText(fmt.Sprintf("Count the position. It is hidden after %d seconds.", seconds))
+		time.AfterFunc(time.Duration(seconds)*time.Second, func() {
+			g.runOnUI(func() {
+				boardImage.Image = nil
+				boardImage.Refresh()
+				status.SetText(fmt.Sprintf("Estimate the area score with komi %d.", g.komi))
+				estimateEntry.SetText("")
+				estimateEntry.Enable()
+				submitButton.Enable()
+			})
+		})
+	})
+	submitButton = widget.NewButton("Submit Estimate", func() {
+		estimate, err := strconv.Atoi(strings.TrimSpace(estimateEntry.Text))
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("the estimate must be a whole number"), w)
+			return
+		}
+		territoryMap := goban.NewTerritoryMap(board, sizeX, sizeY)
+		goban.AssignTerritory(board, territoryMap, sizeX, sizeY)
+		blackScore, whiteScore := goban.CountTerritory(territoryMap)
+		whiteScore += g.komi
+		lead := blackScore - whiteScore
+		g.countingErrors = append(g.countingErrors, estimate-lead)
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
+		}
+
+		boardImage.Image = renderBoardImage(&GameTreeNode{boardState: board}, sizeX, sizeY, max(8, 400/max(sizeX, sizeY)))
+		boardImage.Refresh()
+		status.SetText(fmt.Sprintf("Black: %d, White: %d (komi %d). Black lead: %d, your estimate: %d.", blackScore, whiteScore, g.komi, lead, estimate))
+		history.SetText(countingErrorSummary(g.countingErrors))
+		estimateEntry.Disable()
+		submitButton.Disable()
+		startButton.Enable()
+	})
+	submitButton.Disable()
+
+	controls := container.NewVBox(
+		widget.NewForm(
+			widget.NewFormItem("Seconds Shown", secondsEntry),
+			widget.NewFormItem("Estimate", estimateEntry),
+		),
+		container.NewHBox(startButton, submitButton),
+		status,
+		history,
+	)
+	w.SetContent(container.NewBorder(nil, controls, nil, nil, boardImage))
+	w.Resize(fyne.NewSize(450, 650))
+	w.Show()
+}
+
+// Picks a middle game or endgame position from the open game tree, or generates one if the game is too short
+func (g *Game) countingTrainerPosition() ([][]string, int, int) {
+	longest := 0
+	forEachNode(g.rootNode, func(node *GameTreeNode) {
+		longest = max(longest, node.moveNumber())
+	})
+	candidates := []*GameTreeNode{}
+	if longest >= 40 {
+		forEachNode(g.rootNode, func(node *GameTreeNode) {
+			if node.moveNumber() >= longest/2 {
+				candidates = append(candidates, node)
+			}
+		})
+	}
+	if len(candidates) > 0 {
+		return goban.CopyBoard(candidates[rand.Intn(len(candidates))].boardState), g.sizeX, g.sizeY
+	}
+	return randomPosition(g.sizeX, g.sizeY, g.sizeX*g.sizeY*3/5), g.sizeX, g.sizeY
+}
+
+// Generates a position by playing random legal moves that do not fill single point eyes
+func randomPosition(sizeX, sizeY, moves int) [][]string {
+	board := goban.MakeEmptyBoard(sizeX, sizeY)
+	player := black
+	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+	for attempt := 0; moves > 0 && attempt < moves*20; attempt++ {
+		x, y := rand.Intn(sizeX), rand.Intn(sizeY)
+		if board[y][x] != empty {
+			continue
+		}
+		eye := true
+		for _, d := range dirs {
+			nx, ny := x+d[0], y+d[1]
+			if nx >= 0 && nx < sizeX && ny >= 0 && ny < sizeY && board[ny][nx] != player {
+				eye = false
+			}
+		}
+		if eye {
+			continue
+		}
+		board[y][x] = player
+		captured := false
+		for _, d := range dirs {
+			nx, ny := x+d[0], y+d[1]
+			if nx >= 0 && nx < sizeX && ny >= 0 && ny < sizeY && board[ny][nx] == goban.SwitchPlayer(player) && !goban.HasLiberty(board, nx, ny, board[ny][nx], sizeX, sizeY) {
+				goban.RemoveGroup(board, nx, ny, board[ny][nx], sizeX, sizeY)
+				captured = true
+			}
+		}
+		if !captured && !goban.HasLiberty(board, x, y, player, sizeX, sizeY) {
+			board[y][x] = empty // Suicide
+			continue
+		}
+		player = goban.SwitchPlayer(player)
+		moves--
+	}
+	return board
+}
+
+// Describes the estimation errors of the stone counting trainer
+func countingErrorSummary(estimateErrors []int) string {
+	if len(estimateErrors) == 0 {
+		return "No estimates yet."
+	}
+	total := 0
+	for _, e := range estimateErrors {
+		total += max(e, -e)
+	}
+	recent := estimateErrors[max(0, len(estimateErrors)-10):]
+	recentTotal := 0
+	for _, e := range recent {
+		recentTotal += max(e, -e)
+	}
+	return fmt.Sprintf("Estimates: %d. Average error: %.1f points overall, %.1f over the last %d. Last estimateErrors: %v",
+		len(estimateErrors), float64(total)/float64(len(estimateErrors)), float64(recentTotal)/float64(len(recent)), len(recent), recent)
+}
+
+// Renders the position of a node in the connected groups style, with cell pixels per point
+func renderBoardImage(node *GameTreeNode, sizeX, sizeY, cell int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, sizeX*cell, sizeY*cell))
+	draw.Draw(img, img.Bounds(), image.NewUniform(gobanColor), image.Point{}, draw.Src)
+	board := node.boardState
+	half := cell / 2
+	thickness := max(1, int(float64(cell)*gridLineThickness))
+
+	// Grid lines
+	for x := 0; x < sizeX; x++ {
+		cx := x*cell + half
+		drawImageRect(img, cx-thickness/2, half-thickness/2, cx-thickness/2+thickness, (sizeY-1)*cell+half-thickness/2+thickness, lineColor)
+	}
+	for y := 0; y < sizeY; y++ {
+		cy := y*cell + half
+		drawImageRect(img, half-thickness/2, cy-thickness/2, (sizeX-1)*cell+half-thickness/2+thickness, cy-thickness/2+thickness, lineColor)
+	}
+
+	// Stone connections, following drawStoneConnections
+	stoneColor := func(stone string) color.Color {
+		if stone == white {
+			return whiteColor
+		}
+		return blackColor
+	}
+	for y := 1; y < sizeY; y++ {
+		for x := 1; x < sizeX; x++ {
+			stone1, stone2, stone3, stone4 := board[y][x-1], board[y][x], board[y-1][x-1], board[y-1][x]
+			if !isStone(stone1) || !isStone(stone2) || !isStone(stone3) || !isStone(stone4) {
+				continue
+			}
+			if stone3 == stone2 && stone1 == stone4 && stone1 != stone2 {
+				continue
+			}
+			c := blackColor
+			if (stone1 == white && stone1 == stone4) || (stone2 == white && stone2 == stone3) {
+				c = whiteColor
+			}
+			drawImageRect(img, x*cell-half, y*cell-half, x*cell+half, y*cell+half, c)
+		}
+	}
+	for y := 0; y < sizeY; y++ {
+		for x := 0; x < sizeX; x++ {
+			stone := board[y][x]
+			if !isStone(stone) {
+				continue
+			}
+			if y > 0 && board[y-1][x] == stone {
+				drawImageRect(img, x*cell, y*cell-half, x*cell+cell, y*cell+half, stoneColor(stone))
+			}
+			if x > 0 && board[y][x-1] == stone {
+				drawImageRect(img, x*cell-half, y*cell, x*cell+half, y*cell+cell, stoneColor(stone))
+			}
+		}
+	}
+
+	// Stones
+	for y := 0; y < sizeY; y++ {
+		for x := 0; x < sizeX; x++ {
+			if board[y][x] == blocked {
+				drawImageRect(img, x*cell, y*cell, x*cell+cell, y*cell+cell, blockedColor)
+			} else if board[y][x] != empty {
+				drawImageCircle(img, float64(x*cell)+float64(cell)/2, float64(y*cell)+float64(cell)/2, float64(cell)/2, stoneColor(board[y][x]))
+			}
+		}
+	}
+
+	// Last move highlight
+	if node.parent != nil && node.move[0] >= 0 && node.move[0] < sizeX && node.move[1] >= 0 && node.move[1] < sizeY {
+		drawImageCircle(img, float64(node.move[0]*cell)+float64(cell)/2, float64(node.move[1]*cell)+float64(cell)/2, float64(cell)*0.16, purpleColor)
+	}
+	return img
+}
+
+// Fills the rectangle [x0, x1) x [y0, y1) of the image
+func drawImageRect(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	draw.Draw(img, image.Rect(x0, y0, x1, y1), image.NewUniform(c), image.Point{}, draw.Over)
+}
+
+// Fills a circle of the image, blending its edge for smoother stones
+func drawImageCircle(img *image.RGBA, cx, cy, r float64, c color.Color) {
+	bounds := image.Rect(int(cx-r)-1, int(cy-r)-1, int(cx+r)+2, int(cy+r)+2).Intersect(img.Bounds())
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			distance := math.Hypot(float64(px)+0.5-cx, float64(py)+0.5-cy)
+			coverage := math.Min(1, math.Max(0, r-distance+0.5))
+			if coverage <= 0 {
+				continue
+			}
+			mask := image.NewUniform(color.Alpha{A: uint8(coverage * 255)})
+			draw.DrawMask(img, image.Rect(px, py, px+1, py+1), image.NewUniform(c), image.Point{}, mask, image.Point{}, draw.Over)
+		}
+	}
+}
+
+// Draws the grid lines on the board
+func (g *Game) drawGridLines() {
+	// Draw vertical lines
+	for x := 0; x < g.sizeX; x++ {
+		line := canvas.NewLine(lineColor)
+		startPos := g.boardCoordsToPixel(x, 0)
+		endPos := g.boardCoordsToPixel(x, g.sizeY-1)
+		line.Position1 = fyne.NewPos(startPos.X+0.5*g.cellSize, startPos.Y+(0.5-gridLineThickness/2)*g.cellSize)
+		line.Position2 = fyne.NewPos(endPos.X+0.5*g.cellSize, endPos.Y+(0.5+gridLineThickness/2)*g.cellSize)
+		line.StrokeWidth = g.cellSize * gridLineThickness
+		g.gridContainer.Add(line)
+	}
+
+	// Draw horizontal lines
+	for y := 0; y < g.sizeY; y++ {
+		line := canvas.NewLine(lineColor)
+		startPos := g.boardCoordsToPixel(0, y)
+		endPos := g.boardCoordsToPixel(g.sizeX-1, y)
+		line.Position1 = fyne.NewPos(startPos.X+(0.5-gridLineThickness/2)*g.cellSize, startPos.Y+0.5*g.cellSize)
+		line.Position2 = fyne.NewPos(endPos.X+(0.5+gridLineThickness/2)*g.cellSize, endPos.Y+0.5*g.cellSize)
+		line.StrokeWidth = g.cellSize * gridLineThickness
+		g.gridContainer.Add(line)
+	}
+}
+
+// Draws connections between stones to represent groups
+func (g *Game) drawStoneConnections() {
+	// Draw 4-square stone connections to represent groups
+	for y := 1; y < g.sizeY; y++ {
+		for x := 1; x < g.sizeX; x++ {
+			stone1 := g.currentNode.boardState[y][x-1]
+			stone2 := g.currentNode.boardState[y][x]
+			stone3 := g.currentNode.boardState[y-1][x-1]
+			stone4 := g.currentNode.boardState[y-1][x]
+			if isStone(stone1) && isStone(stone2) && isStone(stone3) && isStone(stone4) {
+				// Rule out cross cuts to prevent incorrect group representation
+				if stone3 == stone2 && stone1 == stone4 && stone1 != stone2 {
+					continue
+				}
+				rect := canvas.NewRectangle(blackColor)
+				if (stone1 == white && stone1 == stone4) || (stone2 == white && stone2 == stone3) {
+					rect.FillColor = whiteColor
+				}
+				rect.StrokeWidth = 0
+				pos := g.boardCoordsToPixel(x, y)
+				pos = fyne.Position{X: pos.X - 0.5*g.cellSize, Y: pos.Y - 0.5*g.cellSize}
+				rect.Resize(fyne.NewSize(g.cellSize, g.cellSize))
+				rect.Move(pos)
+				g.gridContainer.Add(rect)
+			}
+		}
+	}
+
+	// Draw vertical stone connections
+	for y := 1; y < g.sizeY; y++ {
+		for x := 0; x < g.sizeX; x++ {
+			stone1 := g.currentNode.boardState[y-1][x]
+			stone2 := g.currentNode.boardState[y][x]
+			if isStone(stone1) && stone1 == stone2 {
+				rect := canvas.NewRectangle(blackColor)
+				if stone1 == white {
+					rect.FillColor = whiteColor
+				}
+				rect.StrokeWidth = 0
+				pos := g.boardCoordsToPixel(x, y)
+				pos = fyne.Position{X: pos.X, Y: pos.Y - 0.5*g.cellSize}
+				rect.Resize(fyne.NewSize(g.cellSize, g.cellSize))
+				rect.Move(pos)
+				g.gridContainer.Add(rect)
+			}
+		}
+	}
+
+	// Draw horizontal stone connections
+	for y := 0; y < g.sizeY; y++ {
+		for x := 1; x < g.sizeX; x++ {
+			stone1 := g.currentNode.boardState[y][x-1]
+			stone2 := g.currentNode.boardState[y][x]
+			if isStone(stone1) && stone1 == stone2 {
+				rect := canvas.NewRectangle(blackColor)
+				if stone1 == white {
+					rect.FillColor = whiteColor
+				}
+				rect.StrokeWidth = 0
+				pos := g.boardCoordsToPixel(x, y)
+				pos = fyne.Position{X: pos.X - 0.5*g.cellSize, Y: pos.Y}
+				rect.Resize(fyne.NewSize(g.cellSize, g.cellSize))
+				rect.Move(pos)
+				g.gridContainer.Add(rect)
+			}
+		}
+	}
+}
+
+// Draws the stones on the board based on the current board state
+func (g *Game) drawStones() {
+	for y := 0; y < g.sizeY; y++ {
+		for x := 0; x < g.sizeX; x++ {
+			stone := g.currentNode.boardState[y][x]
+			if stone == blocked {
+				hole := canvas.NewRectangle(blockedColor)
+				hole.Resize(fyne.NewSize(g.cellSize, g.cellSize))
+				hole.Move(g.boardCoordsToPixel(x, y))
+				g.gridContainer.Add(hole)
+			} else if stone != empty {
+				circle := canvas.NewCircle(blackColor)
+				if stone == white {
+					circle.FillColor = whiteColor
+				}
+				circle.StrokeWidth = 0
+				pos := g.boardCoordsToPixel(x, y)
+				circle.Resize(fyne.NewSize(g.cellSize, g.cellSize))
+				circle.Move(pos)
+				g.gridContainer.Add(circle)
+			}
+		}
+	}
+}
+
+// Reports whether the node records a played stone or a pass rather than only setup or markup
+func (gtn *GameTreeNode) hasMove() bool {
+	if gtn.parent == nil {
+		return false
+	}
+	x, y := gtn.move[0], gtn.move[1]
+	return (x == -1 && y == -1) || (x >= 0 && y >= 0 && y < len(gtn.boardState) && x < len(gtn.boardState[y]))
+}
+
+// Returns the children of a node, for the tree functions of goban
+func treeChildren(gtn *GameTreeNode) []*GameTreeNode {
+	return gtn.children
+}
+
+// Returns the parent of a node, for the tree functions of goban
+func treeParent(gtn *GameTreeNode) *GameTreeNode {
+	return gtn.parent
+}
+
+// Visits the node and its descendants depth first, children in order; see goban.Walk
+func (gtn *GameTreeNode) Walk(visit func(node *GameTreeNode) bool) bool {
+	return goban.Walk(gtn, treeChildren, visit)
+}
+
+// Returns the identifier of the node's place in the tree; see goban.PathID. Unlike id it is the same
+// whenever the same SGF file is loaded.
+func (gtn *GameTreeNode) PathID() string {
+	return goban.PathID(gtn, treeParent, treeChildren)
+}
+
+// Returns the node of the tree under root with the given PathID, or nil if there is none
+func NodeAtPath(root *GameTreeNode, path string) *GameTreeNode {
+	node, _ := goban.NodeAtPath(root, path, treeChildren)
+	return node
+}
+
+// Returns the number of moves played from the root up to and including the node
+func (gtn *GameTreeNode) moveNumber() int {
+	number := 0
+	for n := gtn; n != nil; n = n.parent {
+		if n.hasMove() {
+			number++
+		}
+	}
+	return number
+}
+
+// Returns the move number shown for the node, counting on from the nearest MN override on the line
+func (gtn *GameTreeNode) displayMoveNumber() int {
+	number := 0
+	for n := gtn; n != nil; n = n.parent {
+		if n.moveNumberOverride > 0 {
+			return number + n.moveNumberOverride
+		}
+		if n.hasMove() {
+			number++
+		}
+	}
+	return number
+}
+
+// Move and position annotation properties, with the symbol or phrase shown for each value
+var annotationProperties = []struct {
+	key   string
+	label string
+}{
+	{"TE", "!"},
+	{"BM", "?"},
+	{"IT", "!?"},
+	{"DO", "?!"},
+	{"GB", "good for Black"},
+	{"GW", "good for White"},
+	{"DM", "even"},
+	{"UC", "unclear"},
+	{"HO", "hotspot"},
+}
+
+// Describes the annotations of a node, e.g. "!! good for Black"; a value of 2 doubles a move symbol
+func (gtn *GameTreeNode) annotationText() string {
+	var parts []string
+	for _, annotation := range annotationProperties {
+		value, ok := gtn.annotations[annotation.key]
+		if !ok {
+			continue
+		}
+		label := annotation.label
+		if value == "2" && (annotation.key == "TE" || annotation.key == "BM") {
+			label += label
+		}
+		parts = append(parts, label)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Finds the nodes of the main line where the middlegame and the endgame begin; nil if the phase is not reached.
+// The opening ends at the first capture or after an eighth of the board has been played, and the endgame begins
+// once at most a sixth of the board is empty points not enclosed by a single color, or after 55% of the board has been played.
+func detectGamePhases(root *GameTreeNode, sizeX, sizeY int) (*GameTreeNode, *GameTreeNode) {
+	area := sizeX * sizeY
+	var middlegame, endgame *GameTreeNode
+	stones, moves := 0, 0
+	for node := root; len(node.children) > 0; {
+		node = node.children[0]
+		if !node.hasMove() {
+			continue
+		}
+		moves++
+		count := 0
+		for _, row := range node.boardState {
+			for _, stone := range row {
+				if stone == black || stone == white {
+					count++
+				}
+			}
+		}
+		captured := node.move[0] >= 0 && count <= stones
+		stones = count
+		if middlegame == nil && (captured || moves >= area/8) {
+			middlegame = node
+		}
+		if middlegame == nil {
+			continue
+		}
+		territoryMap := goban.NewTerritoryMap(node.boardState, sizeX, sizeY)
+		goban.AssignTerritory(node.boardState, territoryMap, sizeX, sizeY)
+		neutral := 0
+		for _, row := range territoryMap {
+			for _, owner := range row {
+				if owner == "?" {
+					neutral++
+				}
+			}
+		}
+		if neutral*6 <= area || moves*100 >= area*55 {
+			endgame = node
+			break
+		}
+	}
+	return middlegame, endgame
+}
+
+// Moves to the start of the middlegame or the endgame of the main line
+func (g *Game) jumpToPhase(endgame bool) {
+	middlegameNode, endgameNode := detectGamePhases(g.rootNode, g.sizeX, g.sizeY)
+	node, phase := middlegameNode, "Middlegame"
+	if endgame {
+		node, phase = endgameNode, "Endgame"
+	}
+	if node == nil {
+		g.scoringStatus.SetText(fmt.Sprintf("%s not reached in the main line", phase))
+		return
+	}
+	g.setCurrentNode(node)
+	g.redrawBoard()
+	g.updateGameTreeUI()
+	g.scoringStatus.SetText(fmt.Sprintf("%s starts at move %d", phase, node.displayMoveNumber()))
+}
+
+// Draws the number of the move that placed each stone still on the board
+func (g *Game) drawMoveNumbers() {
+	numbers := make(map[[2]int]int)
+	for n := g.currentNode; n != nil; n = n.parent {
+		if !n.hasMove() {
+			continue
+		}
+		x, y := n.move[0], n.move[1]
+		if x >= 0 && numbers[[2]int{x, y}] == 0 && g.currentNode.boardState[y][x] == n.player {
+			numbers[[2]int{x, y}] = n.displayMoveNumber()
+		}
+	}
+	for xy, moveNumber := range numbers {
+		textColor := whiteColor
+		if g.currentNode.boardState[xy[1]][xy[0]] == white {
+			textColor = blackColor
+		}
+		pos := g.boardCoordsToPixel(xy[0], xy[1])
+		text := canvas.NewText(strconv.Itoa(moveNumber), textColor)
+		text.TextSize = g.cellSize * 0.35
+		text.Alignment = fyne.TextAlignCenter
+		text.Resize(text.MinSize())
+		text.Move(fyne.Position{
+			X: pos.X + 0.5*g.cellSize - text.Size().Width/2,
+			Y: pos.Y + 0.5*g.cellSize - text.Size().Height/2,
+		})
+		g.gridContainer.Add(text)
+	}
+}
+
+// Writes the liberty count of each group on its most recently played stone, or its first stone if none of its
+// stones was played on the current line. Groups in atari are counted in red.
+func (g *Game) drawLibertyCounts() {
+	board := g.currentNode.boardState
+	played := make(map[[2]int]int) // Moves back from the current node that each point was last played
+	age := 0
+	for n := g.currentNode; n != nil; n = n.parent {
+		if n.hasMove() && n.move[0] >= 0 {
+			point := [2]int{n.move[0], n.move[1]}
+			if _, seen := played[point]; !seen {
+				played[point] = age
+			}
+			age++
+		}
+	}
+	counted := make(map[[2]int]bool)
+	for y := 0; y < g.sizeY; y++ {
+		for x := 0; x < g.sizeX; x++ {
+			if !isStone(board[y][x]) || counted[[2]int{x, y}] {
+				continue
+			}
+			stones, liberties := goban.GroupLiberties(board, x, y, g.sizeX, g.sizeY)
+			label, latest := [2]int{x, y}, -1
+			for _, stone := range stones {
+				counted[stone] = true
+				if moveAge, ok := played[stone]; ok && (latest == -1 || moveAge < latest) {
+					label, latest = stone, moveAge
+				}
+			}
+			var textColor color.Color = whiteColor
+			if board[y][x] == white {
+				textColor = blackColor
+			}
+			if len(liberties) == 1 {
+				textColor = redColor
+			}
+			text := canvas.NewText(strconv.Itoa(len(liberties)), textColor)
+			text.TextSize = g.cellSize * 0.35
+			text.TextStyle = fyne.TextStyle{Bold: true}
+			text.Resize(text.MinSize())
+			pos := g.boardCoordsToPixel(label[0], label[1])
+			center := fyne.Position{X: pos.X + 0.5*g.cellSize, Y: pos.Y + 0.5*g.cellSize}
+			if g.showMoveNumbers {
+				center = fyne.Position{X: pos.X + 0.8*g.cellSize, Y: pos.Y + 0.8*g.cellSize} // Clear of the move number
+			}
+			text.Move(fyne.Position{X: center.X - text.Size().Width/2, Y: center.Y - text.Size().Height/2})
+			g.gridContainer.Add(text)
+		}
+	}
+}
+
+// Draws annotations such as circles, squares, triangles, marks, and labels
+func (g *Game) drawAnnotations() {
+	annotationsLayer := container.NewWithoutLayout()
+	defer g.gridContainer.Add(annotationsLayer)
+
+	if g.showShapes {
+		g.drawShapes(annotationsLayer)
+	}
+
+	// Draw Labels (LB)
+	if !g.showLabels {
+		return
+	}
+	for y := 0; y < g.sizeY; y++ {
+		for x := 0; x < g.sizeX; x++ {
+			if g.currentNode.LB.at(x, y) != "" {
+				pos := g.boardCoordsToPixel(x, y)
+				text := canvas.NewText(g.currentNode.LB.at(x, y), g.labelColor(g.currentNode.LB.at(x, y), x, y))
+				text.TextSize = g.cellSize * 0.4
+				text.Alignment = fyne.TextAlignCenter
+				text.TextStyle = fyne.TextStyle{Bold: true}
+				text.Resize(text.MinSize()) // Calculate the size needed for the text
+
+				// Center the text on the point
+				text.Move(fyne.Position{
+					X: pos.X + 0.5*g.cellSize - text.Size().Width/2,
+					Y: pos.Y + 0.5*g.cellSize - text.Size().Height/2,
+				})
+				annotationsLayer.Add(text)
+			}
+		}
+	}
+}
+
+// Draws circles, squares, triangles, and X marks onto the annotations layer
+func (g *Game) drawShapes(annotationsLayer *fyne.Container) {
+	// Draw Circles (CR)
+	for y := 0; y < g.sizeY; y++ {
+		for x := 0; x < g.sizeX; x++ {
+			if g.currentNode.CR.has(x, y) {
+				pos := g.boardCoordsToPixel(x, y)
+				circle := canvas.NewCircle(color.Transparent)
+				circle.StrokeColor = redColor
+				circle.StrokeWidth = g.cellSize * 0.05
+				circle.Resize(fyne.NewSize(g.cellSize*0.6, g.cellSize*0.6))
+				circle.Move(fyne.Position{
+					X: pos.X + 0.5*g.cellSize - circle.Size().Width/2,
+					Y: pos.Y + 0.5*g.cellSize - circle.Size().Height/2,
+				})
+				annotationsLayer.Add(circle)
+			}
+		}
+	}
+
+	// Draw Squares (SQ)
+	for y := 0; y < g.sizeY; y++ {
+		for x := 0; x < g.sizeX; x++ {
+			if g.currentNode.SQ.has(x, y) {
+				pos := g.boardCoordsToPixel(x, y)
+				square := canvas.NewRectangle(color.Transparent)
+				square.StrokeColor = redColor
+				square.StrokeWidth = g.cellSize * 0.05
+				square.Resize(fyne.NewSize(g.cellSize*0.6, g.cellSize*0.6))
+				square.Move(fyne.Position{
+					X: pos.X + 0.5*g.cellSize - square.Size().Width/2,
+					Y: pos.Y + 0.5*g.cellSize - square.Size().Height/2,
+				})
+				annotationsLayer.Add(square)
+			}
+		}
+	}
+
+	// Draw Triangles (TR) using three lines
+	tSize := g.cellSize * 0.39
+	tXOffset := tSize * float32(math.Sin(math.Pi/3))
+	tYOffset := tSize * float32(math.Cos(math.Pi/3))
+	for y := 0; y < g.sizeY; y++ {
+		for x := 0; x < g.sizeX; x++ {
+			if g.currentNode.TR.has(x, y) {
+				pos := g.boardCoordsToPixel(x, y)
+				pos0 := fyne.NewPos(pos.X+0.5*g.cellSize, pos.Y+0.5*g.cellSize-tSize)
+				pos1 := fyne.NewPos(pos.X+0.5*g.cellSize-tXOffset, pos.Y+0.5*g.cellSize+tYOffset)
+				pos2 := fyne.NewPos(pos.X+0.5*g.cellSize+tXOffset, pos.Y+0.5*g.cellSize+tYOffset)
+
+				// Create triangle lines
+				line1 := canvas.NewLine(redColor)
+				line1.StrokeWidth = g.cellSize * 0.05
+				line1.Position1 = pos0
+				line1.Position2 = pos1
+
+				line2 := canvas.NewLine(redColor)
+				line2.StrokeWidth = g.cellSize * 0.05
+				line2.Position1 = pos1
+				line2.Position2 = pos2
+
+				line3 := canvas.NewLine(redColor)
+				line3.StrokeWidth = g.cellSize * 0.05
+				line3.Position1 = pos2
+				line3.Position2 = pos0
 
-	game.boardCanvas = container.NewStack(
-		background,
-		game.gridContainer,
-		inputLayer,
-	)
+				// Add lines to annotations layer
+				annotationsLayer.Add(line1)
+				annotationsLayer.Add(line2)
+				annotationsLayer.Add(line3)
+			}
+		}
+	}
 
-	game.sizeX = 19
-	game.sizeY = 19
+	// Draw Xs (MA) using two crossing lines
+	for y := 0; y < g.sizeY; y++ {
+		for x := 0; x < g.sizeX; x++ {
+			if g.currentNode.MA.has(x, y) {
+				pos := g.boardCoordsToPixel(x, y)
+				size := g.cellSize * 0.6
 
-	// Initialize the board here
-	game.initializeBoard()
-	game.redrawBoard()
+				// Define the two crossing lines relative to the position
+				line1 := canvas.NewLine(redColor)
+				line1.StrokeWidth = g.cellSize * 0.05
+				line1.Position1 = fyne.NewPos(pos.X+0.5*g.cellSize-size/2, pos.Y+0.5*g.cellSize-size/2)
+				line1.Position2 = fyne.NewPos(pos.X+0.5*g.cellSize+size/2, pos.Y+0.5*g.cellSize+size/2)
 
-	// Initialize the game tree
-	game.gameTreeContainer = container.NewScroll(nil)
-	game.updateGameTreeUI()
+				line2 := canvas.NewLine(redColor)
+				line2.StrokeWidth = g.cellSize * 0.05
+				line2.Position1 = fyne.NewPos(pos.X+0.5*g.cellSize+size/2, pos.Y+0.5*g.cellSize-size/2)
+				line2.Position2 = fyne.NewPos(pos.X+0.5*g.cellSize-size/2, pos.Y+0.5*g.cellSize+size/2)
 
-	// Define the "File" menu
-	fileMenu := fyne.NewMenu("File",
-		fyne.NewMenuItem("Import SGF", func() {
-			dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
-				if err != nil || reader == nil {
-					return
-				}
-				defer reader.Close()
-				sgfContent, err := io.ReadAll(reader)
-				if err != nil {
-					game.showError(err)
-					return
-				}
-				err = game.importFromSGF(string(sgfContent))
-				if err != nil {
-					game.showError(err)
-					return
-				}
-				game.gameTreeContainer.ScrollToBottom()
-			}, game.window)
-		}),
-		fyne.NewMenuItem("Export SGF", func() {
-			dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
-				if err != nil || writer == nil {
-					return
-				}
-				defer writer.Close()
-				sgfContent, err := game.exportToSGF()
-				if err != nil {
-					game.showError(err)
-					return
-				}
-				_, err = writer.Write([]byte(sgfContent))
-				if err != nil {
-					game.showError(err)
-					return
-				}
-			}, game.window)
-		}),
-	)
+				// Add lines to annotations layer
+				annotationsLayer.Add(line1)
+				annotationsLayer.Add(line2)
+			}
+		}
+	}
+}
 
-	gameMenu := fyne.NewMenu("Game",
-		fyne.NewMenuItem("Fresh Board", func() {
-			// Define the input entries outside the dialog
-			widthEntry := widget.NewEntry()
-			widthEntry.SetPlaceHolder("(1-52)")
-			widthEntry.SetText(strconv.Itoa(game.sizeX))
-			heightEntry := widget.NewEntry()
-			heightEntry.SetPlaceHolder("(1-52)")
-			heightEntry.SetText(strconv.Itoa(game.sizeY))
+// Returns the node whose DD property applies to the given node, or nil if none does.
+func inheritedDimNode(node *GameTreeNode) *GameTreeNode {
+	for n := node; n != nil; n = n.parent {
+		if n.hasDD {
+			return n
+		}
+	}
+	return nil
+}
 
-			// Create form items
-			formItems := []*widget.FormItem{
-				widget.NewFormItem("Width", widthEntry),
-				widget.NewFormItem("Height", heightEntry),
+// Returns the node whose VW property applies to the given node, or nil if none does.
+func inheritedViewNode(node *GameTreeNode) *GameTreeNode {
+	for n := node; n != nil; n = n.parent {
+		if n.hasVW {
+			return n
+		}
+	}
+	return nil
+}
+
+// Reports whether any point of the matrix is set.
+// Reports whether (x, y) is dimmed at the current node, either by DD or by lying outside VW
+func (g *Game) isPointDimmed(x, y int) bool {
+	if ddNode := inheritedDimNode(g.currentNode); ddNode != nil && ddNode.DD.has(x, y) {
+		return true
+	}
+	if vwNode := inheritedViewNode(g.currentNode); vwNode != nil && len(vwNode.VW) > 0 && !vwNode.VW.has(x, y) {
+		return true
+	}
+	return false
+}
+
+// Draws a grey veil over points dimmed by the DD and VW properties
+func (g *Game) drawDimmedPoints() {
+	for y := 0; y < g.sizeY; y++ {
+		for x := 0; x < g.sizeX; x++ {
+			if g.isPointDimmed(x, y) {
+				rect := canvas.NewRectangle(dimColor)
+				rect.StrokeWidth = 0
+				rect.Resize(fyne.NewSize(g.cellSize, g.cellSize))
+				rect.Move(g.boardCoordsToPixel(x, y))
+				g.gridContainer.Add(rect)
 			}
+		}
+	}
+}
 
-			// Create a custom dialog to input board width and height
-			boardSizeDialog := dialog.NewForm(
-				"Fresh Board",
-				"OK",
-				"Cancel",
-				formItems,
-				func(ok bool) {
-					if !ok {
-						return
-					}
-					widthStr := widthEntry.Text
-					heightStr := heightEntry.Text
-					x, errX := strconv.Atoi(widthStr)
-					y, errY := strconv.Atoi(heightStr)
-					if errX != nil || errY != nil || x < 1 || y < 1 || x > 52 || y > 52 {
-						game.showError(fmt.Errorf("invalid board size (must be between 1 and 52)"))
-						return
-					}
-					game.sizeX = x
-					game.sizeY = y
-					game.initializeBoard()
-					game.redrawBoard()
-					game.updateGameTreeUI() // Refresh the game tree UI
-				},
-				game.window,
-			)
+// Toggles the dimming of (x, y) on the current node, starting from the inherited DD set
+func (g *Game) toggleDimmedPoint(x, y int) {
+	if !g.currentNode.hasDD {
+		if ddNode := inheritedDimNode(g.currentNode); ddNode != nil {
+			g.currentNode.DD = maps.Clone(ddNode.DD)
+		}
+		g.currentNode.hasDD = true
+	}
+	g.currentNode.DD.toggle(x, y)
+	g.redrawBoard()
+}
 
-			// Optionally, handle dialog close if needed
-			boardSizeDialog.SetOnClosed(func() {
-				// You can perform additional actions here when the dialog is closed
-			})
+// Removes dimming from the current node, undimming inherited points with an empty DD if needed
+func (g *Game) clearDimmedPoints() {
+	g.currentNode.DD = nil
+	g.currentNode.hasDD = g.currentNode.parent != nil && inheritedDimNode(g.currentNode.parent) != nil
+	g.redrawBoard()
+}
 
-			// Show the dialog
-			boardSizeDialog.Show()
-		}),
-		fyne.NewMenuItem("Pass", func() {
-			game.handlePass()
-		}),
-		fyne.NewMenuItem("Set Komi", func() {
-			game.showSetKomiDialog()
-		}),
-		fyne.NewMenuItem("Delete Node", func() {
-			game.deleteCurrentNode()
-		}),
-	)
+// Restricts the view of the current node to the rectangle spanned by the two corners
+func (g *Game) setView(x1, y1, x2, y2 int) {
+	minX, maxX := min(x1, x2), max(x1, x2)
+	minY, maxY := min(y1, y2), max(y1, y2)
+	for y := 0; y < g.sizeY; y++ {
+		for x := 0; x < g.sizeX; x++ {
+			g.currentNode.VW.set(x, y, x >= minX && x <= maxX && y >= minY && y <= maxY)
+		}
+	}
+	g.currentNode.hasVW = true
+	g.redrawBoard()
+}
 
-	// Define the "MouseMode" menu
-	mouseModeMenu := fyne.NewMenu("MouseMode",
-		fyne.NewMenuItem("Play", func() { game.setMouseMode("play") }),
-		fyne.NewMenuItem("Score", func() { game.setMouseMode("score") }),
-		fyne.NewMenuItem("Set Label", func() { game.setMouseMode("label") }),
-		fyne.NewMenuItem("Add Black", func() { game.setMouseMode("addBlack") }),
-		fyne.NewMenuItem("Add White", func() { game.setMouseMode("addWhite") }),
-		fyne.NewMenuItem("Add Empty", func() { game.setMouseMode("addEmpty") }),
-		fyne.NewMenuItem("Toggle Circle", func() { game.setMouseMode("circle") }),
-		fyne.NewMenuItem("Toggle Square", func() { game.setMouseMode("square") }),
-		fyne.NewMenuItem("Toggle Triangle", func() { game.setMouseMode("triangle") }),
-		fyne.NewMenuItem("Toggle X Mark", func() { game.setMouseMode("xMark") }),
-	)
+// Restores the whole board view on the current node, with an empty VW if a view is inherited
+func (g *Game) clearView() {
+	g.currentNode.VW = nil
+	g.currentNode.hasVW = g.currentNode.parent != nil && inheritedViewNode(g.currentNode.parent) != nil
+	g.viewCorner = nil
+	g.redrawBoard()
+}
 
-	// Define the "Engine" menu
-	engineMenu := fyne.NewMenu("Engine",
-		fyne.NewMenuItem("Settings", func() {
-			game.showEngineSettings()
-		}),
-		fyne.NewMenuItem("Attach Engine", func() {
-			game.attachEngine()
-		}),
-		fyne.NewMenuItem("Detach Engine", func() {
-			game.detachEngine()
-		}),
-		fyne.NewMenuItem("Start Self Play", func() {
-			game.gtpColor = "Both"
-			if game.gtpCmd == nil {
-				game.attachEngine()
+// Draws territory markers when in scoring mode
+func (g *Game) drawTerritoryMarkers() {
+	// Create a new layer for territory markers
+	g.territoryLayer = container.NewWithoutLayout()
+
+	// Iterate over the territory map to place markers
+	for y := 0; y < g.sizeY; y++ {
+		for x := 0; x < g.sizeX; x++ {
+			owner := g.territoryMap[y][x]
+			if owner == black || owner == white {
+				rect := canvas.NewRectangle(transparentBlackColor)
+				rect.StrokeColor = blackScoreColor
+				if owner == white {
+					rect.FillColor = transparentWhiteColor
+					rect.StrokeColor = whiteScoreColor
+				}
+				rect.StrokeWidth = g.cellSize * 0.039
+				squareSize := g.cellSize * 0.51
+				pos := g.boardCoordsToPixel(x, y)
+				pos = fyne.Position{X: pos.X + 0.5*g.cellSize - squareSize/2, Y: pos.Y + 0.5*g.cellSize - squareSize/2}
+				rect.Resize(fyne.NewSize(squareSize, squareSize))
+				rect.Move(pos)
+				g.territoryLayer.Add(rect)
 			}
-			game.startSelfPlay()
-		}),
-		fyne.NewMenuItem("Stop Self Play", func() {
-			game.stopSelfPlay()
-		}),
-	)
+		}
+	}
 
-	// Update the main menu to include the new "Engine" menu
-	mainMenu := fyne.NewMainMenu(
-		fileMenu,
-		gameMenu,
-		mouseModeMenu,
-		engineMenu, // Add Engine menu here
-	)
-	w.SetMainMenu(mainMenu)
+	// Add the territoryLayer to gridContainer
+	g.gridContainer.Add(g.territoryLayer)
+}
 
-	// Wrap the gameTreeContainer in a ResizingContainer
-	resizingLabel := widget.NewLabel("Resizing")
-	gameTreeResizingContainer := NewResizingContainer(game.gameTreeContainer, resizingLabel)
+type inputLayer struct {
+	widget.BaseWidget
+	game     *Game
+	touching bool // A finger is on the board
+}
 
-	// Layout for controls
-	controls := container.NewVSplit(
-		container.NewVBox(
-			game.scoringStatus,
-			game.commentEntry,
-		),
-		gameTreeResizingContainer, // Use the ResizingContainer here
-	)
-	controls.SetOffset(0)
+func newInputLayer(game *Game) *inputLayer {
+	i := &inputLayer{game: game}
+	i.ExtendBaseWidget(i)
+	return i
+}
+
+// Input layer of touch devices, which also steps through the game tree on swipes.
+// Desktops keep the plain input layer, since there any jitter of a click would count as a drag.
+type swipeInputLayer struct {
+	inputLayer
+	swipe fyne.Delta // Distance dragged so far
+}
 
-	// Main layout with split view
-	content := container.NewHSplit(
-		controls,
-		game.boardCanvas,
-	)
-	content.SetOffset(0)
-	w.SetContent(content)
-	w.Resize(fyne.NewSize(800, 600))
-	w.Show()
+func newSwipeInputLayer(game *Game) *swipeInputLayer {
+	s := &swipeInputLayer{inputLayer: inputLayer{game: game}}
+	s.ExtendBaseWidget(s)
+	return s
+}
 
-	a.Run()
+func (s *swipeInputLayer) Dragged(ev *fyne.DragEvent) {
+	s.swipe.DX += ev.Dragged.DX
+	s.swipe.DY += ev.Dragged.DY
 }
 
-func (g *Game) deleteCurrentNode() {
-	if g.currentNode == g.rootNode {
-		// Deleting the root node, reset the game
-		g.initializeBoard()
-		g.updateGameTreeUI()
-		g.updateCommentTextbox()
-		g.redrawBoard()
-	} else {
-		parent := g.currentNode.parent
-		if parent != nil {
-			// Remove current node from its parent's children
-			for i, child := range parent.children {
-				if child == g.currentNode {
-					parent.children = append(parent.children[:i], parent.children[i+1:]...)
-					break
-				}
-			}
-			// Set current node to parent
-			g.currentNode = parent
-			g.updateGameTreeUI()
-			g.updateCommentTextbox()
-			g.redrawBoard()
-		}
+// Swiping left or right steps forward or back a move, swiping up or down changes to the next or previous variation
+func (s *swipeInputLayer) DragEnd() {
+	swipe := s.swipe
+	s.swipe = fyne.Delta{}
+	minimum := 2 * s.game.cellSize
+	g := s.game
+	g.lastInteraction = time.Now()
+	switch {
+	case math.Abs(float64(swipe.DX)) >= math.Abs(float64(swipe.DY)) && swipe.DX <= -minimum:
+		g.nextMove()
+	case math.Abs(float64(swipe.DX)) >= math.Abs(float64(swipe.DY)) && swipe.DX >= minimum:
+		g.previousMove()
+	case math.Abs(float64(swipe.DY)) > math.Abs(float64(swipe.DX)) && swipe.DY <= -minimum:
+		g.switchVariation(1)
+	case math.Abs(float64(swipe.DY)) > math.Abs(float64(swipe.DX)) && swipe.DY >= minimum:
+		g.switchVariation(-1)
 	}
 }
 
-func (g *Game) handleKeyEvent(event *fyne.KeyEvent) {
-	switch event.Name {
-	case fyne.KeyUp:
-		if g.currentNode.parent != nil {
-			g.setCurrentNode(g.currentNode.parent)
-			g.updateGameTreeUI()
-			g.redrawBoard()
-		}
-	case fyne.KeyDown:
-		if len(g.currentNode.children) > 0 {
-			g.setCurrentNode(g.currentNode.children[0])
-			g.updateGameTreeUI()
-			g.redrawBoard()
-		}
-	case fyne.KeyRight:
-		if g.currentNode.parent != nil {
-			siblings := g.currentNode.parent.children
-			for i, node := range siblings {
-				if node == g.currentNode && i+1 < len(siblings) {
-					g.setCurrentNode(siblings[i+1])
-					g.updateGameTreeUI()
-					g.redrawBoard()
-					break
-				}
-			}
-		}
-	case fyne.KeyLeft:
-		if g.currentNode.parent != nil {
-			siblings := g.currentNode.parent.children
-			for i, node := range siblings {
-				if node == g.currentNode && i-1 >= 0 {
-					g.setCurrentNode(siblings[i-1])
-					g.updateGameTreeUI()
-					g.redrawBoard()
-					break
-				}
-			}
-		}
-	case fyne.KeyDelete:
-		g.deleteCurrentNode()
-	case fyne.KeyP:
-		g.handlePass()
+func (i *inputLayer) CreateRenderer() fyne.WidgetRenderer {
+	return &inputLayerRenderer{
+		layer: i,
 	}
 }
 
-func (g *Game) showSetKomiDialog() {
-	komiEntry := widget.NewEntry()
-	komiEntry.SetText(fmt.Sprintf("%d", g.komi))
-	komiEntry.Validator = func(s string) error {
-		if _, err := strconv.ParseFloat(s, 64); err != nil {
-			return fmt.Errorf("invalid komi value")
-		}
-		return nil
+func (i *inputLayer) Resize(size fyne.Size) {
+	i.BaseWidget.Resize(size)
+	i.Refresh()
+	// Trigger redraw on resize to update cell dimensions and redraw grid
+	i.game.redrawBoard()
+}
+
+func (i *inputLayer) Tapped(ev *fyne.PointEvent) {
+	if i.game.isDoubleClick(ev) {
+		i.game.performGesture("doubleClick", ev)
+		return
 	}
-	formItems := []*widget.FormItem{
-		widget.NewFormItem("Komi", komiEntry),
+	if i.game.touchInput && i.game.mouseMode == "play" {
+		i.game.placeTouchCursor(ev.Position)
+		return
 	}
-	komiDialog := dialog.NewForm("Set Komi", "OK", "Cancel", formItems, func(ok bool) {
-		if ok {
-			komiValue, err := strconv.Atoi(komiEntry.Text)
-			if err != nil {
-				g.showError(fmt.Errorf("invalid komi value"))
-				return
-			}
-			g.komi = komiValue
+	i.game.handleMouseClick(ev)
+}
 
-			// Save the configuration
-			if err := g.saveConfig(); err != nil {
-				g.showError(fmt.Errorf("failed to save config: %v", err))
-			}
+func (i *inputLayer) TappedSecondary(ev *fyne.PointEvent) {
+	if i.touching {
+		// Touch drivers report a long press as a secondary tap
+		i.game.performGesture("longPress", ev)
+		return
+	}
+	i.game.cancelPremove()
+}
 
-			// If engine is attached, send komi command
-			if g.gtpCmd != nil {
-				_, err := g.sendGTPCommand(fmt.Sprintf("komi %d", g.komi))
-				if err != nil {
-					g.showError(err)
-				}
-			}
+func (i *inputLayer) TouchDown(ev *mobile.TouchEvent) {
+	i.touching = true
+}
 
-			// Recalculate and display score if in scoring mode
-			if g.mouseMode == "score" {
-				g.calculateAndDisplayScore()
-			}
-		}
-	}, g.window)
-	komiDialog.Show()
+func (i *inputLayer) TouchUp(ev *mobile.TouchEvent) {
+	i.touching = false
 }
 
-func (g *Game) showEngineSettings() {
-	// Create input entries for settings
-	gtpPathEntry := widget.NewEntry()
-	gtpPathEntry.SetText(g.gtpPath)
-	gtpArgsEntry := widget.NewEntry()
-	gtpArgsEntry.SetText(g.gtpArgs)
-	gtpColorEntry := widget.NewSelect([]string{"B", "W", "Both"}, func(value string) {})
-	gtpColorEntry.SetSelected(g.gtpColor)
+func (i *inputLayer) TouchCancel(ev *mobile.TouchEvent) {
+	i.touching = false
+}
 
-	// Create the "Browse" button for GTP Path
-	browseButton := widget.NewButton("Browse", func() {
-		// Open file selector
-		fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
-			if err != nil || reader == nil {
-				return
-			}
-			defer reader.Close()
-			gtpPathEntry.SetText(reader.URI().Path())
-		}, g.window)
+func (i *inputLayer) MouseDown(ev *desktop.MouseEvent) {
+	i.game.altClick = ev.Modifier&fyne.KeyModifierAlt != 0
+	if ev.Button == desktop.MouseButtonTertiary {
+		i.game.performGesture("middleClick", &ev.PointEvent)
+	}
+}
 
-		// If g.gtpPath is not a malformed path, set the initial directory
-		if g.gtpPath != "" {
-			dir := filepath.Dir(g.gtpPath)
-			uri := storage.NewFileURI(dir)
-			listableURI, err := storage.ListerForURI(uri)
-			if err == nil {
-				fileDialog.SetLocation(listableURI)
-			}
-		}
+func (i *inputLayer) MouseUp(ev *desktop.MouseEvent) {}
 
-		fileDialog.Show()
-	})
+func (i *inputLayer) MouseMoved(ev *desktop.MouseEvent) {
+	i.game.handleMouseMove(ev)
+}
 
-	// Create form items
-	formItems := []*widget.FormItem{
-		widget.NewFormItem("GTP Path", browseButton),
-		widget.NewFormItem("GTP Path", gtpPathEntry),
-		widget.NewFormItem("GTP Arguments", gtpArgsEntry),
-		widget.NewFormItem("GTP Color", gtpColorEntry),
-	}
+func (i *inputLayer) MouseIn(ev *desktop.MouseEvent) {}
 
-	// Show settings dialog
-	settingsDialog := dialog.NewForm("Engine Settings", "OK", "Cancel", formItems, func(ok bool) {
-		if ok {
-			g.gtpPath = gtpPathEntry.Text
-			g.gtpArgs = gtpArgsEntry.Text
-			g.gtpColor = gtpColorEntry.Selected
+func (i *inputLayer) MouseOut() {
+	i.game.hideGroupInfoTip()
+	i.game.pointerPosition = nil
+	i.game.clearHoverStone()
+}
 
-			// Save the configuration
-			if err := g.saveConfig(); err != nil {
-				g.showError(fmt.Errorf("failed to save config: %v", err))
-			}
-		}
-	}, g.window)
-	settingsDialog.Show()
+type inputLayerRenderer struct {
+	layer *inputLayer
 }
 
-func (g *Game) updateEngineBoardState() error {
-	if g.gtpCmd == nil {
-		return fmt.Errorf("engine is not attached")
+func (r *inputLayerRenderer) Layout(size fyne.Size) {
+	r.layer.Resize(size)
+}
+
+func (r *inputLayerRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(0, 0)
+}
+
+func (r *inputLayerRenderer) Refresh() {}
+
+func (r *inputLayerRenderer) BackgroundColor() color.Color {
+	return color.Transparent
+}
+
+func (r *inputLayerRenderer) Objects() []fyne.CanvasObject {
+	return nil
+}
+
+func (r *inputLayerRenderer) Destroy() {}
+
+// Converts pixel coordinates to board coordinates.
+// Returns x, y indices and a boolean indicating validity.
+func (g *Game) pixelToBoardCoords(pos fyne.Position) (int, int, bool) {
+	size := g.boardCanvas.Size()
+	x := int(((pos.X*2-size.Width)/g.cellSize + float32(g.sizeX)) / 2)
+	y := int(((pos.Y*2-size.Height)/g.cellSize + float32(g.sizeY)) / 2)
+
+	if x < 0 || x >= g.sizeX || y < 0 || y >= g.sizeY {
+		return 93, 93, false // Coordinates out of bounds
 	}
 
-	// Send "clear_board" to reset the engine's board
-	if _, err := g.sendGTPCommand("clear_board"); err != nil {
-		return err
+	return x, y, true
+}
+
+// Converts board coordinates to pixel positions for rendering.
+func (g *Game) boardCoordsToPixel(x, y int) fyne.Position {
+	size := g.boardCanvas.Size()
+	return fyne.NewPos(
+		(float32(2*x-g.sizeX)*g.cellSize+size.Width)/2,
+		(float32(2*y-g.sizeY)*g.cellSize+size.Height)/2,
+	)
+}
+
+// Handles mouse movement events to display a hover stone when applicable.
+func (g *Game) handleMouseMove(ev *desktop.MouseEvent) {
+	g.updateGroupInfoTip(ev)
+	position := ev.Position
+	g.pointerPosition = &position
+	g.updateHoverStone()
+}
+
+// Default opacity and size of the hover stone, in percent
+const (
+	defaultHoverOpacity = 50
+	defaultHoverSize    = 100
+)
+
+// Shows the hover stone for the point under the pointer in the current position, so that it follows
+// keyboard navigation as well as the mouse. A hidden hover stone is drawn transparent, which keeps the
+// capture preview and the move evaluation written on it.
+func (g *Game) updateHoverStone() {
+	if g.mouseMode != "play" || g.pointerPosition == nil {
+		g.clearHoverStone()
+		return
 	}
 
-	// Set komi in case it has changed
-	if _, err := g.sendGTPCommand(fmt.Sprintf("komi %d", g.komi)); err != nil {
-		return err
+	x, y, ok := g.pixelToBoardCoords(*g.pointerPosition)
+	if !ok {
+		g.clearHoverStone()
+		return
 	}
 
-	// Send "play" commands for each stone on the current board
-	for y := 0; y < g.sizeY; y++ {
-		for x := 0; x < g.sizeX; x++ {
-			stone := g.currentNode.boardState[y][x]
-			if stone != empty {
-				coord := g.clientToGTPCoords(x, y)
-				if _, err := g.sendGTPCommand(fmt.Sprintf("play %s %s", stone, coord)); err != nil {
-					return err
-				}
-			}
-		}
+	player := goban.SwitchPlayer(g.currentNode.player)
+
+	if !g.currentLegality().isLegal(x, y, player) {
+		g.clearHoverStone()
+		return
 	}
 
-	return nil
-}
+	if g.hoverStone != nil {
+		g.gridContainer.Remove(g.hoverStone)
+	}
+	if g.hoverCaptures != nil {
+		g.gridContainer.Remove(g.hoverCaptures)
+		g.hoverCaptures = nil
+	}
 
-func (g *Game) startSelfPlay() {
-	if g.selfPlaying {
-		return // Already self-playing
+	opacity, size := g.hoverOpacity, g.hoverSize
+	if opacity <= 0 {
+		opacity = defaultHoverOpacity
 	}
-	g.selfPlaying = true
-	g.selfPlayCtx, g.selfPlayCancel = context.WithCancel(context.Background())
-	g.selfPlayWaitGrp.Add(1)
-	go func() {
-		defer g.selfPlayWaitGrp.Done()
-		player := switchPlayer(g.currentNode.player)
-		for {
-			select {
-			case <-g.selfPlayCtx.Done():
-				return
-			default:
-				// Generate move for current player
-				engineMove, err := g.sendGTPCommand(fmt.Sprintf("genmove %s", player))
-				if err != nil {
-					g.showError(err)
-					g.detachEngine()
-					return
-				}
-				if engineMove == "pass" || engineMove == "resign" {
-					// Game over
-					dialog.ShowInformation("Game Over", fmt.Sprintf("Player %s %s.", player, engineMove), g.window)
-					return
-				}
-				// Update the game state on the main thread
-				g.handleEngineMove(engineMove)
-				// Switch player
-				player = switchPlayer(player)
-			}
-		}
-	}()
+	if size <= 0 {
+		size = defaultHoverSize
+	}
+	fill := color.NRGBA{0, 0, 0, uint8(opacity * 255 / 100)}
+	if player == white {
+		fill = color.NRGBA{255, 255, 255, fill.A}
+	}
+	if !g.showHoverStone {
+		fill.A = 0
+	}
+	circle := canvas.NewCircle(fill)
+	circle.StrokeWidth = 0
+	diameter := g.cellSize * float32(size) / 100
+	circle.Resize(fyne.NewSize(diameter, diameter))
+	circle.Move(g.boardCoordsToPixel(x, y).AddXY((g.cellSize-diameter)/2, (g.cellSize-diameter)/2))
+	g.gridContainer.Add(circle)
+	g.hoverStone = circle
+	if g.capturePreview {
+		g.hoverCaptures = g.newCapturePreview(x, y, player)
+		g.gridContainer.Add(g.hoverCaptures)
+	}
+	if g.hoverEvaluationText != nil {
+		g.gridContainer.Remove(g.hoverEvaluationText)
+		g.hoverEvaluationText = nil
+	}
+	if g.hoverEvaluation {
+		g.evaluateHoveredMove(x, y, player)
+	}
+	g.gridContainer.Refresh()
 }
 
-func (g *Game) stopSelfPlay() {
-	if g.selfPlaying {
-		g.selfPlayCancel()
-		g.selfPlayWaitGrp.Wait()
-		g.selfPlaying = false
-	}
+// Board gestures with their labels in the gesture editor
+var boardGestures = []struct {
+	name  string
+	label string
+}{
+	{"doubleClick", "Double Click"},
+	{"longPress", "Long Press (Touch)"},
+	{"middleClick", "Middle Click"},
 }
 
-func (g *Game) attachEngine() {
-	// Start the GTP engine process
-	args := strings.Fields(g.gtpArgs)
-	g.gtpCmd = exec.Command(g.gtpPath, args...)
+// Actions that can be bound to a board gesture
+var gestureActionNames = []string{"none", "jump to move", "markup chooser", "toggle illegal points and eyes", "toggle move numbers"}
 
-	var err error
-	g.gtpIn, err = g.gtpCmd.StdinPipe()
-	if err != nil {
-		g.showError(err)
-		return
+// Gesture actions used until the user maps the gestures
+var defaultGestureActions = map[string]string{
+	"doubleClick": "jump to move",
+	"longPress":   "markup chooser",
+	"middleClick": "toggle illegal points and eyes",
+}
+
+// How close together two clicks on the same point must be to make a double click
+const doubleClickInterval = 400 * time.Millisecond
+
+// Reports whether the click follows the previous one on the same point quickly enough to make a double click
+func (g *Game) isDoubleClick(ev *fyne.PointEvent) bool {
+	x, y, ok := g.pixelToBoardCoords(ev.Position)
+	if !ok {
+		return false
 	}
+	now := time.Now()
+	double := now.Sub(g.lastTapTime) < doubleClickInterval && g.lastTapPoint == [2]int{x, y}
+	g.lastTapTime, g.lastTapPoint = now, [2]int{x, y}
+	if double {
+		g.lastTapTime = time.Time{} // A third click starts over
+	}
+	return double
+}
 
-	g.gtpOut, err = g.gtpCmd.StdoutPipe()
-	if err != nil {
-		g.showError(err)
+// Performs the action mapped to the gesture at the board point under the event
+func (g *Game) performGesture(gesture string, ev *fyne.PointEvent) {
+	x, y, ok := g.pixelToBoardCoords(ev.Position)
+	if !ok {
 		return
 	}
+	action, mapped := g.gestureActions[gesture]
+	if !mapped {
+		action = defaultGestureActions[gesture]
+	}
+	switch action {
+	case "jump to move":
+		g.jumpToStoneMove(x, y)
+	case "markup chooser":
+		g.showMarkupChooser(x, y, ev.AbsolutePosition)
+	case "toggle illegal points and eyes":
+		g.showLegality = !g.showLegality
+		g.redrawBoard()
+	case "toggle move numbers":
+		g.showMoveNumbers = !g.showMoveNumbers
+		g.redrawBoard()
+	}
+}
 
-	if err := g.gtpCmd.Start(); err != nil {
-		g.showError(err)
+// Moves to the node where the stone at (x, y) was played
+func (g *Game) jumpToStoneMove(x, y int) {
+	stone := g.currentNode.boardState[y][x]
+	if stone != black && stone != white {
 		return
 	}
+	for node := g.currentNode; node != nil; node = node.parent {
+		if node.hasMove() && node.move == [2]int{x, y} && node.player == stone {
+			g.setCurrentNode(node)
+			g.redrawBoard()
+			g.updateGameTreeUI()
+			return
+		}
+	}
+}
 
-	g.gtpReader = bufio.NewReader(g.gtpOut)
-
-	// Initialize the engine
-	if err := g.initializeEngine(); err != nil {
-		g.showError(err)
-		g.detachEngine()
-	} else {
-		dialog.ShowInformation("Engine Attached", "Successfully attached to the engine.", g.window)
-		// Check if it's the engine's move
-		nextPlayer := switchPlayer(g.currentNode.player)
-		if g.gtpColor == "Both" {
-			g.startSelfPlay()
-		} else if g.gtpColor == nextPlayer {
-			engineMove, err := g.sendGTPCommand(fmt.Sprintf("genmove %s", g.gtpColor))
-			if err != nil {
-				g.showError(err)
-				g.detachEngine()
+// Shows a menu of markup to toggle at (x, y)
+func (g *Game) showMarkupChooser(x, y int, position fyne.Position) {
+	toggle := func(marks *pointSet) func() {
+		return func() {
+			if !g.allowEdit(nil) {
 				return
 			}
-			g.handleEngineMove(engineMove)
+			marks.toggle(x, y)
+			g.redrawBoard()
 		}
 	}
+	menu := fyne.NewMenu("",
+		fyne.NewMenuItem("Circle", toggle(&g.currentNode.CR)),
+		fyne.NewMenuItem("Square", toggle(&g.currentNode.SQ)),
+		fyne.NewMenuItem("Triangle", toggle(&g.currentNode.TR)),
+		fyne.NewMenuItem("X Mark", toggle(&g.currentNode.MA)),
+		fyne.NewMenuItem("Clear Markup", func() {
+			if !g.allowEdit(nil) {
+				return
+			}
+			for _, marks := range []*pointSet{&g.currentNode.CR, &g.currentNode.SQ, &g.currentNode.TR, &g.currentNode.MA} {
+				marks.set(x, y, false)
+			}
+			g.currentNode.LB.set(x, y, "")
+			g.redrawBoard()
+		}),
+	)
+	widget.ShowPopUpMenuAtPosition(menu, g.window.Canvas(), position)
 }
 
-func (g *Game) detachEngine() {
-	g.stopSelfPlay()
-	if g.gtpCmd != nil {
-		// Kill the engine process
-		err := g.gtpCmd.Process.Kill()
-		if err != nil {
-			g.showError(fmt.Errorf("failed to kill engine process: %v", err))
+// Shows a dialog mapping each board gesture to an action
+func (g *Game) showGesturesDialog() {
+	selects := make(map[string]*widget.Select)
+	formItems := []*widget.FormItem{}
+	for _, gesture := range boardGestures {
+		actionSelect := widget.NewSelect(gestureActionNames, nil)
+		action, mapped := g.gestureActions[gesture.name]
+		if !mapped {
+			action = defaultGestureActions[gesture.name]
+		}
+		actionSelect.SetSelected(action)
+		selects[gesture.name] = actionSelect
+		formItems = append(formItems, widget.NewFormItem(gesture.label, actionSelect))
+	}
+	dialog.ShowForm("Board Gestures", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
 		}
-
-		// Close stdin pipe
-		if g.gtpIn != nil {
-			err := g.gtpIn.Close()
-			if err != nil {
-				g.showError(fmt.Errorf("failed to close engine stdin: %v", err))
-			}
-			g.gtpIn = nil
+		g.gestureActions = make(map[string]string)
+		for name, actionSelect := range selects {
+			g.gestureActions[name] = actionSelect.Selected
 		}
-
-		// Close stdout pipe
-		if g.gtpOut != nil {
-			err := g.gtpOut.Close()
-			if err != nil {
-				g.showError(fmt.Errorf("failed to close engine stdout: %v", err))
-			}
-			g.gtpOut = nil
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
 		}
+	}, g.window)
+}
 
-		// Wait for the process to exit
-		err = g.gtpCmd.Wait()
-		if err != nil && !strings.Contains(err.Error(), "killed") {
-			g.showError(fmt.Errorf("error while waiting for engine process to exit: %v", err))
+// Lets the user set the opacity and size of the hover stone, previewed on a sample stone
+func (g *Game) showHoverStoneDialog() {
+	opacity, size := g.hoverOpacity, g.hoverSize
+	if opacity <= 0 {
+		opacity = defaultHoverOpacity
+	}
+	if size <= 0 {
+		size = defaultHoverSize
+	}
+	sample := canvas.NewCircle(color.Black)
+	sampleBoard := container.NewStack(canvas.NewRectangle(gobanColor), container.NewWithoutLayout(sample))
+	opacityLabel := widget.NewLabel("")
+	sizeLabel := widget.NewLabel("")
+	opacitySlider := widget.NewSlider(10, 100)
+	sizeSlider := widget.NewSlider(40, 100)
+	update := func(float64) {
+		opacityLabel.SetText(fmt.Sprintf("Opacity: %d%%", int(opacitySlider.Value)))
+		sizeLabel.SetText(fmt.Sprintf("Size: %d%% of a stone", int(sizeSlider.Value)))
+		sample.FillColor = color.NRGBA{0, 0, 0, uint8(opacitySlider.Value * 255 / 100)}
+		diameter := float32(sizeSlider.Value) * 0.6
+		sample.Resize(fyne.NewSize(diameter, diameter))
+		sample.Move(fyne.NewPos((60-diameter)/2, (60-diameter)/2))
+		sample.Refresh()
+	}
+	opacitySlider.Step, sizeSlider.Step = 5, 5
+	opacitySlider.SetValue(float64(opacity))
+	sizeSlider.SetValue(float64(size))
+	opacitySlider.OnChanged, sizeSlider.OnChanged = update, update
+	update(0)
+	content := container.NewVBox(opacityLabel, opacitySlider, sizeLabel, sizeSlider, container.NewGridWrap(fyne.NewSize(60, 60), sampleBoard))
+	dialog.ShowCustomConfirm("Hover Stone Appearance", "OK", "Cancel", content, func(ok bool) {
+		if !ok {
+			return
 		}
+		g.hoverOpacity, g.hoverSize = int(opacitySlider.Value), int(sizeSlider.Value)
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
+		}
+	}, g.window)
+}
 
-		// Set engine-related variables to nil
-		g.gtpCmd = nil
-		g.gtpReader = nil
-
-		dialog.ShowInformation("Engine Detached", "Successfully detached from the engine.", g.window)
+// Removes the hover stone and its capture preview, if shown
+func (g *Game) clearHoverStone() {
+	g.hoverPoint = [2]int{-1, -1}
+	if g.hoverStone == nil && g.hoverCaptures == nil && g.hoverEvaluationText == nil {
+		return
+	}
+	if g.hoverEvaluationText != nil {
+		g.gridContainer.Remove(g.hoverEvaluationText)
+		g.hoverEvaluationText = nil
 	}
+	if g.hoverStone != nil {
+		g.gridContainer.Remove(g.hoverStone)
+		g.hoverStone = nil
+	}
+	if g.hoverCaptures != nil {
+		g.gridContainer.Remove(g.hoverCaptures)
+		g.hoverCaptures = nil
+	}
+	g.gridContainer.Refresh()
 }
 
-func (g *Game) initializeEngine() error {
-	// Check if the required commands are supported
-	supportedCommands, err := g.sendGTPCommand("list_commands")
-	if err != nil {
-		return err
+// Visits of the quick search run for a hovered move that has no cached evaluation
+const hoverPreviewVisits = 50
+
+// Shows how the hovered move changes the mover's winrate. Cached evaluations are used when there are any:
+// an analyzed child with the move, a candidate of the position's analysis, or an earlier hover.
+// Otherwise a quick search starts once the pointer has rested on the point.
+func (g *Game) evaluateHoveredMove(x, y int, player string) {
+	node := g.currentNode
+	point := [2]int{x, y}
+	moved := g.hoverPoint != point
+	g.hoverPoint = point
+	if winrate, ok := g.cachedMoveEvaluation(node, x, y, player); ok {
+		g.drawHoverEvaluation(x, y, player, winrate)
+		return
 	}
-
-	requiredCommands := []string{"boardsize", "komi", "play", "genmove"}
-	for _, cmd := range requiredCommands {
-		if !strings.Contains(supportedCommands, cmd) {
-			return fmt.Errorf("engine does not support required command: %s", cmd)
-		}
+	if !moved || g.gtpCmd == nil || g.engineThinking || g.selfPlaying || g.analyzing {
+		return
 	}
+	time.AfterFunc(400*time.Millisecond, func() {
+		g.runOnUI(func() {
+			if g.hoverPoint != point || g.currentNode != node {
+				return // The pointer moved on without resting
+			}
+			go func() {
+				analysis, err := g.searchPosition(node, &Move{x: x, y: y, player: player}, hoverPreviewVisits)
+				if err != nil || analysis.visits == 0 {
+					return
+				}
+				g.runOnUI(func() {
+					if node.previews == nil {
+						node.previews = make(map[[2]int]float64)
+					}
+					node.previews[point] = analysis.blackWinrate
+					if g.hoverPoint == point && g.currentNode == node && g.hoverStone != nil {
+						g.drawHoverEvaluation(x, y, player, analysis.blackWinrate)
+						g.gridContainer.Refresh()
+					}
+				})
+			}()
+		})
+	})
+}
 
-	// Set board size
-	if g.sizeX == g.sizeY {
-		if _, err := g.sendGTPCommand(fmt.Sprintf("boardsize %d", g.sizeX)); err != nil {
-			return err
+// Returns Black's winrate after the player's move at (x, y) in node's position, if already known
+func (g *Game) cachedMoveEvaluation(node *GameTreeNode, x, y int, player string) (float64, bool) {
+	for _, child := range node.children {
+		if child.move == [2]int{x, y} && child.player == player && child.analysis != nil && child.analysis.visits > 0 {
+			return child.analysis.blackWinrate, true
 		}
-	} else {
-		// Check if rectangular_boardsize is supported
-		if strings.Contains(supportedCommands, "rectangular_boardsize") {
-			if _, err := g.sendGTPCommand(fmt.Sprintf("rectangular_boardsize %d %d", g.sizeX, g.sizeY)); err != nil {
-				return err
-			}
-		} else {
-			return fmt.Errorf("engine does not support rectangular boards and board is not square")
+	}
+	if node.analysis != nil {
+		if winrate, ok := node.analysis.candidates[g.clientToGTPCoords(x, y)]; ok {
+			return winrate, true
 		}
 	}
+	winrate, ok := node.previews[[2]int{x, y}]
+	return winrate, ok
+}
 
-	// Set komi
-	if _, err := g.sendGTPCommand(fmt.Sprintf("komi %d", g.komi)); err != nil {
-		return err
+// Writes the evaluation of the hovered move on its stone: the change of the mover's winrate if the position
+// itself is analyzed, else the mover's winrate after the move
+func (g *Game) drawHoverEvaluation(x, y int, player string, blackWinrate float64) {
+	if g.hoverEvaluationText != nil {
+		g.gridContainer.Remove(g.hoverEvaluationText)
 	}
+	after := blackWinrate
+	if player == white {
+		after = 1 - after
+	}
+	label := fmt.Sprintf("%.0f%%", after*100)
+	if analysis := g.currentNode.analysis; analysis != nil && analysis.visits > 0 {
+		before := analysis.blackWinrate
+		if player == white {
+			before = 1 - before
+		}
+		label = fmt.Sprintf("%+.1f", (after-before)*100)
+	}
+	text := canvas.NewText(label, purpleColor)
+	text.TextStyle = fyne.TextStyle{Bold: true}
+	text.TextSize = g.cellSize * 0.3
+	text.Alignment = fyne.TextAlignCenter
+	text.Resize(text.MinSize())
+	pos := g.boardCoordsToPixel(x, y)
+	text.Move(fyne.Position{
+		X: pos.X + 0.5*g.cellSize - text.Size().Width/2,
+		Y: pos.Y + 0.5*g.cellSize - text.Size().Height/2,
+	})
+	g.gridContainer.Add(text)
+	g.hoverEvaluationText = text
+}
 
-	// Send the current board state to the engine
-	for y := 0; y < g.sizeY; y++ {
-		for x := 0; x < g.sizeX; x++ {
-			stone := g.currentNode.boardState[y][x]
-			if stone != empty {
-				coord := g.clientToGTPCoords(x, y)
-				if _, err := g.sendGTPCommand(fmt.Sprintf("play %s %s", stone, coord)); err != nil {
-					return err
-				}
+// Dims the stones that a move of the player at (x, y) would capture
+func (g *Game) newCapturePreview(x, y int, player string) *fyne.Container {
+	preview := container.NewWithoutLayout()
+	board := goban.CopyBoard(g.currentNode.boardState)
+	board[y][x] = player
+	opponent := goban.SwitchPlayer(player)
+	dimmed := make(map[[2]int]bool)
+	for _, captured := range goban.CapturedStones(board, x, y, opponent, g.sizeX, g.sizeY) {
+		stones, _ := goban.GroupLiberties(board, captured[0], captured[1], g.sizeX, g.sizeY)
+		for _, stone := range stones {
+			if dimmed[stone] {
+				continue
 			}
+			dimmed[stone] = true
+			circle := canvas.NewCircle(withAlpha(color.NRGBA{gobanColor.R, gobanColor.G, gobanColor.B, 255}, 170))
+			circle.StrokeWidth = 0
+			circle.Resize(fyne.NewSize(g.cellSize, g.cellSize))
+			circle.Move(g.boardCoordsToPixel(stone[0], stone[1]))
+			preview.Add(circle)
 		}
 	}
-
-	return nil
+	return preview
 }
 
-func (g *Game) sendGTPCommand(command string) (string, error) {
-	if g.gtpIn == nil || g.gtpReader == nil {
-		return "", fmt.Errorf("engine is not attached")
+func (g *Game) setMouseMode(mode string) {
+	if mode != "scratch" && g.scratchOrigin != nil {
+		g.discardScratchBoard()
+	}
+	if g.mouseMode == mode {
+		return
+	}
+	if g.mouseMode == "score" && mode != "score" {
+		g.exitScoringMode()
+	}
+	if mode == "score" && g.mouseMode != "score" {
+		g.enterScoringMode()
 	}
+	g.mouseMode = mode
+	g.viewCorner = nil
+	g.semeaiFirst = nil
+	g.insertTarget = nil
+}
 
-	// Send command
-	_, err := g.gtpIn.Write([]byte(command + "\n"))
-	if err != nil {
-		return "", err
+// Handles mouse click events to place stones or toggle group status in scoring mode.
+func (g *Game) handleMouseClick(ev *fyne.PointEvent) {
+	if g.selfPlaying || g.broadcasting {
+		return // Do nothing during self-play or while following a broadcast
+	}
+	g.lastInteraction = time.Now()
+	x, y, ok := g.pixelToBoardCoords(ev.Position)
+	if !ok {
+		return // Click outside the board
+	}
+	if g.currentNode.boardState[y][x] == blocked && slices.Contains([]string{"addBlack", "addWhite", "addEmpty", "scratch"}, g.mouseMode) {
+		return // Missing points change only through the board shape
+	}
+	if g.clickEdits(x, y) && !g.allowEdit(func() { g.handleMouseClick(ev) }) {
+		return
 	}
-	fmt.Println("GTP command sent:\n" + command)
 
-	// Read response
-	var responseLines []string
-	for {
-		line, err := g.gtpReader.ReadString('\n')
-		if err != nil {
-			return "", err
-		}
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+	switch g.mouseMode {
+	case "play":
+		if g.tutorialActive {
+			g.tutorialMove(x, y)
+			return
 		}
-		if line[0] == '=' || line[0] == '?' {
-			// Response start
-			if len(line) > 1 {
-				responseLines = append(responseLines, strings.TrimSpace(line[1:]))
+		if g.engineThinking {
+			// The position is about to change, so queue the move instead
+			if g.currentNode.boardState[y][x] == empty {
+				g.premove = &Move{x: x, y: y, player: g.currentNode.player}
+				g.redrawBoard()
 			}
-			// Read any additional output lines
-			for {
-				nextLine, err := g.gtpReader.ReadString('\n')
-				if err != nil {
-					return "", err
-				}
-				nextLine = strings.TrimSpace(nextLine)
-				if nextLine == "" {
-					break
+			return
+		}
+		if g.currentNode.boardState[y][x] != empty {
+			return
+		}
+		player := goban.SwitchPlayer(g.currentNode.player)
+		g.placeMove(x, y, player, true, g.entersExistingMove())
+		g.warnAtari(player)
+		// If engine should play next
+		if g.gtpCmd != nil && g.gtpColor == goban.SwitchPlayer(player) {
+			g.requestEngineMove(goban.SwitchPlayer(player))
+		}
+	case "score":
+		g.toggleGroupStatus(x, y)
+		g.assignTerritoryToEmptyRegions()
+		g.redrawBoard()
+		g.calculateAndDisplayScore()
+		g.resetScoreAcceptance()
+	case "label":
+		// Open a textbox popup to set or remove the label of the vertex
+		entry := widget.NewEntry()
+		if existingLabel := g.currentNode.LB.at(x, y); existingLabel != "" {
+			entry.SetText(existingLabel)
+		}
+		entry.SetPlaceHolder("Enter label (leave empty to remove)")
+		entryDialog := dialog.NewForm("Set Label", "OK", "Cancel",
+			[]*widget.FormItem{widget.NewFormItem("Label", entry)},
+			func(ok bool) {
+				if ok {
+					label := entry.Text
+					g.currentNode.LB.set(x, y, label)
+					g.redrawBoard()
 				}
-				responseLines = append(responseLines, nextLine)
-			}
-			response := strings.Join(responseLines, "\n")
-			fmt.Println("GTP response recieved:\n" + response)
-			if line[0] == '?' {
-				return response, fmt.Errorf("error from engine: %s", strings.Join(responseLines, "\n"))
-			}
-			return response, nil
+			}, g.window)
+		entryDialog.Show()
+	case "addBlack":
+		if g.currentNode.boardState[y][x] != black {
+			g.currentNode.setPoint(x, y, black)
+			g.currentNode.addedBlackStones.set(x, y, true)
+			g.currentNode.addedWhiteStones.set(x, y, false)
+			g.currentNode.AE.set(x, y, false)
+			g.reportConflicts(g.recomputeFollowing(g.currentNode))
+			g.redrawBoard()
+		}
+	case "addWhite":
+		if g.currentNode.boardState[y][x] != white {
+			g.currentNode.setPoint(x, y, white)
+			g.currentNode.addedWhiteStones.set(x, y, true)
+			g.currentNode.addedBlackStones.set(x, y, false)
+			g.currentNode.AE.set(x, y, false)
+			g.reportConflicts(g.recomputeFollowing(g.currentNode))
+			g.redrawBoard()
+		}
+	case "addEmpty":
+		if g.currentNode.boardState[y][x] != empty {
+			g.currentNode.setPoint(x, y, empty)
+			g.currentNode.AE.set(x, y, true)
+			g.currentNode.addedBlackStones.set(x, y, false)
+			g.currentNode.addedWhiteStones.set(x, y, false)
+			g.reportConflicts(g.recomputeFollowing(g.currentNode))
+			g.redrawBoard()
+		}
+	case "insertMove":
+		g.insertMoveBefore(x, y)
+	case "circle":
+		// Toggle CR[y][x]
+		g.currentNode.CR.toggle(x, y)
+		g.redrawBoard()
+	case "square":
+		// Toggle SQ[y][x]
+		g.currentNode.SQ.toggle(x, y)
+		g.redrawBoard()
+	case "triangle":
+		// Toggle TR[y][x]
+		g.currentNode.TR.toggle(x, y)
+		g.redrawBoard()
+	case "xMark":
+		// Toggle MA[y][x]
+		g.currentNode.MA.toggle(x, y)
+		g.redrawBoard()
+	case "sequence":
+		g.placeSequenceLabel(x, y)
+	case "dim":
+		g.toggleDimmedPoint(x, y)
+	case "ladder":
+		g.readLadder(x, y)
+	case "semeai":
+		if g.currentNode.boardState[y][x] == empty {
+			return
 		}
+		if g.semeaiFirst == nil || g.currentNode.boardState[y][x] == g.currentNode.boardState[g.semeaiFirst[1]][g.semeaiFirst[0]] {
+			g.semeaiFirst = &[2]int{x, y}
+			g.scoringStatus.SetText("Pick the opposing group of the capture race.")
+			return
+		}
+		g.countCaptureRace(g.semeaiFirst[0], g.semeaiFirst[1], x, y)
+		g.semeaiFirst = nil
+	case "endgame":
+		g.toggleEndgameValue(x, y)
+	case "scratch":
+		// Cycle the point through empty, Black and White, without captures
+		switch g.currentNode.boardState[y][x] {
+		case empty:
+			g.currentNode.setPoint(x, y, black)
+		case black:
+			g.currentNode.setPoint(x, y, white)
+		default:
+			g.currentNode.setPoint(x, y, empty)
+		}
+		g.redrawBoard()
+	case "view":
+		if g.viewCorner == nil {
+			g.viewCorner = &[2]int{x, y}
+			return
+		}
+		g.setView(g.viewCorner[0], g.viewCorner[1], x, y)
+		g.viewCorner = nil
+	default:
+		// Do nothing or handle other modes
 	}
 }
 
-// GTP coordinates use letters A-H, J-T (I is skipped), and numbers from 1 upwards
-func (g *Game) clientToGTPCoords(x, y int) string {
-	// Convert x to letter
-	letterRunes := []rune("ABCDEFGHJKLMNOPQRSTUVWXYZ")
-	if x < 0 || x >= len(letterRunes) {
-		return ""
+// Places the next number of the numbered sequence tool as a label at (x, y).
+// Clicking the most recently numbered point again removes it and steps back.
+func (g *Game) placeSequenceLabel(x, y int) {
+	if g.sequenceNode != g.currentNode {
+		if g.sequenceAutoRestart {
+			g.sequenceNext = 1
+		}
+		g.sequenceNode = g.currentNode
 	}
-	letter := string(letterRunes[x])
-	// GTP coordinates have origin at lower-left corner
-	number := g.sizeY - y
-	return fmt.Sprintf("%s%d", letter, number)
+	if g.sequenceNext > 1 && g.currentNode.LB.at(x, y) == strconv.Itoa(g.sequenceNext-1) {
+		g.currentNode.LB.set(x, y, "")
+		g.sequenceNext--
+	} else {
+		g.currentNode.LB.set(x, y, strconv.Itoa(g.sequenceNext))
+		g.sequenceNext++
+	}
+	g.redrawBoard()
 }
 
-func (g *Game) gtpToClientCoords(coord string) (int, int, error) {
-	if len(coord) < 2 {
-		return 0, 0, fmt.Errorf("invalid GTP coordinate: %s", coord)
+// Restarts the numbered sequence tool at 1.
+func (g *Game) restartSequence() {
+	g.sequenceNext = 1
+	g.sequenceNode = g.currentNode
+}
+
+// Returns the color used to draw the label at (x, y). With sequence color alternation enabled,
+// numeric labels alternate starting with the color of the player to move; on a stone they take
+// the color opposite to the stone so that they stay readable.
+func (g *Game) labelColor(label string, x, y int) color.Color {
+	if !g.sequenceAlternate {
+		return redColor
 	}
-	letter := coord[:1]
-	numberStr := coord[1:]
-	letterRunes := []rune("ABCDEFGHJKLMNOPQRSTUVWXYZ")
-	x := -1
-	for i, r := range letterRunes {
-		if string(r) == letter {
-			x = i
-			break
-		}
+	n, err := strconv.Atoi(label)
+	if err != nil || n < 1 {
+		return redColor
 	}
-	if x == -1 {
-		return 0, 0, fmt.Errorf("invalid GTP coordinate letter, coord: %s, %s", letter, coord)
+	switch g.currentNode.boardState[y][x] {
+	case black:
+		return whiteColor
+	case white:
+		return blackColor
 	}
-	number, err := strconv.Atoi(numberStr)
-	if err != nil {
-		return 0, 0, err
+	player := goban.SwitchPlayer(g.currentNode.player)
+	if n%2 == 0 {
+		player = goban.SwitchPlayer(player)
 	}
-	y := g.sizeY - number
-	if y < 0 || y >= g.sizeY {
-		return 0, 0, fmt.Errorf("invalid GTP coordinate number: %s", numberStr)
+	if player == white {
+		return whiteColor
 	}
-	return x, y, nil
+	return blackColor
 }
 
-func (g *Game) playMove(x, y int, player string, informEngine bool) {
-	// Check if the move already exists as a child of the current node
-	moveExists := false
-	for _, child := range g.currentNode.children {
-		if child.move[0] == x && child.move[1] == y && child.player == player {
-			// Move already exists, switch to that node
-			g.currentNode = child
-			moveExists = true
-			break
-		}
+// Checks a move on the current node by the rules of the goban package, plus positional superko if enabled
+func (g *Game) isMoveLegal(x, y int, player string) bool {
+	if !goban.IsLegal(g.currentNode.boardState, x, y, player, g.currentNode.koX, g.currentNode.koY, g.sizeX, g.sizeY) {
+		return false
 	}
+	return !g.superko || g.repeatedPosition(x, y, player) == nil
+}
 
-	if !moveExists {
-		if x == -1 && y == -1 {
-			// Handle pass move
-			newNode := g.newGameTreeNode()
-			newNode.boardState = copyBoard(g.currentNode.boardState)
-			newNode.player = player
-			newNode.move = [2]int{-1, -1}
-			newNode.parent = g.currentNode
-			g.currentNode.children = append(g.currentNode.children, newNode)
-			g.currentNode = newNode
-		} else {
-			if !g.isMoveLegal(x, y, player) {
-				g.showError(fmt.Errorf("illegal move at (%d, %d) by player %s", x, y, player))
-				return
-			}
-			// Create new node with the move
-			boardCopy := copyBoard(g.currentNode.boardState)
-			boardCopy[y][x] = player
-			koX, koY := g.captureStones(boardCopy, x, y, player)
-			newNode := g.newGameTreeNode()
-			newNode.boardState = boardCopy
-			newNode.move = [2]int{x, y}
-			newNode.player = player
-			newNode.parent = g.currentNode
-			newNode.koX = koX
-			newNode.koY = koY
-			g.currentNode.children = append(g.currentNode.children, newNode)
-			g.currentNode = newNode
-		}
+// Returns the latest node of the current line whose position playing at (x, y) would repeat, or nil if none.
+// Captures are resolved as usual, so the longer cycles of triple ko and sending two, returning one are found too.
+func (g *Game) repeatedPosition(x, y int, player string) *GameTreeNode {
+	board := goban.CopyBoard(g.currentNode.boardState)
+	if !goban.PlaceStone(board, x, y, player, g.sizeX, g.sizeY) {
+		return nil
 	}
-
-	g.updateCommentTextbox()
-	g.updateGameTreeUI()
-	g.redrawBoard()
-
-	// Inform the engine of the move if it is attached and informEngine is true
-	if informEngine && g.gtpCmd != nil {
-		coord := "pass"
-		if x != -1 && y != -1 {
-			coord = g.clientToGTPCoords(x, y)
-		}
-		_, err := g.sendGTPCommand(fmt.Sprintf("play %s %s", player, coord))
-		if err != nil {
-			g.showError(err)
-			g.detachEngine()
+	// Collected again when another node is current or the current position was edited since
+	if key := goban.BoardKey(g.currentNode.boardState); g.historyNode != g.currentNode || g.historyKey != key {
+		g.positionHistory = make(map[string]*GameTreeNode)
+		for n := g.currentNode; n != nil; n = n.parent {
+			key := goban.BoardKey(n.boardState)
+			if _, ok := g.positionHistory[key]; !ok {
+				g.positionHistory[key] = n
+			}
 		}
+		g.historyNode, g.historyKey = g.currentNode, key
 	}
+	return g.positionHistory[goban.BoardKey(board)]
 }
 
-func (g *Game) handleEngineMove(coord string) {
-	coord = strings.TrimSpace(coord)
-	if coord == "resign" {
-		dialog.ShowInformation("Engine Resigned", "The engine has resigned.", g.window)
+// Shows why a move is illegal, naming the earlier position a ko or superko recapture would repeat
+func (g *Game) explainIllegalMove(x, y int, player string) {
+	point := g.pointName(x, y)
+	var repeated *GameTreeNode
+	switch {
+	case g.currentNode.boardState[y][x] == blocked:
+		dialog.ShowInformation("Illegal Move", fmt.Sprintf("%s is not part of the board.", point), g.window)
 		return
+	case g.currentNode.boardState[y][x] != empty:
+		dialog.ShowInformation("Illegal Move", fmt.Sprintf("%s is already occupied.", point), g.window)
+		return
+	case x == g.currentNode.koX && y == g.currentNode.koY:
+		repeated = g.currentNode.parent
+	case g.superko:
+		repeated = g.repeatedPosition(x, y, player)
 	}
-	x, y := -1, -1
-	if coord != "pass" {
-		var err error
-		x, y, err = g.gtpToClientCoords(coord)
-		if err != nil {
-			g.showError(err)
-			return
+	if repeated == nil {
+		dialog.ShowInformation("Illegal Move", fmt.Sprintf("%s at %s would be suicide: the stone would have no liberties and capture nothing.", playerName(player), point), g.window)
+		return
+	}
+	earlier := "the starting position"
+	if repeated.hasMove() {
+		move := "pass"
+		if repeated.move[0] >= 0 {
+			move = g.pointName(repeated.move[0], repeated.move[1])
 		}
+		earlier = fmt.Sprintf("the position after move %d (%s %s)", repeated.displayMoveNumber(), playerName(repeated.player), move)
 	}
-	player := switchPlayer(g.currentNode.player)
-	g.playMove(x, y, player, false) // Do not inform the engine of its own move
-}
-
-func (g *Game) updateCommentTextbox() {
-	if g.currentNode != nil && g.currentNode.Comment != "" {
-		g.commentEntry.SetText(g.currentNode.Comment)
+	explanation := fmt.Sprintf("%s at %s would repeat %s.", playerName(player), point, earlier)
+	if cycle := g.currentNode.moveNumber() + 1 - repeated.moveNumber(); cycle <= 2 {
+		explanation += "\nThis is a ko: play a ko threat elsewhere before taking back."
 	} else {
-		g.commentEntry.SetText("") // Clears the textbox if there's no comment
-	}
-}
-
-func (g *Game) enterScoringMode() {
-	g.initializeTerritoryMap()
-	g.assignTerritoryToEmptyRegions()
-	g.redrawBoard()
-	g.calculateAndDisplayScore()
-}
-
-func (g *Game) exitScoringMode() {
-	// Remove territory markers
-	if g.territoryLayer != nil {
-		g.gridContainer.Remove(g.territoryLayer)
-		g.territoryLayer = nil
+		explanation += fmt.Sprintf("\nThis closes a %d move cycle, such as a triple ko or sending two, returning one, which positional superko forbids.", cycle)
 	}
-	// Re-draw the board
-	g.redrawBoard()
-	// Reset any scoring status
-	g.scoringStatus.SetText("Not in scoring mode.")
+	dialog.ShowInformation("Illegal Move", explanation, g.window)
 }
 
-func (g *Game) initializeTerritoryMap() {
-	g.territoryMap = make([][]string, g.sizeY)
-	for y := 0; y < g.sizeY; y++ {
-		g.territoryMap[y] = make([]string, g.sizeX)
-		for x := 0; x < g.sizeX; x++ {
-			stone := g.currentNode.boardState[y][x]
-			if stone == black || stone == white {
-				g.territoryMap[y][x] = stone
-			} else {
-				g.territoryMap[y][x] = "?"
-			}
-		}
+// Creates the Positional Superko toggle, which also invalidates the cached legal points
+func (g *Game) newSuperkoMenuItem() *fyne.MenuItem {
+	item := g.newToggleMenuItem("Positional Superko", &g.superko)
+	toggle := item.Action
+	item.Action = func() {
+		g.legalityCache = make(map[*GameTreeNode]*legalityMap)
+		toggle()
 	}
+	return item
 }
 
-func (g *Game) assignTerritoryToEmptyRegions() {
-	visited := make([][]bool, g.sizeY)
-	for y := 0; y < g.sizeY; y++ {
-		visited[y] = make([]bool, g.sizeX)
+// Reads whether the defender group at (x, y), in atari with the defender to move, is captured in a ladder.
+// The defender may extend or capture an adjacent attacker group in atari; three liberties count as an escape.
+// Returns the result and the moves of the main line read.
+func ladderDefend(board [][]string, x, y int, sizeX, sizeY int, depth int) (bool, []Move) {
+	defender := board[y][x]
+	stones, liberties := goban.GroupLiberties(board, x, y, sizeX, sizeY)
+	if depth > sizeX*sizeY {
+		return false, nil // Too long to be a ladder
 	}
 
-	for y := 0; y < g.sizeY; y++ {
-		for x := 0; x < g.sizeX; x++ {
-			if g.currentNode.boardState[y][x] == empty && !visited[y][x] {
-				// Start flood fill for this empty region
-				stack := [][2]int{{x, y}}
-				adjacentStones := make(map[string]bool)
-				region := [][2]int{}
-
-				for len(stack) > 0 {
-					cx, cy := stack[len(stack)-1][0], stack[len(stack)-1][1]
-					stack = stack[:len(stack)-1]
-
-					if visited[cy][cx] {
-						continue
-					}
-					visited[cy][cx] = true
-					region = append(region, [2]int{cx, cy})
-
-					dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
-					for _, d := range dirs {
-						nx, ny := cx+d[0], cy+d[1]
-						if nx >= 0 && nx < g.sizeX && ny >= 0 && ny < g.sizeY {
-							neighborStone := g.territoryMap[ny][nx]
-							if g.currentNode.boardState[ny][nx] == empty && !visited[ny][nx] {
-								stack = append(stack, [2]int{nx, ny})
-							} else if neighborStone == black || neighborStone == white {
-								adjacentStones[neighborStone] = true
-							}
-						}
-					}
-				}
-
-				// Determine owner
-				if len(adjacentStones) == 1 {
-					var owner string
-					for k := range adjacentStones {
-						owner = k
-					}
-					// Assign territory
-					for _, pos := range region {
-						g.territoryMap[pos[1]][pos[0]] = owner
-					}
-				} else {
-					// Neutral territory, leave as "?"
-					for _, pos := range region {
-						g.territoryMap[pos[1]][pos[0]] = "?"
-					}
+	// Escape moves: extend at the liberty, or capture a neighboring attacker group in atari
+	candidates := append([][2]int{}, liberties...)
+	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+	for _, stone := range stones {
+		for _, d := range dirs {
+			nx, ny := stone[0]+d[0], stone[1]+d[1]
+			if nx >= 0 && nx < sizeX && ny >= 0 && ny < sizeY && board[ny][nx] == goban.SwitchPlayer(defender) {
+				if _, attackerLiberties := goban.GroupLiberties(board, nx, ny, sizeX, sizeY); len(attackerLiberties) == 1 {
+					candidates = append(candidates, attackerLiberties[0])
 				}
 			}
 		}
 	}
-}
 
-func (g *Game) calculateScore() (int, int) {
-	blackScore := 0
-	whiteScore := 0
-	for y := 0; y < g.sizeY; y++ {
-		for x := 0; x < g.sizeX; x++ {
-			owner := g.territoryMap[y][x]
-			if owner == black {
-				blackScore += 1.0
-			} else if owner == white {
-				whiteScore += 1.0
+	var capturedLine []Move
+	for _, move := range candidates {
+		next := goban.CopyBoard(board)
+		if !goban.PlaceStone(next, move[0], move[1], defender, sizeX, sizeY) {
+			continue
+		}
+		_, newLiberties := goban.GroupLiberties(next, x, y, sizeX, sizeY)
+		line := []Move{{x: move[0], y: move[1], player: defender}}
+		switch {
+		case len(newLiberties) >= 3:
+			return false, line
+		case len(newLiberties) == 2:
+			captured, rest := ladderAttack(next, x, y, sizeX, sizeY, depth+1)
+			if !captured {
+				return false, append(line, rest...)
+			}
+			if capturedLine == nil {
+				capturedLine = append(line, rest...)
 			}
 		}
 	}
-
-	// Add komi to white's score
-	whiteScore += g.komi
-
-	return blackScore, whiteScore
-}
-
-func (g *Game) calculateAndDisplayScore() {
-	blackScore, whiteScore := g.calculateScore()
-	g.scoringStatus.SetText(fmt.Sprintf("Black: %d, White: %d", blackScore, whiteScore))
+	return true, capturedLine
 }
 
-func (g *Game) toggleGroupStatus(x, y int) {
-	originalOwner := g.currentNode.boardState[y][x]
-	if originalOwner != black && originalOwner != white {
-		return
-	}
-
-	newOwner := switchPlayer(g.territoryMap[y][x])
-
-	visited := make(map[[2]int]bool)
-	stack := [][2]int{{x, y}}
-
-	for len(stack) > 0 {
-		cx, cy := stack[len(stack)-1][0], stack[len(stack)-1][1]
-		stack = stack[:len(stack)-1]
-		if visited[[2]int{cx, cy}] {
+// Reads whether the attacker, to move, captures the defender group at (x, y), which has two liberties, in a ladder.
+// Returns the result and the moves of the main line read.
+func ladderAttack(board [][]string, x, y int, sizeX, sizeY int, depth int) (bool, []Move) {
+	attacker := goban.SwitchPlayer(board[y][x])
+	_, liberties := goban.GroupLiberties(board, x, y, sizeX, sizeY)
+	var escapeLine []Move
+	for _, move := range liberties {
+		next := goban.CopyBoard(board)
+		if !goban.PlaceStone(next, move[0], move[1], attacker, sizeX, sizeY) {
 			continue
 		}
-		visited[[2]int{cx, cy}] = true
-
-		stone := g.currentNode.boardState[cy][cx]
-
-		if stone == originalOwner {
-			// Toggle the ownership
-			g.territoryMap[cy][cx] = newOwner
+		line := []Move{{x: move[0], y: move[1], player: attacker}}
+		captured, rest := ladderDefend(next, x, y, sizeX, sizeY, depth+1)
+		if captured {
+			return true, append(line, rest...)
 		}
-
-		// Add neighbors to stack
-		dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
-		for _, d := range dirs {
-			nx, ny := cx+d[0], cy+d[1]
-			if nx >= 0 && nx < g.sizeX && ny >= 0 && ny < g.sizeY {
-				neighborStone := g.currentNode.boardState[ny][nx]
-				if !visited[[2]int{nx, ny}] && (neighborStone == originalOwner || neighborStone == empty) {
-					stack = append(stack, [2]int{nx, ny})
-				}
-			}
+		if escapeLine == nil {
+			escapeLine = append(line, rest...)
 		}
 	}
+	return false, escapeLine
+}
 
-	// Reset all empty spaces to "?" (no owner)
-	for y := 0; y < g.sizeY; y++ {
-		for x := 0; x < g.sizeX; x++ {
-			if g.currentNode.boardState[y][x] == empty {
-				g.territoryMap[y][x] = "?"
-			}
-		}
+// Reads the ladder of the group at (x, y) and reports the result in the status line
+func (g *Game) readLadder(x, y int) {
+	board := g.currentNode.boardState
+	if board[y][x] == empty {
+		return
 	}
-
-	// Recalculate the territory
-	g.assignTerritoryToEmptyRegions()
+	_, liberties := goban.GroupLiberties(board, x, y, g.sizeX, g.sizeY)
+	var captured bool
+	var path []Move
+	switch len(liberties) {
+	case 1:
+		captured, path = ladderDefend(goban.CopyBoard(board), x, y, g.sizeX, g.sizeY, 0)
+	case 2:
+		captured, path = ladderAttack(goban.CopyBoard(board), x, y, g.sizeX, g.sizeY, 0)
+	default:
+		g.scoringStatus.SetText(fmt.Sprintf("The group has %d liberties; ladders need one or two.", len(liberties)))
+		g.ladderPath = nil
+		g.redrawBoard()
+		return
+	}
+	if captured {
+		g.scoringStatus.SetText(fmt.Sprintf("Ladder works: the group is captured after %d moves.", len(path)))
+	} else {
+		g.scoringStatus.SetText(fmt.Sprintf("Ladder fails: the group escapes after %d moves.", len(path)))
+	}
+	g.ladderPath = path
+	g.ladderNode = g.currentNode
+	g.redrawBoard()
 }
 
-func (g *Game) updateGameTreeUI() {
-	scrollPosition := g.gameTreeContainer.Offset
-	newGameTreeUI := g.buildGameTreeUI(g.rootNode)
-	g.gameTreeContainer.Content = newGameTreeUI
-	g.gameTreeContainer.Refresh()
-	g.gameTreeContainer.Offset = scrollPosition
-}
+// Draws the moves of the last ladder read as numbered translucent stones
+func (g *Game) drawLadderPath() {
+	for i, move := range g.ladderPath {
+		circle := canvas.NewCircle(transparentBlackColor)
+		textColor := whiteColor
+		if move.player == white {
+			circle.FillColor = transparentWhiteColor
+			textColor = blackColor
+		}
+		circle.StrokeWidth = 0
+		pos := g.boardCoordsToPixel(move.x, move.y)
+		circle.Resize(fyne.NewSize(g.cellSize, g.cellSize))
+		circle.Move(pos)
+		g.gridContainer.Add(circle)
 
-func (g *Game) buildGameTreeUI(node *GameTreeNode) fyne.CanvasObject {
-	var nodeLabel string
-	if node.parent == nil {
-		nodeLabel = "Root"
-	} else if node.hasAddedBlackStones() || node.hasAddedWhiteStones() {
-		nodeLabel = fmt.Sprintf("%s:Setup", node.player)
-	} else if node.move[0] == -1 && node.move[1] == -1 {
-		nodeLabel = fmt.Sprintf("%s:Pass", node.player)
-	} else {
-		nodeLabel = fmt.Sprintf("%s:(%d,%d)", node.player, node.move[0], node.move[1])
+		text := canvas.NewText(strconv.Itoa(i+1), textColor)
+		text.TextSize = g.cellSize * 0.35
+		text.Alignment = fyne.TextAlignCenter
+		text.Resize(text.MinSize())
+		text.Move(fyne.Position{
+			X: pos.X + 0.5*g.cellSize - text.Size().Width/2,
+			Y: pos.Y + 0.5*g.cellSize - text.Size().Height/2,
+		})
+		g.gridContainer.Add(text)
 	}
+}
 
-	nodeButton := widget.NewButton(nodeLabel, func() {
-		nodeChanged := node != g.currentNode
-		g.setMouseMode("play")
-		g.setCurrentNode(node)
-		g.redrawBoard()
-		g.updateGameTreeUI()
-		if nodeChanged && g.gtpCmd != nil {
-			// Update engine board state
-			err := g.updateEngineBoardState()
-			if err != nil {
-				g.showError(err)
-				g.detachEngine()
+// Returns the stones of the given color that are pass-alive (unconditionally alive) by Benson's algorithm
+func passAliveStones(board [][]string, player string, sizeX, sizeY int) map[[2]int]bool {
+	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+
+	// Label the chains of the player and the regions of the other points
+	chainOf := make(map[[2]int]int)
+	regionOf := make(map[[2]int]int)
+	var chains, regions [][][2]int
+	for y := 0; y < sizeY; y++ {
+		for x := 0; x < sizeX; x++ {
+			start := [2]int{x, y}
+			isChain := board[y][x] == player
+			if _, labeled := chainOf[start]; labeled {
+				continue
+			}
+			if _, labeled := regionOf[start]; labeled {
+				continue
+			}
+			labels, id := regionOf, len(regions)
+			if isChain {
+				labels, id = chainOf, len(chains)
+			}
+			points := [][2]int{}
+			stack := [][2]int{start}
+			labels[start] = id
+			for len(stack) > 0 {
+				p := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				points = append(points, p)
+				for _, d := range dirs {
+					n := [2]int{p[0] + d[0], p[1] + d[1]}
+					if n[0] < 0 || n[0] >= sizeX || n[1] < 0 || n[1] >= sizeY || (board[n[1]][n[0]] == player) != isChain {
+						continue
+					}
+					if _, seen := labels[n]; !seen {
+						labels[n] = id
+						stack = append(stack, n)
+					}
+				}
+			}
+			if isChain {
+				chains = append(chains, points)
+			} else {
+				regions = append(regions, points)
 			}
 		}
-	})
-
-	if node == g.currentNode {
-		nodeButton.Importance = widget.HighImportance
 	}
 
-	childUIs := []fyne.CanvasObject{}
-	for _, child := range node.children {
-		childUIs = append(childUIs, g.buildGameTreeUI(child))
+	// For each region, find the bordering chains and the chains it is vital to,
+	// that is the chains having every empty point of the region as a liberty
+	borders := make([]map[int]bool, len(regions))
+	vitalTo := make([][]int, len(regions))
+	for r, points := range regions {
+		borders[r] = make(map[int]bool)
+		libertyOf := make(map[int]int) // Empty points of the region that are liberties of each chain
+		emptyPoints := 0
+		for _, p := range points {
+			isEmpty := board[p[1]][p[0]] == empty
+			if isEmpty {
+				emptyPoints++
+			}
+			touched := make(map[int]bool)
+			for _, d := range dirs {
+				n := [2]int{p[0] + d[0], p[1] + d[1]}
+				if c, ok := chainOf[n]; ok && !touched[c] {
+					touched[c] = true
+					borders[r][c] = true
+					if isEmpty {
+						libertyOf[c]++
+					}
+				}
+			}
+		}
+		for c := range borders[r] {
+			if libertyOf[c] == emptyPoints {
+				vitalTo[r] = append(vitalTo[r], c)
+			}
+		}
 	}
-	childrenContainer := container.NewHBox(childUIs...)
-	return container.NewVBox(nodeButton, childrenContainer)
-}
-
-func (g *Game) showError(err error) {
-	fmt.Printf("Error: %v\n", err)
-	dialog.ShowError(err, g.window)
-}
 
-func makeEmptyBoard(sizeX, sizeY int) [][]string {
-	board := make([][]string, sizeY)
-	for i := range board {
-		board[i] = make([]string, sizeX)
-		for j := range board[i] {
-			board[i][j] = empty
+	aliveChains := make([]bool, len(chains))
+	for c := range aliveChains {
+		aliveChains[c] = true
+	}
+	healthyRegions := make([]bool, len(regions))
+	for r := range healthyRegions {
+		healthyRegions[r] = true
+	}
+	for changed := true; changed; {
+		changed = false
+		// Chains need two vital regions
+		vitalCount := make([]int, len(chains))
+		for r := range regions {
+			if healthyRegions[r] {
+				for _, c := range vitalTo[r] {
+					vitalCount[c]++
+				}
+			}
+		}
+		for c := range chains {
+			if aliveChains[c] && vitalCount[c] < 2 {
+				aliveChains[c] = false
+				changed = true
+			}
+		}
+		// Regions bordering a removed chain are no longer enclosed by living chains
+		for r := range regions {
+			if !healthyRegions[r] {
+				continue
+			}
+			for c := range borders[r] {
+				if !aliveChains[c] {
+					healthyRegions[r] = false
+					changed = true
+					break
+				}
+			}
 		}
 	}
-	return board
-}
-
-func (g *Game) initializeBoard() {
-	g.idCounter = 1
-	rootNode := g.newGameTreeNode()
-	rootNode.player = "" // No player has moved yet
-	g.rootNode = rootNode
-	g.currentNode = rootNode
-	g.nodeMap = make(map[string]*GameTreeNode)
-	g.nodeMap[rootNode.id] = rootNode
-	g.setMouseMode("play")
-	g.updateCommentTextbox()
 
-	// If engine is attached, re-initialize it with the new board size
-	if g.gtpCmd != nil {
-		err := g.initializeEngine()
-		if err != nil {
-			g.showError(err)
-			g.detachEngine()
+	alive := make(map[[2]int]bool)
+	for c, points := range chains {
+		if aliveChains[c] {
+			for _, p := range points {
+				alive[p] = true
+			}
 		}
 	}
+	return alive
 }
 
-func copyBoard(board [][]string) [][]string {
-	boardCopy := make([][]string, len(board))
-	for i := range board {
-		boardCopy[i] = make([]string, len(board[i]))
-		copy(boardCopy[i], board[i])
+// Shows the size, liberties and pass-alive status of the hovered group while Shift is held
+func (g *Game) updateGroupInfoTip(ev *desktop.MouseEvent) {
+	x, y, ok := g.pixelToBoardCoords(ev.Position)
+	if !ok || ev.Modifier&fyne.KeyModifierShift == 0 || g.currentNode.boardState[y][x] == empty {
+		g.hideGroupInfoTip()
+		return
 	}
-	return boardCopy
+	board := g.currentNode.boardState
+	player := board[y][x]
+	stones, liberties := goban.GroupLiberties(board, x, y, g.sizeX, g.sizeY)
+	status := "not pass-alive"
+	if passAliveStones(board, player, g.sizeX, g.sizeY)[[2]int{x, y}] {
+		status = "pass-alive"
+	}
+	label := widget.NewLabel(fmt.Sprintf("%s group\n%d stones, %d liberties\n%s", playerName(player), len(stones), len(liberties), status))
+	background := canvas.NewRectangle(theme.Color(theme.ColorNameOverlayBackground))
+	background.CornerRadius = 4
+	tip := container.NewStack(background, label)
+	tip.Resize(tip.MinSize())
+	tip.Move(ev.AbsolutePosition.Add(fyne.NewPos(16, 16)))
+
+	g.hideGroupInfoTip()
+	g.groupInfoTip = container.NewWithoutLayout(tip)
+	g.window.Canvas().Overlays().Add(g.groupInfoTip)
 }
 
-func (g *Game) setCurrentNode(node *GameTreeNode) {
-	g.stopSelfPlay()
-	g.currentNode = node
-	g.updateCommentTextbox()
-	if g.gtpCmd != nil {
-		// Update engine board state
-		err := g.updateEngineBoardState()
-		if err != nil {
-			g.showError(err)
-			g.detachEngine()
-		} else {
-			// Determine whose turn it is
-			player := switchPlayer(g.currentNode.player)
-			// If engine should play next
-			if g.gtpColor == player {
-				engineMove, err := g.sendGTPCommand(fmt.Sprintf("genmove %s", player))
-				if err != nil {
-					g.showError(err)
-					g.detachEngine()
-				}
-				g.handleEngineMove(engineMove)
-			}
-		}
+// Removes the group info overlay, if shown
+func (g *Game) hideGroupInfoTip() {
+	if g.groupInfoTip == nil {
+		return
 	}
+	g.window.Canvas().Overlays().Remove(g.groupInfoTip)
+	g.groupInfoTip = nil
 }
 
-func (g *Game) drawLastMoveHighlight() {
-	if g.currentNode.parent == nil {
-		return
+// Returns the legal points of the current position, computing them once per position
+func (g *Game) currentLegality() *legalityMap {
+	if legality, ok := g.legalityCache[g.currentNode]; ok {
+		return legality
 	}
-	x := g.currentNode.move[0]
-	y := g.currentNode.move[1]
-	if x >= 0 && x < g.sizeX && y >= 0 && y < g.sizeY {
-		// Draw the highlight
-		circle := canvas.NewCircle(purpleColor)
-		circle.StrokeWidth = 0
-		circle.Resize(fyne.NewSize(g.cellSize*0.319, g.cellSize*0.319))
-		pos := g.boardCoordsToPixel(x, y)
-		circle.Move(fyne.Position{
-			X: pos.X + 0.5*g.cellSize - circle.Size().Width/2,
-			Y: pos.Y + 0.5*g.cellSize - circle.Size().Height/2,
-		})
-		g.gridContainer.Add(circle)
+	legality := &legalityMap{black: make([][]bool, g.sizeY), white: make([][]bool, g.sizeY)}
+	for y := 0; y < g.sizeY; y++ {
+		legality.black[y] = make([]bool, g.sizeX)
+		legality.white[y] = make([]bool, g.sizeX)
+		for x := 0; x < g.sizeX; x++ {
+			legality.black[y][x] = g.isMoveLegal(x, y, black)
+			legality.white[y][x] = g.isMoveLegal(x, y, white)
+		}
 	}
+	g.legalityCache[g.currentNode] = legality
+	return legality
 }
 
-func (g *Game) redrawBoard() {
-	// Clear previous grid lines, stones, and annotations
-	g.gridContainer.Objects = nil
-
-	// Remove existing territory layer if present
-	if g.territoryLayer != nil {
-		g.gridContainer.Remove(g.territoryLayer)
+// Reports whether the player may play at (x, y)
+func (l *legalityMap) isLegal(x, y int, player string) bool {
+	if player == white {
+		return l.white[y][x]
 	}
+	return l.black[y][x]
+}
 
-	// Calculate cell size based on the current board size and window dimensions
-	size := g.boardCanvas.Size()
-	g.cellSize = min(size.Width/float32(g.sizeX), size.Height/float32(g.sizeY))
-
-	// Draw various components of the board
-	g.drawGridLines()
-	g.drawStoneConnections()
-	g.drawStones()
-	g.drawAnnotations()
-	g.drawLastMoveHighlight()
-
-	// Draw territory markers if in scoring mode
-	if g.mouseMode == "score" {
-		g.drawTerritoryMarkers()
+// Returns the color owning the empty point (x, y) as a true eye, or empty if it is not one.
+// All neighbors must be stones of one color, and the opponent may hold at most one diagonal point,
+// or none on the edge.
+func trueEyeOwner(board [][]string, x, y int, sizeX, sizeY int) string {
+	if board[y][x] != empty {
+		return empty
 	}
-
-	// Show and refresh the grid container to render all added objects
-	g.gridContainer.Refresh()
+	owner := empty
+	for _, d := range [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}} {
+		nx, ny := x+d[0], y+d[1]
+		if nx < 0 || nx >= sizeX || ny < 0 || ny >= sizeY {
+			continue
+		}
+		stone := board[ny][nx]
+		if stone == blocked {
+			continue // A missing point bounds the eye as the edge does
+		}
+		if stone == empty || (owner != empty && stone != owner) {
+			return empty
+		}
+		owner = stone
+	}
+	if owner == empty {
+		return empty
+	}
+	opponentDiagonals, offBoard := 0, false
+	for _, d := range [][2]int{{-1, -1}, {1, -1}, {-1, 1}, {1, 1}} {
+		nx, ny := x+d[0], y+d[1]
+		if nx < 0 || nx >= sizeX || ny < 0 || ny >= sizeY {
+			offBoard = true
+		} else if board[ny][nx] == goban.SwitchPlayer(owner) {
+			opponentDiagonals++
+		}
+	}
+	if opponentDiagonals > 1 || (offBoard && opponentDiagonals > 0) {
+		return empty
+	}
+	return owner
 }
 
-// Draws the grid lines on the board
-func (g *Game) drawGridLines() {
-	// Draw vertical lines
-	for x := 0; x < g.sizeX; x++ {
-		line := canvas.NewLine(lineColor)
-		startPos := g.boardCoordsToPixel(x, 0)
-		endPos := g.boardCoordsToPixel(x, g.sizeY-1)
-		line.Position1 = fyne.NewPos(startPos.X+0.5*g.cellSize, startPos.Y+(0.5-gridLineThickness/2)*g.cellSize)
-		line.Position2 = fyne.NewPos(endPos.X+0.5*g.cellSize, endPos.Y+(0.5+gridLineThickness/2)*g.cellSize)
-		line.StrokeWidth = g.cellSize * gridLineThickness
-		g.gridContainer.Add(line)
-	}
+// Open areas shown by the tenuki finder: points at least openAreaDistance from every stone,
+// in regions of at least minOpenAreaSize points, the largest maxOpenAreas of them
+const (
+	openAreaDistance = 2
+	minOpenAreaSize  = 4
+	maxOpenAreas     = 3
+)
 
-	// Draw horizontal lines
-	for y := 0; y < g.sizeY; y++ {
-		line := canvas.NewLine(lineColor)
-		startPos := g.boardCoordsToPixel(0, y)
-		endPos := g.boardCoordsToPixel(g.sizeX-1, y)
-		line.Position1 = fyne.NewPos(startPos.X+(0.5-gridLineThickness/2)*g.cellSize, startPos.Y+0.5*g.cellSize)
-		line.Position2 = fyne.NewPos(endPos.X+(0.5+gridLineThickness/2)*g.cellSize, endPos.Y+0.5*g.cellSize)
-		line.StrokeWidth = g.cellSize * gridLineThickness
-		g.gridContainer.Add(line)
-	}
+// An open area of the board and the color whose nearest stones surround it, "" if neither
+type openArea struct {
+	points [][2]int
+	owner  string
 }
 
-// Draws connections between stones to represent groups
-func (g *Game) drawStoneConnections() {
-	// Draw 4-square stone connections to represent groups
-	for y := 1; y < g.sizeY; y++ {
-		for x := 1; x < g.sizeX; x++ {
-			stone1 := g.currentNode.boardState[y][x-1]
-			stone2 := g.currentNode.boardState[y][x]
-			stone3 := g.currentNode.boardState[y-1][x-1]
-			stone4 := g.currentNode.boardState[y-1][x]
-			if stone1 != empty && stone2 != empty && stone3 != empty && stone4 != empty {
-				// Rule out cross cuts to prevent incorrect group representation
-				if stone3 == stone2 && stone1 == stone4 && stone1 != stone2 {
-					continue
-				}
-				rect := canvas.NewRectangle(blackColor)
-				if (stone1 == white && stone1 == stone4) || (stone2 == white && stone2 == stone3) {
-					rect.FillColor = whiteColor
-				}
-				rect.StrokeWidth = 0
-				pos := g.boardCoordsToPixel(x, y)
-				pos = fyne.Position{X: pos.X - 0.5*g.cellSize, Y: pos.Y - 0.5*g.cellSize}
-				rect.Resize(fyne.NewSize(g.cellSize, g.cellSize))
-				rect.Move(pos)
-				g.gridContainer.Add(rect)
+// Finds the largest open areas of the board, largest first: connected empty regions far from all stones,
+// which are the big points left for a move elsewhere, or the frameworks one color is building
+func openAreas(board [][]string, sizeX, sizeY int) []openArea {
+	distance := make([][]int, sizeY)
+	var queue [][2]int
+	for y := 0; y < sizeY; y++ {
+		distance[y] = make([]int, sizeX)
+		for x := 0; x < sizeX; x++ {
+			distance[y][x] = -1
+			if isStone(board[y][x]) {
+				distance[y][x] = 0
+				queue = append(queue, [2]int{x, y})
 			}
 		}
 	}
-
-	// Draw vertical stone connections
-	for y := 1; y < g.sizeY; y++ {
-		for x := 0; x < g.sizeX; x++ {
-			stone1 := g.currentNode.boardState[y-1][x]
-			stone2 := g.currentNode.boardState[y][x]
-			if stone1 != empty && stone1 == stone2 {
-				rect := canvas.NewRectangle(blackColor)
-				if stone1 == white {
-					rect.FillColor = whiteColor
-				}
-				rect.StrokeWidth = 0
-				pos := g.boardCoordsToPixel(x, y)
-				pos = fyne.Position{X: pos.X, Y: pos.Y - 0.5*g.cellSize}
-				rect.Resize(fyne.NewSize(g.cellSize, g.cellSize))
-				rect.Move(pos)
-				g.gridContainer.Add(rect)
+	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+	for len(queue) > 0 {
+		point := queue[0]
+		queue = queue[1:]
+		for _, d := range dirs {
+			nx, ny := point[0]+d[0], point[1]+d[1]
+			if nx >= 0 && nx < sizeX && ny >= 0 && ny < sizeY && distance[ny][nx] == -1 {
+				distance[ny][nx] = distance[point[1]][point[0]] + 1
+				queue = append(queue, [2]int{nx, ny})
 			}
 		}
 	}
+	open := func(x, y int) bool {
+		return board[y][x] == empty && (distance[y][x] == -1 || distance[y][x] >= openAreaDistance)
+	}
 
-	// Draw horizontal stone connections
-	for y := 0; y < g.sizeY; y++ {
-		for x := 1; x < g.sizeX; x++ {
-			stone1 := g.currentNode.boardState[y][x-1]
-			stone2 := g.currentNode.boardState[y][x]
-			if stone1 != empty && stone1 == stone2 {
-				rect := canvas.NewRectangle(blackColor)
-				if stone1 == white {
-					rect.FillColor = whiteColor
+	owners := nearestOwners(board, sizeX, sizeY)
+	visited := make(map[[2]int]bool)
+	var areas []openArea
+	for y := 0; y < sizeY; y++ {
+		for x := 0; x < sizeX; x++ {
+			if !open(x, y) || visited[[2]int{x, y}] {
+				continue
+			}
+			area := openArea{}
+			counts := map[string]int{}
+			stack := [][2]int{{x, y}}
+			visited[[2]int{x, y}] = true
+			for len(stack) > 0 {
+				point := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				area.points = append(area.points, point)
+				counts[owners[point[1]][point[0]]]++
+				for _, d := range dirs {
+					nx, ny := point[0]+d[0], point[1]+d[1]
+					if nx >= 0 && nx < sizeX && ny >= 0 && ny < sizeY && open(nx, ny) && !visited[[2]int{nx, ny}] {
+						visited[[2]int{nx, ny}] = true
+						stack = append(stack, [2]int{nx, ny})
+					}
 				}
-				rect.StrokeWidth = 0
-				pos := g.boardCoordsToPixel(x, y)
-				pos = fyne.Position{X: pos.X - 0.5*g.cellSize, Y: pos.Y}
-				rect.Resize(fyne.NewSize(g.cellSize, g.cellSize))
-				rect.Move(pos)
-				g.gridContainer.Add(rect)
 			}
-		}
-	}
-}
-
-// Draws the stones on the board based on the current board state
-func (g *Game) drawStones() {
-	for y := 0; y < g.sizeY; y++ {
-		for x := 0; x < g.sizeX; x++ {
-			stone := g.currentNode.boardState[y][x]
-			if stone != empty {
-				circle := canvas.NewCircle(blackColor)
-				if stone == white {
-					circle.FillColor = whiteColor
+			if len(area.points) < minOpenAreaSize {
+				continue
+			}
+			// A framework is an area whose points are mostly nearer to one color's stones
+			for _, color := range []string{black, white} {
+				if counts[color]*3 > len(area.points)*2 {
+					area.owner = color
 				}
-				circle.StrokeWidth = 0
-				pos := g.boardCoordsToPixel(x, y)
-				circle.Resize(fyne.NewSize(g.cellSize, g.cellSize))
-				circle.Move(pos)
-				g.gridContainer.Add(circle)
 			}
+			areas = append(areas, area)
 		}
 	}
-}
-
-// Draws annotations such as circles, squares, triangles, marks, and labels
-func (g *Game) drawAnnotations() {
-	annotationsLayer := container.NewWithoutLayout()
-
-	// Draw Circles (CR)
-	for y := 0; y < g.sizeY; y++ {
-		for x := 0; x < g.sizeX; x++ {
-			if g.currentNode.CR[y][x] {
-				pos := g.boardCoordsToPixel(x, y)
-				circle := canvas.NewCircle(color.Transparent)
-				circle.StrokeColor = redColor
-				circle.StrokeWidth = g.cellSize * 0.05
-				circle.Resize(fyne.NewSize(g.cellSize*0.6, g.cellSize*0.6))
-				circle.Move(fyne.Position{
-					X: pos.X + 0.5*g.cellSize - circle.Size().Width/2,
-					Y: pos.Y + 0.5*g.cellSize - circle.Size().Height/2,
-				})
-				annotationsLayer.Add(circle)
+	sort.SliceStable(areas, func(i, j int) bool {
+		return len(areas[i].points) > len(areas[j].points)
+	})
+	return areas[:min(len(areas), maxOpenAreas)]
+}
+
+// Shades the largest open areas of the current position and labels each with its size: green where neither
+// color has a claim, and in the owner's color for the frameworks
+func (g *Game) drawOpenAreas() {
+	for _, area := range openAreas(g.currentNode.boardState, g.sizeX, g.sizeY) {
+		shade := color.NRGBA{0, 160, 0, 60}
+		switch area.owner {
+		case black:
+			shade = color.NRGBA{0, 0, 0, 60}
+		case white:
+			shade = color.NRGBA{255, 255, 255, 70}
+		}
+		var sumX, sumY int
+		for _, point := range area.points {
+			rect := canvas.NewRectangle(shade)
+			rect.Resize(fyne.NewSize(g.cellSize, g.cellSize))
+			rect.Move(g.boardCoordsToPixel(point[0], point[1]))
+			g.gridContainer.Add(rect)
+			sumX += point[0]
+			sumY += point[1]
+		}
+		// Label the point of the area nearest to its center
+		centerX, centerY := float64(sumX)/float64(len(area.points)), float64(sumY)/float64(len(area.points))
+		labelPoint := area.points[0]
+		best := math.Inf(1)
+		for _, point := range area.points {
+			if d := math.Hypot(float64(point[0])-centerX, float64(point[1])-centerY); d < best {
+				best, labelPoint = d, point
 			}
 		}
+		text := canvas.NewText(strconv.Itoa(len(area.points)), purpleColor)
+		text.TextSize = g.cellSize * 0.5
+		text.TextStyle = fyne.TextStyle{Bold: true}
+		text.Resize(text.MinSize())
+		pos := g.boardCoordsToPixel(labelPoint[0], labelPoint[1])
+		text.Move(fyne.Position{
+			X: pos.X + 0.5*g.cellSize - text.Size().Width/2,
+			Y: pos.Y + 0.5*g.cellSize - text.Size().Height/2,
+		})
+		g.gridContainer.Add(text)
 	}
+}
 
-	// Draw Squares (SQ)
+// Marks empty points illegal for Black with a small black square, those illegal for White with a small white square,
+// and true eyes with a ring in the color of their owner
+func (g *Game) drawLegalityAndEyes() {
+	legality := g.currentLegality()
+	board := g.currentNode.boardState
+	markSize := g.cellSize * 0.22
 	for y := 0; y < g.sizeY; y++ {
 		for x := 0; x < g.sizeX; x++ {
-			if g.currentNode.SQ[y][x] {
-				pos := g.boardCoordsToPixel(x, y)
-				square := canvas.NewRectangle(color.Transparent)
-				square.StrokeColor = redColor
-				square.StrokeWidth = g.cellSize * 0.05
-				square.Resize(fyne.NewSize(g.cellSize*0.6, g.cellSize*0.6))
-				square.Move(fyne.Position{
-					X: pos.X + 0.5*g.cellSize - square.Size().Width/2,
-					Y: pos.Y + 0.5*g.cellSize - square.Size().Height/2,
-				})
-				annotationsLayer.Add(square)
+			if board[y][x] != empty {
+				continue
+			}
+			pos := g.boardCoordsToPixel(x, y)
+			if !legality.black[y][x] {
+				square := canvas.NewRectangle(blackColor)
+				square.Resize(fyne.NewSize(markSize, markSize))
+				square.Move(fyne.Position{X: pos.X + 0.5*g.cellSize - markSize, Y: pos.Y + 0.5*g.cellSize - markSize/2})
+				g.gridContainer.Add(square)
+			}
+			if !legality.white[y][x] {
+				square := canvas.NewRectangle(whiteColor)
+				square.Resize(fyne.NewSize(markSize, markSize))
+				square.Move(fyne.Position{X: pos.X + 0.5*g.cellSize, Y: pos.Y + 0.5*g.cellSize - markSize/2})
+				g.gridContainer.Add(square)
+			}
+			if owner := trueEyeOwner(board, x, y, g.sizeX, g.sizeY); owner != empty {
+				ring := canvas.NewCircle(color.Transparent)
+				ring.StrokeColor = blackColor
+				if owner == white {
+					ring.StrokeColor = whiteColor
+				}
+				ring.StrokeWidth = max(1, g.cellSize*0.06)
+				ring.Resize(fyne.NewSize(g.cellSize*0.7, g.cellSize*0.7))
+				ring.Move(fyne.Position{X: pos.X + 0.15*g.cellSize, Y: pos.Y + 0.15*g.cellSize})
+				g.gridContainer.Add(ring)
 			}
 		}
 	}
+}
 
-	// Draw Triangles (TR) using three lines
-	tSize := g.cellSize * 0.39
-	tXOffset := tSize * float32(math.Sin(math.Pi/3))
-	tYOffset := tSize * float32(math.Cos(math.Pi/3))
-	for y := 0; y < g.sizeY; y++ {
-		for x := 0; x < g.sizeX; x++ {
-			if g.currentNode.TR[y][x] {
-				pos := g.boardCoordsToPixel(x, y)
-				pos0 := fyne.NewPos(pos.X+0.5*g.cellSize, pos.Y+0.5*g.cellSize-tSize)
-				pos1 := fyne.NewPos(pos.X+0.5*g.cellSize-tXOffset, pos.Y+0.5*g.cellSize+tYOffset)
-				pos2 := fyne.NewPos(pos.X+0.5*g.cellSize+tXOffset, pos.Y+0.5*g.cellSize+tYOffset)
-
-				// Create triangle lines
-				line1 := canvas.NewLine(redColor)
-				line1.StrokeWidth = g.cellSize * 0.05
-				line1.Position1 = pos0
-				line1.Position2 = pos1
-
-				line2 := canvas.NewLine(redColor)
-				line2.StrokeWidth = g.cellSize * 0.05
-				line2.Position1 = pos1
-				line2.Position2 = pos2
+// A built-in lesson: the main line alternates the moves expected from the student with the replies,
+// and the comments of the nodes give the guidance shown after each step
+type tutorialLesson struct {
+	title string
+	sgf   string
+}
 
-				line3 := canvas.NewLine(redColor)
-				line3.StrokeWidth = g.cellSize * 0.05
-				line3.Position1 = pos2
-				line3.Position2 = pos0
+var tutorialLessons = []tutorialLesson{
+	{"Rules: Liberties", `(;GM[1]FF[4]SZ[9]AW[ee]C[Welcome! Stones are played on the intersections. The empty points next to a stone are its liberties: the white stone has four.
+
+Play Black directly above the white stone.]
+;B[ed]C[Well done. The white stone now has three liberties.]
+;W[cc]C[White played elsewhere. Now take another liberty: play Black directly below the white stone.]
+;B[ef]C[Good. The white stone has only two liberties left.])`},
+	{"Capturing", `(;GM[1]FF[4]SZ[9]AB[de][fe][ed]AW[ee]C[A stone or group without liberties is captured and removed from the board. The white stone has a single liberty left: it is in atari.
+
+Capture it by playing Black directly below it.]
+;B[ef]C[Captured! The white stone is removed and kept as a prisoner.])`},
+	{"Ko", `(;GM[1]FF[4]SZ[9]AB[dd][ce][df]AW[ed][de][fe][ef]C[The white stone between the black stones is in atari.
+
+Capture it by playing Black in the middle of the white stones.]
+;B[ee]C[You captured a stone. White may not take back at once, since that would repeat the position: this is ko. White has to play elsewhere first.]
+;W[gc]C[White played a ko threat elsewhere. End the ko by filling the point where the white stone was.]
+;B[de]C[The ko is resolved and your stones are connected.])`},
+	{"Scoring", `(;GM[1]FF[4]SZ[5]AB[ba][bb][bc][bd][be]AW[da][db][dc][dd][de]C[Under area scoring, each player counts their stones plus the empty points they surround. The points of the middle column belong to nobody and should be filled at the end of the game.
+
+Play Black on the top point of the middle column.]
+;B[ca]C[Good.]
+;W[cb]C[White filled another neutral point. Fill the next one, in the middle of the board.]
+;B[cc]C[Filling neutral points does not change the difference between the scores. Choose MouseMode, then Score, to count the position.])`},
+}
 
-				// Add lines to annotations layer
-				annotationsLayer.Add(line1)
-				annotationsLayer.Add(line2)
-				annotationsLayer.Add(line3)
-			}
-		}
+// Loads a tutorial lesson and shows its introduction
+func (g *Game) startTutorial(lesson tutorialLesson) {
+	if err := g.importFromSGF(lesson.sgf); err != nil {
+		g.showError(err)
+		return
 	}
+	g.sgfPath = ""
+	g.tutorialActive = true
+	g.redrawBoard()
+	g.updateGameTreeUI()
+	g.showTutorialMessage(lesson.title, g.rootNode.Comment)
+}
 
-	// Draw Xs (MA) using two crossing lines
-	for y := 0; y < g.sizeY; y++ {
-		for x := 0; x < g.sizeX; x++ {
-			if g.currentNode.MA[y][x] {
-				pos := g.boardCoordsToPixel(x, y)
-				size := g.cellSize * 0.6
+// Checks a move of the student against the lesson and plays the reply of the lesson
+func (g *Game) tutorialMove(x, y int) {
+	if len(g.currentNode.children) == 0 {
+		return
+	}
+	expected := g.currentNode.children[0]
+	if expected.move != [2]int{x, y} {
+		g.showTutorialMessage("Not Quite", "That is not the move the lesson asks for. Read the instructions again and try another point.")
+		return
+	}
+	g.setCurrentNode(expected)
+	text := expected.Comment
+	if len(expected.children) > 0 {
+		reply := expected.children[0]
+		g.setCurrentNode(reply)
+		text += "\n\n" + reply.Comment
+	}
+	if len(g.currentNode.children) == 0 {
+		text += "\n\nLesson complete!"
+		g.tutorialActive = false
+	}
+	g.redrawBoard()
+	g.updateGameTreeUI()
+	g.showTutorialMessage("Tutorial", text)
+}
 
-				// Define the two crossing lines relative to the position
-				line1 := canvas.NewLine(redColor)
-				line1.StrokeWidth = g.cellSize * 0.05
-				line1.Position1 = fyne.NewPos(pos.X+0.5*g.cellSize-size/2, pos.Y+0.5*g.cellSize-size/2)
-				line1.Position2 = fyne.NewPos(pos.X+0.5*g.cellSize+size/2, pos.Y+0.5*g.cellSize+size/2)
+// Shows a tutorial message in a dialog with wrapped text
+func (g *Game) showTutorialMessage(title, text string) {
+	label := widget.NewLabel(text)
+	label.Wrapping = fyne.TextWrapWord
+	messageDialog := dialog.NewCustom(title, "OK", label, g.window)
+	messageDialog.Resize(fyne.NewSize(420, 260))
+	messageDialog.Show()
+}
 
-				line2 := canvas.NewLine(redColor)
-				line2.StrokeWidth = g.cellSize * 0.05
-				line2.Position1 = fyne.NewPos(pos.X+0.5*g.cellSize+size/2, pos.Y+0.5*g.cellSize-size/2)
-				line2.Position2 = fyne.NewPos(pos.X+0.5*g.cellSize-size/2, pos.Y+0.5*g.cellSize+size/2)
+// How long the atari warning marks stay on the board
+const atariWarningDuration = 2 * time.Second
 
-				// Add lines to annotations layer
-				annotationsLayer.Add(line1)
-				annotationsLayer.Add(line2)
-			}
-		}
+// Flags the player's groups left with one liberty by the move just played, if atari warnings are on.
+// The marks disappear after a moment; the terminal bell rings as the warning sound.
+func (g *Game) warnAtari(player string) {
+	if !g.atariWarnings || g.currentNode.player != player {
+		return // Disabled, or the move was not played
 	}
-
-	// Draw Labels (LB)
+	board := g.currentNode.boardState
+	var stones [][2]int
+	seen := make(map[[2]int]bool)
 	for y := 0; y < g.sizeY; y++ {
 		for x := 0; x < g.sizeX; x++ {
-			if g.currentNode.LB[y][x] != "" {
-				pos := g.boardCoordsToPixel(x, y)
-				text := canvas.NewText(g.currentNode.LB[y][x], redColor)
-				text.TextSize = g.cellSize * 0.4
-				text.Alignment = fyne.TextAlignCenter
-				text.TextStyle = fyne.TextStyle{Bold: true}
-				text.Resize(text.MinSize()) // Calculate the size needed for the text
-
-				// Center the text on the point
-				text.Move(fyne.Position{
-					X: pos.X + 0.5*g.cellSize - text.Size().Width/2,
-					Y: pos.Y + 0.5*g.cellSize - text.Size().Height/2,
-				})
-				annotationsLayer.Add(text)
+			if board[y][x] != player || seen[[2]int{x, y}] {
+				continue
+			}
+			group, liberties := goban.GroupLiberties(board, x, y, g.sizeX, g.sizeY)
+			for _, stone := range group {
+				seen[stone] = true
+			}
+			if len(liberties) == 1 {
+				stones = append(stones, group...)
 			}
 		}
 	}
+	if len(stones) == 0 {
+		return
+	}
+	node := g.currentNode
+	g.atariStones = stones
+	g.atariNode = node
+	g.redrawBoard()
+	fmt.Print("\a")
+	time.AfterFunc(atariWarningDuration, func() {
+		g.runOnUI(func() {
+			if g.atariNode == node {
+				g.atariNode = nil
+				g.atariStones = nil
+				g.redrawBoard()
+			}
+		})
+	})
+}
 
-	// Add annotations layer to gridContainer
-	g.gridContainer.Add(annotationsLayer)
+// Rings the stones flagged by the atari warning in red
+func (g *Game) drawAtariWarning() {
+	for _, stone := range g.atariStones {
+		ring := canvas.NewCircle(color.Transparent)
+		ring.StrokeColor = redColor
+		ring.StrokeWidth = max(2, g.cellSize*0.1)
+		ring.Resize(fyne.NewSize(g.cellSize, g.cellSize))
+		ring.Move(g.boardCoordsToPixel(stone[0], stone[1]))
+		g.gridContainer.Add(ring)
+	}
 }
 
-// Draws territory markers when in scoring mode
-func (g *Game) drawTerritoryMarkers() {
-	// Create a new layer for territory markers
-	g.territoryLayer = container.NewWithoutLayout()
+// Frames the move of the current node in red when an edit of an earlier node left it illegal
+func (g *Game) drawConflictMarker() {
+	x, y := g.currentNode.move[0], g.currentNode.move[1]
+	if x < 0 || y < 0 || x >= g.sizeX || y >= g.sizeY {
+		return
+	}
+	frame := canvas.NewRectangle(color.Transparent)
+	frame.StrokeColor = redColor
+	frame.StrokeWidth = max(2, g.cellSize*0.1)
+	frame.Resize(fyne.NewSize(g.cellSize, g.cellSize))
+	frame.Move(g.boardCoordsToPixel(x, y))
+	g.gridContainer.Add(frame)
+}
 
-	// Iterate over the territory map to place markers
-	for y := 0; y < g.sizeY; y++ {
-		for x := 0; x < g.sizeX; x++ {
-			owner := g.territoryMap[y][x]
-			if owner == black || owner == white {
-				rect := canvas.NewRectangle(transparentBlackColor)
-				rect.StrokeColor = blackScoreColor
-				if owner == white {
-					rect.FillColor = transparentWhiteColor
-					rect.StrokeColor = whiteScoreColor
-				}
-				rect.StrokeWidth = g.cellSize * 0.039
-				squareSize := g.cellSize * 0.51
-				pos := g.boardCoordsToPixel(x, y)
-				pos = fyne.Position{X: pos.X + 0.5*g.cellSize - squareSize/2, Y: pos.Y + 0.5*g.cellSize - squareSize/2}
-				rect.Resize(fyne.NewSize(squareSize, squareSize))
-				rect.Move(pos)
-				g.territoryLayer.Add(rect)
+// Outcomes of a capture race
+const (
+	raceFirstWins  = "first"
+	raceSecondWins = "second"
+	raceSeki       = "seki"
+)
+
+// Evaluates a capture race between two groups without eyes from their outside and shared liberty counts.
+// Each turn a player fills an outside liberty of the opponent, fills a shared liberty, or passes;
+// filling the last liberty of one's own group without capturing is not allowed.
+// Returns the outcome with the first group to move, assuming both sides play their best.
+func evaluateCaptureRace(first, second, shared int) string {
+	type raceState struct {
+		own, other, shared int
+		passed             bool
+	}
+	memo := make(map[raceState]int)
+	// Returns 1 if the player to move wins, 0 for seki and -1 if the player to move loses
+	var solve func(state raceState) int
+	solve = func(state raceState) int {
+		if result, ok := memo[state]; ok {
+			return result
+		}
+		best := -1
+		if state.passed {
+			best = 0 // Passing back ends the race in seki
+		} else {
+			best = max(best, -solve(raceState{state.other, state.own, state.shared, true}))
+		}
+		if state.other+state.shared == 1 {
+			best = 1 // The opponent is in atari
+		} else {
+			if state.other > 0 {
+				best = max(best, -solve(raceState{state.other - 1, state.own, state.shared, false}))
+			}
+			if state.shared > 0 && state.own+state.shared > 1 {
+				best = max(best, -solve(raceState{state.other, state.own, state.shared - 1, false}))
 			}
 		}
+		memo[state] = best
+		return best
 	}
-
-	// Add the territoryLayer to gridContainer
-	g.gridContainer.Add(g.territoryLayer)
+	switch solve(raceState{first, second, shared, false}) {
+	case 1:
+		return raceFirstWins
+	case -1:
+		return raceSecondWins
+	}
+	return raceSeki
 }
 
-type inputLayer struct {
-	widget.BaseWidget
-	game *Game
-}
+// Counts the liberties of two opposing groups and reports the capture race in the status line
+func (g *Game) countCaptureRace(x1, y1, x2, y2 int) {
+	board := g.currentNode.boardState
+	_, liberties1 := goban.GroupLiberties(board, x1, y1, g.sizeX, g.sizeY)
+	_, liberties2 := goban.GroupLiberties(board, x2, y2, g.sizeX, g.sizeY)
+	isLiberty1 := make(map[[2]int]bool)
+	for _, liberty := range liberties1 {
+		isLiberty1[liberty] = true
+	}
+	isLiberty2 := make(map[[2]int]bool)
+	for _, liberty := range liberties2 {
+		isLiberty2[liberty] = true
+	}
+	var outside1, outside2, shared [][2]int
+	for _, liberty := range liberties1 {
+		if isLiberty2[liberty] {
+			shared = append(shared, liberty)
+		} else {
+			outside1 = append(outside1, liberty)
+		}
+	}
+	for _, liberty := range liberties2 {
+		if !isLiberty1[liberty] {
+			outside2 = append(outside2, liberty)
+		}
+	}
+	color1, color2 := board[y1][x1], board[y2][x2]
+	g.semeaiLiberties = [3][][2]int{outside1, outside2, shared}
+	g.semeaiColors = [2]string{color1, color2}
+	g.semeaiNode = g.currentNode
 
-func newInputLayer(game *Game) *inputLayer {
-	i := &inputLayer{game: game}
-	i.ExtendBaseWidget(i)
-	return i
+	describe := func(outcome string, mover string) string {
+		switch outcome {
+		case raceFirstWins:
+			return fmt.Sprintf("%s to move: %s wins", mover, mover)
+		case raceSecondWins:
+			return fmt.Sprintf("%s to move: %s wins", mover, goban.SwitchPlayer(mover))
+		}
+		return fmt.Sprintf("%s to move: seki", mover)
+	}
+	g.scoringStatus.SetText(fmt.Sprintf("%s: %d liberties (%d outside), %s: %d liberties (%d outside), %d shared. Without eyes, %s; %s.",
+		color1, len(liberties1), len(outside1), color2, len(liberties2), len(outside2), len(shared),
+		describe(evaluateCaptureRace(len(outside1), len(outside2), len(shared)), color1),
+		describe(evaluateCaptureRace(len(outside2), len(outside1), len(shared)), color2)))
+	g.redrawBoard()
 }
 
-func (i *inputLayer) CreateRenderer() fyne.WidgetRenderer {
-	return &inputLayerRenderer{
-		layer: i,
+// Marks the liberties counted by the capture race tool: outside liberties in the color of their group, shared ones in purple
+func (g *Game) drawCaptureRaceLiberties() {
+	for i, liberties := range g.semeaiLiberties {
+		var markColor color.Color = purpleColor
+		if i < 2 {
+			markColor = transparentBlackColor
+			if g.semeaiColors[i] == white {
+				markColor = transparentWhiteColor
+			}
+		}
+		for _, liberty := range liberties {
+			square := canvas.NewRectangle(markColor)
+			square.Resize(fyne.NewSize(g.cellSize*0.3, g.cellSize*0.3))
+			pos := g.boardCoordsToPixel(liberty[0], liberty[1])
+			square.Move(fyne.Position{X: pos.X + 0.35*g.cellSize, Y: pos.Y + 0.35*g.cellSize})
+			g.gridContainer.Add(square)
+		}
 	}
 }
 
-func (i *inputLayer) Resize(size fyne.Size) {
-	i.BaseWidget.Resize(size)
-	i.Refresh()
-	// Trigger redraw on resize to update cell dimensions and redraw grid
-	i.game.redrawBoard()
+// How many local moves the endgame calculator reads after the evaluated move
+const endgameSearchDepth = 2
+
+// Gives each point to the color of the nearest stones, so that open boundaries count as the surrounding walls suggest.
+// Points as near to both colors are neutral ("?").
+func nearestOwners(board [][]string, sizeX, sizeY int) [][]string {
+	owner := make([][]string, sizeY)
+	distance := make([][]int, sizeY)
+	var queue [][2]int
+	for y := 0; y < sizeY; y++ {
+		owner[y] = make([]string, sizeX)
+		distance[y] = make([]int, sizeX)
+		for x := 0; x < sizeX; x++ {
+			distance[y][x] = -1
+			if stone := board[y][x]; stone == black || stone == white {
+				owner[y][x] = stone
+				distance[y][x] = 0
+				queue = append(queue, [2]int{x, y})
+			}
+		}
+	}
+	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+	for len(queue) > 0 {
+		point := queue[0]
+		queue = queue[1:]
+		x, y := point[0], point[1]
+		if owner[y][x] == "?" {
+			continue // Neutral points do not spread
+		}
+		for _, d := range dirs {
+			nx, ny := x+d[0], y+d[1]
+			if nx < 0 || nx >= sizeX || ny < 0 || ny >= sizeY || board[ny][nx] != empty {
+				continue
+			}
+			if distance[ny][nx] == -1 {
+				distance[ny][nx] = distance[y][x] + 1
+				owner[ny][nx] = owner[y][x]
+				queue = append(queue, [2]int{nx, ny})
+			} else if distance[ny][nx] == distance[y][x]+1 && owner[ny][nx] != owner[y][x] {
+				owner[ny][nx] = "?"
+			}
+		}
+	}
+	return owner
 }
 
-func (i *inputLayer) Tapped(ev *fyne.PointEvent) {
-	i.game.handleMouseClick(ev)
+// Estimates Black's area score minus White's from the nearest owners of the points
+func areaDifference(board [][]string, sizeX, sizeY int) int {
+	owner := nearestOwners(board, sizeX, sizeY)
+	difference := 0
+	for y := 0; y < sizeY; y++ {
+		for x := 0; x < sizeX; x++ {
+			if owner[y][x] == black {
+				difference++
+			} else if owner[y][x] == white {
+				difference--
+			}
+		}
+	}
+	return difference
 }
 
-func (i *inputLayer) TappedSecondary(ev *fyne.PointEvent) {}
-
-func (i *inputLayer) MouseMoved(ev *desktop.MouseEvent) {
-	i.game.handleMouseMove(ev)
+// Reads the local endgame with the player to move, either side being free to play elsewhere instead.
+// Returns the best area difference for Black that the player to move can reach.
+func localEndgameScore(board [][]string, player string, candidates [][2]int, depth, sizeX, sizeY int) int {
+	best := areaDifference(board, sizeX, sizeY)
+	if depth == 0 {
+		return best
+	}
+	for _, point := range candidates {
+		next := goban.CopyBoard(board)
+		if !goban.PlaceStone(next, point[0], point[1], player, sizeX, sizeY) {
+			continue
+		}
+		score := localEndgameScore(next, goban.SwitchPlayer(player), candidates, depth-1, sizeX, sizeY)
+		if (player == black && score > best) || (player == white && score < best) {
+			best = score
+		}
+	}
+	return best
 }
 
-func (i *inputLayer) MouseIn(ev *desktop.MouseEvent) {}
-
-func (i *inputLayer) MouseOut() {
-	if i.game.hoverStone != nil {
-		i.game.gridContainer.Remove(i.game.hoverStone)
-		i.game.hoverStone = nil
-		i.game.gridContainer.Refresh()
+// Evaluates the endgame play at (x, y) by local search on the boundary points within two lines of it,
+// that is the empty points that are neutral or next to points of both colors. Returns the miai value of the play (half the swing between Black and White playing there first)
+// and whether it is sente for Black and for White, that is whether the follow-up it threatens is worth
+// more than the play itself.
+func evaluateEndgamePoint(board [][]string, x, y, sizeX, sizeY int) (float64, bool, bool) {
+	owner := nearestOwners(board, sizeX, sizeY)
+	isBoundary := func(cx, cy int) bool {
+		if owner[cy][cx] == "?" {
+			return true
+		}
+		for _, d := range [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}} {
+			nx, ny := cx+d[0], cy+d[1]
+			if nx >= 0 && nx < sizeX && ny >= 0 && ny < sizeY && owner[ny][nx] != owner[cy][cx] {
+				return true
+			}
+		}
+		return false
+	}
+	var candidates [][2]int
+	for cy := y - 2; cy <= y+2; cy++ {
+		for cx := x - 2; cx <= x+2; cx++ {
+			if cx >= 0 && cx < sizeX && cy >= 0 && cy < sizeY && board[cy][cx] == empty && (cx != x || cy != y) && isBoundary(cx, cy) {
+				candidates = append(candidates, [2]int{cx, cy})
+			}
+		}
 	}
+	// Scores after the given player plays at (x, y), with the given player to move next
+	after := func(player, next string) (int, bool) {
+		played := goban.CopyBoard(board)
+		if !goban.PlaceStone(played, x, y, player, sizeX, sizeY) {
+			return 0, false
+		}
+		return localEndgameScore(played, next, candidates, endgameSearchDepth, sizeX, sizeY), true
+	}
+	blackFirst, blackLegal := after(black, white)
+	whiteFirst, whiteLegal := after(white, black)
+	if !blackLegal || !whiteLegal {
+		return 0, false, false
+	}
+	value := float64(blackFirst-whiteFirst) / 2
+	blackFollowUp, _ := after(black, black)
+	whiteFollowUp, _ := after(white, white)
+	blackSente := float64(blackFollowUp-blackFirst) > value
+	whiteSente := float64(whiteFirst-whiteFollowUp) > value
+	return value, blackSente, whiteSente
 }
 
-type inputLayerRenderer struct {
-	layer *inputLayer
+// Evaluates the endgame play at the clicked point, or removes its value if it was already shown
+func (g *Game) toggleEndgameValue(x, y int) {
+	if g.endgameNode != g.currentNode {
+		g.endgameValues = make(map[[2]int]string)
+		g.endgameNode = g.currentNode
+	}
+	point := [2]int{x, y}
+	if _, ok := g.endgameValues[point]; ok {
+		delete(g.endgameValues, point)
+		g.redrawBoard()
+		return
+	}
+	if g.currentNode.boardState[y][x] != empty {
+		return
+	}
+	value, blackSente, whiteSente := evaluateEndgamePoint(g.currentNode.boardState, x, y, g.sizeX, g.sizeY)
+	label := strconv.FormatFloat(value, 'f', -1, 64)
+	kind := "gote"
+	switch {
+	case blackSente && whiteSente:
+		label += "ss"
+		kind = "double sente"
+	case blackSente:
+		label += "s"
+		kind = "sente for Black"
+	case whiteSente:
+		label += "s"
+		kind = "sente for White"
+	}
+	g.endgameValues[point] = label
+	g.scoringStatus.SetText(fmt.Sprintf("Endgame play worth %s points, %s", strconv.FormatFloat(value, 'f', -1, 64), kind))
+	g.redrawBoard()
 }
 
-func (r *inputLayerRenderer) Layout(size fyne.Size) {
-	r.layer.Resize(size)
+// Draws the values of the evaluated endgame points
+func (g *Game) drawEndgameValues() {
+	for point, label := range g.endgameValues {
+		text := canvas.NewText(label, purpleColor)
+		text.TextSize = g.cellSize * 0.35
+		text.TextStyle = fyne.TextStyle{Bold: true}
+		text.Resize(text.MinSize())
+		pos := g.boardCoordsToPixel(point[0], point[1])
+		text.Move(fyne.Position{
+			X: pos.X + 0.5*g.cellSize - text.Size().Width/2,
+			Y: pos.Y + 0.5*g.cellSize - text.Size().Height/2,
+		})
+		g.gridContainer.Add(text)
+	}
 }
 
-func (r *inputLayerRenderer) MinSize() fyne.Size {
-	return fyne.NewSize(0, 0)
+// Returns the name of the color of the player ("Black" or "White")
+func playerName(player string) string {
+	if player == white {
+		return "White"
+	}
+	return "Black"
 }
 
-func (r *inputLayerRenderer) Refresh() {}
-
-func (r *inputLayerRenderer) BackgroundColor() color.Color {
-	return color.Transparent
+func (g *Game) importFromSGF(sgfContent string) error {
+	g.stopBroadcast()
+	collection, err := goban.ParseSGF(sgfContent)
+	if err != nil {
+		return err
+	}
+	return g.importCollection(collection)
 }
 
-func (r *inputLayerRenderer) Objects() []fyne.CanvasObject {
-	return nil
+// Shows the first game of a collection read from a game record
+func (g *Game) importCollection(collection []*SGFGameTree) error {
+	g.setMouseMode("play")
+	if len(collection) == 0 {
+		return fmt.Errorf("no valid SGF game trees found")
+	}
+	gameTree := collection[0]
+	g.selectMainLine(gameTree)
+	return g.initializeGameFromSGFTree(gameTree)
 }
 
-func (r *inputLayerRenderer) Destroy() {}
-
-// Converts pixel coordinates to board coordinates.
-// Returns x, y indices and a boolean indicating validity.
-func (g *Game) pixelToBoardCoords(pos fyne.Position) (int, int, bool) {
-	size := g.boardCanvas.Size()
-	x := int(((pos.X*2-size.Width)/g.cellSize + float32(g.sizeX)) / 2)
-	y := int(((pos.Y*2-size.Height)/g.cellSize + float32(g.sizeY)) / 2)
+// A format of game records that can be imported, recognized by the content rather than the file extension
+type recordFormat struct {
+	name       string
+	extensions []string
+	detect     func(content string) bool
+	decode     func(content string) ([]*SGFGameTree, error)
+}
 
-	if x < 0 || x >= g.sizeX || y < 0 || y >= g.sizeY {
-		return 93, 93, false // Coordinates out of bounds
+// Import formats in the order they are tried; the formats with a clear signature come first
+var recordFormats = []recordFormat{
+	{"Go XML (Jago)", []string{".xml"}, func(content string) bool {
+		return strings.HasPrefix(content, "<") && strings.Contains(content, "<Go")
+	}, decodeGoXML},
+	{"Tygem GIB", []string{".gib"}, func(content string) bool {
+		return strings.HasPrefix(content, `\HS`) || strings.HasPrefix(content, `\GS`)
+	}, decodeGIB},
+	{"PANDA-glGo UGF", []string{".ugf", ".ugi"}, func(content string) bool {
+		return strings.HasPrefix(strings.ToUpper(content), "[HEADER]")
+	}, decodeUGF},
+	{"SGF", []string{".sgf"}, sgfContentPattern.MatchString, goban.ParseSGF},
+	{"NGF", []string{".ngf"}, func(content string) bool {
+		lines := strings.Split(content, "\n")
+		if len(lines) < 12 {
+			return false
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(lines[1]))
+		return err == nil && size >= 2 && size <= maxSGFBoardSize &&
+			slices.ContainsFunc(lines[12:], func(line string) bool { return strings.HasPrefix(line, "PM") })
+	}, decodeNGF},
+}
+
+// The start of an SGF game tree, which may follow other text
+var sgfContentPattern = regexp.MustCompile(`\(\s*;`)
+
+// Returns the extensions of the import formats, for the file dialog
+func recordExtensions() []string {
+	var extensions []string
+	for _, format := range recordFormats {
+		extensions = append(extensions, format.extensions...)
 	}
+	return extensions
+}
 
-	return x, y, true
+// Returns the format of a game record by its content
+func detectRecordFormat(content string) (recordFormat, error) {
+	content = strings.TrimSpace(strings.TrimPrefix(content, "\ufeff"))
+	for _, format := range recordFormats {
+		if format.detect(content) {
+			return format, nil
+		}
+	}
+	var supported []string
+	for _, format := range recordFormats {
+		supported = append(supported, fmt.Sprintf("%s (%s)", format.name, strings.Join(format.extensions, ", ")))
+	}
+	return recordFormat{}, fmt.Errorf("the file is not a game record in a supported format.\nSupported formats: %s", strings.Join(supported, "; "))
 }
 
-// Converts board coordinates to pixel positions for rendering.
-func (g *Game) boardCoordsToPixel(x, y int) fyne.Position {
-	size := g.boardCanvas.Size()
-	return fyne.NewPos(
-		(float32(2*x-g.sizeX)*g.cellSize+size.Width)/2,
-		(float32(2*y-g.sizeY)*g.cellSize+size.Height)/2,
-	)
+// Imports a game record in any of the import formats, chosen by its content
+func (g *Game) importGameRecord(content string) error {
+	g.stopBroadcast()
+	format, err := detectRecordFormat(content)
+	if err != nil {
+		return err
+	}
+	collection, err := format.decode(strings.TrimPrefix(content, "\ufeff"))
+	if err != nil {
+		return fmt.Errorf("invalid %s file: %v", format.name, err)
+	}
+	return g.importCollection(collection)
 }
 
-// Handles mouse movement events to display a hover stone when applicable.
-func (g *Game) handleMouseMove(ev *desktop.MouseEvent) {
-	if g.mouseMode != "play" {
-		if g.hoverStone != nil {
-			g.gridContainer.Remove(g.hoverStone)
-			g.hoverStone = nil
-			g.gridContainer.Refresh()
+// Builds a game tree of a single line: a root node with the given properties, then a node for each move
+func lineGameTree(root map[string][]string, moves []goban.Move) *SGFGameTree {
+	tree := &SGFGameTree{Sequence: []*SGFNode{{Properties: root}}}
+	for _, move := range moves {
+		point := ""
+		if !move.IsPass() {
+			point = goban.SGFPoint(move.X, move.Y)
 		}
-		return
+		tree.Sequence = append(tree.Sequence, &SGFNode{Properties: map[string][]string{move.Player: {point}}})
 	}
+	return tree
+}
 
-	x, y, ok := g.pixelToBoardCoords(ev.Position)
-	if !ok {
-		if g.hoverStone != nil {
-			g.gridContainer.Remove(g.hoverStone)
-			g.hoverStone = nil
-			g.gridContainer.Refresh()
-		}
+// Writes the komi of a record as an integer KM value; half points are rounded up, as the board counts whole points
+func setRecordKomi(root map[string][]string, komi string) {
+	if value, err := strconv.ParseFloat(strings.TrimSpace(komi), 64); err == nil {
+		root["KM"] = []string{strconv.Itoa(int(math.Ceil(value)))}
+	}
+}
+
+// Places the handicap stones of a record that gives only their number on the standard points
+func setRecordHandicap(root map[string][]string, size, stones int) {
+	if stones < 2 {
 		return
 	}
+	root["HA"] = []string{strconv.Itoa(stones)}
+	for _, point := range handicapPoints(size, size, stones) {
+		root["AB"] = append(root["AB"], goban.SGFPoint(point[0], point[1]))
+	}
+}
 
-	player := switchPlayer(g.currentNode.player)
+// Splits "Name (5d)" or "Name 5d" into the name and the rank
+var recordPlayerPattern = regexp.MustCompile(`^(.*?)\s*(?:\((\d+[kdpKDP])\)|\s(\d+[kdpKDP]))$`)
 
-	if !g.isMoveLegal(x, y, player) {
-		if g.hoverStone != nil {
-			g.gridContainer.Remove(g.hoverStone)
-			g.hoverStone = nil
-			g.gridContainer.Refresh()
-		}
+// Sets the name and rank properties of a player, e.g. PB and BR, from text such as "Name (5d)"
+func setRecordPlayer(root map[string][]string, nameKey, rankKey, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	if match := recordPlayerPattern.FindStringSubmatch(text); match != nil && match[1] != "" {
+		root[nameKey] = []string{match[1]}
+		root[rankKey] = []string{strings.ToLower(match[2] + match[3])}
 		return
 	}
+	root[nameKey] = []string{text}
+}
 
-	if g.hoverStone != nil {
-		g.gridContainer.Remove(g.hoverStone)
+// Numbers of a date such as "2016- 3-13" or "20160313"
+var recordDatePattern = regexp.MustCompile(`^\D*(\d{4})\D*?(\d{1,2})\D*?(\d{1,2})`)
+
+// Sets DT from a date in any of the forms the record formats use
+func setRecordDate(root map[string][]string, text string) {
+	if match := recordDatePattern.FindStringSubmatch(strings.TrimSpace(text)); match != nil {
+		month, _ := strconv.Atoi(match[2])
+		day, _ := strconv.Atoi(match[3])
+		root["DT"] = []string{fmt.Sprintf("%s-%02d-%02d", match[1], month, day)}
 	}
+}
 
-	circle := canvas.NewCircle(transparentBlackColor)
-	if player == white {
-		circle.FillColor = transparentWhiteColor
+// Decodes a Tygem GIB file: header lines such as \[GAMEBLACKNAME=...\] between \HS and \HE,
+// then the game between \GS and \GE with "STO 0 number color x y" for moves and "SKI 0 number" for passes
+func decodeGIB(content string) ([]*SGFGameTree, error) {
+	const size = 19 // Tygem games are all played on 19x19
+	root := map[string][]string{"SZ": {strconv.Itoa(size)}}
+	var moves []goban.Move
+	player := black
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, `\[`) && strings.HasSuffix(line, `\]`) {
+			key, value, _ := strings.Cut(line[2:len(line)-2], "=")
+			switch key {
+			case "GAMEBLACKNAME":
+				setRecordPlayer(root, "PB", "BR", value)
+			case "GAMEWHITENAME":
+				setRecordPlayer(root, "PW", "WR", value)
+			case "GAMENAME":
+				root["GN"] = []string{value}
+			case "GAMEPLACE":
+				root["PC"] = []string{value}
+			case "GAMEDATE":
+				setRecordDate(root, value)
+			case "GAMEINFOMAIN":
+				decodeGIBInfo(root, value)
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) >= 4 && fields[0] == "INI":
+			handicap, _ := strconv.Atoi(fields[3])
+			setRecordHandicap(root, size, handicap)
+			if handicap >= 2 {
+				player = white
+			}
+		case len(fields) >= 6 && fields[0] == "STO":
+			x, errX := strconv.Atoi(fields[4])
+			y, errY := strconv.Atoi(fields[5])
+			if errX != nil || errY != nil || x < 0 || x >= size || y < 0 || y >= size {
+				return nil, fmt.Errorf("invalid move %q", line)
+			}
+			player = black
+			if fields[3] == "2" {
+				player = white
+			}
+			moves = append(moves, goban.Move{X: x, Y: y, Player: player})
+			player = goban.SwitchPlayer(player)
+		case len(fields) >= 1 && fields[0] == "SKI":
+			moves = append(moves, goban.Pass(player))
+			player = goban.SwitchPlayer(player)
+		}
 	}
-	circle.StrokeWidth = 0
-	circle.Resize(fyne.NewSize(g.cellSize, g.cellSize))
-	circle.Move(g.boardCoordsToPixel(x, y))
-	g.gridContainer.Add(circle)
-	g.hoverStone = circle
-	g.gridContainer.Refresh()
+	return []*SGFGameTree{lineGameTree(root, moves)}, nil
 }
 
-func (g *Game) setMouseMode(mode string) {
-	if g.mouseMode == mode {
-		return
+// Reads the komi and the result from the GAMEINFOMAIN header of a GIB file, e.g. "GONGJE:65,GRLT:0,ZIPSU:35":
+// GONGJE is the komi and ZIPSU the margin in tenths of a point, and GRLT the way the game ended
+func decodeGIBInfo(root map[string][]string, info string) {
+	values := make(map[string]string)
+	for _, field := range strings.Split(info, ",") {
+		if key, value, ok := strings.Cut(field, ":"); ok {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
 	}
-	if g.mouseMode == "score" && mode != "score" {
-		g.exitScoringMode()
+	if komi, err := strconv.Atoi(values["GONGJE"]); err == nil {
+		setRecordKomi(root, strconv.FormatFloat(float64(komi)/10, 'f', -1, 64))
 	}
-	if mode == "score" && g.mouseMode != "score" {
-		g.enterScoringMode()
+	margin, _ := strconv.Atoi(values["ZIPSU"])
+	result := map[string]string{
+		"0": "B+" + strconv.FormatFloat(float64(margin)/10, 'f', -1, 64),
+		"1": "W+" + strconv.FormatFloat(float64(margin)/10, 'f', -1, 64),
+		"3": "B+R", "4": "W+R", "7": "B+T", "8": "W+T",
+	}[values["GRLT"]]
+	if result != "" {
+		root["RE"] = []string{result}
 	}
-	g.mouseMode = mode
 }
 
-// Handles mouse click events to place stones or toggle group status in scoring mode.
-func (g *Game) handleMouseClick(ev *fyne.PointEvent) {
-	if g.selfPlaying {
-		return // Do nothing during self-play
+// Decodes an NGF file: twelve header lines (title, board size, White, Black, site, handicap, unused, komi, date,
+// unused, result and the number of moves), then a "PM" line per move holding the color at the fifth character
+// and the point as two letters from B
+func decodeNGF(content string) ([]*SGFGameTree, error) {
+	lines := strings.Split(strings.ReplaceAll(content, "\r", ""), "\n")
+	if len(lines) < 12 {
+		return nil, fmt.Errorf("the header is incomplete")
+	}
+	size, err := strconv.Atoi(strings.TrimSpace(lines[1]))
+	if err != nil || size < 2 || size > maxSGFBoardSize {
+		return nil, fmt.Errorf("invalid board size %q", lines[1])
+	}
+	root := map[string][]string{"SZ": {strconv.Itoa(size)}}
+	if title := strings.TrimSpace(lines[0]); title != "" {
+		root["GN"] = []string{title}
+	}
+	setRecordPlayer(root, "PW", "WR", lines[2])
+	setRecordPlayer(root, "PB", "BR", lines[3])
+	handicap, _ := strconv.Atoi(strings.TrimSpace(lines[5]))
+	setRecordHandicap(root, size, handicap)
+	setRecordKomi(root, lines[7])
+	setRecordDate(root, lines[8])
+	if result := decodeResultText(lines[10]); result != "" {
+		root["RE"] = []string{result}
+	}
+	var moves []goban.Move
+	for _, line := range lines[12:] {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "PM") || len(line) < 7 {
+			continue
+		}
+		player := black
+		if line[4] == 'W' {
+			player = white
+		}
+		x, y := int(line[5])-'B', int(line[6])-'B'
+		if x < 0 || x >= size || y < 0 || y >= size {
+			moves = append(moves, goban.Pass(player))
+		} else {
+			moves = append(moves, goban.Move{X: x, Y: y, Player: player})
+		}
 	}
-	x, y, ok := g.pixelToBoardCoords(ev.Position)
-	if !ok {
-		return // Click outside the board
+	return []*SGFGameTree{lineGameTree(root, moves)}, nil
+}
+
+// A result written out, as in "White wins by 3.5 points!" or "Black wins by resign"
+var resultTextPattern = regexp.MustCompile(`(?i)(black|white)\s+win\w*(?:\s+by\s+(resign|time|[\d.]+))?`)
+
+// Turns a result written out into an RE value such as "W+3.5" or "B+R", "" if it is not recognized
+func decodeResultText(text string) string {
+	match := resultTextPattern.FindStringSubmatch(text)
+	if match == nil {
+		return ""
+	}
+	winner := strings.ToUpper(match[1][:1])
+	switch strings.ToLower(match[2]) {
+	case "resign":
+		return winner + "+R"
+	case "time":
+		return winner + "+T"
+	default:
+		return winner + "+" + match[2]
 	}
+}
 
-	switch g.mouseMode {
-	case "play":
-		if g.currentNode.boardState[y][x] != empty {
-			return
+// Decodes a UGF file of PANDA-glGo: the game info in the [Header] section, e.g. "PlayerB=Name,5d" and
+// "Hdcp=0,6.5", and the moves in [Data] as "QD,B1,0,10": the point as column and row letters, the row from
+// the bottom, then the color and the move number, 0 for handicap stones
+func decodeUGF(content string) ([]*SGFGameTree, error) {
+	header := make(map[string]string)
+	var data []string
+	section := ""
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(line)
+			continue
 		}
-		player := switchPlayer(g.currentNode.player)
-		g.playMove(x, y, player, true)
-		// If engine should play next
-		if g.gtpCmd != nil && g.gtpColor == switchPlayer(player) {
-			engineMove, err := g.sendGTPCommand(fmt.Sprintf("genmove %s", switchPlayer(player)))
-			if err != nil {
-				g.showError(err)
-				g.detachEngine()
-				return
+		switch section {
+		case "[header]":
+			if key, value, ok := strings.Cut(line, "="); ok {
+				header[strings.ToLower(key)] = value
+			}
+		case "[data]":
+			if line != "" {
+				data = append(data, line)
 			}
-			g.handleEngineMove(engineMove)
 		}
-	case "score":
-		g.toggleGroupStatus(x, y)
-		g.assignTerritoryToEmptyRegions()
-		g.redrawBoard()
-		g.calculateAndDisplayScore()
-	case "label":
-		// Open a textbox popup to set or remove the label of the vertex
-		entry := widget.NewEntry()
-		if existingLabel := g.currentNode.LB[y][x]; existingLabel != "" {
-			entry.SetText(existingLabel)
+	}
+	size := 19
+	if header["size"] != "" {
+		var err error
+		if size, err = strconv.Atoi(header["size"]); err != nil || size < 2 || size > maxSGFBoardSize {
+			return nil, fmt.Errorf("invalid board size %q", header["size"])
 		}
-		entry.SetPlaceHolder("Enter label (leave empty to remove)")
-		entryDialog := dialog.NewForm("Set Label", "OK", "Cancel",
-			[]*widget.FormItem{widget.NewFormItem("Label", entry)},
-			func(ok bool) {
-				if ok {
-					label := entry.Text
-					g.currentNode.LB[y][x] = label
-					g.redrawBoard()
-				}
-			}, g.window)
-		entryDialog.Show()
-	case "addBlack":
-		if g.currentNode.boardState[y][x] != black {
-			g.currentNode.boardState[y][x] = black
-			g.currentNode.addedBlackStones[y][x] = true
-			g.currentNode.addedWhiteStones[y][x] = false
-			g.currentNode.AE[y][x] = false
-			g.redrawBoard()
+	}
+	root := map[string][]string{"SZ": {strconv.Itoa(size)}}
+	for key, property := range map[string]string{"title": "GN", "place": "PC"} {
+		if header[key] != "" {
+			root[property] = []string{header[key]}
 		}
-	case "addWhite":
-		if g.currentNode.boardState[y][x] != white {
-			g.currentNode.boardState[y][x] = white
-			g.currentNode.addedWhiteStones[y][x] = true
-			g.currentNode.addedBlackStones[y][x] = false
-			g.currentNode.AE[y][x] = false
-			g.redrawBoard()
+	}
+	for key, properties := range map[string][2]string{"playerb": {"PB", "BR"}, "playerw": {"PW", "WR"}} {
+		fields := strings.Split(header[key], ",")
+		if fields[0] != "" {
+			root[properties[0]] = []string{fields[0]}
 		}
-	case "addEmpty":
-		if g.currentNode.boardState[y][x] != empty {
-			g.currentNode.boardState[y][x] = empty
-			g.currentNode.AE[y][x] = true
-			g.currentNode.addedBlackStones[y][x] = false
-			g.currentNode.addedWhiteStones[y][x] = false
-			g.redrawBoard()
+		if len(fields) > 1 && fields[1] != "" {
+			root[properties[1]] = []string{strings.ToLower(fields[1])}
 		}
-	case "circle":
-		// Toggle CR[y][x]
-		g.currentNode.CR[y][x] = !g.currentNode.CR[y][x]
-		g.redrawBoard()
-	case "square":
-		// Toggle SQ[y][x]
-		g.currentNode.SQ[y][x] = !g.currentNode.SQ[y][x]
-		g.redrawBoard()
-	case "triangle":
-		// Toggle TR[y][x]
-		g.currentNode.TR[y][x] = !g.currentNode.TR[y][x]
-		g.redrawBoard()
-	case "xMark":
-		// Toggle MA[y][x]
-		g.currentNode.MA[y][x] = !g.currentNode.MA[y][x]
-		g.redrawBoard()
-	default:
-		// Do nothing or handle other modes
 	}
-}
-
-func (g *Game) isMoveLegal(x, y int, player string) bool {
-	if (x == g.currentNode.koX && y == g.currentNode.koY) || g.currentNode.boardState[y][x] != empty {
-		return false
+	if handicap, komi, ok := strings.Cut(header["hdcp"], ","); ok {
+		if stones, _ := strconv.Atoi(handicap); stones >= 2 {
+			root["HA"] = []string{handicap}
+		}
+		setRecordKomi(root, komi)
 	}
+	if winner, margin, ok := strings.Cut(header["winner"], ","); ok && (winner == "B" || winner == "W") {
+		switch margin {
+		case "C":
+			margin = "R"
+		case "T":
+		default:
+			if _, err := strconv.ParseFloat(margin, 64); err != nil {
+				margin = ""
+			}
+		}
+		root["RE"] = []string{winner + "+" + margin}
+	}
+	date, _, _ := strings.Cut(header["date"], ",")
+	setRecordDate(root, date)
 
-	// Copy board
-	boardCopy := copyBoard(g.currentNode.boardState)
-	boardCopy[y][x] = player
+	var moves []goban.Move
+	for _, line := range data {
+		fields := strings.Split(line, ",")
+		if len(fields) < 3 || len(fields[0]) < 2 || fields[1] == "" {
+			return nil, fmt.Errorf("invalid move %q", line)
+		}
+		player := black
+		if fields[1][0] == 'W' {
+			player = white
+		}
+		number, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid move %q", line)
+		}
+		x, y := int(fields[0][0])-'A', size-1-(int(fields[0][1])-'A')
+		switch {
+		case x < 0 || x >= size || y < 0 || y >= size:
+			moves = append(moves, goban.Pass(player))
+		case number == 0:
+			setup := "A" + player
+			root[setup] = append(root[setup], goban.SGFPoint(x, y))
+		default:
+			moves = append(moves, goban.Move{X: x, Y: y, Player: player})
+		}
+	}
+	return []*SGFGameTree{lineGameTree(root, moves)}, nil
+}
 
-	// Check if any opponent stones will be captured
-	opponent := switchPlayer(player)
-	captured := g.getCapturedStones(boardCopy, x, y, opponent)
+// An element of a Go XML file with its attributes and children in document order
+type goXMLElement struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr     `xml:",any,attr"`
+	Children []goXMLElement `xml:",any"`
+	Text     string         `xml:",chardata"`
+}
 
-	// If capturing any stones, move is legal
-	if len(captured) > 0 {
-		return true
+// Returns the value of an attribute, "" if it is missing
+func (e *goXMLElement) attr(name string) string {
+	for _, attr := range e.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
 	}
+	return ""
+}
 
-	// Check if the new stone has liberties
-	if hasLiberty(boardCopy, x, y, player, g.sizeX, g.sizeY) {
-		return true
+// Returns the first child of the given name, nil if there is none
+func (e *goXMLElement) child(name string) *goXMLElement {
+	for i := range e.Children {
+		if e.Children[i].XMLName.Local == name {
+			return &e.Children[i]
+		}
 	}
-
-	// Move is suicide
-	return false
+	return nil
 }
 
-// Determines if the stone at (x, y) has any liberties.
-// Utilizes depth-first search to check for empty adjacent positions.
-func hasLiberty(board [][]string, x, y int, player string, sizeX, sizeY int) bool {
-	visited := make(map[[2]int]bool) // Tracks visited positions to prevent infinite loops
-	return dfs(board, x, y, player, visited, sizeX, sizeY)
+// Game info elements of the Information section of Go XML and their SGF properties
+var goXMLInfoProperties = []struct {
+	element  string
+	property string
+}{
+	{"BlackPlayer", "PB"}, {"BlackRank", "BR"}, {"WhitePlayer", "PW"}, {"WhiteRank", "WR"},
+	{"Date", "DT"}, {"Handicap", "HA"}, {"Result", "RE"}, {"Event", "EV"}, {"Round", "RO"},
+	{"Time", "TM"}, {"Copyright", "CP"}, {"Site", "PC"}, {"User", "US"}, {"Application", "AP"},
 }
 
-// Recursive DFS to check for liberties
-func dfs(board [][]string, x, y int, player string, visited map[[2]int]bool, sizeX, sizeY int) bool {
-	if x < 0 || x >= sizeX || y < 0 || y >= sizeY {
-		return false // Out of bounds
+// Mark types of Go XML and their SGF properties; a mark without a type or label is an X
+var goXMLMarkProperties = map[string]string{"triangle": "TR", "square": "SQ", "circle": "CR", "": "MA"}
+
+// Decodes a Go XML file of Jago: the game info in GoGame/Information, and the nodes in GoGame/Nodes as
+// Node, Black and White elements in order, each Variation holding an alternative to the node before it
+func decodeGoXML(content string) ([]*SGFGameTree, error) {
+	var document goXMLElement
+	if err := xml.Unmarshal([]byte(content), &document); err != nil {
+		return nil, err
+	}
+	games := document.Children
+	if document.XMLName.Local == "GoGame" {
+		games = []goXMLElement{document} // A single game without the Go element around it
+	}
+	var collection []*SGFGameTree
+	for i := range games {
+		if games[i].XMLName.Local != "GoGame" {
+			continue
+		}
+		tree, err := decodeGoXMLGame(&games[i])
+		if err != nil {
+			return nil, err
+		}
+		collection = append(collection, tree)
+	}
+	if len(collection) == 0 {
+		return nil, fmt.Errorf("no GoGame element found")
 	}
+	return collection, nil
+}
+
+// A node of a Go XML game while its variations are collected
+type goXMLNode struct {
+	properties map[string][]string
+	parent     *goXMLNode
+	children   []*goXMLNode
+}
 
-	if visited[[2]int{x, y}] {
-		return false // Already visited
+// Decodes one GoGame element of a Go XML file
+func decodeGoXMLGame(game *goXMLElement) (*SGFGameTree, error) {
+	root := &goXMLNode{properties: map[string][]string{}}
+	size := 19
+	if info := game.child("Information"); info != nil {
+		if boardSize := info.child("BoardSize"); boardSize != nil {
+			var err error
+			if size, err = strconv.Atoi(strings.TrimSpace(boardSize.Text)); err != nil || size < 2 || size > maxSGFBoardSize {
+				return nil, fmt.Errorf("invalid board size %q", boardSize.Text)
+			}
+		}
+		for _, field := range goXMLInfoProperties {
+			if element := info.child(field.element); element != nil && strings.TrimSpace(element.Text) != "" {
+				root.properties[field.property] = []string{strings.TrimSpace(element.Text)}
+			}
+		}
+		if komi := info.child("Komi"); komi != nil {
+			setRecordKomi(root.properties, komi.Text)
+		}
+	}
+	root.properties["SZ"] = []string{strconv.Itoa(size)}
+	if name := game.attr("name"); name != "" {
+		root.properties["GN"] = []string{name}
+	}
+	nodes := game.child("Nodes")
+	if nodes == nil {
+		return nodesToSGFTree(root), nil
 	}
 
-	if board[y][x] == empty {
-		return true // Found a liberty
+	// Each list of elements is read with the node its first element follows; a Variation starts from
+	// the parent of the node before it
+	type pending struct {
+		elements []goXMLElement
+		current  *goXMLNode
+	}
+	stack := []pending{{nodes.Children, root}}
+	first := true
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if len(top.elements) == 0 {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		element := top.elements[0]
+		top.elements = top.elements[1:]
+		switch element.XMLName.Local {
+		case "Variation":
+			if top.current.parent == nil {
+				return nil, fmt.Errorf("a variation precedes the first move")
+			}
+			stack = append(stack, pending{element.Children, top.current.parent})
+		case "Node", "Black", "White":
+			properties, err := decodeGoXMLNode(&element, size)
+			if err != nil {
+				return nil, err
+			}
+			if first && element.XMLName.Local == "Node" && properties["B"] == nil && properties["W"] == nil {
+				// The first node without a move holds the setup of the root
+				maps.Copy(root.properties, properties)
+			} else {
+				node := &goXMLNode{properties: properties, parent: top.current}
+				top.current.children = append(top.current.children, node)
+				top.current = node
+			}
+		}
+		first = false
 	}
+	return nodesToSGFTree(root), nil
+}
 
-	if board[y][x] != player {
-		return false // Encountered opponent's stone
+// Reads the properties of a Node element, or of a Black or White element standing for a node with just the move
+func decodeGoXMLNode(element *goXMLElement, size int) (map[string][]string, error) {
+	properties := make(map[string][]string)
+	children := element.Children
+	if element.XMLName.Local != "Node" {
+		children = []goXMLElement{*element}
+	}
+	for _, child := range children {
+		var point string
+		if at := child.attr("at"); at != "" {
+			x, y, ok := parseGoXMLPoint(at, size)
+			if !ok {
+				return nil, fmt.Errorf("invalid point %q", at)
+			}
+			point = goban.SGFPoint(x, y)
+		}
+		switch child.XMLName.Local {
+		case "Black":
+			properties["B"] = []string{point}
+		case "White":
+			properties["W"] = []string{point}
+		case "AddBlack", "AddWhite", "Delete":
+			property := map[string]string{"AddBlack": "AB", "AddWhite": "AW", "Delete": "AE"}[child.XMLName.Local]
+			if point != "" {
+				properties[property] = append(properties[property], point)
+			}
+		case "Mark":
+			if point == "" {
+				continue
+			}
+			if label := child.attr("label"); label != "" {
+				properties["LB"] = append(properties["LB"], point+":"+label)
+			} else if property, ok := goXMLMarkProperties[child.attr("type")]; ok {
+				properties[property] = append(properties[property], point)
+			}
+		case "Comment":
+			var paragraphs []string
+			for _, paragraph := range child.Children {
+				paragraphs = append(paragraphs, strings.TrimSpace(paragraph.Text))
+			}
+			if text := strings.TrimSpace(child.Text); text != "" {
+				paragraphs = append([]string{text}, paragraphs...)
+			}
+			properties["C"] = []string{strings.Join(paragraphs, "\n")}
+		case "BlackTimeLeft", "WhiteTimeLeft":
+			properties[map[string]string{"BlackTimeLeft": "BL", "WhiteTimeLeft": "WL"}[child.XMLName.Local]] = []string{strings.TrimSpace(child.Text)}
+		}
 	}
+	return properties, nil
+}
 
-	visited[[2]int{x, y}] = true // Mark the current stone as visited
+// Reads a point of Go XML, written as in GTP ("D4", the letters skipping I and the rows counted from the bottom)
+// or as in SGF ("dp")
+func parseGoXMLPoint(point string, size int) (x, y int, ok bool) {
+	if len(point) == 2 && point[0] >= 'a' && point[0] <= 'z' && point[1] >= 'a' && point[1] <= 'z' {
+		x, y = int(point[0]-'a'), int(point[1]-'a')
+		return x, y, x < size && y < size
+	}
+	column := unicode.ToUpper(rune(point[0]))
+	row, err := strconv.Atoi(point[1:])
+	if err != nil || column < 'A' || column > 'Z' || column == 'I' {
+		return 0, 0, false
+	}
+	x = int(column - 'A')
+	if column > 'I' {
+		x--
+	}
+	y = size - row
+	return x, y, x < size && y >= 0 && y < size
+}
 
-	// Explore all four adjacent directions
-	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
-	for _, d := range dirs {
-		if dfs(board, x+d[0], y+d[1], player, visited, sizeX, sizeY) {
-			return true // Found a liberty in adjacent stones
+// Turns a tree of nodes into an SGF game tree: runs of single children become sequences, branches subtrees
+func nodesToSGFTree(root *goXMLNode) *SGFGameTree {
+	type pending struct {
+		node *goXMLNode
+		tree *SGFGameTree // The tree whose sequence starts at node
+	}
+	rootTree := &SGFGameTree{}
+	stack := []pending{{root, rootTree}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node := top.node
+		for {
+			top.tree.Sequence = append(top.tree.Sequence, &SGFNode{Properties: node.properties})
+			if len(node.children) != 1 {
+				break
+			}
+			node = node.children[0]
+		}
+		for _, child := range node.children {
+			subtree := &SGFGameTree{}
+			top.tree.Subtrees = append(top.tree.Subtrees, subtree)
+			stack = append(stack, pending{child, subtree})
 		}
 	}
-	return false // No liberties found in this group
+	return rootTree
 }
 
-func (g *Game) captureStones(board [][]string, x, y int, player string) (int, int) {
-	opponent := switchPlayer(player)
+// Main line policies offered for imported files, by name
+// "file order" keeps the first variation everywhere, as the SGF specification defines
+var mainLinePolicies = []string{"file order", "longest path", "fewest BM/TE annotations"}
 
-	// Check adjacent opponent stones for capture
-	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
-	capturedGroupsSizes := []int{}
-	capturedGroupsCoords := [][2]int{}
-
-	for _, d := range dirs {
-		nx, ny := x+d[0], y+d[1]
-		if nx < 0 || nx >= g.sizeX || ny < 0 || ny >= g.sizeY {
-			continue
+// Asks how the main line of imported files should be chosen
+func (g *Game) showMainLinePolicyDialog() {
+	policySelect := widget.NewSelect(mainLinePolicies, nil)
+	if g.mainLinePolicy != "" {
+		policySelect.SetSelected(g.mainLinePolicy)
+	} else {
+		policySelect.SetSelected(mainLinePolicies[0])
+	}
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Main Line", policySelect),
+	}
+	policyDialog := dialog.NewForm("Main Line After Import", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
 		}
-		if board[ny][nx] == opponent && !hasLiberty(board, nx, ny, opponent, g.sizeX, g.sizeY) {
-			// Get size of captured group
-			groupSize := getGroupSize(board, nx, ny, opponent, g.sizeX, g.sizeY)
-			capturedGroupsSizes = append(capturedGroupsSizes, groupSize)
-			capturedGroupsCoords = append(capturedGroupsCoords, [2]int{nx, ny})
-
-			// Capture group
-			removeGroup(board, nx, ny, opponent, g.sizeX, g.sizeY)
+		g.mainLinePolicy = policySelect.Selected
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
 		}
+	}, g.window)
+	policyDialog.Show()
+}
+
+// What clicking a move that already exists as a child does, by name; holding Alt does the other
+var replayPolicies = []string{"enter the existing move", "add a new variation"}
+
+// Reports whether the current click enters an existing child move rather than adding it again, Alt inverting the policy
+func (g *Game) entersExistingMove() bool {
+	return (g.replayPolicy != replayPolicies[1]) != g.altClick
+}
+
+// Asks what clicking a move that already exists as a child should do
+func (g *Game) showReplayPolicyDialog() {
+	policySelect := widget.NewSelect(replayPolicies, nil)
+	if g.replayPolicy != "" {
+		policySelect.SetSelected(g.replayPolicy)
+	} else {
+		policySelect.SetSelected(replayPolicies[0])
+	}
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Existing Move", policySelect),
+		widget.NewFormItem("", widget.NewLabel("Hold Alt while clicking to do the other.")),
 	}
+	policyDialog := dialog.NewForm("Replaying Existing Moves", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+		g.replayPolicy = policySelect.Selected
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
+		}
+	}, g.window)
+	policyDialog.Show()
+}
 
-	// Check for suicide
-	if !hasLiberty(board, x, y, player, g.sizeX, g.sizeY) {
-		// Remove player's own stone
-		removeGroup(board, x, y, player, g.sizeX, g.sizeY)
+// Returns the value written for passes on export, "tt" only where it lies off the board
+func (g *Game) passValue() string {
+	if g.passEncoding == passEncodings[1] && g.sizeX <= 19 && g.sizeY <= 19 {
+		return "tt"
 	}
+	return ""
+}
+
+// Ways of writing a pass on export: an empty value as in FF[4], or "tt" for old programs on boards up to 19x19
+var passEncodings = []string{"empty value", "tt up to 19x19"}
 
-	// Implement ko logic
-	koX := -1
-	koY := -1
-	if len(capturedGroupsSizes) == 1 { // 1 group was captured, might be ko
-		capturingGroupSize := getGroupSize(board, x, y, player, g.sizeX, g.sizeY)
-		capturedGroupSize := capturedGroupsSizes[0]
-		if capturedGroupSize == 1 && capturingGroupSize == 1 {
-			// Set ko point
-			koX = capturedGroupsCoords[0][0]
-			koY = capturedGroupsCoords[0][1]
+// Shows a dialog choosing how passes are written on export
+func (g *Game) showPassEncodingDialog() {
+	encodingSelect := widget.NewSelect(passEncodings, nil)
+	if g.passEncoding != "" {
+		encodingSelect.SetSelected(g.passEncoding)
+	} else {
+		encodingSelect.SetSelected(passEncodings[0])
+	}
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Passes", encodingSelect),
+	}
+	encodingDialog := dialog.NewForm("Pass Encoding", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+		g.passEncoding = encodingSelect.Selected
+		if err := g.saveConfig(); err != nil {
+			g.showError(fmt.Errorf("failed to save config: %v", err))
 		}
+	}, g.window)
+	encodingDialog.Show()
+}
+
+// Reorders the variations of an imported game tree so the first variation everywhere follows the main line policy
+func (g *Game) selectMainLine(gameTree *SGFGameTree) {
+	switch g.mainLinePolicy {
+	case "longest path":
+		orderVariations(gameTree, func(*SGFNode) int { return 1 }, true)
+	case "fewest BM/TE annotations":
+		orderVariations(gameTree, func(node *SGFNode) int {
+			_, hasBM := node.Properties["BM"]
+			_, hasTE := node.Properties["TE"]
+			if hasBM || hasTE {
+				return 1
+			}
+			return 0
+		}, false)
 	}
-	return koX, koY
 }
 
-func getGroupSize(board [][]string, x, y int, player string, sizeX, sizeY int) int {
-	visited := make(map[[2]int]bool)
-	groupDFS(board, x, y, player, visited, sizeX, sizeY)
-	return len(visited)
+// Sorts the variations of the tree at every level by the total node score along their best path.
+// Ties keep the file order. Returns the score of the best path through the tree. The trees are visited
+// from a list rather than by recursion, so files nested as deep as the parser allows are ordered too.
+func orderVariations(gameTree *SGFGameTree, nodeScore func(*SGFNode) int, preferHigher bool) int {
+	// Every tree comes after its parent, so going through the list backwards scores the variations first
+	trees := []*SGFGameTree{gameTree}
+	for i := 0; i < len(trees); i++ {
+		trees = append(trees, trees[i].Subtrees...)
+	}
+	scores := make(map[*SGFGameTree]int, len(trees))
+	for i := len(trees) - 1; i >= 0; i-- {
+		tree := trees[i]
+		score := 0
+		for _, node := range tree.Sequence {
+			score += nodeScore(node)
+		}
+		if len(tree.Subtrees) > 0 {
+			sort.SliceStable(tree.Subtrees, func(i, j int) bool {
+				if preferHigher {
+					return scores[tree.Subtrees[i]] > scores[tree.Subtrees[j]]
+				}
+				return scores[tree.Subtrees[i]] < scores[tree.Subtrees[j]]
+			})
+			score += scores[tree.Subtrees[0]]
+		}
+		scores[tree] = score
+	}
+	return scores[gameTree]
 }
 
-func groupDFS(board [][]string, x, y int, player string, visited map[[2]int]bool, sizeX, sizeY int) {
-	if x < 0 || x >= sizeX || y < 0 || y >= sizeY {
+// Imports SGF text pasted into the clipboard
+func (g *Game) importFromClipboard() {
+	content := g.window.Clipboard().Content()
+	if strings.TrimSpace(content) == "" {
+		g.showError(fmt.Errorf("clipboard is empty"))
 		return
 	}
+	g.importRecordText(content)
+}
 
-	if visited[[2]int{x, y}] {
+// Imports a game record pasted or downloaded rather than opened from a file. It changes the game and
+// its widgets, so it runs on the UI thread; downloads call it through runOnUI.
+func (g *Game) importRecordText(content string) {
+	if err := g.importGameRecord(content); err != nil {
+		g.showError(err)
 		return
 	}
+	g.sgfPath = ""
+	g.updateAudioControls()
+	g.gameTreeContainer.ScrollToBottom()
+}
 
-	if board[y][x] != player {
-		return
+// Maximum size of an SGF file downloaded with Open from URL
+const maxSGFDownloadSize = 16 << 20
+
+// Asks for a URL and imports the SGF file found there
+func (g *Game) showOpenURLDialog() {
+	urlEntry := widget.NewEntry()
+	urlEntry.SetPlaceHolder("https://example.com/game.sgf")
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("URL", urlEntry),
 	}
+	urlDialog := dialog.NewForm("Open from URL", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+		address := strings.TrimSpace(urlEntry.Text)
+		go func() {
+			sgfContent, err := fetchSGF(address)
+			g.runOnUI(func() {
+				if err != nil {
+					g.showError(err)
+					return
+				}
+				g.importRecordText(sgfContent)
+			})
+		}()
+	}, g.window)
+	urlDialog.Resize(fyne.NewSize(450, 150))
+	urlDialog.Show()
+}
 
-	visited[[2]int{x, y}] = true
+// Downloads an SGF file over HTTP(S)
+func fetchSGF(address string) (string, error) {
+	parsed, err := url.Parse(address)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "", fmt.Errorf("invalid URL: %s", address)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	response, err := client.Get(parsed.String())
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %s: %s", address, response.Status)
+	}
+	content, err := io.ReadAll(io.LimitReader(response.Body, maxSGFDownloadSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(content) > maxSGFDownloadSize {
+		return "", fmt.Errorf("file at %s is larger than %d bytes", address, maxSGFDownloadSize)
+	}
+	return string(content), nil
+}
 
-	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
-	for _, d := range dirs {
-		groupDFS(board, x+d[0], y+d[1], player, visited, sizeX, sizeY)
+// Asks for a file path or URL of a growing SGF file and starts following it
+func (g *Game) showBroadcastDialog() {
+	sourceEntry := widget.NewEntry()
+	sourceEntry.SetPlaceHolder("File path or https:// URL")
+	if g.sgfPath != "" {
+		sourceEntry.SetText(g.sgfPath)
+	}
+	intervalEntry := widget.NewEntry()
+	intervalEntry.SetText("10")
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Source", sourceEntry),
+		widget.NewFormItem("Interval (seconds)", intervalEntry),
 	}
+	broadcastDialog := dialog.NewForm("Follow Live Broadcast", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+		seconds, err := strconv.Atoi(intervalEntry.Text)
+		if err != nil || seconds < 1 {
+			g.showError(fmt.Errorf("invalid interval (must be at least 1 second)"))
+			return
+		}
+		g.startBroadcast(strings.TrimSpace(sourceEntry.Text), time.Duration(seconds)*time.Second)
+	}, g.window)
+	broadcastDialog.Resize(fyne.NewSize(450, 200))
+	broadcastDialog.Show()
 }
 
-func removeGroup(board [][]string, x, y int, player string, sizeX, sizeY int) int {
-	visited := make(map[[2]int]bool)
-	removeDFS(board, x, y, player, visited, sizeX, sizeY)
-	return len(visited)
+// Reads the SGF content of a broadcast source, which is either a URL or a local file
+func readBroadcastSource(source string) (string, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return fetchSGF(source)
+	}
+	content, err := os.ReadFile(source)
+	return string(content), err
 }
 
-func removeDFS(board [][]string, x, y int, player string, visited map[[2]int]bool, sizeX, sizeY int) {
-	if x < 0 || x >= sizeX || y < 0 || y >= sizeY {
+// Imports the broadcast source, then re-reads it at every interval and appends new main line moves at the tip
+func (g *Game) startBroadcast(source string, interval time.Duration) {
+	g.stopBroadcast()
+	g.stopSelfPlay()
+	content, err := readBroadcastSource(source)
+	if err != nil {
+		g.showError(err)
 		return
 	}
-
-	if visited[[2]int{x, y}] {
+	collection, err := goban.ParseSGF(content)
+	if err != nil {
+		g.showError(err)
 		return
 	}
-
-	if board[y][x] != player {
+	if err := g.importCollection(collection); err != nil {
+		g.showError(err)
 		return
 	}
+	g.sgfPath = ""
+	g.broadcasting = true
+	var ctx context.Context
+	ctx, g.broadcastCancel = context.WithCancel(context.Background())
+	go func() {
+		// Only the reading happens here; the game changes on the UI thread in applyBroadcast
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			content, err := readBroadcastSource(source)
+			if err != nil {
+				fmt.Println("Broadcast read failed:", err)
+				continue
+			}
+			collection, err := goban.ParseSGF(content)
+			if err == nil && len(collection) == 0 {
+				err = fmt.Errorf("no valid SGF game trees found")
+			}
+			if err != nil {
+				fmt.Println("Broadcast update failed:", err)
+				continue
+			}
+			g.applyBroadcast(ctx, collection[0])
+		}
+	}()
+}
 
-	visited[[2]int{x, y}] = true
-
-	board[y][x] = empty
-
-	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
-	for _, d := range dirs {
-		removeDFS(board, x+d[0], y+d[1], player, visited, sizeX, sizeY)
+// Stops following the live broadcast and makes the board editable again
+func (g *Game) stopBroadcast() {
+	if g.broadcastCancel != nil {
+		g.broadcastCancel()
+		g.broadcastCancel = nil
 	}
+	g.broadcasting = false
 }
 
-func (g *Game) getCapturedStones(board [][]string, x, y int, opponent string) [][2]int {
-	captured := make([][2]int, 0)
-	dirs := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
-	for _, d := range dirs {
-		nx, ny := x+d[0], y+d[1]
-		if nx < 0 || nx >= g.sizeX || ny < 0 || ny >= g.sizeY {
-			continue
+// Returns the moves along the first variation of an SGF game tree on a board of the given size
+func sgfMainLineMoves(gameTree *SGFGameTree, sizeX, sizeY int) ([]*Move, error) {
+	moves := []*Move{}
+	for tree := gameTree; tree != nil; {
+		for _, node := range tree.Sequence {
+			moveData, err := extractMoveFromNode(node.Properties, sizeX, sizeY)
+			if err != nil {
+				return nil, err
+			}
+			if moveData.move != nil {
+				moves = append(moves, moveData.move)
+			}
 		}
-		if board[ny][nx] == opponent && !hasLiberty(board, nx, ny, opponent, g.sizeX, g.sizeY) {
-			captured = append(captured, [2]int{nx, ny})
+		if len(tree.Subtrees) == 0 {
+			break
 		}
+		tree = tree.Subtrees[0]
 	}
-	return captured
+	return moves, nil
 }
 
-// Switches the current player.
-// Returns "W" if the current player is "B", and vice versa.
-func switchPlayer(player string) string {
-	if player == black {
-		return white
+// Applies a re-read broadcast record on the UI thread one new move at a time, pausing between the moves so that
+// each is seen before the next. Returns once the record is applied or the broadcast stops.
+func (g *Game) applyBroadcast(ctx context.Context, gameTree *SGFGameTree) {
+	for {
+		appended := make(chan bool, 1)
+		g.runOnUI(func() {
+			if ctx.Err() != nil {
+				appended <- false // The broadcast stopped or another game was loaded meanwhile
+				return
+			}
+			ok, err := g.updateBroadcast(gameTree)
+			if err != nil {
+				fmt.Println("Broadcast update failed:", err)
+			}
+			appended <- ok
+		})
+		select {
+		case <-ctx.Done():
+			return
+		case ok := <-appended:
+			if !ok {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
 	}
-	return black
 }
 
-func (g *Game) importFromSGF(sgfContent string) error {
-	g.setMouseMode("play")
-	collection, err := parseSGF(sgfContent)
+// Appends the next move of the re-read broadcast that extends the main line, reporting whether there was one.
+// If the record no longer extends the main line, it is imported from scratch.
+func (g *Game) updateBroadcast(gameTree *SGFGameTree) (bool, error) {
+	g.selectMainLine(gameTree)
+	moves, err := sgfMainLineMoves(gameTree, g.sizeX, g.sizeY)
 	if err != nil {
-		return err
+		return false, err
 	}
-	if len(collection) == 0 {
-		return fmt.Errorf("no valid SGF game trees found")
+
+	// Match the known main line against the broadcast moves
+	tip := g.rootNode
+	matched := 0
+	for len(tip.children) > 0 {
+		next := tip.children[0]
+		if next.hasMove() {
+			if matched >= len(moves) || moves[matched].player != next.player || moves[matched].x != next.move[0] || moves[matched].y != next.move[1] {
+				return false, g.importCollection([]*SGFGameTree{gameTree})
+			}
+			matched++
+		}
+		tip = next
 	}
-	gameTree := collection[0]
-	return g.initializeGameFromSGFTree(gameTree)
+	if matched == len(moves) {
+		return false, nil
+	}
+
+	move := moves[matched]
+	if move.x != -1 && (move.x >= g.sizeX || move.y >= g.sizeY) {
+		return false, fmt.Errorf("broadcast move (%d, %d) is off the board", move.x, move.y)
+	}
+	followTip := g.currentNode == tip
+	tip = g.appendMoveNode(tip, move.x, move.y, move.player)
+	if followTip {
+		g.currentNode = tip
+		g.updateCommentTextbox()
+		g.redrawBoard()
+	}
+	g.updateGameTreeUI()
+	return true, nil
 }
 
 func (g *Game) exportToSGF() (string, error) {
-	sgfContent := generateSGF(g.rootNode, g.sizeX, g.sizeY, g.komi)
+	sgfContent := generateSGF(g.rootNode, g.sizeX, g.sizeY, g.komi, g.exportGameInfo(), g.passValue())
 	return sgfContent, nil
 }
 
-type SGFParser struct {
-	sgfContent string // The SGF content to parse
-	index      int    // Current parsing index
-	length     int    // Length of the SGF content
+// Formats the game tree under root as a Go XML file of Jago. Points are written as in GTP, which only names
+// the points of square boards up to 25 lines; other boards are refused.
+func generateGoXML(root *GameTreeNode, sizeX, sizeY int, komi int, gameInfo map[string]string) (string, error) {
+	if sizeX != sizeY || sizeX > 25 {
+		return "", fmt.Errorf("Go XML only describes square boards of up to 25 lines, not %dx%d", sizeX, sizeY)
+	}
+	var sb strings.Builder
+	sb.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n<!DOCTYPE Go SYSTEM \"go.dtd\">\n<Go>\n")
+	sb.WriteString("<GoGame")
+	if name := gameInfo["GN"]; name != "" {
+		sb.WriteString(" name=\"" + xmlEscape(name) + "\"")
+	}
+	sb.WriteString(">\n<Information>\n")
+	fmt.Fprintf(&sb, "<Application>ConnectedGroupsGoban Version %s</Application>\n", version)
+	fmt.Fprintf(&sb, "<BoardSize>%d</BoardSize>\n<Komi>%d</Komi>\n", sizeX, komi)
+	for _, field := range goXMLInfoProperties {
+		if value := gameInfo[field.property]; value != "" && field.element != "Application" {
+			fmt.Fprintf(&sb, "<%s>%s</%s>\n", field.element, xmlEscape(value), field.element)
+		}
+	}
+	sb.WriteString("</Information>\n<Nodes>\n")
+	writeGoXMLNode(&sb, root, sizeX)
+	writeGoXMLLine(&sb, root, sizeX)
+	sb.WriteString("</Nodes>\n</GoGame>\n</Go>\n")
+	return sb.String(), nil
 }
 
-type SGFGameTree struct {
-	sequence []*SGFNode     // Sequence of nodes representing moves and properties
-	subtrees []*SGFGameTree // Subtrees representing variations
+// Writes the line of first children below node, each other child in a Variation after the first child,
+// as the alternative to the node before it
+func writeGoXMLLine(sb *strings.Builder, node *GameTreeNode, size int) {
+	// A step writes the line below its node; a variation step first opens a Variation and writes the node,
+	// and a step without a node closes a Variation
+	type step struct {
+		node      *GameTreeNode
+		variation bool
+	}
+	stack := []step{{node: node}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if top.node == nil {
+			sb.WriteString("</Variation>\n")
+			continue
+		}
+		if top.variation {
+			sb.WriteString("<Variation>\n")
+			writeGoXMLNode(sb, top.node, size)
+		}
+		children := top.node.children
+		if len(children) == 0 {
+			continue
+		}
+		writeGoXMLNode(sb, children[0], size)
+		stack = append(stack, step{node: children[0]})
+		for i := len(children) - 1; i >= 1; i-- {
+			stack = append(stack, step{}, step{node: children[i], variation: true})
+		}
+	}
 }
 
-type SGFNode struct {
-	properties map[string][]string // Properties of the node (e.g., move, annotations)
+// Writes a node: a Black or White element if it holds only a move, else a Node element with the move,
+// setup stones, marks and comment
+func writeGoXMLNode(sb *strings.Builder, node *GameTreeNode, size int) {
+	var move string
+	if node.parent != nil && (node.player == black || node.player == white) && node.hasMove() {
+		element := map[string]string{black: "Black", white: "White"}[node.player]
+		at := ""
+		if node.move[0] >= 0 {
+			at = goXMLPoint(node.move[0], node.move[1], size)
+		}
+		move = fmt.Sprintf("<%s number=\"%d\" at=\"%s\"/>\n", element, node.moveNumber(), at)
+	}
+	var content strings.Builder
+	for _, stones := range []struct {
+		element string
+		points  pointSet
+	}{{"AddBlack", node.addedBlackStones}, {"AddWhite", node.addedWhiteStones}, {"Delete", node.AE}} {
+		for _, point := range stones.points.sorted() {
+			fmt.Fprintf(&content, "<%s at=\"%s\"/>\n", stones.element, goXMLPoint(point[0], point[1], size))
+		}
+	}
+	for _, marks := range []struct {
+		markType string
+		points   pointSet
+	}{{"triangle", node.TR}, {"square", node.SQ}, {"circle", node.CR}, {"", node.MA}} {
+		for _, point := range marks.points.sorted() {
+			if marks.markType == "" {
+				fmt.Fprintf(&content, "<Mark at=\"%s\"/>\n", goXMLPoint(point[0], point[1], size))
+			} else {
+				fmt.Fprintf(&content, "<Mark type=\"%s\" at=\"%s\"/>\n", marks.markType, goXMLPoint(point[0], point[1], size))
+			}
+		}
+	}
+	labelPoints := make(pointSet, len(node.LB))
+	for point := range node.LB {
+		labelPoints[point] = true
+	}
+	for _, point := range labelPoints.sorted() {
+		fmt.Fprintf(&content, "<Mark label=\"%s\" at=\"%s\"/>\n", xmlEscape(node.LB[point]), goXMLPoint(point[0], point[1], size))
+	}
+	if node.Comment != "" {
+		content.WriteString("<Comment>\n")
+		for _, paragraph := range strings.Split(node.Comment, "\n") {
+			fmt.Fprintf(&content, "<P>%s</P>\n", xmlEscape(paragraph))
+		}
+		content.WriteString("</Comment>\n")
+	}
+	switch {
+	case content.Len() == 0 && move != "":
+		sb.WriteString(move)
+	case content.Len() > 0 || node.parent == nil:
+		sb.WriteString("<Node>\n" + move + content.String() + "</Node>\n")
+	default:
+		sb.WriteString("<Node/>\n") // A node without a move nor anything else still takes its place in the line
+	}
 }
 
-func parseSGF(sgfContent string) ([]*SGFGameTree, error) {
-	parser := &SGFParser{
-		sgfContent: sgfContent,
-		index:      0,
-		length:     len(sgfContent),
+// Names a point as GTP does: a column letter skipping I, then the row counted from the bottom
+func goXMLPoint(x, y, size int) string {
+	column := 'A' + rune(x)
+	if column >= 'I' {
+		column++
 	}
+	return fmt.Sprintf("%c%d", column, size-y)
+}
 
-	// Validate the SGF content for balanced parentheses
-	if err := parser.validateSGF(); err != nil {
-		return nil, err
-	}
+// Escapes text for an XML element or attribute
+func xmlEscape(text string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(text))
+	return sb.String()
+}
 
-	// Parse the SGF content into a collection of game trees
-	collection, err := parser.parseCollection()
-	if err != nil {
-		return nil, fmt.Errorf("error parsing SGF at index %d: %v", parser.index, err)
-	}
-	return collection, nil
+// Formats the game as Go XML
+func (g *Game) exportToGoXML() (string, error) {
+	return generateGoXML(g.rootNode, g.sizeX, g.sizeY, g.komi, g.exportGameInfo())
 }
 
-// Validates that all parentheses in the SGF content are balanced
-func (p *SGFParser) validateSGF() error {
-	openParens := 0
-	for i, char := range p.sgfContent {
-		if char == '(' {
-			openParens++
-		} else if char == ')' {
-			openParens--
-			if openParens < 0 {
-				return fmt.Errorf("unmatched ')' at index %d", i)
+// Asks where to export the game, suggesting fileName. The format follows the extension chosen:
+// Go XML for .xml, SGF otherwise.
+func (g *Game) showExportDialog(fileName string) {
+	fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil || writer == nil {
+			return
+		}
+		defer writer.Close()
+		path := writer.URI().Path()
+		xmlExport := strings.EqualFold(filepath.Ext(path), ".xml")
+		var audioNotes map[*GameTreeNode]string
+		var copyErr error
+		if !xmlExport {
+			// Go XML has no audio notes
+			if audioNotes, copyErr = g.copyAudioNotes(path); copyErr != nil {
+				g.showError(copyErr)
 			}
 		}
-	}
-	if openParens != 0 {
-		return fmt.Errorf("unmatched '(' in SGF content")
-	}
-	fmt.Println("SGF validated at the level of parenthesis.")
-	return nil
-}
-
-// Parses the entire collection of game trees in the SGF content
-func (p *SGFParser) parseCollection() ([]*SGFGameTree, error) {
-	var collection []*SGFGameTree
-	for p.index < p.length {
-		p.skipWhitespace() // Skip any whitespace before checking for '('
-		if p.index < p.length && p.sgfContent[p.index] == '(' {
-			p.index++ // Consume '('
-			gameTree, err := p.parseGameTree()
-			if err != nil {
-				return nil, err
+		g.rememberFileView()
+		if path == g.sgfPath {
+			// The dialog has already emptied the file, so the backup is made from the content last read or written
+			if err := g.backUpFile(g.sgfPath, g.sgfFileContent); err != nil {
+				g.showError(fmt.Errorf("failed to back up %s: %v", filepath.Base(g.sgfPath), err))
+			}
+		}
+		// The file refers to the copied clips; the nodes keep doing so only if every copy and the write succeed
+		previousNotes := setAudioNotes(audioNotes)
+		// The file is kept as written for the next backup
+		var written strings.Builder
+		out := io.MultiWriter(writer, &written)
+		if xmlExport {
+			var xmlContent string
+			if xmlContent, err = g.exportToGoXML(); err == nil {
+				_, err = io.WriteString(out, xmlContent)
 			}
-			collection = append(collection, gameTree)
 		} else {
-			p.index++ // Move to the next character
+			err = writeSGF(out, g.rootNode, g.sizeX, g.sizeY, g.komi, g.exportGameInfo(), g.passValue())
+		}
+		if err != nil || copyErr != nil {
+			// Back to the clips the nodes had, resolved while g.sgfPath still names their folder
+			for node, note := range previousNotes {
+				previousNotes[node] = g.resolveAudioPath(note)
+			}
+			setAudioNotes(previousNotes)
+		}
+		if err != nil {
+			g.showError(err)
+			return
+		}
+		g.sgfPath = path
+		g.sgfFileContent = written.String()
+		g.markSaved()
+		g.rememberFileView()
+		if g.sizeX > maxSGFBoardSize || g.sizeY > maxSGFBoardSize {
+			dialog.ShowInformation("Extended Coordinates", fmt.Sprintf("Boards larger than %d are beyond the SGF letters, so points past the %dth line were written as four letters, which other SGF programs cannot read.", maxSGFBoardSize, maxSGFBoardSize), g.window)
+		}
+	}, g.window)
+	fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".sgf", ".xml"}))
+	if g.sgfPath != "" {
+		// Suggest the game record's own file, in the chosen format
+		base := filepath.Base(g.sgfPath)
+		fileName = strings.TrimSuffix(base, filepath.Ext(base)) + filepath.Ext(fileName)
+		if folder, err := storage.ListerForURI(storage.NewFileURI(filepath.Dir(g.sgfPath))); err == nil {
+			fileDialog.SetLocation(folder)
 		}
 	}
-	return collection, nil
+	fileDialog.SetFileName(fileName)
+	fileDialog.Show()
 }
 
-// Parses a single game tree, including its sequence and any subtrees (variations)
-func (p *SGFParser) parseGameTree() (*SGFGameTree, error) {
-	sequence, err := p.parseSequence()
-	if err != nil {
-		return nil, err
-	}
-	var subtrees []*SGFGameTree
+// A node of a parsed SGF game tree with its variations, for comparing files node by node
+type sgfTreeNode struct {
+	properties map[string][]string
+	children   []*sgfTreeNode
+}
 
-	for {
-		p.skipWhitespace() // Skip any whitespace before checking for '('
-		if p.index < p.length && p.sgfContent[p.index] == '(' {
-			p.index++ // Consume '(' before parsing subtree
-			subtree, err := p.parseGameTree()
-			if err != nil {
-				return nil, err
+// Links the sequences and subtrees of a parsed game tree into a tree of nodes
+func sgfTreeNodes(gameTree *SGFGameTree) *sgfTreeNode {
+	if len(gameTree.Sequence) == 0 {
+		return nil
+	}
+	type pending struct {
+		tree  *SGFGameTree
+		first *sgfTreeNode // The node of the tree's first sequence node, already linked to its parent
+	}
+	root := &sgfTreeNode{properties: gameTree.Sequence[0].Properties}
+	stack := []pending{{gameTree, root}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		last := top.first
+		for _, node := range top.tree.Sequence[1:] {
+			treeNode := &sgfTreeNode{properties: node.Properties}
+			last.children = append(last.children, treeNode)
+			last = treeNode
+		}
+		for _, subtree := range top.tree.Subtrees {
+			if len(subtree.Sequence) == 0 {
+				continue
 			}
-			subtrees = append(subtrees, subtree)
-		} else {
-			break // No more subtrees
+			first := &sgfTreeNode{properties: subtree.Sequence[0].Properties}
+			last.children = append(last.children, first)
+			stack = append(stack, pending{subtree, first})
 		}
 	}
+	return root
+}
 
-	p.skipWhitespace() // Skip any whitespace before expecting ')'
+// Properties rewritten by every export, which carry no content of the game
+var roundTripIgnoredProperties = []string{"FF", "GM", "CA", "AP"}
 
-	if p.index < p.length {
-		if p.sgfContent[p.index] == ')' {
-			p.index++ // Consume ')'
-		} else {
-			return nil, fmt.Errorf("expected ')' at index %d, found '%c'", p.index, p.sgfContent[p.index])
+// Properties holding point lists, compared as sets with compressed rectangles expanded
+var pointListProperties = []string{"AB", "AW", "AE", "CR", "SQ", "TR", "MA", "DD", "VW"}
+
+// Returns the values of a property in a form comparable across files
+func normalizedPropertyValues(key string, values []string) string {
+	var normalized []string
+	if slices.Contains(pointListProperties, key) {
+		for _, xy := range expandSGFPointList(values) {
+			normalized = append(normalized, goban.SGFPoint(xy[0], xy[1]))
 		}
 	} else {
-		return nil, fmt.Errorf("expected ')' at end of SGF, but reached end of content")
+		for _, value := range values {
+			normalized = append(normalized, strings.TrimSpace(value))
+		}
 	}
-	return &SGFGameTree{
-		sequence: sequence,
-		subtrees: subtrees,
-	}, nil
+	if key != "C" {
+		sort.Strings(normalized)
+	}
+	return "[" + strings.Join(normalized, "][") + "]"
 }
 
-// Parses a sequence of nodes within a game tree
-func (p *SGFParser) parseSequence() ([]*SGFNode, error) {
-	var nodes []*SGFNode
-	for p.index < p.length && p.sgfContent[p.index] == ';' {
-		node, err := p.parseNode()
-		if err != nil {
-			return nil, err
+// Compares an SGF file with its re-export node by node and describes every difference in content.
+// Variations are matched by their move so that reordering by the main line policy is not reported.
+func diffSGFTrees(original, exported *sgfTreeNode, path string) []string {
+	moveOf := func(node *sgfTreeNode) string {
+		for _, key := range []string{"B", "W"} {
+			if values, ok := node.properties[key]; ok {
+				return key + normalizedPropertyValues(key, values)
+			}
 		}
-		nodes = append(nodes, node)
+		return ""
 	}
-	return nodes, nil
-}
-
-// Skips whitespace characters in the SGF content
-func (p *SGFParser) skipWhitespace() {
-	for p.index < p.length && (p.sgfContent[p.index] == ' ' || p.sgfContent[p.index] == '\n' || p.sgfContent[p.index] == '\r' || p.sgfContent[p.index] == '\t') {
-		p.index++
+	// A step compares a pair of nodes, or without nodes reports its lines as they are. Steps are taken
+	// from a stack of their own, so each node's differences come before those of its variations.
+	type step struct {
+		original, exported *sgfTreeNode
+		path               string
+		lines              []string
 	}
-}
-
-// Parses a single node, extracting its properties
-func (p *SGFParser) parseNode() (*SGFNode, error) {
-	properties := make(map[string][]string)
-	p.index++ // Skip the ';'
+	var report []string
+	stack := []step{{original: original, exported: exported, path: path}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if top.original == nil {
+			report = append(report, top.lines...)
+			continue
+		}
+		original, exported, path := top.original, top.exported, top.path
 
-	for {
-		p.skipWhitespace() // Skip any whitespace before the next property
-		if p.index >= p.length {
-			break // End of content
+		var lines []string
+		for key, values := range original.properties {
+			if slices.Contains(roundTripIgnoredProperties, key) {
+				continue
+			}
+			before := normalizedPropertyValues(key, values)
+			exportedValues, ok := exported.properties[key]
+			if !ok {
+				lines = append(lines, fmt.Sprintf("Node %s: %s%s lost", path, key, before))
+			} else if after := normalizedPropertyValues(key, exportedValues); after != before {
+				lines = append(lines, fmt.Sprintf("Node %s: %s changed from %s to %s", path, key, before, after))
+			}
 		}
-		r, _, err := p.nextRune()
-		if err != nil {
-			return nil, err
+		for key, values := range exported.properties {
+			if _, ok := original.properties[key]; !ok && !slices.Contains(roundTripIgnoredProperties, key) {
+				lines = append(lines, fmt.Sprintf("Node %s: %s%s added", path, key, normalizedPropertyValues(key, values)))
+			}
 		}
-		if !p.isUpperCaseLetter(r) {
-			break // No more properties in this node
+		sort.Strings(lines)
+		report = append(report, lines...)
+
+		var next []step
+		used := make([]bool, len(exported.children))
+		for i, child := range original.children {
+			match := -1
+			for j, candidate := range exported.children {
+				if !used[j] && moveOf(candidate) == moveOf(child) {
+					match = j
+					break
+				}
+			}
+			if match == -1 {
+				lost := fmt.Sprintf("Node %s.%d: variation starting with %q lost", path, i, moveOf(child))
+				next = append(next, step{lines: []string{lost}})
+				continue
+			}
+			used[match] = true
+			next = append(next, step{original: child, exported: exported.children[match], path: fmt.Sprintf("%s.%d", path, i)})
 		}
-		ident, values, err := p.parseProperty()
-		if err != nil {
-			return nil, err
+		var added []string
+		for j, candidate := range exported.children {
+			if !used[j] {
+				added = append(added, fmt.Sprintf("Node %s: variation starting with %q added", path, moveOf(candidate)))
+			}
 		}
-		properties[ident] = values
+		next = append(next, step{lines: added})
+		slices.Reverse(next)
+		stack = append(stack, next...)
 	}
-
-	return &SGFNode{
-		properties: properties,
-	}, nil
+	return report
 }
 
-// Checks if a rune is an uppercase letter
-func (p *SGFParser) isUpperCaseLetter(r rune) bool {
-	return unicode.IsUpper(r)
-}
-
-// Parses a property, returning its identifier and associated values
-func (p *SGFParser) parseProperty() (string, []string, error) {
-	ident := ""
-	for p.index < p.length {
-		r, size, err := p.nextRune()
-		if err != nil {
-			return "", nil, err
+// Imports an SGF file, exports it again and shows every difference in moves, setup, markup, comments or game info
+func (g *Game) validateSGFRoundTrip() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
 		}
-		if !unicode.IsUpper(r) {
-			break // End of property identifier
+		defer reader.Close()
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			g.showError(err)
+			return
 		}
-		ident += string(r)
-		p.index += size
-	}
-	var values []string
-	for p.index < p.length {
-		r, _, err := p.nextRune()
+		original, err := goban.ParseSGF(string(content))
 		if err != nil {
-			return "", nil, err
+			g.showError(err)
+			return
 		}
-		if r != '[' {
-			break // No more values for this property
+		if err := g.importFromSGF(string(content)); err != nil {
+			g.showError(err)
+			return
 		}
-		value, err := p.parsePropValue()
+		g.sgfPath = reader.URI().Path()
+		g.sgfFileContent = string(content)
+		g.markSaved()
+		exportedContent, err := g.exportToSGF()
 		if err != nil {
-			return "", nil, err
+			g.showError(err)
+			return
 		}
-		values = append(values, value)
-	}
-	return ident, values, nil
-}
-
-// Retrieves the next rune from the SGF content without advancing the index
-func (p *SGFParser) nextRune() (rune, int, error) {
-	if p.index >= p.length {
-		return 0, 0, io.EOF
-	}
-	r, size := utf8.DecodeRuneInString(p.sgfContent[p.index:])
-	if r == utf8.RuneError && size == 1 {
-		return 0, 0, fmt.Errorf("invalid UTF-8 encoding at index %d", p.index)
-	}
-	return r, size, nil
-}
-
-// Parses the value of a property, handling escaped characters
-func (p *SGFParser) parsePropValue() (string, error) {
-	p.index++ // Skip '['
-	var runes []rune
-	for p.index < p.length {
-		r, size, err := p.nextRune()
+		exported, err := goban.ParseSGF(exportedContent)
 		if err != nil {
-			return "", err
+			g.showError(fmt.Errorf("the re-exported file cannot be parsed: %v", err))
+			return
 		}
-		if r == ']' {
-			p.index += size // Skip ']'
-			break           // End of property value
+		originalRoot, exportedRoot := sgfTreeNodes(original[0]), sgfTreeNodes(exported[0])
+		var report []string
+		if originalRoot != nil && exportedRoot != nil {
+			report = diffSGFTrees(originalRoot, exportedRoot, "0")
 		}
-		if r == '\\' {
-			p.index += size // Skip '\\'
-			if p.index >= p.length {
-				return "", fmt.Errorf("unexpected end of content after '\\'")
-			}
-			escapedRune, escSize, err := p.nextRune()
-			if err != nil {
-				return "", err
-			}
-			runes = append(runes, escapedRune)
-			p.index += escSize // Skip escaped character
-		} else {
-			runes = append(runes, r)
-			p.index += size // Move to next rune
+		if len(original) > 1 {
+			report = append(report, fmt.Sprintf("%d further games of the collection are not imported", len(original)-1))
+		}
+		text := "Nothing is lost: the re-exported file has the same content."
+		if len(report) > 0 {
+			text = fmt.Sprintf("%d differences after import and re-export:\n\n%s", len(report), strings.Join(report, "\n"))
+		}
+		reportLabel := widget.NewLabel(text)
+		reportLabel.Wrapping = fyne.TextWrapWord
+		scroll := container.NewVScroll(reportLabel)
+		scroll.SetMinSize(fyne.NewSize(600, 400))
+		dialog.ShowCustom("SGF Round Trip", "Close", scroll, g.window)
+	}, g.window)
+}
+
+// Parsed SGF game trees and their nodes, as read by goban.ParseSGF
+type (
+	SGFGameTree = goban.SGFGameTree
+	SGFNode     = goban.SGFNode
+)
+
+// Returns the board size of the SZ property of a root node, 19x19 if it is missing
+func sgfBoardSize(rootNodeProperties map[string][]string) (int, int, error) {
+	sizeProp, hasSZ := rootNodeProperties["SZ"]
+	if !hasSZ || len(sizeProp) == 0 {
+		return 19, 19, nil
+	}
+	size := sizeProp[0]
+	sizes := strings.Split(size, ":")
+	if len(sizes) == 2 {
+		xSize, err1 := strconv.Atoi(sizes[0])
+		ySize, err2 := strconv.Atoi(sizes[1])
+		if err1 != nil || err2 != nil {
+			return 0, 0, fmt.Errorf("invalid SZ property: %s", size)
 		}
+		return xSize, ySize, nil
 	}
-	return string(runes), nil
+	sizeInt, err := strconv.Atoi(size)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid SZ property: %s", size)
+	}
+	return sizeInt, sizeInt, nil
 }
 
 func (g *Game) initializeGameFromSGFTree(gameTree *SGFGameTree) error {
-	if len(gameTree.sequence) == 0 {
+	if len(gameTree.Sequence) == 0 {
 		return fmt.Errorf("SGF game tree has no nodes")
 	}
-	rootNodeProperties := gameTree.sequence[0].properties
+	rootNodeProperties := gameTree.Sequence[0].Properties
+	g.importWarnings = nil
 
 	// Adjust the komi based on KM property
 	if kmProp, hasKM := rootNodeProperties["KM"]; hasKM && len(kmProp) > 0 {
@@ -2451,32 +12740,14 @@ func (g *Game) initializeGameFromSGFTree(gameTree *SGFGameTree) error {
 	}
 
 	// Adjust the board size based on SZ property
-	sizeProp, hasSZ := rootNodeProperties["SZ"]
-	if hasSZ && len(sizeProp) > 0 {
-		size := sizeProp[0]
-		sizes := strings.Split(size, ":")
-		if len(sizes) == 2 {
-			xSize, err1 := strconv.Atoi(sizes[0])
-			ySize, err2 := strconv.Atoi(sizes[1])
-			if err1 != nil || err2 != nil {
-				return fmt.Errorf("invalid SZ property: %s", size)
-			}
-			g.sizeX = xSize
-			g.sizeY = ySize
-		} else {
-			sizeInt, err := strconv.Atoi(size)
-			if err != nil {
-				return fmt.Errorf("invalid SZ property: %s", size)
-			}
-			g.sizeX = sizeInt
-			g.sizeY = sizeInt
-		}
-	} else {
-		g.sizeX = 19
-		g.sizeY = 19
+	sizeX, sizeY, err := sgfBoardSize(rootNodeProperties)
+	if err != nil {
+		return err
 	}
-	if g.sizeX > 52 || g.sizeY > 52 {
-		return fmt.Errorf("board size exceeds maximum allowed size of 52")
+	g.sizeX = sizeX
+	g.sizeY = sizeY
+	if g.sizeX > maxBoardSize || g.sizeY > maxBoardSize {
+		return fmt.Errorf("board size exceeds maximum allowed size of %d", maxBoardSize)
 	}
 
 	// Initialize the board
@@ -2491,94 +12762,83 @@ func (g *Game) initializeGameFromSGFTree(gameTree *SGFGameTree) error {
 		}
 	}
 
+	// Take the game info from the file rather than from the defaults
+	g.gameInfo = make(map[string]string)
+	for _, field := range gameInfoFields {
+		if values, ok := rootNodeProperties[field.key]; ok && len(values) > 0 && values[0] != "" {
+			g.gameInfo[field.key] = values[0]
+		}
+	}
+
 	// Handle initial stones (AB and AW properties)
 	initialBoard := g.rootNode.boardState
 
 	abProp, hasAB := rootNodeProperties["AB"]
 	if hasAB {
-		for _, coord := range abProp {
-			xy := convertSGFCoordToXY(coord)
-			if xy == nil {
-				fmt.Printf("Warning: Invalid AB coordinate '%s' skipped.\n", coord)
-				continue
-			}
+		for _, coord := range onBoardPoints("AB", abProp, g.sizeX, g.sizeY, &g.importWarnings) {
+			xy := goban.ParseSGFPoint(coord)
 			initialBoard[xy[1]][xy[0]] = black
 			g.rootNode.addBlackStone(xy[0], xy[1])
 		}
 	}
 	awProp, hasAW := rootNodeProperties["AW"]
 	if hasAW {
-		for _, coord := range awProp {
-			xy := convertSGFCoordToXY(coord)
-			if xy == nil {
-				fmt.Printf("Warning: Invalid AW coordinate '%s' skipped.\n", coord)
-				continue
-			}
+		for _, coord := range onBoardPoints("AW", awProp, g.sizeX, g.sizeY, &g.importWarnings) {
+			xy := goban.ParseSGFPoint(coord)
 			initialBoard[xy[1]][xy[0]] = white
 			g.rootNode.addWhiteStone(xy[0], xy[1])
 		}
 	}
+	for _, coord := range onBoardPoints("BLOCKED", rootNodeProperties["BLOCKED"], g.sizeX, g.sizeY, &g.importWarnings) {
+		xy := goban.ParseSGFPoint(coord)
+		initialBoard[xy[1]][xy[0]] = blocked
+		g.rootNode.addedBlackStones.set(xy[0], xy[1], false)
+		g.rootNode.addedWhiteStones.set(xy[0], xy[1], false)
+	}
 
-	// Assign comment to root node if present
-	if commentProps, hasC := gameTree.sequence[0].properties["C"]; hasC && len(commentProps) > 0 {
+	// Assign comment and custom properties to root node if present
+	if commentProps, hasC := gameTree.Sequence[0].Properties["C"]; hasC && len(commentProps) > 0 {
 		g.rootNode.Comment = commentProps[0]
 	}
+	applyCustomProperties(g.rootNode, rootNodeProperties)
 
 	// Process additional properties (LB, CR, SQ, TR, MA) for the root node
 	// Create a copy of properties to exclude AB, AW, C, SZ, etc.
 	additionalProps := make(map[string][]string)
 	for key, values := range rootNodeProperties {
-		if key != "AB" && key != "AW" && key != "C" && key != "SZ" && key != "GM" && key != "FF" && key != "CA" && key != "AP" && key != "DT" && key != "GN" && key != "PC" && key != "PB" && key != "PW" && key != "BR" && key != "WR" && key != "ST" && key != "TM" && key != "OT" && key != "RE" && key != "KM" && key != "RU" {
+		if key != "AB" && key != "AW" && key != "C" && key != "SZ" && key != "GM" && key != "FF" && key != "CA" && key != "AP" && key != "DT" && key != "GN" && key != "PC" && key != "PB" && key != "PW" && key != "BR" && key != "WR" && key != "ST" && key != "TM" && key != "OT" && key != "RE" && key != "KM" && key != "RU" && !isCustomProperty(key) && !isGameInfoProperty(key) {
 			additionalProps[key] = values
 		}
 	}
 
 	if len(additionalProps) > 0 {
-		moveData, err := extractMoveFromNode(additionalProps)
+		moveData, err := extractMoveFromNode(additionalProps, g.sizeX, g.sizeY)
 		if err != nil {
 			return err
 		}
+		g.importWarnings = append(g.importWarnings, moveData.warnings...)
 		// Append annotation properties to root node
 		for _, coord := range moveData.CR {
-			xy := convertSGFCoordToXY(coord)
-			if xy == nil {
-				fmt.Printf("Warning: Invalid CR coordinate '%s' skipped.\n", coord)
-				continue
-			}
-			g.rootNode.CR[xy[1]][xy[0]] = true
+			xy := goban.ParseSGFPoint(coord)
+			g.rootNode.CR.set(xy[0], xy[1], true)
 		}
 		for _, coord := range moveData.SQ {
-			xy := convertSGFCoordToXY(coord)
-			if xy == nil {
-				fmt.Printf("Warning: Invalid CR coordinate '%s' skipped.\n", coord)
-				continue
-			}
-			g.rootNode.SQ[xy[1]][xy[0]] = true
+			xy := goban.ParseSGFPoint(coord)
+			g.rootNode.SQ.set(xy[0], xy[1], true)
 		}
 		for _, coord := range moveData.TR {
-			xy := convertSGFCoordToXY(coord)
-			if xy == nil {
-				fmt.Printf("Warning: Invalid CR coordinate '%s' skipped.\n", coord)
-				continue
-			}
-			g.rootNode.TR[xy[1]][xy[0]] = true
+			xy := goban.ParseSGFPoint(coord)
+			g.rootNode.TR.set(xy[0], xy[1], true)
 		}
 		for _, coord := range moveData.MA {
-			xy := convertSGFCoordToXY(coord)
-			if xy == nil {
-				fmt.Printf("Warning: Invalid CR coordinate '%s' skipped.\n", coord)
-				continue
-			}
-			g.rootNode.MA[xy[1]][xy[0]] = true
+			xy := goban.ParseSGFPoint(coord)
+			g.rootNode.MA.set(xy[0], xy[1], true)
 		}
 		for coord, label := range moveData.LB {
-			xy := convertSGFCoordToXY(coord)
-			if xy == nil {
-				fmt.Printf("Warning: Invalid LB coordinate '%s' skipped.\n", coord)
-				continue
-			}
-			g.rootNode.LB[xy[1]][xy[0]] = label
+			xy := goban.ParseSGFPoint(coord)
+			g.rootNode.LB.set(xy[0], xy[1], label)
 		}
+		applyDimAndView(g.rootNode, moveData, g.sizeX, g.sizeY)
 	}
 
 	// Set the current node to the root node to ensure the comment is displayed
@@ -2587,9 +12847,8 @@ func (g *Game) initializeGameFromSGFTree(gameTree *SGFGameTree) error {
 	// Update the comment textbox to reflect the root node's comment
 	g.updateCommentTextbox()
 
-	// Start processing the main line
-	var lastNode *GameTreeNode
-	err := g.processMainLine(gameTree, g.rootNode, &lastNode)
+	// Build the tree below the root
+	lastNode, err := g.buildGameTree(gameTree)
 	if err != nil {
 		return err
 	}
@@ -2604,130 +12863,23 @@ func (g *Game) initializeGameFromSGFTree(gameTree *SGFGameTree) error {
 	// Refresh the game tree UI
 	g.updateGameTreeUI()
 
+	g.showImportWarnings()
 	return nil
 }
 
-func charToInt(c rune) (int, error) {
-	if c >= 'a' && c <= 'z' {
-		return int(c - 'a'), nil
-	} else if c >= 'A' && c <= 'Z' {
-		return int(c - 'A' + 26), nil
-	} else {
-		return 93, fmt.Errorf("invalid coordinate character: %c", c)
-	}
-}
-
-// Converts SGF coordinates (e.g., "pd") to board x, y indices.
-// Returns a slice with [x, y] or nil if invalid.
-func convertSGFCoordToXY(coord string) []int {
-	if len(coord) != 2 {
-		return nil // Invalid coordinate length
-	}
-	x, err1 := charToInt(rune(coord[0]))
-	y, err2 := charToInt(rune(coord[1]))
-	if err1 != nil || err2 != nil {
-		return nil // Invalid characters in coordinate
-	}
-	if x >= 0 && x < 52 && y >= 0 && y < 52 {
-		return []int{x, y} // Valid coordinate
-	}
-	return nil // Coordinate out of range
-}
-
-func (g *Game) processMainLine(gameTree *SGFGameTree, parentNode *GameTreeNode, lastNode **GameTreeNode) error {
-	currentParent := parentNode
-	sequenceStartIndex := 0
-	if currentParent == g.rootNode {
-		sequenceStartIndex = 1
+// Lists what the last import skipped, at most 20 lines, so a damaged file does not load silently
+func (g *Game) showImportWarnings() {
+	if len(g.importWarnings) == 0 || g.window == nil {
+		return
 	}
-	for i := sequenceStartIndex; i < len(gameTree.sequence); i++ {
-		nodeProperties := gameTree.sequence[i].properties
-		moveData, err := extractMoveFromNode(nodeProperties)
-		if err != nil {
-			return err
-		}
-		newBoardState := copyBoard(currentParent.boardState)
-		newNode := g.newGameTreeNode()
-		newNode.boardState = newBoardState
-		newNode.parent = currentParent
-		if moveData.move != nil {
-			newNode.player = moveData.move.player
-		} else {
-			newNode.player = currentParent.player
-		}
-		currentParent.children = append(currentParent.children, newNode)
-
-		// Handle move
-		if moveData.move != nil {
-			x, y := moveData.move.x, moveData.move.y
-			player := moveData.move.player
-			if x >= 0 && y >= 0 {
-				// Place the stone
-				newBoardState[y][x] = player
-				// Capture stones and handle ko
-				koX, koY := g.captureStones(newBoardState, x, y, player)
-				newNode.koX = koX
-				newNode.koY = koY
-				newNode.move = [2]int{x, y}
-			} else {
-				// Pass move
-				newNode.move = [2]int{-1, -1}
-			}
-		} else {
-			// No move
-			newNode.move = [2]int{93, 93}
-		}
-
-		// Apply added black stones
-		for _, coord := range moveData.addedBlackStones {
-			xy := convertSGFCoordToXY(coord)
-			if xy != nil {
-				newBoardState[xy[1]][xy[0]] = black
-				newNode.addBlackStone(xy[0], xy[1])
-			}
-		}
-
-		// Apply added white stones
-		for _, coord := range moveData.addedWhiteStones {
-			xy := convertSGFCoordToXY(coord)
-			if xy != nil {
-				newBoardState[xy[1]][xy[0]] = white
-			}
-		}
-
-		// Append added empty points
-		if len(moveData.addedEmptyPoints) > 0 {
-			for _, coord := range moveData.addedEmptyPoints {
-				xy := convertSGFCoordToXY(coord)
-				if xy != nil {
-					newBoardState[xy[1]][xy[0]] = empty
-					newNode.AE[xy[1]][xy[0]] = true
-				}
-			}
-		}
-
-		// Assign comment to the new node if present
-		if commentProps, hasC := nodeProperties["C"]; hasC && len(commentProps) > 0 {
-			newNode.Comment = commentProps[0]
-		}
-
-		currentParent = newNode
-		*lastNode = newNode
+	for _, warning := range g.importWarnings {
+		fmt.Printf("Warning: %s.\n", warning)
 	}
-
-	if len(gameTree.subtrees) > 0 {
-		err := g.processMainLine(gameTree.subtrees[0], currentParent, lastNode)
-		if err != nil {
-			return err
-		}
-		for i := 1; i < len(gameTree.subtrees); i++ {
-			err := g.processSubtree(gameTree.subtrees[i], currentParent)
-			if err != nil {
-				return err
-			}
-		}
+	lines := g.importWarnings
+	if len(lines) > 20 {
+		lines = append(lines[:20:20], fmt.Sprintf("... and %d more", len(g.importWarnings)-20))
 	}
-	return nil
+	dialog.ShowInformation("Import Warnings", "Some coordinates were invalid or outside the board and were skipped:\n"+strings.Join(lines, "\n"), g.window)
 }
 
 type MoveData struct {
@@ -2741,6 +12893,11 @@ type MoveData struct {
 	TR               []string          // Triangle annotations
 	MA               []string          // Mark (X) annotations
 	LB               map[string]string // Labels for specific points
+	DD               [][]int           // Dimmed points (DD), compressed lists expanded
+	VW               [][]int           // Visible points (VW), compressed lists expanded
+	hasDD            bool              // Indicates if a DD property is present, possibly empty
+	hasVW            bool              // Indicates if a VW property is present, possibly empty
+	warnings         []string          // Moves and points skipped because they are invalid or off the board
 }
 
 type Move struct {
@@ -2749,12 +12906,14 @@ type Move struct {
 	player string // Player who made the move ("B" or "W")
 }
 
-func extractMoveFromNode(nodeProperties map[string][]string) (*MoveData, error) {
+// Reads the move, setup and markup of a node; the size tells whether "tt" is a legacy pass
+func extractMoveFromNode(nodeProperties map[string][]string, sizeX, sizeY int) (*MoveData, error) {
 	if nodeProperties == nil {
 		return nil, fmt.Errorf("node properties are nil")
 	}
 	var move *Move = nil
 	var player string = ""
+	var moveCoord string
 	var addedBlackStones []string
 	var addedWhiteStones []string
 	var addedEmptyPoints []string
@@ -2767,21 +12926,19 @@ func extractMoveFromNode(nodeProperties map[string][]string) (*MoveData, error)
 	// Handle Black moves
 	if bProp, hasB := nodeProperties["B"]; hasB {
 		player = black
-		coord := ""
 		if len(bProp) > 0 {
-			coord = bProp[0]
+			moveCoord = bProp[0]
 		}
-		move = createMoveFromCoord(coord, player)
+		move = createMoveFromCoord(moveCoord, player, sizeX, sizeY)
 	}
 
 	// Handle White moves
 	if wProp, hasW := nodeProperties["W"]; hasW {
 		player = white
-		coord := ""
 		if len(wProp) > 0 {
-			coord = wProp[0]
+			moveCoord = wProp[0]
 		}
-		move = createMoveFromCoord(coord, player)
+		move = createMoveFromCoord(moveCoord, player, sizeX, sizeY)
 	}
 
 	// Handle Add Black Stones
@@ -2830,6 +12987,31 @@ func extractMoveFromNode(nodeProperties map[string][]string) (*MoveData, error)
 		}
 	}
 
+	// Handle DD (Dim) and VW (View) properties, which may use compressed point lists
+	ddProps, hasDD := nodeProperties["DD"]
+	vwProps, hasVW := nodeProperties["VW"]
+
+	// Skip whatever does not lie on the board declared by SZ, so that no later step indexes past it
+	var warnings []string
+	if player != "" && move == nil {
+		warnings = append(warnings, fmt.Sprintf("invalid %s coordinate '%s' skipped", player, moveCoord))
+	} else if move != nil && (move.x >= sizeX || move.y >= sizeY) {
+		warnings = append(warnings, fmt.Sprintf("%s move '%s' lies outside the %dx%d board and was skipped", player, moveCoord, sizeX, sizeY))
+		move = nil
+	}
+	addedBlackStones = onBoardPoints("AB", addedBlackStones, sizeX, sizeY, &warnings)
+	addedWhiteStones = onBoardPoints("AW", addedWhiteStones, sizeX, sizeY, &warnings)
+	addedEmptyPoints = onBoardPoints("AE", addedEmptyPoints, sizeX, sizeY, &warnings)
+	CR = onBoardPoints("CR", CR, sizeX, sizeY, &warnings)
+	SQ = onBoardPoints("SQ", SQ, sizeX, sizeY, &warnings)
+	TR = onBoardPoints("TR", TR, sizeX, sizeY, &warnings)
+	MA = onBoardPoints("MA", MA, sizeX, sizeY, &warnings)
+	for point := range LB {
+		if len(onBoardPoints("LB", []string{point}, sizeX, sizeY, &warnings)) == 0 {
+			delete(LB, point)
+		}
+	}
+
 	return &MoveData{
 		move:             move,
 		pass:             move != nil && move.x == -1 && move.y == -1,
@@ -2841,55 +13023,246 @@ func extractMoveFromNode(nodeProperties map[string][]string) (*MoveData, error)
 		TR:               TR,
 		MA:               MA,
 		LB:               LB,
+		DD:               expandSGFPointList(onBoardPoints("DD", ddProps, sizeX, sizeY, &warnings)),
+		VW:               expandSGFPointList(onBoardPoints("VW", vwProps, sizeX, sizeY, &warnings)),
+		hasDD:            hasDD,
+		hasVW:            hasVW,
+		warnings:         warnings,
 	}, nil
 }
 
-func createMoveFromCoord(coord string, player string) *Move {
-	if coord == "" {
+// Returns the points of an SGF point list that lie on a sizeX by sizeY board, with compressed rectangles expanded.
+// Each invalid or off-board value adds a warning naming the property.
+func onBoardPoints(property string, values []string, sizeX, sizeY int, warnings *[]string) []string {
+	var points []string
+	for _, value := range values {
+		expanded := expandSGFPointList([]string{value})
+		if len(expanded) == 0 {
+			*warnings = append(*warnings, fmt.Sprintf("invalid %s coordinate '%s' skipped", property, value))
+			continue
+		}
+		outside := 0
+		for _, xy := range expanded {
+			if xy[0] >= sizeX || xy[1] >= sizeY {
+				outside++
+				continue
+			}
+			points = append(points, goban.SGFPoint(xy[0], xy[1]))
+		}
+		if outside > 0 {
+			*warnings = append(*warnings, fmt.Sprintf("%s point '%s' lies outside the %dx%d board and was skipped", property, value, sizeX, sizeY))
+		}
+	}
+	return points
+}
+
+// Expands SGF point list values, including compressed rectangles such as "aa:cc", into [x, y] pairs.
+// Empty values and invalid coordinates are skipped.
+func expandSGFPointList(values []string) [][]int {
+	var points [][]int
+	for _, value := range values {
+		corners := strings.SplitN(value, ":", 2)
+		first := goban.ParseSGFPoint(corners[0])
+		if first == nil {
+			continue
+		}
+		if len(corners) == 1 {
+			points = append(points, first)
+			continue
+		}
+		second := goban.ParseSGFPoint(corners[1])
+		if second == nil {
+			continue
+		}
+		for y := min(first[1], second[1]); y <= max(first[1], second[1]); y++ {
+			for x := min(first[0], second[0]); x <= max(first[0], second[0]); x++ {
+				points = append(points, []int{x, y})
+			}
+		}
+	}
+	return points
+}
+
+// Applies the DD and VW properties of the move data to the node, skipping points off the board
+func applyDimAndView(node *GameTreeNode, moveData *MoveData, sizeX, sizeY int) {
+	node.hasDD = moveData.hasDD
+	for _, xy := range moveData.DD {
+		if xy[0] < sizeX && xy[1] < sizeY {
+			node.DD.set(xy[0], xy[1], true)
+		}
+	}
+	node.hasVW = moveData.hasVW
+	for _, xy := range moveData.VW {
+		if xy[0] < sizeX && xy[1] < sizeY {
+			node.VW.set(xy[0], xy[1], true)
+		}
+	}
+}
+
+// Custom SGF properties written by this application
+var customProperties = []string{"AUDIO", "VARCOLOR", "MOVETIME", "TAG", "BLOCKED"}
+
+// Layout of the MOVETIME property
+const moveTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// Reports whether the SGF property is one of the custom properties of this application
+func isCustomProperty(key string) bool {
+	for _, custom := range customProperties {
+		if custom == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Copies the custom properties of an SGF node onto the game tree node
+func applyCustomProperties(node *GameTreeNode, properties map[string][]string) {
+	if audioProps, hasAudio := properties["AUDIO"]; hasAudio && len(audioProps) > 0 {
+		node.audioNote = audioProps[0]
+	}
+	if colorProps, hasColor := properties["VARCOLOR"]; hasColor && len(colorProps) > 0 {
+		if _, known := variationColors[colorProps[0]]; known {
+			node.variationColor = colorProps[0]
+		}
+	}
+	for _, tag := range properties["TAG"] {
+		node.tags = append(node.tags, parseNodeTags(tag)...)
+	}
+	if timeProps, hasTime := properties["MOVETIME"]; hasTime && len(timeProps) > 0 {
+		if moveTime, err := time.Parse(moveTimeLayout, timeProps[0]); err == nil {
+			node.moveTime = moveTime
+		}
+	}
+	if mnProps, hasMN := properties["MN"]; hasMN && len(mnProps) > 0 {
+		if number, err := strconv.Atoi(strings.TrimSpace(mnProps[0])); err == nil && number > 0 {
+			node.moveNumberOverride = number
+		}
+	}
+	if plProps, hasPL := properties["PL"]; hasPL && len(plProps) > 0 && !node.hasMove() {
+		// The node records the player who moved last, so the player to move is the other one
+		switch strings.ToUpper(strings.TrimSpace(plProps[0])) {
+		case black:
+			node.player = white
+		case white:
+			node.player = black
+		}
+	}
+	for _, annotation := range annotationProperties {
+		if values, ok := properties[annotation.key]; ok {
+			if node.annotations == nil {
+				node.annotations = make(map[string]string)
+			}
+			node.annotations[annotation.key] = ""
+			if len(values) > 0 {
+				node.annotations[annotation.key] = strings.TrimSpace(values[0])
+			}
+		}
+	}
+	for key, values := range properties {
+		if !isInterpretedProperty(key) {
+			if node.otherProperties == nil {
+				node.otherProperties = make(map[string][]string)
+			}
+			node.otherProperties[key] = values
+		}
+	}
+}
+
+// Standard SGF properties read on import or written anew on export; all others are preserved verbatim
+var interpretedProperties = []string{"B", "W", "AB", "AW", "AE", "C", "CR", "SQ", "TR", "MA", "LB", "DD", "VW", "SZ", "KM", "GM", "FF", "CA", "AP", "PL", "MN",
+	"TE", "BM", "IT", "DO", "GB", "GW", "DM", "UC", "HO"}
+
+// Reports whether the SGF property is interpreted by this application rather than preserved verbatim
+func isInterpretedProperty(key string) bool {
+	return slices.Contains(interpretedProperties, key) || isCustomProperty(key) || isGameInfoProperty(key)
+}
+
+// Formats the preserved properties of a node, sorted by key so the output is stable
+func formatOtherProperties(node *GameTreeNode) string {
+	keys := make([]string, 0, len(node.otherProperties))
+	for key := range node.otherProperties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	text := ""
+	for _, key := range keys {
+		text += key
+		for _, value := range node.otherProperties[key] {
+			text += "[" + escapeSGFText(value) + "]"
+		}
+	}
+	return text
+}
+
+// Old files encode passes as "tt", which lies off boards up to 19x19
+func createMoveFromCoord(coord string, player string, sizeX, sizeY int) *Move {
+	if coord == "" || (coord == "tt" && sizeX <= 19 && sizeY <= 19) {
 		// Pass move
 		return &Move{x: -1, y: -1, player: player}
 	}
-	xy := convertSGFCoordToXY(coord)
+	xy := goban.ParseSGFPoint(coord)
 	if xy != nil {
 		return &Move{x: xy[0], y: xy[1], player: player}
 	}
 	return nil
 }
 
-func (g *Game) processSubtree(gameTree *SGFGameTree, parentNode *GameTreeNode) error {
-	currentParent := parentNode
-	if currentParent == nil {
-		return fmt.Errorf("current parent node is nil")
-	}
-	// Process the sequence of moves in the variation
-	err := g.processSequence(gameTree.sequence, currentParent)
-	if err != nil {
-		return err
+// Builds the game tree below the root node from a parsed game tree, whose first node is the root's.
+// Variations wait on an explicit stack rather than the call stack, so deeply nested files are read without
+// recursion, and trees nested deeper than goban.MaxVariationDepth are refused. Returns the last node of the main line.
+func (g *Game) buildGameTree(gameTree *SGFGameTree) (*GameTreeNode, error) {
+	type variation struct {
+		tree   *SGFGameTree
+		parent *GameTreeNode
+		depth  int
 	}
-
-	// Recursively process any sub-variations
-	for _, subtree := range gameTree.subtrees {
-		err := g.processSubtree(subtree, currentParent)
-		if err != nil {
-			return err
+	var lastNode *GameTreeNode
+	stack := []variation{{&SGFGameTree{Sequence: gameTree.Sequence[1:], Subtrees: gameTree.Subtrees}, g.rootNode, 0}}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		mainLine := lastNode == nil
+		// Follow the first variation at each branch, leaving the others for later; they are added to
+		// their parents after it, so the file's order of variations is kept
+		for tree, parent, depth := current.tree, current.parent, current.depth; ; {
+			if depth > goban.MaxVariationDepth {
+				return nil, fmt.Errorf("variations are nested deeper than %d levels", goban.MaxVariationDepth)
+			}
+			last, err := g.processSequence(tree.Sequence, parent)
+			if err != nil {
+				return nil, err
+			}
+			for i := len(tree.Subtrees) - 1; i >= 1; i-- {
+				stack = append(stack, variation{tree.Subtrees[i], last, depth + 1})
+			}
+			if len(tree.Subtrees) == 0 {
+				if mainLine {
+					lastNode = last
+				}
+				break
+			}
+			tree, parent, depth = tree.Subtrees[0], last, depth+1
 		}
 	}
-	return nil
+	return lastNode, nil
 }
 
-func (g *Game) processSequence(sequence []*SGFNode, parentNode *GameTreeNode) error {
+// Adds the nodes of a sequence below parentNode, each the child of the one before, and returns the last one,
+// parentNode itself if the sequence is empty
+func (g *Game) processSequence(sequence []*SGFNode, parentNode *GameTreeNode) (*GameTreeNode, error) {
 	currentParent := parentNode
-	if parentNode == nil || sequence == nil {
-		return fmt.Errorf("invalid sequence or parent node, cannot process")
+	if parentNode == nil {
+		return nil, fmt.Errorf("invalid parent node, cannot process the sequence")
 	}
 
 	for _, nodeProperties := range sequence {
-		moveData, err := extractMoveFromNode(nodeProperties.properties)
+		moveData, err := extractMoveFromNode(nodeProperties.Properties, g.sizeX, g.sizeY)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		g.importWarnings = append(g.importWarnings, moveData.warnings...)
 
-		newBoardState := copyBoard(currentParent.boardState)
+		newBoardState := goban.CopyBoard(currentParent.boardState)
 
 		newNode := g.newGameTreeNode()
 		newNode.boardState = newBoardState
@@ -2909,7 +13282,7 @@ func (g *Game) processSequence(sequence []*SGFNode, parentNode *GameTreeNode) er
 				// Place the stone
 				newBoardState[y][x] = player
 				// Capture stones and handle ko
-				koX, koY := g.captureStones(newBoardState, x, y, player)
+				koX, koY := goban.CaptureStones(newBoardState, x, y, player, g.sizeX, g.sizeY)
 				newNode.koX = koX
 				newNode.koY = koY
 				newNode.move = [2]int{x, y}
@@ -2925,7 +13298,7 @@ func (g *Game) processSequence(sequence []*SGFNode, parentNode *GameTreeNode) er
 		// Append added black stones
 		if len(moveData.addedBlackStones) > 0 {
 			for _, coord := range moveData.addedBlackStones {
-				xy := convertSGFCoordToXY(coord)
+				xy := goban.ParseSGFPoint(coord)
 				if xy != nil {
 					newBoardState[xy[1]][xy[0]] = black
 					newNode.addBlackStone(xy[0], xy[1])
@@ -2936,7 +13309,7 @@ func (g *Game) processSequence(sequence []*SGFNode, parentNode *GameTreeNode) er
 		// Append added white stones
 		if len(moveData.addedWhiteStones) > 0 {
 			for _, coord := range moveData.addedWhiteStones {
-				xy := convertSGFCoordToXY(coord)
+				xy := goban.ParseSGFPoint(coord)
 				if xy != nil {
 					newBoardState[xy[1]][xy[0]] = white
 					newNode.addWhiteStone(xy[0], xy[1])
@@ -2947,77 +13320,70 @@ func (g *Game) processSequence(sequence []*SGFNode, parentNode *GameTreeNode) er
 		// Append added empty points
 		if len(moveData.addedEmptyPoints) > 0 {
 			for _, coord := range moveData.addedEmptyPoints {
-				xy := convertSGFCoordToXY(coord)
+				xy := goban.ParseSGFPoint(coord)
 				if xy != nil {
 					newBoardState[xy[1]][xy[0]] = empty
-					newNode.AE[xy[1]][xy[0]] = true
+					newNode.AE.set(xy[0], xy[1], true)
 				}
 			}
 		}
 
 		// Append annotation properties
 		for _, coord := range moveData.CR {
-			xy := convertSGFCoordToXY(coord)
+			xy := goban.ParseSGFPoint(coord)
 			if xy[0] >= 0 && xy[1] >= 0 && xy[0] < g.sizeX && xy[1] < g.sizeY {
-				newNode.CR[xy[1]][xy[0]] = true
+				newNode.CR.set(xy[0], xy[1], true)
 			}
 		}
 		for _, coord := range moveData.SQ {
-			xy := convertSGFCoordToXY(coord)
+			xy := goban.ParseSGFPoint(coord)
 			if xy[0] >= 0 && xy[1] >= 0 && xy[0] < g.sizeX && xy[1] < g.sizeY {
-				newNode.SQ[xy[1]][xy[0]] = true
+				newNode.SQ.set(xy[0], xy[1], true)
 			}
 		}
 		for _, coord := range moveData.TR {
-			xy := convertSGFCoordToXY(coord)
+			xy := goban.ParseSGFPoint(coord)
 			if xy[0] >= 0 && xy[1] >= 0 && xy[0] < g.sizeX && xy[1] < g.sizeY {
-				newNode.TR[xy[1]][xy[0]] = true
+				newNode.TR.set(xy[0], xy[1], true)
 			}
 		}
 		for _, coord := range moveData.MA {
-			xy := convertSGFCoordToXY(coord)
+			xy := goban.ParseSGFPoint(coord)
 			if xy[0] >= 0 && xy[1] >= 0 && xy[0] < g.sizeX && xy[1] < g.sizeY {
-				newNode.MA[xy[1]][xy[0]] = true
+				newNode.MA.set(xy[0], xy[1], true)
 			}
 		}
 		for coord, label := range moveData.LB {
-			xy := convertSGFCoordToXY(coord)
+			xy := goban.ParseSGFPoint(coord)
 			if xy[0] >= 0 && xy[1] >= 0 && xy[0] < g.sizeX && xy[1] < g.sizeY {
-				newNode.LB[xy[1]][xy[0]] = label
+				newNode.LB.set(xy[0], xy[1], label)
 			}
 		}
 
-		// Assign comment to the new node if present
-		if commentProps, hasC := nodeProperties.properties["C"]; hasC && len(commentProps) > 0 {
+		// Store the rows the node left unchanged only once, in the parent
+		newNode.boardState = shareRows(newBoardState, currentParent.boardState)
+
+		applyDimAndView(newNode, moveData, g.sizeX, g.sizeY)
+
+		// Assign comment and custom properties to the new node if present
+		if commentProps, hasC := nodeProperties.Properties["C"]; hasC && len(commentProps) > 0 {
 			newNode.Comment = commentProps[0]
 		}
+		applyCustomProperties(newNode, nodeProperties.Properties)
 
 		currentParent = newNode
 	}
-	return nil
-}
-
-func intToChar(n int) (string, error) {
-	if n >= 0 && n <= 25 {
-		// 'a' to 'z' for indices 0 to 25
-		return string(rune('a' + n)), nil
-	} else if n >= 26 && n <= 51 {
-		// 'A' to 'Z' for indices 26 to 51
-		return string(rune('A' + n - 26)), nil
-	} else {
-		return "", fmt.Errorf("coordinate out of range for SGF (max 52x52 board size)")
-	}
+	return currentParent, nil
 }
 
-// Converts board x, y indices to SGF coordinates.
-func convertCoordinatesToSGF(x, y int) string {
-	sgfX, _ := intToChar(x)
-	sgfY, _ := intToChar(y)
-	return sgfX + sgfY
+// Escapes backslashes and closing brackets in an SGF property value
+func escapeSGFText(text string) string {
+	escaped := strings.ReplaceAll(text, "\\", "\\\\")
+	return strings.ReplaceAll(escaped, "]", "\\]")
 }
 
-// Helper function to format SGF properties for a node
-func formatNodeProperties(node *GameTreeNode, isRoot bool, sizeX, sizeY int, komi int) string {
+// Helper function to format SGF properties for a node; passValue is written inside the B or W property of passes
+func formatNodeProperties(node *GameTreeNode, isRoot bool, sizeX, sizeY int, komi int, gameInfo map[string]string, passValue string) string {
 	sgf := ";"
 
 	if isRoot {
@@ -3031,6 +13397,14 @@ func formatNodeProperties(node *GameTreeNode, isRoot bool, sizeX, sizeY int, kom
 			sgf += fmt.Sprintf("SZ[%d:%d]", sizeX, sizeY)
 		}
 		sgf += fmt.Sprintf("KM[%d]", komi) // Include komi
+		if holes := blockedPoints(node.boardState); len(holes) > 0 {
+			sgf += "BLOCKED" + formatPointList(holes) // Points missing from an irregular board
+		}
+		for _, field := range gameInfoFields {
+			if value := gameInfo[field.key]; value != "" {
+				sgf += fmt.Sprintf("%s[%s]", field.key, escapeSGFText(value))
+			}
+		}
 	}
 
 	if !isRoot && node.move[0] >= 0 && node.move[0] < sizeX && node.move[1] >= 0 && node.move[1] < sizeY {
@@ -3039,175 +13413,145 @@ func formatNodeProperties(node *GameTreeNode, isRoot bool, sizeX, sizeY int, kom
 		} else if node.player == white {
 			sgf += "W"
 		}
-		coords := convertCoordinatesToSGF(node.move[0], node.move[1])
+		coords := goban.SGFPoint(node.move[0], node.move[1])
 		sgf += fmt.Sprintf("[%s]", coords)
+	} else if !isRoot && node.move == [2]int{-1, -1} && (node.player == black || node.player == white) {
+		sgf += fmt.Sprintf("%s[%s]", node.player, passValue)
 	}
 
 	if node.Comment != "" {
-		escapedComment := strings.ReplaceAll(node.Comment, "\\", "\\\\")
-		escapedComment = strings.ReplaceAll(escapedComment, "]", "\\]")
-		sgf += fmt.Sprintf("C[%s]", escapedComment)
+		sgf += fmt.Sprintf("C[%s]", escapeSGFText(node.Comment))
 	}
 
-	sgf += formatAnnotations(node)
-	sgf += formatAddedStones(node)
+	if node.audioNote != "" {
+		sgf += fmt.Sprintf("AUDIO[%s]", escapeSGFText(node.audioNote))
+	}
 
-	return sgf
-}
+	if node.variationColor != "" {
+		sgf += fmt.Sprintf("VARCOLOR[%s]", node.variationColor)
+	}
 
-// Formats annotations (CR, SQ, TR, MA) for a node
-func formatAnnotations(node *GameTreeNode) string {
-	annotations := ""
+	if !node.moveTime.IsZero() {
+		sgf += fmt.Sprintf("MOVETIME[%s]", node.moveTime.Format(moveTimeLayout))
+	}
 
-	circleText := "CR"
-	for y, arr := range node.CR {
-		for x, el := range arr {
-			if el {
-				circleText += "[" + convertCoordinatesToSGF(x, y) + "]"
-			}
+	if len(node.tags) > 0 {
+		sgf += "TAG"
+		for _, tag := range node.tags {
+			sgf += fmt.Sprintf("[%s]", escapeSGFText(tag.key+": "+tag.value))
 		}
 	}
-	if circleText != "CR" {
-		annotations += circleText
-	}
 
-	squareText := "SQ"
-	for y, arr := range node.SQ {
-		for x, el := range arr {
-			if el {
-				squareText += "[" + convertCoordinatesToSGF(x, y) + "]"
-			}
+	if node.moveNumberOverride > 0 {
+		sgf += fmt.Sprintf("MN[%d]", node.moveNumberOverride)
+	}
+	for _, annotation := range annotationProperties {
+		if value, ok := node.annotations[annotation.key]; ok {
+			sgf += fmt.Sprintf("%s[%s]", annotation.key, value)
 		}
 	}
-	if squareText != "SQ" {
-		annotations += squareText
+
+	sgf += formatAnnotations(node)
+	sgf += formatAddedStones(node)
+	if !node.hasMove() && (node.hasAddedBlackStones() || node.hasAddedWhiteStones() || len(node.AE) > 0) {
+		sgf += fmt.Sprintf("PL[%s]", goban.SwitchPlayer(node.player)) // Player to move after the setup
 	}
+	sgf += formatOtherProperties(node)
 
-	triangleText := "TR"
-	for y, arr := range node.TR {
-		for x, el := range arr {
-			if el {
-				triangleText += "[" + convertCoordinatesToSGF(x, y) + "]"
-			}
+	return sgf
+}
+
+// Formats annotations (CR, SQ, TR, MA, LB, DD, VW) for a node
+func formatAnnotations(node *GameTreeNode) string {
+	annotations := ""
+	for _, marks := range []struct {
+		key    string
+		points pointSet
+	}{{"CR", node.CR}, {"SQ", node.SQ}, {"TR", node.TR}, {"MA", node.MA}} {
+		if len(marks.points) > 0 {
+			annotations += marks.key + formatPointList(marks.points)
 		}
 	}
-	if triangleText != "TR" {
-		annotations += triangleText
-	}
 
-	xMarkText := "MA"
-	for y, arr := range node.MA {
-		for x, el := range arr {
-			if el {
-				xMarkText += "[" + convertCoordinatesToSGF(x, y) + "]"
-			}
+	if len(node.LB) > 0 {
+		labelPoints := make(pointSet, len(node.LB))
+		for point := range node.LB {
+			labelPoints[point] = true
+		}
+		annotations += "LB"
+		for _, point := range labelPoints.sorted() {
+			annotations += "[" + goban.SGFPoint(point[0], point[1]) + ":" + node.LB[point] + "]"
 		}
-	}
-	if xMarkText != "MA" {
-		annotations += xMarkText
 	}
 
-	labelsText := "LB"
-	for y, arr := range node.LB {
-		for x, el := range arr {
-			if el != "" {
-				labelsText += "[" + convertCoordinatesToSGF(x, y) + ":" + el + "]"
-			}
-		}
+	// DD and VW are written even when empty, since an empty value resets the inherited property
+	if node.hasDD {
+		annotations += "DD" + formatPointList(node.DD)
 	}
-	if labelsText != "LB" {
-		annotations += labelsText
+	if node.hasVW {
+		annotations += "VW" + formatPointList(node.VW)
 	}
 
 	return annotations
 }
 
-// Formats added black and white stones for a node
-func formatAddedStones(node *GameTreeNode) string {
-	addedStones := ""
-
-	blackStonesText := "AB"
-	for y, arr := range node.addedBlackStones {
-		for x, el := range arr {
-			if el {
-				blackStonesText += "[" + convertCoordinatesToSGF(x, y) + "]"
-			}
-		}
+// Formats the points of a set as SGF values, or "[]" if the set is empty
+func formatPointList(points pointSet) string {
+	text := ""
+	for _, point := range points.sorted() {
+		text += "[" + goban.SGFPoint(point[0], point[1]) + "]"
 	}
-	if blackStonesText != "AB" {
-		addedStones += blackStonesText
+	if text == "" {
+		return "[]"
 	}
+	return text
+}
 
-	whiteStonesText := "AW"
-	for y, arr := range node.addedWhiteStones {
-		for x, el := range arr {
-			if el {
-				whiteStonesText += "[" + convertCoordinatesToSGF(x, y) + "]"
-			}
-		}
-	}
-	if whiteStonesText != "AW" {
-		addedStones += whiteStonesText
+// Formats added black and white stones for a node
+func formatAddedStones(node *GameTreeNode) string {
+	addedStones := ""
+	if len(node.addedBlackStones) > 0 {
+		addedStones += "AB" + formatPointList(node.addedBlackStones)
 	}
-
-	// Add this code to handle AE properties
-	emptyPointsText := "AE"
-	for y, arr := range node.AE {
-		for x, el := range arr {
-			if el {
-				emptyPointsText += "[" + convertCoordinatesToSGF(x, y) + "]"
-			}
-		}
+	if len(node.addedWhiteStones) > 0 {
+		addedStones += "AW" + formatPointList(node.addedWhiteStones)
 	}
-	if emptyPointsText != "AE" {
-		addedStones += emptyPointsText
+	if len(node.AE) > 0 {
+		addedStones += "AE" + formatPointList(node.AE)
 	}
-
 	return addedStones
 }
 
-func generateSGF(node *GameTreeNode, sizeX, sizeY int, komi int) string {
-	sgf := "(" // Start of variation
-
-	// Add the properties for the current node
-	sgf += formatNodeProperties(node, node.parent == nil, sizeX, sizeY, komi)
-
-	// Recursively generate SGF for child nodes (variations)
-	if len(node.children) > 0 {
-		if len(node.children) == 1 {
-			// Continue the main line without starting a new variation
-			childSGF := generateSGF(node.children[0], sizeX, sizeY, komi)
-			childSGF = childSGF[1 : len(childSGF)-1] // Remove outer parentheses to nest within the current variation
-			sgf += childSGF
-		} else {
-			// Multiple variations; each variation is enclosed in parentheses
-			for _, child := range node.children {
-				sgf += generateSGF(child, sizeX, sizeY, komi)
-			}
-		}
-	}
+// Formats the game tree under node as SGF
+func generateSGF(node *GameTreeNode, sizeX, sizeY int, komi int, gameInfo map[string]string, passValue string) string {
+	var sb strings.Builder
+	writeSGF(&sb, node, sizeX, sizeY, komi, gameInfo, passValue)
+	return sb.String()
+}
 
-	sgf += ")" // End of variation
-	return sgf
+// Writes the game tree under node as SGF to w, node by node, the main line of each branch first
+func writeSGF(w io.Writer, node *GameTreeNode, sizeX, sizeY int, komi int, gameInfo map[string]string, passValue string) error {
+	return goban.WriteSGFTree(w, node,
+		func(n *GameTreeNode) string {
+			return formatNodeProperties(n, n.parent == nil, sizeX, sizeY, komi, gameInfo, passValue)
+		},
+		func(n *GameTreeNode) []*GameTreeNode { return n.children })
 }
 
 func (g *Game) handlePass() {
-	if g.selfPlaying {
-		return // Do nothing during self-play
+	if g.selfPlaying || g.broadcasting || g.engineThinking {
+		return // Do nothing during self-play, while following a broadcast or while the engine thinks
+	}
+	player := goban.SwitchPlayer(g.currentNode.player)
+	if g.childWithMove(-1, -1, player) == nil && !g.allowEdit(g.handlePass) {
+		return
 	}
-	player := switchPlayer(g.currentNode.player)
 	g.playMove(-1, -1, player, true)
 	if g.mouseMode == "score" {
 		g.exitScoringMode()
 	}
 	// If engine should play next
-	if g.gtpCmd != nil && g.gtpColor == switchPlayer(player) {
-		engineMove, err := g.sendGTPCommand(fmt.Sprintf("genmove %s", switchPlayer(player)))
-		if err != nil {
-			g.showError(err)
-			g.detachEngine()
-			return
-		}
-		g.handleEngineMove(engineMove)
+	if g.gtpCmd != nil && g.gtpColor == goban.SwitchPlayer(player) {
+		g.requestEngineMove(goban.SwitchPlayer(player))
 	}
 }
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image/color"
+	"strings"
+	"testing"
+
+	"ConnectedGroupsGoban/goban"
+)
+
+func TestExchangeGTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         int
+		command    string
+		transcript string // Output of the engine, recorded from its stdout
+		want       string
+		wantErr    string // Text of the expected error, empty for none
+	}{
+		{
+			name:       "GNU Go genmove",
+			id:         3,
+			command:    "genmove b",
+			transcript: "=3 D4\n\n",
+			want:       "D4",
+		},
+		{
+			name:       "KataGo list_commands",
+			id:         1,
+			command:    "list_commands",
+			transcript: "=1 protocol_version\nname\nversion\nkata-analyze\n\n",
+			want:       "protocol_version\nname\nversion\nkata-analyze",
+		},
+		{
+			name:       "Leela Zero progress lines before the reply",
+			id:         7,
+			command:    "genmove w",
+			transcript: "Thinking at most 5.0 seconds...\nNN eval=0.513892\nQ16 ->    1432 (V: 51.39%) (N: 40.25%) PV: Q16 D4\n=7 Q16\n\n",
+			want:       "Q16",
+		},
+		{
+			name:       "carriage returns",
+			id:         2,
+			command:    "komi 7",
+			transcript: "=2 \r\n\r\n",
+			want:       "",
+		},
+		{
+			name:       "reply without an id",
+			id:         5,
+			command:    "clear_board",
+			transcript: "=\n\n",
+			want:       "",
+		},
+		{
+			name:       "error reply",
+			id:         4,
+			command:    "kata-set-rules nonsense",
+			transcript: "?4 unknown rules\n\n",
+			want:       "unknown rules",
+			wantErr:    "error from engine: unknown rules",
+		},
+		{
+			name:       "late reply to a timed out command",
+			id:         9,
+			command:    "play b D4",
+			transcript: "=8 R16\n\n=9\n\n",
+			want:       "",
+		},
+		{
+			name:       "late error to another command",
+			id:         11,
+			command:    "genmove b",
+			transcript: "?10 illegal move\n\n=11 pass\n\n",
+			want:       "pass",
+		},
+		{
+			name:       "reply cut off by EOF",
+			id:         12,
+			command:    "list_commands",
+			transcript: "=12 protocol_version\nname",
+			wantErr:    "EOF",
+		},
+		{
+			name:       "engine exited before replying",
+			id:         13,
+			command:    "genmove w",
+			transcript: "KataGo v1.14.1\nLoaded model\n",
+			wantErr:    "EOF",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent strings.Builder
+			got, err := exchangeGTP(&sent, bufio.NewReader(strings.NewReader(tt.transcript)), tt.id, tt.command)
+			if sent.String() != fmt.Sprintf("%d %s\n", tt.id, tt.command) {
+				t.Errorf("sent %q", sent.String())
+			}
+			gotErr := ""
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != tt.wantErr {
+				t.Fatalf("exchangeGTP() error = %q, want %q", gotErr, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("exchangeGTP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeGTPWriteError(t *testing.T) {
+	broken := errors.New("broken pipe")
+	_, err := exchangeGTP(failingWriter{broken}, bufio.NewReader(strings.NewReader("=1\n\n")), 1, "name")
+	if !errors.Is(err, broken) {
+		t.Errorf("exchangeGTP() = %v, want the write error", err)
+	}
+}
+
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestVisibleTreeChildren(t *testing.T) {
+	root := &GameTreeNode{id: "root"}
+	add := func(parent *GameTreeNode, id string) *GameTreeNode {
+		node := &GameTreeNode{id: id, parent: parent, annotations: map[string]string{}}
+		parent.children = append(parent.children, node)
+		return node
+	}
+	plain := add(root, "plain")
+	add(plain, "commented").Comment = "Joseki"
+	marked := add(plain, "marked")
+	marked.TR = pointSet{{3, 3}: true}
+	deeper := add(plain, "deeper")
+	add(deeper, "bookmarked").annotations["HO"] = "1"
+	add(add(deeper, "hidden"), "blunder").annotations["BM"] = "2"
+	add(deeper, "tesuji").annotations["TE"] = "1"
+	current := add(root, "current")
+
+	ids := func(nodes []*GameTreeNode) string {
+		var ids []string
+		for _, node := range nodes {
+			ids = append(ids, node.id)
+		}
+		return strings.Join(ids, " ")
+	}
+	g := &Game{gameState: gameState{rootNode: root, currentNode: current}}
+	if got, want := ids(g.visibleTreeChildren(root)), "plain current"; got != want {
+		t.Errorf("unfiltered children = %s, want %s", got, want)
+	}
+	g.filterTree = true
+	if got, want := ids(g.visibleTreeChildren(root)), "commented marked bookmarked blunder current"; got != want {
+		t.Errorf("filtered children = %s, want %s", got, want)
+	}
+}
+
+func TestOrderVariations(t *testing.T) {
+	collection, err := goban.ParseSGF("(;GM[1](;B[aa])(;B[bb];W[cc]BM[1](;B[dd])(;B[ee];W[ff]))(;B[gg];W[hh]))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := collection[0]
+	if score := orderVariations(tree, func(*SGFNode) int { return 1 }, true); score != 5 {
+		t.Errorf("longest path has %d nodes, want 5", score)
+	}
+	if first := tree.Subtrees[0].Sequence[0].Properties["B"][0]; first != "bb" {
+		t.Errorf("longest variation starts with %s, want bb", first)
+	}
+	if first := tree.Subtrees[0].Subtrees[0].Sequence[0].Properties["B"][0]; first != "ee" {
+		t.Errorf("longest sub-variation starts with %s, want ee", first)
+	}
+}
+
+func TestOrderVariationsDeepTree(t *testing.T) {
+	// Nested as deep as the parser allows; parsing and ordering keep their own stacks, so depth costs no recursion
+	depth := goban.MaxVariationDepth
+	content := strings.Repeat("(;B[aa]", depth) + "(;W[bb])(;W[cc];B[dd])" + strings.Repeat(")", depth)
+	collection, err := goban.ParseSGF(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score := orderVariations(collection[0], func(*SGFNode) int { return 1 }, true); score != depth+2 {
+		t.Errorf("longest path has %d nodes, want %d", score, depth+2)
+	}
+}
+
+func TestMisspelledSpans(t *testing.T) {
+	dictionary := map[string]bool{"a": true, "good": true, "move": true, "black's": true, "shape": true}
+	text := "A good mvoe.\n\n'Black's' shpae, 'good'\nÉtude"
+	want := []spellingSpan{{0, 7, 11}, {2, 10, 15}, {3, 0, 5}}
+	if got := misspelledSpans(text, dictionary); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("misspelledSpans = %v, want %v", got, want)
+	}
+	if got := misspelledSpans("'' ' good", dictionary); len(got) != 0 {
+		t.Errorf("quotes alone were flagged: %v", got)
+	}
+}
+
+func TestTimeoutSettings(t *testing.T) {
+	// Configurations written before the timeouts existed load 0, which must keep the default
+	if got := timeoutSeconds(0, defaultGTPTimeout); got != defaultGTPTimeout {
+		t.Errorf("timeoutSeconds(0) = %d, want the default %d", got, defaultGTPTimeout)
+	}
+	if got := timeoutSeconds(timeoutSetting(0), defaultGTPTimeout); got != 0 {
+		t.Errorf("entering 0 waits %d seconds, want 0 (forever)", got)
+	}
+	if got := timeoutSeconds(timeoutSetting(45), defaultGTPTimeout); got != 45 {
+		t.Errorf("entering 45 waits %d seconds, want 45", got)
+	}
+}
+
+func TestCheckEngineMove(t *testing.T) {
+	board := goban.MakeEmptyBoard(5, 5)
+	board[2][2] = blocked // C3
+	board[0][0] = black   // A5
+	node := &GameTreeNode{boardState: board, player: black, koX: -1, koY: -1}
+	g := &Game{gameState: gameState{sizeX: 5, sizeY: 5, currentNode: node}}
+	tests := []struct {
+		coord   string
+		x, y    int
+		wantErr string
+	}{
+		{coord: "B4", x: 1, y: 1},
+		{coord: "pass", x: -1, y: -1},
+		{coord: "C3", wantErr: "engine played C3, which is a blocked point"},
+		{coord: "A5", wantErr: "engine played the illegal move A5"},
+		{coord: "F3", wantErr: "engine played F3, which is off the board"},
+	}
+	for _, test := range tests {
+		x, y, err := g.checkEngineMove(test.coord)
+		gotErr := ""
+		if err != nil {
+			gotErr = err.Error()
+		}
+		if gotErr != test.wantErr {
+			t.Errorf("checkEngineMove(%s) error = %q, want %q", test.coord, gotErr, test.wantErr)
+		} else if err == nil && (x != test.x || y != test.y) {
+			t.Errorf("checkEngineMove(%s) = (%d, %d), want (%d, %d)", test.coord, x, y, test.x, test.y)
+		}
+	}
+}
+
+func TestDecodeRecords(t *testing.T) {
+	tests := []struct {
+		name      string
+		decode    func(string) ([]*SGFGameTree, error)
+		content   string
+		wantRoot  map[string]string // Root properties, several values joined by commas
+		wantMoves string
+		wantErr   string // Text of the expected error, empty for none
+	}{
+		{
+			name:   "GIB",
+			decode: decodeGIB,
+			content: "\\HS\n\\[GAMEBLACKNAME=Lee (9d)\\]\n\\[GAMEWHITENAME=Kim 8D\\]\n\\[GAMEDATE=2016- 3-13\\]\n" +
+				"\\[GAMEINFOMAIN=GONGJE:65,GRLT:1,ZIPSU:35\\]\n\\HE\n\\GS\nINI 0 1 2 &4\n" +
+				"STO 0 2 2 15 3\nSTO 0 3 1 2 16\nSKI 0 4\n\\GE\n",
+			wantRoot: map[string]string{
+				"SZ": "19", "PB": "Lee", "BR": "9d", "PW": "Kim", "WR": "8d", "DT": "2016-03-13",
+				"KM": "7", "RE": "W+3.5", "HA": "2", "AB": "dp,pd",
+			},
+			wantMoves: "W[pd] B[cq] W[]",
+		},
+		{
+			name:    "GIB malformed move",
+			decode:  decodeGIB,
+			content: "\\GS\nSTO 0 1 1 3 x\n\\GE\n",
+			wantErr: `invalid move "STO 0 1 1 3 x"`,
+		},
+		{
+			name:   "NGF",
+			decode: decodeNGF,
+			content: "Final\r\n9\r\nKim 3d\r\nLee (5d)\r\nwww.example.com\r\n2\r\n0\r\n0.5\r\n2016-03-13 [10:00]\r\n5\r\n" +
+				"White wins by 3.5 points!\r\n3\r\nPMABWHD\r\nPMACBDH\r\nPMADWAA\r\n",
+			wantRoot: map[string]string{
+				"SZ": "9", "GN": "Final", "PW": "Kim", "WR": "3d", "PB": "Lee", "BR": "5d", "DT": "2016-03-13",
+				"KM": "1", "RE": "W+3.5", "HA": "2", "AB": "cg,gc",
+			},
+			wantMoves: "W[gc] B[cg] W[]",
+		},
+		{
+			name:    "NGF malformed header",
+			decode:  decodeNGF,
+			content: "Final\n9\nKim 3d\n",
+			wantErr: "the header is incomplete",
+		},
+		{
+			name:   "UGF",
+			decode: decodeUGF,
+			content: "[Header]\nTitle=Final\nPlace=Tokyo\nPlayerB=Lee,5D\nPlayerW=Kim,3d\nHdcp=2,0.5\nWinner=B,C\n" +
+				"Date=2016/03/13,10:00\nSize=19\n[Data]\nDP,B1,0,0\nPD,B1,0,0\nQD,W2,1,10\nYA,B1,2,5\n",
+			wantRoot: map[string]string{
+				"SZ": "19", "GN": "Final", "PC": "Tokyo", "PB": "Lee", "BR": "5d", "PW": "Kim", "WR": "3d",
+				"DT": "2016-03-13", "KM": "1", "RE": "B+R", "HA": "2", "AB": "dd,pp",
+			},
+			wantMoves: "W[qp] B[]",
+		},
+		{
+			name:    "UGF malformed move",
+			decode:  decodeUGF,
+			content: "[Header]\nSize=19\n[Data]\nQD\n",
+			wantErr: `invalid move "QD"`,
+		},
+	}
+	for _, test := range tests {
+		trees, err := test.decode(test.content)
+		if test.wantErr != "" {
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("%s: error = %v, want %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		sequence := trees[0].Sequence
+		root := make(map[string]string)
+		for key, values := range sequence[0].Properties {
+			root[key] = strings.Join(values, ",")
+		}
+		if fmt.Sprint(root) != fmt.Sprint(test.wantRoot) {
+			t.Errorf("%s: root = %v, want %v", test.name, root, test.wantRoot)
+		}
+		var moves []string
+		for _, node := range sequence[1:] {
+			for key, values := range node.Properties {
+				moves = append(moves, fmt.Sprintf("%s[%s]", key, values[0]))
+			}
+		}
+		if got := strings.Join(moves, " "); got != test.wantMoves {
+			t.Errorf("%s: moves = %s, want %s", test.name, got, test.wantMoves)
+		}
+	}
+}
+
+// Creates a game on an empty size by size board holding only its root node
+func newTestGame(size int) *Game {
+	g := &Game{gameState: gameState{sizeX: size, sizeY: size, nodeMap: make(map[string]*GameTreeNode), gameInfo: make(map[string]string)}}
+	g.rootNode = g.newGameTreeNode()
+	g.currentNode = g.rootNode
+	return g
+}
+
+func TestTransformTree(t *testing.T) {
+	g := newTestGame(5)
+	root := g.rootNode
+	root.addBlackStone(0, 1)
+	root.setPoint(0, 1, black)
+	first := g.appendMoveNode(root, 1, 0, black)
+	first.TR.set(0, 0, true)
+	first.LB = pointLabels{{1, 2}: "A"}
+	first.otherProperties = map[string][]string{"AR": {"aa:bb"}}
+	second := g.appendMoveNode(first, 3, 3, white)
+	variation := g.appendMoveNode(first, 4, 0, white)
+	original := generateSGF(root, 5, 5, 0, g.gameInfo, "")
+
+	g.transformTree("rotate 90° clockwise")
+	checks := []struct {
+		what string
+		got  any
+		want any
+	}{
+		{"setup stone", root.addedBlackStones, pointSet{{3, 0}: true}},
+		{"root position", root.boardState[0][3], black},
+		{"move", first.move, [2]int{4, 1}},
+		{"position after the move", first.boardState[1][4], black},
+		{"triangle", first.TR, pointSet{{4, 0}: true}},
+		{"label", first.LB, pointLabels{{2, 1}: "A"}},
+		{"arrow", first.otherProperties["AR"], []string{"ea:db"}},
+		{"main line", second.move, [2]int{1, 3}},
+		{"variation", variation.move, [2]int{4, 4}},
+	}
+	for _, check := range checks {
+		if fmt.Sprint(check.got) != fmt.Sprint(check.want) {
+			t.Errorf("%s after rotating = %v, want %v", check.what, check.got, check.want)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		g.transformTree("rotate 90° clockwise")
+	}
+	if got := generateSGF(root, 5, 5, 0, g.gameInfo, ""); got != original {
+		t.Errorf("rotating four times gives\n%s\nwant\n%s", got, original)
+	}
+	g.transformTree("mirror left-right")
+	if first.move != [2]int{3, 0} || variation.move != [2]int{0, 0} {
+		t.Errorf("mirrored moves = %v and %v, want [3 0] and [0 0]", first.move, variation.move)
+	}
+	g.transformTree("mirror left-right")
+	if got := generateSGF(root, 5, 5, 0, g.gameInfo, ""); got != original {
+		t.Errorf("mirroring twice gives\n%s\nwant\n%s", got, original)
+	}
+}
+
+func TestSwapTreeColors(t *testing.T) {
+	g := newTestGame(5)
+	root := g.rootNode
+	root.addWhiteStone(0, 0)
+	root.setPoint(0, 0, white)
+	first := g.appendMoveNode(root, 1, 0, black)
+	first.annotations = map[string]string{"GB": "1"}
+	second := g.appendMoveNode(first, 4, 4, white)
+	second.otherProperties = map[string][]string{"BL": {"30"}}
+	capture := g.appendMoveNode(second, 0, 1, black) // Captures the setup stone at the corner
+	g.currentNode = capture
+	g.gameInfo = map[string]string{"PB": "Lee", "PW": "Kim", "WR": "3d", "RE": "B+R"}
+
+	g.swapTreeColors()
+	checks := []struct {
+		what string
+		got  any
+		want any
+	}{
+		{"setup stones", fmt.Sprint(root.addedBlackStones, root.addedWhiteStones), fmt.Sprint(pointSet{{0, 0}: true}, pointSet(nil))},
+		{"root position", root.boardState[0][0], black},
+		{"players", first.player + second.player + capture.player, white + black + white},
+		{"stones", capture.boardState[0][0] + capture.boardState[0][1] + capture.boardState[1][0] + capture.boardState[4][4], empty + white + white + black},
+		{"good move annotation", first.annotations, map[string]string{"GW": "1"}},
+		{"time left", second.otherProperties, map[string][]string{"WL": {"30"}}},
+		{"game info", g.gameInfo, map[string]string{"PB": "Kim", "PW": "Lee", "BR": "3d", "RE": "W+R"}},
+	}
+	for _, check := range checks {
+		if fmt.Sprint(check.got) != fmt.Sprint(check.want) {
+			t.Errorf("%s after swapping = %v, want %v", check.what, check.got, check.want)
+		}
+	}
+	if byBlack, byWhite := g.lineCaptures(); byBlack != 0 || byWhite != 1 {
+		t.Errorf("captures after swapping = %d by Black and %d by White, want 0 and 1", byBlack, byWhite)
+	}
+}
+
+func TestInsertMoveNode(t *testing.T) {
+	g := newTestGame(5)
+	first := g.appendMoveNode(g.rootNode, 1, 1, black)
+	second := g.appendMoveNode(first, 3, 3, white)
+	third := g.appendMoveNode(second, 2, 2, black)
+
+	node, conflicts := g.insertMoveNode(second, 0, 0, white)
+	if node.parent != first || len(first.children) != 1 || first.children[0] != node || second.parent != node {
+		t.Fatal("the move was not linked between the first and second moves")
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("conflicts = %d, want none", len(conflicts))
+	}
+	if third.boardState[0][0] != white || third.boardState[3][3] != white {
+		t.Error("the later positions do not hold the inserted stone")
+	}
+
+	// A stone on the point of a later move makes that move illegal, and the stone stays
+	_, conflicts = g.insertMoveNode(third, 2, 2, white)
+	if len(conflicts) != 1 || conflicts[0] != third || !third.conflict {
+		t.Errorf("conflicts = %v, want the third move", conflicts)
+	}
+	if third.boardState[2][2] != white {
+		t.Errorf("the third move overwrote the inserted stone: %s at its point", third.boardState[2][2])
+	}
+}
+
+func TestSwapMoves(t *testing.T) {
+	g := newTestGame(5)
+	first := g.appendMoveNode(g.rootNode, 1, 1, black)
+	second := g.appendMoveNode(first, 3, 3, white)
+	third := g.appendMoveNode(second, 2, 2, black)
+	second.Comment = "travels with its move"
+
+	if _, err := g.swapMoves(second); err != nil {
+		t.Fatal(err)
+	}
+	if g.rootNode.children[0] != second || second.children[0] != first || first.children[0] != third || third.parent != first {
+		t.Fatal("the moves were not exchanged")
+	}
+	if second.boardState[1][1] != empty || second.boardState[3][3] != white || second.Comment != "travels with its move" {
+		t.Error("the position or comment of the exchanged move is wrong")
+	}
+	if first.boardState[1][1] != black || first.boardState[3][3] != white {
+		t.Error("the position after both moves is wrong")
+	}
+
+	g.appendMoveNode(second, 4, 4, black)
+	if _, err := g.swapMoves(first); err == nil {
+		t.Error("swapped a move whose previous move has other variations")
+	}
+
+	// Black's capture at C5 makes White's A5 legal; in the other order A5 is still occupied
+	g = newTestGame(5)
+	root := g.rootNode
+	for _, stone := range []struct {
+		x, y  int
+		color string
+	}{{0, 0, white}, {1, 0, white}, {0, 1, black}, {1, 1, black}} {
+		root.setPoint(stone.x, stone.y, stone.color)
+	}
+	capture := g.appendMoveNode(root, 2, 0, black)
+	retake := g.appendMoveNode(capture, 0, 0, white)
+	if _, err := g.swapMoves(retake); err == nil {
+		t.Error("swapped moves that are illegal in the other order")
+	}
+	if root.children[0] != capture || capture.children[0] != retake || retake.boardState[0][0] != white {
+		t.Error("a refused swap changed the tree")
+	}
+}
+
+func TestLadder(t *testing.T) {
+	// White's stone at C7 is in atari and runs diagonally towards the lower right corner
+	board := goban.MakeEmptyBoard(9, 9)
+	board[2][2] = white
+	for _, point := range [][2]int{{2, 1}, {1, 2}, {3, 2}, {1, 3}} {
+		board[point[1]][point[0]] = black
+	}
+	captured, path := ladderDefend(goban.CopyBoard(board), 2, 2, 9, 9, 0)
+	if !captured {
+		t.Errorf("the ladder escapes along %v, want it captured", path)
+	} else if last := path[len(path)-1]; len(path) != 22 || last.player != black {
+		t.Errorf("the ladder ends after %d moves with %v, want 22 moves ending with Black's capture", len(path), last)
+	}
+
+	board[6][6] = white // A ladder breaker on the diagonal
+	if captured, path := ladderDefend(goban.CopyBoard(board), 2, 2, 9, 9, 0); captured {
+		t.Errorf("the ladder is captured along %v despite the ladder breaker", path)
+	}
+}
+
+func TestLabelColor(t *testing.T) {
+	board := goban.MakeEmptyBoard(3, 3)
+	board[0][0] = black
+	board[0][1] = white
+	g := &Game{gameState: gameState{sizeX: 3, sizeY: 3, currentNode: &GameTreeNode{boardState: board, player: black}}}
+	g.sequenceAlternate = true
+	tests := []struct {
+		label string
+		x, y  int
+		want  color.Color
+	}{
+		{"1", 2, 2, whiteColor}, // White is to move
+		{"2", 2, 2, blackColor},
+		{"1", 1, 0, blackColor}, // Readable on the white stone
+		{"2", 0, 0, whiteColor}, // Readable on the black stone
+		{"A", 0, 0, redColor},
+	}
+	for _, test := range tests {
+		if got := g.labelColor(test.label, test.x, test.y); got != test.want {
+			t.Errorf("labelColor(%q, %d, %d) = %v, want %v", test.label, test.x, test.y, got, test.want)
+		}
+	}
+}